@@ -11,12 +11,22 @@ import (
 	"syscall"
 	"time"
 
+	"example.com/coupon-service/internal/admission"
+	"example.com/coupon-service/internal/api/admin"
 	"example.com/coupon-service/internal/api/dummy"
 	"example.com/coupon-service/internal/api/middleware"
+	"example.com/coupon-service/internal/api/waitingroom"
+	"example.com/coupon-service/internal/auth"
 	"example.com/coupon-service/internal/config"
+	"example.com/coupon-service/internal/domainevent"
+	"example.com/coupon-service/internal/idempotency"
 	"example.com/coupon-service/internal/instrument/logging"
 	"example.com/coupon-service/internal/instrument/metrics"
 	"example.com/coupon-service/internal/instrument/tracing"
+	"example.com/coupon-service/internal/outbox"
+	"example.com/coupon-service/internal/ratelimit"
+	"example.com/coupon-service/internal/reconciler"
+	"example.com/coupon-service/internal/sweeper"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
 
@@ -24,6 +34,7 @@ import (
 	v2 "example.com/coupon-service/internal/api/v2"
 	v3 "example.com/coupon-service/internal/api/v3"
 	v4 "example.com/coupon-service/internal/api/v4"
+	v5 "example.com/coupon-service/internal/api/v5"
 )
 
 func main() {
@@ -64,17 +75,45 @@ func main() {
 	tracing.NewTracer(cfg.Server.Name)
 	defer shutdownTrace(ctx)
 
+	// A nil verifier disables auth, X-USER-ID is then trusted as before (local runs and k6)
+	// and the admin routes and dummy endpoints answer 403
+	var verifier *auth.Verifier
+	if cfg.Auth.Enabled {
+		verifier, err = auth.NewVerifier(ctx, cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to initialize auth: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		log.Warn("auth disabled, trusting the X-USER-ID header and closing the admin routes")
+	}
+
 	e := echo.New()
 	e.Use(middleware.TraceIDMiddleware())
 
 	dummyHandler := dummy.NewHandler(e, pg, rdb)
-	dummyHandler.RegisterDummyAPI()
+	dummyHandler.RegisterDummyAPI(middleware.AuthMiddleware(verifier), middleware.RequireAdminScope(verifier))
+
+	idempotencyStore := idempotency.NewStore(cfg, pg, rdb)
+
+	admissionQueue := admission.NewQueue(cfg, pg, rdb)
+
+	eventPublisher := domainevent.NewPublisher(cfg.Kafka.Brokers)
+	defer eventPublisher.Close()
 
 	api := e.Group("/api")
-	v1.RegisterAPIV1(api, pg)
-	v2.RegisterAPIV2(api, pg)
-	v3.RegisterAPIV3(api, pg, rdb)
-	v4.RegisterAPIV4(api, cfg, pg, rdb)
+	api.Use(middleware.AuthMiddleware(verifier))
+	if cfg.RateLimit.Enabled {
+		api.Use(middleware.RateLimitMiddleware(ratelimit.NewLimiter(cfg, rdb)))
+	}
+	v1.RegisterAPIV1(api, pg, idempotencyStore)
+	v2.RegisterAPIV2(api, pg, idempotencyStore)
+	v3.RegisterAPIV3(api, pg, rdb, idempotencyStore)
+	v4.RegisterAPIV4(api, cfg, pg, rdb, idempotencyStore, admissionQueue, eventPublisher)
+	v5.RegisterAPIV5(api, cfg, pg, rdb, idempotencyStore, admissionQueue)
+	waitingroom.RegisterAPIWaitingRoom(api, admissionQueue)
+	quotaReconciler := reconciler.NewQuotaReconciler(cfg, pg, rdb)
+	admin.RegisterAPIAdmin(api, pg, rdb, quotaReconciler, verifier, eventPublisher)
 
 	serverAddr := fmt.Sprintf(":%v", cfg.Server.Port)
 	go func() {
@@ -84,7 +123,7 @@ func main() {
 		}
 	}()
 
-	kafkaConsumer := v4.NewKafkaConsumer(cfg, pg, rdb)
+	kafkaConsumer := v4.NewKafkaConsumer(cfg, pg, rdb, eventPublisher)
 	go func() {
 		log.Info("starting kafka consumer...")
 		if err := kafkaConsumer.Start(ctx); err != nil {
@@ -92,6 +131,76 @@ func main() {
 		}
 	}()
 
+	sweeperCtx, stopSweeper := context.WithCancel(ctx)
+	defer stopSweeper()
+	if cfg.Sweeper.Enabled {
+		expirySweeper := sweeper.NewCouponExpirySweeper(cfg, pg, eventPublisher)
+		go func() {
+			log.Info("starting coupon expiry sweeper...")
+			if err := expirySweeper.Start(sweeperCtx); err != nil {
+				log.Error("coupon expiry sweeper stopped with error", zap.Error(err))
+			}
+		}()
+
+		reservationSweeper := sweeper.NewCouponReservationSweeper(cfg, pg)
+		go func() {
+			log.Info("starting coupon reservation sweeper...")
+			if err := reservationSweeper.Start(sweeperCtx); err != nil {
+				log.Error("coupon reservation sweeper stopped with error", zap.Error(err))
+			}
+		}()
+
+		poolReclaimer := sweeper.NewCouponPoolReclaimer(cfg, pg, rdb)
+		go func() {
+			log.Info("starting coupon pool reclaimer...")
+			if err := poolReclaimer.Start(sweeperCtx); err != nil {
+				log.Error("coupon pool reclaimer stopped with error", zap.Error(err))
+			}
+		}()
+	}
+	if cfg.Idempotency.PurgeEnabled {
+		idempotencyKeySweeper := sweeper.NewIdempotencyKeySweeper(cfg, pg)
+		go func() {
+			log.Info("starting idempotency key sweeper...")
+			if err := idempotencyKeySweeper.Start(sweeperCtx); err != nil {
+				log.Error("idempotency key sweeper stopped with error", zap.Error(err))
+			}
+		}()
+	}
+
+	relayCtx, stopRelay := context.WithCancel(ctx)
+	defer stopRelay()
+	// Always on, v4 IssueCoupon only writes the issue request to the outbox and the relay is what publishes it
+	outboxRelay := outbox.NewRelay(cfg, pg)
+	go func() {
+		log.Info("starting outbox relay...")
+		if err := outboxRelay.Start(relayCtx); err != nil {
+			log.Error("outbox relay stopped with error", zap.Error(err))
+		}
+	}()
+
+	reconcilerCtx, stopReconciler := context.WithCancel(ctx)
+	defer stopReconciler()
+	if cfg.Reconciler.Enabled {
+		go func() {
+			log.Info("starting coupon quota reconciler...")
+			if err := quotaReconciler.Start(reconcilerCtx); err != nil {
+				log.Error("coupon quota reconciler stopped with error", zap.Error(err))
+			}
+		}()
+	}
+
+	admitterCtx, stopAdmitter := context.WithCancel(ctx)
+	defer stopAdmitter()
+	if cfg.WaitingRoom.Enabled {
+		go func() {
+			log.Info("starting waiting room admitter...")
+			if err := admissionQueue.Start(admitterCtx); err != nil {
+				log.Error("waiting room admitter stopped with error", zap.Error(err))
+			}
+		}()
+	}
+
 	metricAddr := fmt.Sprintf(":%v", cfg.Metric.Port)
 	go func() {
 		log.Info("starting metric server", zap.String("addr", metricAddr))
@@ -106,8 +215,21 @@ func main() {
 	sig := <-quit
 	log.Info("received shutdown signal", zap.String("signal", sig.String()))
 
-	log.Info("closing kafka consumer...")
-	kafkaConsumer.Close()
+	stopSweeper()
+	stopRelay()
+	stopReconciler()
+	stopAdmitter()
+
+	log.Info("draining kafka consumer...")
+	drainTimeout := cfg.Kafka.Consumer.DrainTimeout
+	if drainTimeout <= 0 {
+		drainTimeout = 15 * time.Second
+	}
+	ctxDrain, cancelDrain := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancelDrain()
+	if err := kafkaConsumer.Shutdown(ctxDrain); err != nil {
+		log.Warn("kafka consumer drain deadline exceeded, uncommitted messages will be redelivered", zap.Error(err))
+	}
 	log.Info("kafka consumer closed")
 
 	ctxShutDown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"example.com/coupon-service/internal/config"
+	"example.com/coupon-service/internal/couponpool"
+	"example.com/coupon-service/internal/instrument/logging"
+	"go.uber.org/zap"
+)
+
+func main() {
+	cfgPath := flag.String("config", "config.yml", "Config filepath")
+	policyCode := flag.String("policy", "", "Code of the POOL coupon policy")
+	quantity := flag.Int("quantity", 0, "Number of coupons to pre-generate, 0 fills the remaining policy quantity")
+	batchSize := flag.Int("batch", 10000, "Coupons inserted and pushed per batch")
+	load := flag.Bool("load", false, "Reload a missing Redis pool from the unassigned coupons instead of generating")
+	flag.Parse()
+
+	if *policyCode == "" {
+		fmt.Fprintln(os.Stderr, "-policy is required")
+		os.Exit(2)
+	}
+
+	cfg, err := config.NewConfig(*cfgPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := logging.InitLogging(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
+	defer logging.GetLogger().Sync()
+	log := logging.GetLogger()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	pg, err := config.NewPostgres(ctx, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to postgres: %v\n", err)
+		os.Exit(1)
+	}
+	defer pg.Close()
+
+	rdb, err := config.NewRedis(ctx, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to redis: %v\n", err)
+		os.Exit(1)
+	}
+	defer rdb.Close()
+
+	generator := couponpool.NewGenerator(pg, rdb, *batchSize)
+
+	if *load {
+		log.Info("loading coupon pool", zap.String("policy_code", *policyCode))
+		loaded, err := generator.Load(ctx, *policyCode)
+		if err != nil {
+			log.Error("coupon pool load stopped with error", zap.String("policy_code", *policyCode), zap.Int("loaded", loaded), zap.Error(err))
+			os.Exit(1)
+		}
+
+		log.Info("coupon pool load completed", zap.String("policy_code", *policyCode), zap.Int("loaded", loaded))
+		return
+	}
+
+	log.Info("generating coupon pool", zap.String("policy_code", *policyCode), zap.Int("quantity", *quantity), zap.Int("batch", *batchSize))
+	generated, err := generator.Generate(ctx, *policyCode, *quantity)
+	if err != nil {
+		log.Error("coupon pool generation stopped with error", zap.String("policy_code", *policyCode), zap.Int("generated", generated), zap.Error(err))
+		os.Exit(1)
+	}
+
+	log.Info("coupon pool generation completed", zap.String("policy_code", *policyCode), zap.Int("generated", generated))
+}
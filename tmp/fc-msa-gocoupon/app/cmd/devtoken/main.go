@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"example.com/coupon-service/internal/auth"
+	"example.com/coupon-service/internal/config"
+)
+
+// Mints an HS256 token with the secret, issuer and audience of the config, for local runs with auth enabled.
+func main() {
+	cfgPath := flag.String("config", "config.yml", "Config filepath")
+	subject := flag.String("sub", "", "User ID put in the user claim")
+	admin := flag.Bool("admin", false, "Grant the admin scope")
+	ttl := flag.Duration("ttl", time.Hour, "Token lifetime")
+	flag.Parse()
+
+	if *subject == "" {
+		fmt.Fprintln(os.Stderr, "-sub is required")
+		os.Exit(2)
+	}
+
+	cfg, err := config.NewConfig(*cfgPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	if !strings.EqualFold(cfg.Auth.Algorithm, auth.AlgorithmHS256) || cfg.Auth.Secret == "" {
+		fmt.Fprintln(os.Stderr, "devtoken only signs HS256 tokens, set auth.algorithm and auth.secret")
+		os.Exit(1)
+	}
+
+	userClaim := cfg.Auth.UserClaim
+	if userClaim == "" {
+		userClaim = auth.DefaultUserClaim
+	}
+
+	now := time.Now()
+	claims := map[string]any{
+		userClaim: *subject,
+		"iat":     now.Unix(),
+		"exp":     now.Add(*ttl).Unix(),
+	}
+	if cfg.Auth.Issuer != "" {
+		claims["iss"] = cfg.Auth.Issuer
+	}
+	if cfg.Auth.Audience != "" {
+		claims["aud"] = cfg.Auth.Audience
+	}
+	if *admin {
+		adminScope := cfg.Auth.AdminScope
+		if adminScope == "" {
+			adminScope = auth.DefaultAdminScope
+		}
+		claims["scope"] = adminScope
+	}
+
+	token, err := auth.SignHS256([]byte(cfg.Auth.Secret), claims)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to sign token: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(token)
+}
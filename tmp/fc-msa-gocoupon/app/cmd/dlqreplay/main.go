@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"example.com/coupon-service/internal/config"
+	"example.com/coupon-service/internal/instrument/logging"
+	"go.uber.org/zap"
+
+	v4 "example.com/coupon-service/internal/api/v4"
+)
+
+func main() {
+	cfgPath := flag.String("config", "config.yml", "Config filepath")
+	limit := flag.Int("limit", 0, "Maximum number of messages to replay, 0 replays all")
+	idle := flag.Duration("idle", 5*time.Second, "Stop after the DLQ has been idle this long")
+	dryRun := flag.Bool("dry-run", false, "Log dead-lettered messages without replaying or committing them")
+	flag.Parse()
+
+	cfg, err := config.NewConfig(*cfgPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := logging.InitLogging(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
+	defer logging.GetLogger().Sync()
+	log := logging.GetLogger()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	replayer := v4.NewDLQReplayer(cfg)
+	defer replayer.Close()
+
+	log.Info("replaying dlq messages", zap.String("topic", v4.TopicCouponIssueDLQ), zap.Int("limit", *limit), zap.Bool("dry_run", *dryRun))
+	replayed, err := replayer.Replay(ctx, *limit, *idle, *dryRun)
+	if err != nil {
+		log.Error("dlq replay stopped with error", zap.Int("replayed", replayed), zap.Error(err))
+		os.Exit(1)
+	}
+
+	log.Info("dlq replay completed", zap.Int("replayed", replayed), zap.Bool("dry_run", *dryRun))
+}
@@ -0,0 +1,434 @@
+package admission
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"example.com/coupon-service/internal/config"
+	"example.com/coupon-service/internal/instrument/logging"
+	"example.com/coupon-service/internal/instrument/metrics"
+	"example.com/coupon-service/internal/instrument/tracing"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+type TicketStatus string
+
+const (
+	// TicketStatusWaiting means the user is queued and has not been admitted yet
+	TicketStatusWaiting TicketStatus = "WAITING"
+	// TicketStatusAdmitted means the user may call issue until AdmittedUntil
+	TicketStatusAdmitted TicketStatus = "ADMITTED"
+	// TicketStatusSoldOut means the quota ran out before the user was admitted
+	TicketStatusSoldOut TicketStatus = "SOLD_OUT"
+	// TicketStatusExpired means the admission lapsed or the queue entry is gone, the user has to enter again
+	TicketStatusExpired TicketStatus = "EXPIRED"
+)
+
+// Ticket is what a user sees of their place in a policy's waiting room.
+type Ticket struct {
+	PolicyCode    string       `json:"policy_code"`
+	Token         string       `json:"token,omitempty"`
+	Status        TicketStatus `json:"status"`
+	Position      int          `json:"position,omitempty"`
+	AdmittedUntil *time.Time   `json:"admitted_until,omitempty"`
+}
+
+var (
+	ErrNotEnabled   = errors.New("coupon policy has no waiting room")
+	ErrTokenInvalid = errors.New("invalid waiting room token")
+	ErrTokenExpired = errors.New("waiting room token expired")
+)
+
+var (
+	// CouponPolicyQuantityKeyPrefix is the Redis quota the v4 and v5 issuers decrement
+	CouponPolicyQuantityKeyPrefix = "coupon:policy:quantity:"
+
+	WaitingRoomQueueKeyPrefix    = "waitingroom:queue:"
+	WaitingRoomAdmittedKeyPrefix = "waitingroom:admitted:"
+	WaitingRoomSeqKeyPrefix      = "waitingroom:seq:"
+	WaitingRoomActiveKey         = "waitingroom:active"
+)
+
+// enabledCacheTTL bounds how long a policy's waiting_room flag is served from memory,
+// so the issue hot path does not query Postgres on every request.
+const enabledCacheTTL = 5 * time.Second
+
+// enterScript queues the user unless they are already queued or admitted.
+// Returns {1, admitted_until_ms} when admitted or {0, rank} when waiting.
+var enterScript = redis.NewScript(`
+	local admitted = redis.call('ZSCORE', KEYS[2], ARGV[1])
+	if admitted and tonumber(admitted) > tonumber(ARGV[2]) then
+		return {1, tonumber(admitted)}
+	end
+
+	local rank = redis.call('ZRANK', KEYS[1], ARGV[1])
+	if not rank then
+		local seq = redis.call('INCR', KEYS[3])
+		redis.call('ZADD', KEYS[1], seq, ARGV[1])
+		rank = redis.call('ZRANK', KEYS[1], ARGV[1])
+	end
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+	redis.call('PEXPIRE', KEYS[3], ARGV[3])
+	redis.call('SADD', KEYS[4], ARGV[4])
+	return {0, rank}
+`)
+
+// admitScript moves up to ARGV[2] users from the head of the queue to the admitted set, never more
+// than the remaining quota, and drops the policy from the active set once nobody is left in it.
+// Returns {admitted, queued}, admitted being -1 once the quota is exhausted.
+var admitScript = redis.NewScript(`
+	local now = tonumber(ARGV[1])
+	redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', now)
+
+	local n = tonumber(ARGV[2])
+	local quantity = redis.call('GET', KEYS[3])
+	if quantity then
+		quantity = tonumber(quantity)
+		if quantity <= 0 then
+			return {-1, redis.call('ZCARD', KEYS[1])}
+		end
+		n = math.min(n, quantity)
+	end
+
+	local popped = redis.call('ZPOPMIN', KEYS[1], n)
+	local until_ms = now + tonumber(ARGV[3])
+	for i = 1, #popped, 2 do
+		redis.call('ZADD', KEYS[2], until_ms, popped[i])
+	end
+	if #popped > 0 then
+		redis.call('PEXPIRE', KEYS[2], ARGV[3])
+	end
+
+	local queued = redis.call('ZCARD', KEYS[1])
+	if queued == 0 and redis.call('ZCARD', KEYS[2]) == 0 then
+		redis.call('SREM', KEYS[4], ARGV[4])
+	end
+	return {math.floor(#popped / 2), queued}
+`)
+
+// Queue is the virtual waiting room in front of issue for policies with waiting_room set.
+// Users enter a per-policy Redis sorted set in arrival order and get a signed token, and the
+// admitter moves admitRate users per second per policy to an admitted set that issue checks.
+type Queue struct {
+	pg           *config.Postgres
+	rdb          *config.Redis
+	secret       []byte
+	admitRate    int
+	interval     time.Duration
+	tokenTTL     time.Duration
+	admissionTTL time.Duration
+
+	mu      sync.Mutex
+	enabled map[string]enabledEntry
+}
+
+type enabledEntry struct {
+	enabled   bool
+	expiresAt time.Time
+}
+
+func NewQueue(cfg *config.Config, pg *config.Postgres, rdb *config.Redis) *Queue {
+	secret := []byte(cfg.WaitingRoom.Secret)
+	if len(secret) == 0 {
+		// Tokens then only verify on this instance, fine locally but not behind a load balancer
+		logging.GetLogger().Warn("waiting room secret not configured, using a random one")
+		secret = make([]byte, 32)
+		_, _ = rand.Read(secret)
+	}
+	admitRate := cfg.WaitingRoom.AdmitRate
+	if admitRate <= 0 {
+		admitRate = 100
+	}
+	interval := cfg.WaitingRoom.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	tokenTTL := cfg.WaitingRoom.TokenTTL
+	if tokenTTL <= 0 {
+		tokenTTL = time.Hour
+	}
+	admissionTTL := cfg.WaitingRoom.AdmissionTTL
+	if admissionTTL <= 0 {
+		admissionTTL = time.Minute
+	}
+
+	return &Queue{
+		pg:           pg,
+		rdb:          rdb,
+		secret:       secret,
+		admitRate:    admitRate,
+		interval:     interval,
+		tokenTTL:     tokenTTL,
+		admissionTTL: admissionTTL,
+		enabled:      make(map[string]enabledEntry),
+	}
+}
+
+// Start admits users of every policy with a non-empty waiting room every interval until ctx is canceled.
+func (q *Queue) Start(ctx context.Context) error {
+	log := logging.GetLogger()
+
+	ticker := time.NewTicker(q.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("waiting room admitter stopped")
+			return nil
+		case <-ticker.C:
+			if err := q.AdmitAll(ctx); err != nil && ctx.Err() == nil {
+				log.Error("failed to admit waiting room users", zap.Error(err))
+			}
+		}
+	}
+}
+
+// AdmitAll runs one admission round for every active waiting room.
+func (q *Queue) AdmitAll(ctx context.Context) error {
+	log := logging.GetLoggerFromContext(ctx)
+
+	codes, err := q.rdb.Client.SMembers(ctx, WaitingRoomActiveKey).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, code := range codes {
+		if _, err := q.Admit(ctx, code); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Error("failed to admit waiting room users", zap.String("policy_code", code), zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+// Admit moves the next batch of users of a policy to the admitted set and returns how many were admitted.
+func (q *Queue) Admit(ctx context.Context, policyCode string) (int, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admission.Queue.Admit")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	batch := int(math.Ceil(float64(q.admitRate) * q.interval.Seconds()))
+	result, err := admitScript.Run(ctx, q.rdb.Client, []string{
+		WaitingRoomQueueKeyPrefix + policyCode,
+		WaitingRoomAdmittedKeyPrefix + policyCode,
+		CouponPolicyQuantityKeyPrefix + policyCode,
+		WaitingRoomActiveKey,
+	}, time.Now().UnixMilli(), batch, q.admissionTTL.Milliseconds(), policyCode).Int64Slice()
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+
+	admitted, queued := int(result[0]), int(result[1])
+	metrics.WaitingRoomQueueLength.WithLabelValues(policyCode).Set(float64(queued))
+	if admitted < 0 {
+		log.Debug("waiting room sold out", zap.String("policy_code", policyCode), zap.Int("queued", queued))
+		return 0, nil
+	}
+	if admitted > 0 {
+		metrics.WaitingRoomAdmittedTotal.WithLabelValues(policyCode).Add(float64(admitted))
+		log.Info("admitted waiting room users", zap.String("policy_code", policyCode), zap.Int("admitted", admitted), zap.Int("queued", queued))
+	}
+
+	return admitted, nil
+}
+
+// Enter queues the user for a policy and returns their ticket with a signed token.
+// Entering again returns the same place in the queue.
+func (q *Queue) Enter(ctx context.Context, policyCode string, userID string) (*Ticket, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admission.Queue.Enter")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	// Check Waiting Room Enabled
+	enabled, err := q.IsEnabled(ctx, policyCode)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrNotEnabled
+	}
+
+	now := time.Now()
+	token, err := signToken(q.secret, claims{
+		PolicyCode: policyCode,
+		UserID:     userID,
+		IssuedAt:   now.UnixMilli(),
+		ExpiresAt:  now.Add(q.tokenTTL).UnixMilli(),
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	// Check Sold Out, nobody is queued once the quota is gone
+	soldOut, err := q.isSoldOut(ctx, policyCode)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	if soldOut {
+		return &Ticket{PolicyCode: policyCode, Token: token, Status: TicketStatusSoldOut}, nil
+	}
+
+	// Join Queue
+	result, err := enterScript.Run(ctx, q.rdb.Client, []string{
+		WaitingRoomQueueKeyPrefix + policyCode,
+		WaitingRoomAdmittedKeyPrefix + policyCode,
+		WaitingRoomSeqKeyPrefix + policyCode,
+		WaitingRoomActiveKey,
+	}, userID, now.UnixMilli(), q.tokenTTL.Milliseconds(), policyCode).Int64Slice()
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to enter waiting room", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	ticket := &Ticket{PolicyCode: policyCode, Token: token}
+	if result[0] == 1 {
+		admittedUntil := time.UnixMilli(result[1])
+		ticket.Status = TicketStatusAdmitted
+		ticket.AdmittedUntil = &admittedUntil
+	} else {
+		ticket.Status = TicketStatusWaiting
+		ticket.Position = int(result[1]) + 1
+	}
+
+	log.Info("entered waiting room", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.String("status", string(ticket.Status)), zap.Int("position", ticket.Position))
+	return ticket, nil
+}
+
+// Status returns the current ticket for a token, which must belong to userID.
+func (q *Queue) Status(ctx context.Context, token string, userID string) (*Ticket, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admission.Queue.Status")
+	defer span.End()
+
+	c, err := verifyToken(q.secret, token, time.Now())
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	if c.UserID != userID {
+		span.RecordError(ErrTokenInvalid)
+		return nil, ErrTokenInvalid
+	}
+
+	return q.ticket(ctx, c.PolicyCode, userID)
+}
+
+// Check returns the ticket of a token presented to issue for policyCode. Callers let the
+// request through only if the ticket is ADMITTED.
+func (q *Queue) Check(ctx context.Context, token string, policyCode string, userID string) (*Ticket, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admission.Queue.Check")
+	defer span.End()
+
+	c, err := verifyToken(q.secret, token, time.Now())
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	if c.UserID != userID || c.PolicyCode != policyCode {
+		span.RecordError(ErrTokenInvalid)
+		return nil, ErrTokenInvalid
+	}
+
+	return q.ticket(ctx, policyCode, userID)
+}
+
+func (q *Queue) ticket(ctx context.Context, policyCode string, userID string) (*Ticket, error) {
+	var (
+		admitted *redis.FloatCmd
+		rank     *redis.IntCmd
+		quantity *redis.StringCmd
+	)
+	_, err := q.rdb.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		admitted = pipe.ZScore(ctx, WaitingRoomAdmittedKeyPrefix+policyCode, userID)
+		rank = pipe.ZRank(ctx, WaitingRoomQueueKeyPrefix+policyCode, userID)
+		quantity = pipe.Get(ctx, CouponPolicyQuantityKeyPrefix+policyCode)
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	ticket := &Ticket{PolicyCode: policyCode}
+
+	if until, err := admitted.Result(); err == nil && int64(until) > time.Now().UnixMilli() {
+		admittedUntil := time.UnixMilli(int64(until))
+		ticket.Status = TicketStatusAdmitted
+		ticket.AdmittedUntil = &admittedUntil
+		return ticket, nil
+	}
+
+	if remaining, err := quantity.Int(); err == nil && remaining <= 0 {
+		ticket.Status = TicketStatusSoldOut
+		return ticket, nil
+	}
+
+	if r, err := rank.Result(); err == nil {
+		ticket.Status = TicketStatusWaiting
+		ticket.Position = int(r) + 1
+		return ticket, nil
+	}
+
+	ticket.Status = TicketStatusExpired
+	return ticket, nil
+}
+
+// IsEnabled reports whether the policy has a waiting room. Unknown policies report false
+// so the issuer answers with its usual not found error, and only existing policies are cached.
+func (q *Queue) IsEnabled(ctx context.Context, policyCode string) (bool, error) {
+	now := time.Now()
+
+	q.mu.Lock()
+	entry, ok := q.enabled[policyCode]
+	q.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.enabled, nil
+	}
+
+	var enabled bool
+	err := q.pg.Pool.QueryRow(ctx, `
+		SELECT waiting_room
+		FROM coupon_policies
+		WHERE code = $1
+	`, policyCode).Scan(&enabled)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Not cached, the code comes from the client and caching every one would grow without bound
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	q.mu.Lock()
+	q.enabled[policyCode] = enabledEntry{enabled: enabled, expiresAt: now.Add(enabledCacheTTL)}
+	q.mu.Unlock()
+
+	return enabled, nil
+}
+
+func (q *Queue) isSoldOut(ctx context.Context, policyCode string) (bool, error) {
+	remaining, err := q.rdb.Client.Get(ctx, CouponPolicyQuantityKeyPrefix+policyCode).Int()
+	if errors.Is(err, redis.Nil) {
+		// Not seeded yet, the first issue call rebuilds it from Postgres
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return remaining <= 0, nil
+}
@@ -0,0 +1,436 @@
+package admin
+
+import (
+	"strconv"
+
+	"example.com/coupon-service/internal/api/middleware"
+	"example.com/coupon-service/internal/api/problem"
+	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/instrument/logging"
+	"example.com/coupon-service/internal/instrument/tracing"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+type Handler struct {
+	service IService
+}
+
+func NewHandler(service IService) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// CreateCouponPolicy godoc
+// @Summary      Create a coupon policy
+// @Description  Creates a coupon policy and seeds its Redis quota
+// @Tags         coupon-policies
+// @Accept       json
+// @Produce      json,application/problem+json
+// @Param        payload  body  coupon.CreateCouponPolicyRequest  true  "Create coupon policy payload"
+// @Success      201  {object}  coupon.CouponPolicy
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      422  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /coupon-policies [post]
+func (h *Handler) CreateCouponPolicy(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "Admin.Handler.CreateCouponPolicy")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	var payload coupon.CreateCouponPolicyRequest
+	if err := c.Bind(&payload); err != nil {
+		span.RecordError(err)
+		log.Warn("invalid body request", zap.Error(err))
+		return problem.BadRequest(c, err.Error())
+	}
+
+	result, err := h.service.CreateCouponPolicy(ctx, payload)
+	if err != nil || result == nil {
+		span.RecordError(err)
+		log.Error("failed to create coupon policy", zap.String("policy_code", payload.Code), zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	log.Info("create coupon policy successfully", zap.String("policy_code", result.Code))
+	return c.JSON(201, result)
+}
+
+// UpdateCouponPolicy godoc
+// @Summary      Update a coupon policy
+// @Description  Replaces the mutable fields of a coupon policy and re-seeds its Redis quota
+// @Tags         coupon-policies
+// @Accept       json
+// @Produce      json,application/problem+json
+// @Param        policy_code  path  string  true  "Coupon Policy Code"
+// @Param        payload      body  coupon.UpdateCouponPolicyRequest  true  "Update coupon policy payload"
+// @Success      200  {object}  coupon.CouponPolicy
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      422  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /coupon-policies/{policy_code} [put]
+func (h *Handler) UpdateCouponPolicy(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "Admin.Handler.UpdateCouponPolicy")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	policyCode := c.Param("policy_code")
+
+	var payload coupon.UpdateCouponPolicyRequest
+	if err := c.Bind(&payload); err != nil {
+		span.RecordError(err)
+		log.Warn("invalid body request", zap.Error(err))
+		return problem.BadRequest(c, err.Error())
+	}
+
+	result, err := h.service.UpdateCouponPolicy(ctx, policyCode, payload)
+	if err != nil || result == nil {
+		span.RecordError(err)
+		log.Error("failed to update coupon policy", zap.String("policy_code", policyCode), zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	log.Info("update coupon policy successfully", zap.String("policy_code", policyCode))
+	return c.JSON(200, result)
+}
+
+// PauseCouponPolicy godoc
+// @Summary      Pause a coupon policy
+// @Description  Stops an active coupon policy from issuing coupons
+// @Tags         coupon-policies
+// @Produce      json,application/problem+json
+// @Param        policy_code  path  string  true  "Coupon Policy Code"
+// @Success      200  {object}  coupon.CouponPolicy
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /coupon-policies/{policy_code}/pause [post]
+func (h *Handler) PauseCouponPolicy(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "Admin.Handler.PauseCouponPolicy")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	policyCode := c.Param("policy_code")
+	result, err := h.service.PauseCouponPolicy(ctx, policyCode)
+	if err != nil || result == nil {
+		span.RecordError(err)
+		log.Error("failed to pause coupon policy", zap.String("policy_code", policyCode), zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	log.Info("pause coupon policy successfully", zap.String("policy_code", policyCode))
+	return c.JSON(200, result)
+}
+
+// ResumeCouponPolicy godoc
+// @Summary      Resume a coupon policy
+// @Description  Re-activates a paused coupon policy
+// @Tags         coupon-policies
+// @Produce      json,application/problem+json
+// @Param        policy_code  path  string  true  "Coupon Policy Code"
+// @Success      200  {object}  coupon.CouponPolicy
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /coupon-policies/{policy_code}/resume [post]
+func (h *Handler) ResumeCouponPolicy(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "Admin.Handler.ResumeCouponPolicy")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	policyCode := c.Param("policy_code")
+	result, err := h.service.ResumeCouponPolicy(ctx, policyCode)
+	if err != nil || result == nil {
+		span.RecordError(err)
+		log.Error("failed to resume coupon policy", zap.String("policy_code", policyCode), zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	log.Info("resume coupon policy successfully", zap.String("policy_code", policyCode))
+	return c.JSON(200, result)
+}
+
+// RetireCouponPolicy godoc
+// @Summary      Retire a coupon policy
+// @Description  Permanently stops a coupon policy from issuing coupons
+// @Tags         coupon-policies
+// @Produce      json,application/problem+json
+// @Param        policy_code  path  string  true  "Coupon Policy Code"
+// @Success      200  {object}  coupon.CouponPolicy
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /coupon-policies/{policy_code}/retire [post]
+func (h *Handler) RetireCouponPolicy(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "Admin.Handler.RetireCouponPolicy")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	policyCode := c.Param("policy_code")
+	result, err := h.service.RetireCouponPolicy(ctx, policyCode)
+	if err != nil || result == nil {
+		span.RecordError(err)
+		log.Error("failed to retire coupon policy", zap.String("policy_code", policyCode), zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	log.Info("retire coupon policy successfully", zap.String("policy_code", policyCode))
+	return c.JSON(200, result)
+}
+
+// FindCouponPolicies godoc
+// @Summary      List coupon policies
+// @Description  Lists coupon policies, optionally filtered by status
+// @Tags         coupon-policies
+// @Produce      json,application/problem+json
+// @Param        status  query  string  false  "Policy status (ACTIVE, PAUSED, RETIRED)"
+// @Success      200  {array}   coupon.CouponPolicy
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /coupon-policies [get]
+func (h *Handler) FindCouponPolicies(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "Admin.Handler.FindCouponPolicies")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	status := coupon.CouponPolicyStatus(c.QueryParam("status"))
+	result, err := h.service.FindCouponPolicies(ctx, status)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to find coupon policies", zap.String("status", string(status)), zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	log.Info("find coupon policies successfully", zap.String("status", string(status)), zap.Int("count", len(result)))
+	return c.JSON(200, result)
+}
+
+// FindCouponPolicyByCode godoc
+// @Summary      Find coupon policy by code
+// @Description  Retrieves a single coupon policy
+// @Tags         coupon-policies
+// @Produce      json,application/problem+json
+// @Param        policy_code  path  string  true  "Coupon Policy Code"
+// @Success      200  {object}  coupon.CouponPolicy
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /coupon-policies/{policy_code} [get]
+func (h *Handler) FindCouponPolicyByCode(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "Admin.Handler.FindCouponPolicyByCode")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	policyCode := c.Param("policy_code")
+	result, err := h.service.FindCouponPolicyByCode(ctx, policyCode)
+	if err != nil || result == nil {
+		span.RecordError(err)
+		log.Error("failed to find coupon policy by code", zap.String("policy_code", policyCode), zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	log.Info("find coupon policy by code successfully", zap.String("policy_code", policyCode))
+	return c.JSON(200, result)
+}
+
+// FindCouponsByPolicyCode godoc
+// @Summary      List the coupons of a policy
+// @Description  Lists the coupons of a policy newest first, with keyset pagination. Pass next_cursor as cursor to get the next page, it is omitted on the last page.
+// @Tags         coupon-policies
+// @Produce      json,application/problem+json
+// @Param        policy_code  path   string  true   "Coupon Policy Code"
+// @Param        status       query  string  false  "Coupon status (UNASSIGNED, PENDING, AVAILABLE, RESERVED, USED, EXPIRED, CANCELED, REVOKED)"
+// @Param        cursor       query  string  false  "next_cursor of the previous page"
+// @Param        limit        query  int     false  "Page size, 20 by default and at most 100"
+// @Success      200  {object}  coupon.CouponPage
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /coupon-policies/{policy_code}/coupons [get]
+func (h *Handler) FindCouponsByPolicyCode(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "Admin.Handler.FindCouponsByPolicyCode")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	policyCode := c.Param("policy_code")
+	filter := coupon.CouponFilter{Status: coupon.CouponStatus(c.QueryParam("status"))}
+	if limit := c.QueryParam("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			span.RecordError(err)
+			log.Warn("invalid limit", zap.String("limit", limit))
+			return problem.BadRequest(c, "limit must be a number")
+		}
+		filter.Limit = n
+	}
+
+	result, err := h.service.FindCouponsByPolicyCode(ctx, policyCode, filter, c.QueryParam("cursor"))
+	if err != nil || result == nil {
+		span.RecordError(err)
+		log.Error("failed to find coupons by policy code", zap.String("policy_code", policyCode), zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	log.Info("find coupons by policy code successfully", zap.String("policy_code", policyCode), zap.Int("count", len(result.Items)))
+	return c.JSON(200, result)
+}
+
+// ReconcileCouponPolicyQuota godoc
+// @Summary      Reconcile a coupon policy quota
+// @Description  Compares the Redis quota of a policy with Postgres and corrects it within the configured bound
+// @Tags         coupon-policies
+// @Produce      json,application/problem+json
+// @Param        policy_code  path  string  true  "Coupon Policy Code"
+// @Success      200  {object}  coupon.QuotaReconciliation
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /coupon-policies/{policy_code}/reconcile [post]
+func (h *Handler) ReconcileCouponPolicyQuota(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "Admin.Handler.ReconcileCouponPolicyQuota")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	policyCode := c.Param("policy_code")
+	result, err := h.service.ReconcileCouponPolicyQuota(ctx, policyCode)
+	if err != nil || result == nil {
+		span.RecordError(err)
+		log.Error("failed to reconcile coupon policy quota", zap.String("policy_code", policyCode), zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	log.Info("reconcile coupon policy quota successfully", zap.String("policy_code", policyCode), zap.String("action", string(result.Action)))
+	return c.JSON(200, result)
+}
+
+// ReconcileCouponPolicyQuotas godoc
+// @Summary      Reconcile all coupon policy quotas
+// @Description  Runs the quota reconciler over every active policy
+// @Tags         coupon-policies
+// @Produce      json,application/problem+json
+// @Success      200  {array}   coupon.QuotaReconciliation
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /coupon-policies/reconcile [post]
+func (h *Handler) ReconcileCouponPolicyQuotas(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "Admin.Handler.ReconcileCouponPolicyQuotas")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	result, err := h.service.ReconcileCouponPolicyQuotas(ctx)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to reconcile coupon policy quotas", zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	log.Info("reconcile coupon policy quotas successfully", zap.Int("count", len(result)))
+	return c.JSON(200, result)
+}
+
+// RevokeCoupon godoc
+// @Summary      Revoke a coupon
+// @Description  Takes back an available or reserved coupon for fraud, the reason is kept in the coupon history
+// @Tags         coupons
+// @Accept       json
+// @Produce      json,application/problem+json
+// @Param        coupon_code  path  string  true  "Coupon Code"
+// @Param        payload      body  coupon.RevokeCouponRequest  true  "Revoke coupon payload"
+// @Success      200  {object}  coupon.Coupon
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      410  {object}  problem.Problem
+// @Failure      422  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /coupons/{coupon_code}/revoke [post]
+func (h *Handler) RevokeCoupon(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "Admin.Handler.RevokeCoupon")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	couponCode := c.Param("coupon_code")
+
+	var payload coupon.RevokeCouponRequest
+	if err := c.Bind(&payload); err != nil {
+		span.RecordError(err)
+		log.Warn("invalid body request", zap.Error(err))
+		return problem.BadRequest(c, err.Error())
+	}
+	if payload.Reason == "" {
+		log.Warn("missing revoke reason", zap.String("coupon_code", couponCode))
+		return problem.BadRequest(c, "reason is required")
+	}
+
+	// The admin's user ID, auth disabled leaves the shared admin actor
+	actor, _ := ctx.Value(middleware.UserIDKey).(string)
+	if actor == "" {
+		actor = coupon.ActorAdmin
+	}
+
+	result, err := h.service.RevokeCoupon(ctx, couponCode, actor, payload.Reason)
+	if err != nil || result == nil {
+		span.RecordError(err)
+		log.Error("failed to revoke coupon", zap.String("coupon_code", couponCode), zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	log.Info("revoke coupon successfully", zap.String("coupon_code", couponCode), zap.String("actor", actor))
+	return c.JSON(200, result)
+}
@@ -0,0 +1,782 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"example.com/coupon-service/internal/config"
+	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/instrument/logging"
+	"example.com/coupon-service/internal/instrument/tracing"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+type IRepository interface {
+	CreateCouponPolicy(ctx context.Context, policy *coupon.CouponPolicy) (*coupon.CouponPolicy, error)
+	FindCouponPolicyByCode(ctx context.Context, code string) (*coupon.CouponPolicy, error)
+	FindCouponPolicyByCodeForUpdateTx(ctx context.Context, tx pgx.Tx, code string) (*coupon.CouponPolicy, error)
+	FindCouponPolicies(ctx context.Context, status coupon.CouponPolicyStatus) ([]coupon.CouponPolicy, error)
+	UpdateCouponPolicyTx(ctx context.Context, tx pgx.Tx, policy *coupon.CouponPolicy) (*coupon.CouponPolicy, error)
+	CountIssuedCouponsTx(ctx context.Context, tx pgx.Tx, policyID string) (int, error)
+	FindCouponsByPolicyID(ctx context.Context, policyID string, filter coupon.CouponFilter) ([]coupon.Coupon, error)
+	FindCouponByCode(ctx context.Context, code string) (*coupon.Coupon, error)
+	UpdateCoupon(ctx context.Context, c *coupon.Coupon, event *coupon.CouponEvent) (*coupon.Coupon, error)
+	WithTx(ctx context.Context, fn func(pgx.Tx) error) error
+
+	SetCouponPolicyQuantity(ctx context.Context, code string, quantity int, endTime time.Time) error
+	DeleteCouponPolicyQuantity(ctx context.Context, code string) error
+	DeleteCouponPolicyMetadata(ctx context.Context, code string) error
+}
+
+var (
+	CouponPolicyQuantityKeyPrefix = "coupon:policy:quantity:"
+	CouponPolicyMetadataKeyPrefix = "coupon:policy:meta:"
+)
+
+type repository struct {
+	pg  *config.Postgres
+	rdb *config.Redis
+}
+
+func NewRepository(pg *config.Postgres, rdb *config.Redis) IRepository {
+	return &repository{
+		pg:  pg,
+		rdb: rdb,
+	}
+}
+
+func (r *repository) CreateCouponPolicy(ctx context.Context, p *coupon.CouponPolicy) (*coupon.CouponPolicy, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Repository.CreateCouponPolicy")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	row := r.pg.Pool.QueryRow(ctx, `
+		INSERT INTO coupon_policies (
+			id,
+			code,
+			name,
+			description,
+			total_quantity,
+			start_time,
+			end_time,
+			discount_type,
+			discount_value,
+			minimum_order_amount,
+			maximum_discount_amount,
+			max_per_user,
+			status,
+			include_product_ids,
+			exclude_product_ids,
+			include_categories,
+			exclude_categories,
+			valid_days,
+			issuance_mode,
+			code_prefix,
+			code_length,
+			waiting_room,
+			cancel_mode,
+			created_at,
+			updated_at
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13,
+			COALESCE($14::TEXT[], '{}'), COALESCE($15::TEXT[], '{}'),
+			COALESCE($16::TEXT[], '{}'), COALESCE($17::TEXT[], '{}'),
+			$18, $19, $20, $21, $22, $23, NOW(), NOW()
+		)
+		RETURNING
+			id,
+			code,
+			name,
+			description,
+			total_quantity,
+			start_time,
+			end_time,
+			discount_type,
+			discount_value,
+			minimum_order_amount,
+			maximum_discount_amount,
+			max_per_user,
+			status,
+			include_product_ids,
+			exclude_product_ids,
+			include_categories,
+			exclude_categories,
+			valid_days,
+			issuance_mode,
+			code_prefix,
+			code_length,
+			waiting_room,
+			cancel_mode,
+			created_at,
+			updated_at
+	`,
+		p.ID,
+		p.Code,
+		p.Name,
+		p.Description,
+		p.TotalQuantity,
+		p.StartTime.UTC(),
+		p.EndTime.UTC(),
+		p.DiscountType,
+		p.DiscountValue,
+		p.MinimumOrderAmount,
+		p.MaximumDiscountAmount,
+		p.MaxPerUser,
+		p.Status,
+		p.IncludeProductIDs,
+		p.ExcludeProductIDs,
+		p.IncludeCategories,
+		p.ExcludeCategories,
+		p.ValidDays,
+		p.IssuanceMode,
+		p.CodePrefix,
+		p.CodeLength,
+		p.WaitingRoom,
+		p.CancelMode,
+	)
+
+	policy, err := scanCouponPolicy(row)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to create coupon policy", zap.String("policy_code", p.Code), zap.Error(err))
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, coupon.ErrCouponPolicyAlreadyExists
+		}
+		return nil, coupon.ErrCouponInternal
+	}
+
+	log.Info("coupon policy created successfully", zap.String("policy_id", policy.ID), zap.String("policy_code", policy.Code))
+	return policy, nil
+}
+
+func (r *repository) FindCouponPolicyByCode(ctx context.Context, code string) (*coupon.CouponPolicy, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Repository.FindCouponPolicyByCode")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	row := r.pg.Pool.QueryRow(ctx, `
+		SELECT
+			id,
+			code,
+			name,
+			description,
+			total_quantity,
+			start_time,
+			end_time,
+			discount_type,
+			discount_value,
+			minimum_order_amount,
+			maximum_discount_amount,
+			max_per_user,
+			status,
+			include_product_ids,
+			exclude_product_ids,
+			include_categories,
+			exclude_categories,
+			valid_days,
+			issuance_mode,
+			code_prefix,
+			code_length,
+			waiting_room,
+			cancel_mode,
+			created_at,
+			updated_at
+		FROM coupon_policies
+		WHERE code = $1
+		LIMIT 1
+	`, code)
+
+	policy, err := scanCouponPolicy(row)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to fetch coupon policy by code", zap.String("policy_code", code), zap.Error(err))
+		return nil, coupon.ErrCouponPolicyNotFound
+	}
+
+	log.Info("fetched coupon policy successfully", zap.String("policy_id", policy.ID), zap.String("policy_code", code))
+	return policy, nil
+}
+
+func (r *repository) FindCouponPolicyByCodeForUpdateTx(ctx context.Context, tx pgx.Tx, code string) (*coupon.CouponPolicy, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Repository.FindCouponPolicyByCodeForUpdateTx")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	row := tx.QueryRow(ctx, `
+		SELECT
+			id,
+			code,
+			name,
+			description,
+			total_quantity,
+			start_time,
+			end_time,
+			discount_type,
+			discount_value,
+			minimum_order_amount,
+			maximum_discount_amount,
+			max_per_user,
+			status,
+			include_product_ids,
+			exclude_product_ids,
+			include_categories,
+			exclude_categories,
+			valid_days,
+			issuance_mode,
+			code_prefix,
+			code_length,
+			waiting_room,
+			cancel_mode,
+			created_at,
+			updated_at
+		FROM coupon_policies
+		WHERE code = $1
+		FOR UPDATE
+	`, code)
+
+	policy, err := scanCouponPolicy(row)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to fetch coupon policy by code", zap.String("policy_code", code), zap.Error(err))
+		return nil, coupon.ErrCouponPolicyNotFound
+	}
+
+	log.Info("fetched coupon policy successfully", zap.String("policy_id", policy.ID), zap.String("policy_code", code))
+	return policy, nil
+}
+
+func (r *repository) FindCouponPolicies(ctx context.Context, status coupon.CouponPolicyStatus) ([]coupon.CouponPolicy, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Repository.FindCouponPolicies")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	rows, err := r.pg.Pool.Query(ctx, `
+		SELECT
+			id,
+			code,
+			name,
+			description,
+			total_quantity,
+			start_time,
+			end_time,
+			discount_type,
+			discount_value,
+			minimum_order_amount,
+			maximum_discount_amount,
+			max_per_user,
+			status,
+			include_product_ids,
+			exclude_product_ids,
+			include_categories,
+			exclude_categories,
+			valid_days,
+			issuance_mode,
+			code_prefix,
+			code_length,
+			waiting_room,
+			cancel_mode,
+			created_at,
+			updated_at
+		FROM coupon_policies
+		WHERE ($1 = '' OR status::TEXT = $1)
+		ORDER BY created_at DESC
+	`, string(status))
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to fetch coupon policies", zap.String("status", string(status)), zap.Error(err))
+		return nil, coupon.ErrCouponInternal
+	}
+	defer rows.Close()
+
+	policies := make([]coupon.CouponPolicy, 0)
+	for rows.Next() {
+		policy, err := scanCouponPolicy(rows)
+		if err != nil {
+			span.RecordError(err)
+			log.Error("failed to scan coupon policy", zap.Error(err))
+			return nil, coupon.ErrCouponInternal
+		}
+		policies = append(policies, *policy)
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		log.Error("failed to iterate coupon policies", zap.Error(err))
+		return nil, coupon.ErrCouponInternal
+	}
+
+	log.Info("fetched coupon policies successfully", zap.String("status", string(status)), zap.Int("count", len(policies)))
+	return policies, nil
+}
+
+func (r *repository) UpdateCouponPolicyTx(ctx context.Context, tx pgx.Tx, p *coupon.CouponPolicy) (*coupon.CouponPolicy, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Repository.UpdateCouponPolicyTx")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	row := tx.QueryRow(ctx, `
+		UPDATE coupon_policies
+		SET
+			name = $1,
+			description = $2,
+			total_quantity = $3,
+			start_time = $4,
+			end_time = $5,
+			discount_type = $6,
+			discount_value = $7,
+			minimum_order_amount = $8,
+			maximum_discount_amount = $9,
+			max_per_user = $10,
+			status = $11,
+			include_product_ids = COALESCE($12::TEXT[], '{}'),
+			exclude_product_ids = COALESCE($13::TEXT[], '{}'),
+			include_categories = COALESCE($14::TEXT[], '{}'),
+			exclude_categories = COALESCE($15::TEXT[], '{}'),
+			valid_days = $16,
+			waiting_room = $17,
+			cancel_mode = $18,
+			updated_at = NOW()
+		WHERE id = $19
+		RETURNING
+			id,
+			code,
+			name,
+			description,
+			total_quantity,
+			start_time,
+			end_time,
+			discount_type,
+			discount_value,
+			minimum_order_amount,
+			maximum_discount_amount,
+			max_per_user,
+			status,
+			include_product_ids,
+			exclude_product_ids,
+			include_categories,
+			exclude_categories,
+			valid_days,
+			issuance_mode,
+			code_prefix,
+			code_length,
+			waiting_room,
+			cancel_mode,
+			created_at,
+			updated_at
+	`,
+		p.Name,
+		p.Description,
+		p.TotalQuantity,
+		p.StartTime.UTC(),
+		p.EndTime.UTC(),
+		p.DiscountType,
+		p.DiscountValue,
+		p.MinimumOrderAmount,
+		p.MaximumDiscountAmount,
+		p.MaxPerUser,
+		p.Status,
+		p.IncludeProductIDs,
+		p.ExcludeProductIDs,
+		p.IncludeCategories,
+		p.ExcludeCategories,
+		p.ValidDays,
+		p.WaitingRoom,
+		p.CancelMode,
+		p.ID,
+	)
+
+	policy, err := scanCouponPolicy(row)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to update coupon policy", zap.String("policy_id", p.ID), zap.Error(err))
+		return nil, coupon.ErrCouponInternal
+	}
+
+	log.Info("coupon policy updated successfully", zap.String("policy_id", policy.ID), zap.String("policy_code", policy.Code), zap.String("status", string(policy.Status)))
+	return policy, nil
+}
+
+func (r *repository) CountIssuedCouponsTx(ctx context.Context, tx pgx.Tx, policyID string) (int, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Repository.CountIssuedCouponsTx")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	row := tx.QueryRow(ctx, `
+        SELECT COUNT(*)
+        FROM coupons
+        WHERE coupon_policy_id = $1 AND status <> 'UNASSIGNED' AND NOT quota_released
+    `, policyID)
+
+	var count int
+	if err := row.Scan(&count); err != nil {
+		span.RecordError(err)
+		log.Error("failed to count issued coupons", zap.String("policy_id", policyID), zap.Error(err))
+		return 0, coupon.ErrCouponCounted
+	}
+
+	log.Info("counted issued coupons successfully", zap.String("policy_id", policyID), zap.Int("issued_count", count))
+	return count, nil
+}
+
+// FindCouponsByPolicyID returns up to filter.Limit+1 coupons of a policy after filter.Cursor, newest first,
+// the extra row telling the caller there is a next page.
+func (r *repository) FindCouponsByPolicyID(ctx context.Context, policyID string, filter coupon.CouponFilter) ([]coupon.Coupon, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Repository.FindCouponsByPolicyID")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	var (
+		cursorCreatedAt *time.Time
+		cursorID        string
+	)
+	if filter.Cursor != nil {
+		cursorCreatedAt = &filter.Cursor.CreatedAt
+		cursorID = filter.Cursor.ID
+	}
+
+	rows, err := r.pg.Pool.Query(ctx, `
+		SELECT
+			id,
+			code,
+			status,
+			used_at,
+			user_id,
+			order_id,
+			order_amount,
+			discount_amount,
+			coupon_policy_id,
+			expires_at,
+			created_at,
+			updated_at
+		FROM coupons
+		WHERE coupon_policy_id = $1
+			AND ($2 = '' OR status::TEXT = $2)
+			AND ($3::TIMESTAMPTZ IS NULL OR (created_at, id) < ($3::TIMESTAMPTZ, $4::TEXT))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $5
+	`, policyID, string(filter.Status), cursorCreatedAt, cursorID, filter.Limit+1)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to fetch coupons", zap.String("policy_id", policyID), zap.Error(err))
+		return nil, coupon.ErrCouponInternal
+	}
+	defer rows.Close()
+
+	coupons := make([]coupon.Coupon, 0, filter.Limit+1)
+	for rows.Next() {
+		var c coupon.Coupon
+		err := rows.Scan(
+			&c.ID,
+			&c.Code,
+			&c.Status,
+			&c.UsedAt,
+			&c.UserID,
+			&c.OrderID,
+			&c.OrderAmount,
+			&c.DiscountAmount,
+			&c.CouponPolicyID,
+			&c.ExpiresAt,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+		)
+		if err != nil {
+			span.RecordError(err)
+			log.Error("failed to scan coupon", zap.Error(err))
+			return nil, coupon.ErrCouponInternal
+		}
+		coupons = append(coupons, c)
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		log.Error("failed to iterate coupons", zap.Error(err))
+		return nil, coupon.ErrCouponInternal
+	}
+
+	log.Info("fetched coupons successfully", zap.String("policy_id", policyID), zap.Int("count", len(coupons)))
+	return coupons, nil
+}
+
+func (r *repository) FindCouponByCode(ctx context.Context, code string) (*coupon.Coupon, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Repository.FindCouponByCode")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	row := r.pg.Pool.QueryRow(ctx, `
+		SELECT
+			id,
+			code,
+			status,
+			used_at,
+			user_id,
+			order_id,
+			order_amount,
+			discount_amount,
+			reserved_until,
+			coupon_policy_id,
+			expires_at,
+			created_at,
+			updated_at,
+			version
+		FROM coupons
+		WHERE code = $1
+		LIMIT 1
+	`, code)
+
+	var c coupon.Coupon
+	err := row.Scan(
+		&c.ID,
+		&c.Code,
+		&c.Status,
+		&c.UsedAt,
+		&c.UserID,
+		&c.OrderID,
+		&c.OrderAmount,
+		&c.DiscountAmount,
+		&c.ReservedUntil,
+		&c.CouponPolicyID,
+		&c.ExpiresAt,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&c.Version,
+	)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to fetch coupon by code", zap.String("coupon_code", code), zap.Error(err))
+		return nil, coupon.ErrCouponNotFound
+	}
+
+	log.Info("fetched coupon successfully", zap.String("coupon_id", c.ID), zap.String("coupon_code", c.Code))
+	return &c, nil
+}
+
+// UpdateCoupon writes the coupon and its history event in one statement, only if the coupon is
+// still at the status and version it was read with. A concurrent write makes it return ErrCouponConflict.
+func (r *repository) UpdateCoupon(ctx context.Context, c *coupon.Coupon, event *coupon.CouponEvent) (*coupon.Coupon, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Repository.UpdateCoupon")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	row := r.pg.Pool.QueryRow(ctx, `
+		WITH written AS (
+			UPDATE coupons
+			SET
+				status = $1,
+				order_id = $2,
+				order_amount = $3,
+				discount_amount = $4,
+				reserved_until = $5,
+				version = version + 1,
+				updated_at = NOW()
+			WHERE id = $6 AND status = $8::coupon_status AND version = $13
+			RETURNING
+				id,
+				code,
+				status,
+				used_at,
+				user_id,
+				order_id,
+				order_amount,
+				discount_amount,
+				reserved_until,
+				coupon_policy_id,
+				expires_at,
+				created_at,
+				updated_at,
+				version
+		), event AS (
+			INSERT INTO coupon_events (
+				coupon_id,
+				type,
+				previous_status,
+				status,
+				actor,
+				order_id,
+				trace_id,
+				reason
+			)
+			SELECT id, $7::coupon_event_type, $8::coupon_status, status, $9::TEXT, $10::TEXT, $11::TEXT, $12::TEXT
+			FROM written
+		)
+		SELECT
+			id,
+			code,
+			status,
+			used_at,
+			user_id,
+			order_id,
+			order_amount,
+			discount_amount,
+			reserved_until,
+			coupon_policy_id,
+			expires_at,
+			created_at,
+			updated_at,
+			version
+		FROM written
+	`,
+		c.Status,
+		c.OrderID,
+		c.OrderAmount,
+		c.DiscountAmount,
+		c.ReservedUntil,
+		c.ID,
+		event.Type,
+		event.PreviousStatus,
+		event.Actor,
+		event.OrderID,
+		event.TraceID,
+		event.Reason,
+		c.Version,
+	)
+
+	var result coupon.Coupon
+	err := row.Scan(
+		&result.ID,
+		&result.Code,
+		&result.Status,
+		&result.UsedAt,
+		&result.UserID,
+		&result.OrderID,
+		&result.OrderAmount,
+		&result.DiscountAmount,
+		&result.ReservedUntil,
+		&result.CouponPolicyID,
+		&result.ExpiresAt,
+		&result.CreatedAt,
+		&result.UpdatedAt,
+		&result.Version,
+	)
+	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Warn("coupon changed since it was read", zap.String("coupon_id", c.ID), zap.Int("version", c.Version))
+			return nil, coupon.ErrCouponConflict
+		}
+		log.Error("failed to update coupon", zap.String("coupon_id", c.ID), zap.Error(err))
+		return nil, coupon.ErrCouponInternal
+	}
+
+	log.Info("coupon updated successfully", zap.String("coupon_id", result.ID), zap.String("coupon_code", result.Code), zap.String("status", string(result.Status)))
+	return &result, nil
+}
+
+func (r *repository) WithTx(ctx context.Context, fn func(pgx.Tx) error) error {
+	tx, err := r.pg.Pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *repository) SetCouponPolicyQuantity(ctx context.Context, policyCode string, quantity int, endTime time.Time) error {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Repository.SetCouponPolicyQuantity")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	key := CouponPolicyQuantityKeyPrefix + policyCode
+	ttl := time.Until(endTime)
+	if ttl <= 0 {
+		ttl = time.Millisecond
+	}
+
+	if err := r.rdb.Client.Set(ctx, key, quantity, ttl).Err(); err != nil {
+		span.RecordError(err)
+		log.Error("failed to set coupon policy quantity", zap.String("policy_code", policyCode), zap.Error(err))
+		return err
+	}
+
+	log.Info("coupon policy quantity set", zap.String("policy_code", policyCode), zap.Int("quantity", quantity), zap.Duration("ttl", ttl))
+	return nil
+}
+
+func (r *repository) DeleteCouponPolicyQuantity(ctx context.Context, policyCode string) error {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Repository.DeleteCouponPolicyQuantity")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	key := CouponPolicyQuantityKeyPrefix + policyCode
+	if err := r.rdb.Client.Del(ctx, key).Err(); err != nil {
+		span.RecordError(err)
+		log.Error("failed to delete coupon policy quantity", zap.String("policy_code", policyCode), zap.Error(err))
+		return err
+	}
+
+	log.Info("coupon policy quantity invalidated", zap.String("policy_code", policyCode))
+	return nil
+}
+
+// DeleteCouponPolicyMetadata drops the policy metadata cached by the v5 issuer, which reloads it on the next request.
+func (r *repository) DeleteCouponPolicyMetadata(ctx context.Context, policyCode string) error {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Repository.DeleteCouponPolicyMetadata")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	key := CouponPolicyMetadataKeyPrefix + policyCode
+	if err := r.rdb.Client.Del(ctx, key).Err(); err != nil {
+		span.RecordError(err)
+		log.Error("failed to delete coupon policy metadata", zap.String("policy_code", policyCode), zap.Error(err))
+		return err
+	}
+
+	log.Info("coupon policy metadata invalidated", zap.String("policy_code", policyCode))
+	return nil
+}
+
+func scanCouponPolicy(row pgx.Row) (*coupon.CouponPolicy, error) {
+	var policy coupon.CouponPolicy
+
+	err := row.Scan(
+		&policy.ID,
+		&policy.Code,
+		&policy.Name,
+		&policy.Description,
+		&policy.TotalQuantity,
+		&policy.StartTime,
+		&policy.EndTime,
+		&policy.DiscountType,
+		&policy.DiscountValue,
+		&policy.MinimumOrderAmount,
+		&policy.MaximumDiscountAmount,
+		&policy.MaxPerUser,
+		&policy.Status,
+		&policy.IncludeProductIDs,
+		&policy.ExcludeProductIDs,
+		&policy.IncludeCategories,
+		&policy.ExcludeCategories,
+		&policy.ValidDays,
+		&policy.IssuanceMode,
+		&policy.CodePrefix,
+		&policy.CodeLength,
+		&policy.WaitingRoom,
+		&policy.CancelMode,
+		&policy.CreatedAt,
+		&policy.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
@@ -0,0 +1,39 @@
+package admin
+
+import (
+	"example.com/coupon-service/internal/api/middleware"
+	"example.com/coupon-service/internal/auth"
+	"example.com/coupon-service/internal/config"
+	"example.com/coupon-service/internal/domainevent"
+	"example.com/coupon-service/internal/reconciler"
+	"github.com/labstack/echo/v4"
+)
+
+// @title Coupon Admin API
+// @version 1.0
+// @description Coupon policy management API
+// @BasePath /api/admin
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+func RegisterAPIAdmin(group *echo.Group, pg *config.Postgres, rdb *config.Redis, quotaReconciler *reconciler.QuotaReconciler, verifier *auth.Verifier, events domainevent.IPublisher) {
+	repository := NewRepository(pg, rdb)
+	service := NewService(repository, quotaReconciler, events)
+	handler := NewHandler(service)
+
+	policies := group.Group("/admin/coupon-policies", middleware.RequireAdminScope(verifier))
+	policies.POST("", handler.CreateCouponPolicy)
+	policies.GET("", handler.FindCouponPolicies)
+	policies.POST("/reconcile", handler.ReconcileCouponPolicyQuotas)
+	policies.GET("/:policy_code", handler.FindCouponPolicyByCode)
+	policies.PUT("/:policy_code", handler.UpdateCouponPolicy)
+	policies.POST("/:policy_code/pause", handler.PauseCouponPolicy)
+	policies.POST("/:policy_code/resume", handler.ResumeCouponPolicy)
+	policies.POST("/:policy_code/retire", handler.RetireCouponPolicy)
+	policies.GET("/:policy_code/coupons", handler.FindCouponsByPolicyCode)
+	policies.POST("/:policy_code/reconcile", handler.ReconcileCouponPolicyQuota)
+
+	coupons := group.Group("/admin/coupons", middleware.RequireAdminScope(verifier))
+	coupons.POST("/:coupon_code/revoke", handler.RevokeCoupon)
+}
@@ -0,0 +1,476 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/couponcode"
+	"example.com/coupon-service/internal/domainevent"
+	"example.com/coupon-service/internal/instrument/logging"
+	"example.com/coupon-service/internal/instrument/tracing"
+	"example.com/coupon-service/internal/reconciler"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+type IService interface {
+	CreateCouponPolicy(ctx context.Context, req coupon.CreateCouponPolicyRequest) (*coupon.CouponPolicy, error)
+	UpdateCouponPolicy(ctx context.Context, policyCode string, req coupon.UpdateCouponPolicyRequest) (*coupon.CouponPolicy, error)
+	PauseCouponPolicy(ctx context.Context, policyCode string) (*coupon.CouponPolicy, error)
+	ResumeCouponPolicy(ctx context.Context, policyCode string) (*coupon.CouponPolicy, error)
+	RetireCouponPolicy(ctx context.Context, policyCode string) (*coupon.CouponPolicy, error)
+	FindCouponPolicies(ctx context.Context, status coupon.CouponPolicyStatus) ([]coupon.CouponPolicy, error)
+	FindCouponPolicyByCode(ctx context.Context, policyCode string) (*coupon.CouponPolicy, error)
+	FindCouponsByPolicyCode(ctx context.Context, policyCode string, filter coupon.CouponFilter, cursor string) (*coupon.CouponPage, error)
+	ReconcileCouponPolicyQuota(ctx context.Context, policyCode string) (*coupon.QuotaReconciliation, error)
+	ReconcileCouponPolicyQuotas(ctx context.Context) ([]coupon.QuotaReconciliation, error)
+	RevokeCoupon(ctx context.Context, couponCode string, actor string, reason string) (*coupon.Coupon, error)
+}
+
+type service struct {
+	repo            IRepository
+	quotaReconciler *reconciler.QuotaReconciler
+	events          domainevent.IPublisher
+}
+
+func NewService(repo IRepository, quotaReconciler *reconciler.QuotaReconciler, events domainevent.IPublisher) IService {
+	return &service{
+		repo:            repo,
+		quotaReconciler: quotaReconciler,
+		events:          events,
+	}
+}
+
+// CreateCouponPolicy validates and stores a new policy, then seeds its Redis quota
+// with the full quantity so the Redis-backed issuers never start from a cache miss.
+func (s *service) CreateCouponPolicy(ctx context.Context, req coupon.CreateCouponPolicyRequest) (*coupon.CouponPolicy, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Service.CreateCouponPolicy")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	policy := &coupon.CouponPolicy{
+		ID:                    uuid.New().String(),
+		Code:                  req.Code,
+		Name:                  req.Name,
+		Description:           req.Description,
+		TotalQuantity:         req.TotalQuantity,
+		StartTime:             req.StartTime,
+		EndTime:               req.EndTime,
+		DiscountType:          req.DiscountType,
+		DiscountValue:         req.DiscountValue,
+		MinimumOrderAmount:    req.MinimumOrderAmount,
+		MaximumDiscountAmount: req.MaximumDiscountAmount,
+		MaxPerUser:            req.MaxPerUser,
+		Status:                coupon.CouponPolicyStatusActive,
+		IncludeProductIDs:     req.IncludeProductIDs,
+		ExcludeProductIDs:     req.ExcludeProductIDs,
+		IncludeCategories:     req.IncludeCategories,
+		ExcludeCategories:     req.ExcludeCategories,
+		ValidDays:             req.ValidDays,
+		IssuanceMode:          req.IssuanceMode,
+		CodePrefix:            strings.ToUpper(req.CodePrefix),
+		CodeLength:            req.CodeLength,
+		WaitingRoom:           req.WaitingRoom,
+		CancelMode:            req.CancelMode,
+	}
+	if policy.MaxPerUser == 0 {
+		policy.MaxPerUser = 1
+	}
+	if policy.IssuanceMode == "" {
+		policy.IssuanceMode = coupon.CouponPolicyIssuanceModeOnDemand
+	}
+	if policy.CodeLength == 0 {
+		policy.CodeLength = couponcode.DefaultLength
+	}
+	if policy.CancelMode == "" {
+		policy.CancelMode = coupon.CouponPolicyCancelModeVoid
+	}
+
+	if err := policy.Validate(); err != nil {
+		span.RecordError(err)
+		log.Warn("invalid coupon policy", zap.String("policy_code", req.Code), zap.Error(err))
+		return nil, err
+	}
+
+	createdPolicy, err := s.repo.CreateCouponPolicy(ctx, policy)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to create coupon policy", zap.String("policy_code", req.Code), zap.Error(err))
+		return nil, err
+	}
+
+	// Seed Redis Quota
+	if err := s.repo.SetCouponPolicyQuantity(ctx, createdPolicy.Code, createdPolicy.TotalQuantity, createdPolicy.EndTime); err != nil {
+		// Issuers rebuild the quota from COUNT(*) on a cache miss, so a failed seed is not fatal.
+		span.RecordError(err)
+		log.Warn("failed to seed coupon policy quantity", zap.String("policy_code", createdPolicy.Code), zap.Error(err))
+	}
+
+	log.Info("coupon policy created successfully", zap.String("policy_id", createdPolicy.ID), zap.String("policy_code", createdPolicy.Code))
+	return createdPolicy, nil
+}
+
+// UpdateCouponPolicy replaces the mutable fields of a policy. The policy row stays locked
+// while the Redis quota is re-seeded, so v3/v4 issuers cannot decrement a stale counter.
+func (s *service) UpdateCouponPolicy(ctx context.Context, policyCode string, req coupon.UpdateCouponPolicyRequest) (*coupon.CouponPolicy, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Service.UpdateCouponPolicy")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	var updatedPolicy *coupon.CouponPolicy
+
+	err := s.repo.WithTx(ctx, func(tx pgx.Tx) error {
+		policy, err := s.repo.FindCouponPolicyByCodeForUpdateTx(ctx, tx, policyCode)
+		if err != nil || policy == nil {
+			span.RecordError(err)
+			log.Warn("failed to get coupon policy not found", zap.String("policy_code", policyCode), zap.Error(err))
+			return coupon.ErrCouponPolicyNotFound
+		}
+
+		if policy.Status == coupon.CouponPolicyStatusRetired {
+			err := fmt.Errorf("%w, retired policy cannot be updated", coupon.ErrCouponPolicyInvalidStatus)
+			span.RecordError(err)
+			log.Warn("failed to update retired coupon policy", zap.String("policy_code", policyCode), zap.Error(err))
+			return err
+		}
+
+		policy.Name = req.Name
+		policy.Description = req.Description
+		policy.TotalQuantity = req.TotalQuantity
+		policy.StartTime = req.StartTime
+		policy.EndTime = req.EndTime
+		policy.DiscountType = req.DiscountType
+		policy.DiscountValue = req.DiscountValue
+		policy.MinimumOrderAmount = req.MinimumOrderAmount
+		policy.MaximumDiscountAmount = req.MaximumDiscountAmount
+		if req.MaxPerUser != 0 {
+			policy.MaxPerUser = req.MaxPerUser
+		}
+		policy.IncludeProductIDs = req.IncludeProductIDs
+		policy.ExcludeProductIDs = req.ExcludeProductIDs
+		policy.IncludeCategories = req.IncludeCategories
+		policy.ExcludeCategories = req.ExcludeCategories
+		policy.ValidDays = req.ValidDays
+		if req.WaitingRoom != nil {
+			policy.WaitingRoom = *req.WaitingRoom
+		}
+		if req.CancelMode != "" {
+			policy.CancelMode = req.CancelMode
+		}
+
+		if err := policy.Validate(); err != nil {
+			span.RecordError(err)
+			log.Warn("invalid coupon policy", zap.String("policy_code", policyCode), zap.Error(err))
+			return err
+		}
+
+		issued, err := s.repo.CountIssuedCouponsTx(ctx, tx, policy.ID)
+		if err != nil {
+			span.RecordError(err)
+			log.Error("failed to count issued coupons", zap.String("policy_code", policyCode), zap.Error(err))
+			return coupon.ErrCouponInternal
+		}
+
+		if policy.TotalQuantity < issued {
+			err := fmt.Errorf("%w, total_quantity %v is below %v issued coupons", coupon.ErrCouponPolicyInvalid, policy.TotalQuantity, issued)
+			span.RecordError(err)
+			log.Warn("invalid coupon policy quantity", zap.String("policy_code", policyCode), zap.Error(err))
+			return err
+		}
+
+		updatedPolicy, err = s.repo.UpdateCouponPolicyTx(ctx, tx, policy)
+		if err != nil {
+			span.RecordError(err)
+			log.Error("failed to update coupon policy", zap.String("policy_code", policyCode), zap.Error(err))
+			return coupon.ErrCouponInternal
+		}
+
+		// Re-seed Redis Quota, net of issue requests still in flight
+		if _, err := s.quotaReconciler.Reseed(ctx, tx, updatedPolicy.Code, updatedPolicy.EndTime); err != nil {
+			span.RecordError(err)
+			log.Warn("failed to re-seed coupon policy quantity", zap.String("policy_code", policyCode), zap.Error(err))
+			_ = s.repo.DeleteCouponPolicyQuantity(ctx, updatedPolicy.Code)
+		}
+
+		// Invalidate Cached Policy Metadata
+		if err := s.repo.DeleteCouponPolicyMetadata(ctx, updatedPolicy.Code); err != nil {
+			span.RecordError(err)
+			log.Error("failed to invalidate coupon policy metadata", zap.String("policy_code", policyCode), zap.Error(err))
+			return coupon.ErrCouponInternal
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("coupon policy updated successfully", zap.String("policy_id", updatedPolicy.ID), zap.String("policy_code", policyCode))
+	return updatedPolicy, nil
+}
+
+func (s *service) PauseCouponPolicy(ctx context.Context, policyCode string) (*coupon.CouponPolicy, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Service.PauseCouponPolicy")
+	defer span.End()
+
+	return s.changeCouponPolicyStatus(ctx, policyCode, (*coupon.CouponPolicy).Pause)
+}
+
+func (s *service) ResumeCouponPolicy(ctx context.Context, policyCode string) (*coupon.CouponPolicy, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Service.ResumeCouponPolicy")
+	defer span.End()
+
+	return s.changeCouponPolicyStatus(ctx, policyCode, (*coupon.CouponPolicy).Resume)
+}
+
+func (s *service) RetireCouponPolicy(ctx context.Context, policyCode string) (*coupon.CouponPolicy, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Service.RetireCouponPolicy")
+	defer span.End()
+
+	return s.changeCouponPolicyStatus(ctx, policyCode, (*coupon.CouponPolicy).Retire)
+}
+
+// changeCouponPolicyStatus applies a status transition under the policy row lock, re-seeds the
+// Redis quota and invalidates the cached metadata, which issuers rebuild on the next request.
+func (s *service) changeCouponPolicyStatus(ctx context.Context, policyCode string, transition func(*coupon.CouponPolicy) error) (*coupon.CouponPolicy, error) {
+	log := logging.GetLoggerFromContext(ctx)
+
+	var updatedPolicy *coupon.CouponPolicy
+
+	err := s.repo.WithTx(ctx, func(tx pgx.Tx) error {
+		policy, err := s.repo.FindCouponPolicyByCodeForUpdateTx(ctx, tx, policyCode)
+		if err != nil || policy == nil {
+			log.Warn("failed to get coupon policy not found", zap.String("policy_code", policyCode), zap.Error(err))
+			return coupon.ErrCouponPolicyNotFound
+		}
+
+		if err := transition(policy); err != nil {
+			log.Warn("failed to change coupon policy status", zap.String("policy_code", policyCode), zap.String("status", string(policy.Status)), zap.Error(err))
+			return err
+		}
+
+		updatedPolicy, err = s.repo.UpdateCouponPolicyTx(ctx, tx, policy)
+		if err != nil {
+			log.Error("failed to update coupon policy status", zap.String("policy_code", policyCode), zap.Error(err))
+			return coupon.ErrCouponInternal
+		}
+
+		// Re-seed Redis Quota, net of issue requests still in flight, or invalidate it if that fails
+		if _, err := s.quotaReconciler.Reseed(ctx, tx, updatedPolicy.Code, updatedPolicy.EndTime); err != nil {
+			log.Warn("failed to re-seed coupon policy quantity", zap.String("policy_code", policyCode), zap.Error(err))
+			if err := s.repo.DeleteCouponPolicyQuantity(ctx, updatedPolicy.Code); err != nil {
+				log.Error("failed to invalidate coupon policy quantity", zap.String("policy_code", policyCode), zap.Error(err))
+				return coupon.ErrCouponInternal
+			}
+		}
+
+		// Invalidate Cached Policy Metadata
+		if err := s.repo.DeleteCouponPolicyMetadata(ctx, updatedPolicy.Code); err != nil {
+			log.Error("failed to invalidate coupon policy metadata", zap.String("policy_code", policyCode), zap.Error(err))
+			return coupon.ErrCouponInternal
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("coupon policy status changed successfully", zap.String("policy_code", policyCode), zap.String("status", string(updatedPolicy.Status)))
+	return updatedPolicy, nil
+}
+
+func (s *service) FindCouponPolicies(ctx context.Context, status coupon.CouponPolicyStatus) ([]coupon.CouponPolicy, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Service.FindCouponPolicies")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	switch status {
+	case "", coupon.CouponPolicyStatusActive, coupon.CouponPolicyStatusPaused, coupon.CouponPolicyStatusRetired:
+	default:
+		err := fmt.Errorf("%w, unknown status %q", coupon.ErrCouponPolicyInvalid, status)
+		span.RecordError(err)
+		log.Warn("invalid coupon policy status filter", zap.String("status", string(status)))
+		return nil, err
+	}
+
+	policies, err := s.repo.FindCouponPolicies(ctx, status)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to find coupon policies", zap.String("status", string(status)), zap.Error(err))
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+func (s *service) FindCouponPolicyByCode(ctx context.Context, policyCode string) (*coupon.CouponPolicy, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Service.FindCouponPolicyByCode")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	policy, err := s.repo.FindCouponPolicyByCode(ctx, policyCode)
+	if err != nil || policy == nil {
+		span.RecordError(err)
+		log.Warn("failed to get coupon policy not found", zap.String("policy_code", policyCode), zap.Error(err))
+		return nil, coupon.ErrCouponPolicyNotFound
+	}
+
+	return policy, nil
+}
+
+// FindCouponsByPolicyCode lists the coupons of a policy newest first, a page at a time,
+// including the unassigned ones of a pool. cursor is the next_cursor of the previous page.
+func (s *service) FindCouponsByPolicyCode(ctx context.Context, policyCode string, filter coupon.CouponFilter, cursor string) (*coupon.CouponPage, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Service.FindCouponsByPolicyCode")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	filter.PolicyCode = policyCode
+	if err := filter.Validate(); err != nil {
+		span.RecordError(err)
+		log.Warn("invalid coupon filter", zap.String("policy_code", policyCode), zap.String("status", string(filter.Status)), zap.Error(err))
+		return nil, err
+	}
+
+	decoded, err := coupon.DecodeCouponCursor(cursor)
+	if err != nil {
+		span.RecordError(err)
+		log.Warn("invalid coupon cursor", zap.String("policy_code", policyCode), zap.Error(err))
+		return nil, err
+	}
+	filter.Cursor = decoded
+
+	policy, err := s.repo.FindCouponPolicyByCode(ctx, policyCode)
+	if err != nil || policy == nil {
+		span.RecordError(err)
+		log.Warn("failed to get coupon policy not found", zap.String("policy_code", policyCode), zap.Error(err))
+		return nil, coupon.ErrCouponPolicyNotFound
+	}
+
+	coupons, err := s.repo.FindCouponsByPolicyID(ctx, policy.ID, filter)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to find coupons", zap.String("policy_code", policyCode), zap.Error(err))
+		return nil, err
+	}
+
+	return coupon.NewCouponPage(coupons, filter.Limit), nil
+}
+
+// ReconcileCouponPolicyQuota runs the quota reconciler for one policy on demand, with the same
+// correction bounds as the periodic run.
+func (s *service) ReconcileCouponPolicyQuota(ctx context.Context, policyCode string) (*coupon.QuotaReconciliation, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Service.ReconcileCouponPolicyQuota")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	result, err := s.quotaReconciler.Reconcile(ctx, policyCode)
+	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, coupon.ErrCouponPolicyNotFound) {
+			log.Warn("failed to get coupon policy not found", zap.String("policy_code", policyCode), zap.Error(err))
+			return nil, err
+		}
+		log.Error("failed to reconcile coupon policy quota", zap.String("policy_code", policyCode), zap.Error(err))
+		return nil, coupon.ErrCouponInternal
+	}
+
+	return result, nil
+}
+
+func (s *service) ReconcileCouponPolicyQuotas(ctx context.Context) ([]coupon.QuotaReconciliation, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Service.ReconcileCouponPolicyQuotas")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	results, err := s.quotaReconciler.ReconcileAll(ctx)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to reconcile coupon policy quotas", zap.Error(err))
+		return nil, coupon.ErrCouponInternal
+	}
+
+	return results, nil
+}
+
+// RevokeCoupon takes back an unused coupon for fraud, reason is kept in its history. A revoked
+// coupon keeps its unit of the quota, so revoking cannot be used to re-issue coupons.
+func (s *service) RevokeCoupon(ctx context.Context, couponCode string, actor string, reason string) (*coupon.Coupon, error) {
+	ctx, span := tracing.StartSpan(ctx, "Admin.Service.RevokeCoupon")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	// Check Coupon Code Format
+	normalized, err := couponcode.Parse(couponCode)
+	if err != nil {
+		err = fmt.Errorf("%w, %v", coupon.ErrCouponCodeInvalid, err)
+		span.RecordError(err)
+		log.Warn("invalid coupon code", zap.String("coupon_code", couponCode), zap.Error(err))
+		return nil, err
+	}
+	couponCode = normalized
+
+	// Retrieve Coupon
+	c, err := s.repo.FindCouponByCode(ctx, couponCode)
+	if err != nil || c == nil {
+		span.RecordError(err)
+		log.Warn("failed to get coupon by code", zap.String("coupon_code", couponCode), zap.Error(err))
+		return nil, coupon.ErrCouponNotFound
+	}
+
+	// Check Coupon Status, Revoke clears a reservation so the event keeps its order
+	previousStatus, previousOrderID := c.Status, c.OrderID
+	if err := c.Revoke(); err != nil {
+		span.RecordError(err)
+		log.Warn("failed to revoke coupon not match status", zap.String("coupon_code", couponCode), zap.String("status", string(previousStatus)), zap.Error(err))
+		return nil, err
+	}
+
+	// Update Coupon
+	event := coupon.NewCouponEvent(coupon.CouponEventTypeRevoked, previousStatus, actor, previousOrderID, tracing.TraceID(ctx))
+	event.Reason = &reason
+	revokedCoupon, err := s.repo.UpdateCoupon(ctx, c, event)
+	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, coupon.ErrCouponConflict) {
+			log.Warn("failed to update coupon changed concurrently", zap.String("coupon_code", couponCode), zap.Error(err))
+			return nil, err
+		}
+		log.Error("failed to update coupon", zap.String("coupon_code", couponCode), zap.Error(err))
+		return nil, coupon.ErrCouponInternal
+	}
+
+	// Publish Event, best effort as the coupon history records the revoke
+	domainEvent, err := domainevent.New(domainevent.TypeCouponRevoked, revokedCoupon.ID, tracing.TraceID(ctx), domainevent.CouponRevoked{
+		CouponID:   revokedCoupon.ID,
+		CouponCode: revokedCoupon.Code,
+		PolicyID:   revokedCoupon.CouponPolicyID,
+		UserID:     revokedCoupon.UserID,
+		OrderID:    previousOrderID,
+		Reason:     reason,
+	})
+	if err == nil {
+		err = s.events.Publish(ctx, domainEvent)
+	}
+	if err != nil {
+		log.Error("failed to publish domain event", zap.String("type", string(domainevent.TypeCouponRevoked)), zap.String("coupon_code", couponCode), zap.Error(err))
+	}
+
+	log.Info("coupon revoked successfully", zap.String("coupon_code", couponCode), zap.String("actor", actor), zap.String("previous_status", string(previousStatus)))
+	return revokedCoupon, nil
+}
@@ -7,6 +7,7 @@ import (
 
 	"example.com/coupon-service/internal/config"
 	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/couponpool"
 	"example.com/coupon-service/internal/instrument/logging"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
@@ -32,12 +33,13 @@ func NewHandler(
 	}
 }
 
-func (h *Handler) RegisterDummyAPI() {
-	h.e.GET("/init-dummy-db", h.InitDummyDB)
-	h.e.GET("/clean-dummy-db", h.CleanDummyDB)
-	h.e.GET("/init-dummy-redis-db", h.InitDummyRedisAndDB)
-	h.e.GET("/clean-dummy-redis-db", h.CleanDummyRedisAndDB)
-	h.e.GET("/check-quantity/:policy_code", h.CheckQuantity)
+// RegisterDummyAPI registers the test data endpoints behind m, the admin scope check in main.
+func (h *Handler) RegisterDummyAPI(m ...echo.MiddlewareFunc) {
+	h.e.GET("/init-dummy-db", h.InitDummyDB, m...)
+	h.e.GET("/clean-dummy-db", h.CleanDummyDB, m...)
+	h.e.GET("/init-dummy-redis-db", h.InitDummyRedisAndDB, m...)
+	h.e.GET("/clean-dummy-redis-db", h.CleanDummyRedisAndDB, m...)
+	h.e.GET("/check-quantity/:policy_code", h.CheckQuantity, m...)
 }
 
 // Dummy save in DB
@@ -115,8 +117,8 @@ func (h *Handler) CleanDummyDB(c echo.Context) error {
 	log := logging.GetLogger()
 	ctx := c.Request().Context()
 
-	// Delete CouponPolicy records in Postgres
-	_, err := h.pg.Pool.Exec(ctx, `DELETE FROM coupon_policies`)
+	// Delete CouponPolicy records in Postgres, coupon history first as it does not cascade
+	_, err := h.pg.Pool.Exec(ctx, `DELETE FROM coupon_events; DELETE FROM coupon_policies`)
 	if err != nil {
 		log.Error("failed to clean dummy data", zap.Error(err))
 		return c.JSON(500, map[string]string{"error": err.Error()})
@@ -231,15 +233,19 @@ func (h *Handler) CleanDummyRedisAndDB(c echo.Context) error {
 	// Delete CouponPolicy in Redis
 	for _, code := range codes {
 		policyQuantityKey := "coupon:policy:quantity:" + code
-		if err := h.rdb.Client.Del(ctx, policyQuantityKey).Err(); err != nil {
+		policyClaimsKey := "coupon:policy:claims:" + code
+		policyMetadataKey := "coupon:policy:meta:" + code
+		policyPoolKey := couponpool.CouponPolicyPoolKeyPrefix + code
+		waitingRoomKeys := []string{"waitingroom:queue:" + code, "waitingroom:admitted:" + code, "waitingroom:seq:" + code}
+		if err := h.rdb.Client.Del(ctx, append([]string{policyQuantityKey, policyClaimsKey, policyMetadataKey, policyPoolKey}, waitingRoomKeys...)...).Err(); err != nil {
 			log.Warn("failed to delete redis key", zap.String("key", policyQuantityKey), zap.Error(err))
 		} else {
 			log.Info("successfully deleted redis key", zap.String("key", policyQuantityKey))
 		}
 	}
 
-	// Delete CouponPolicy records in Postgres
-	_, err = h.pg.Pool.Exec(ctx, `DELETE FROM coupon_policies`)
+	// Delete CouponPolicy records in Postgres, coupon history first as it does not cascade
+	_, err = h.pg.Pool.Exec(ctx, `DELETE FROM coupon_events; DELETE FROM coupon_policies`)
 	if err != nil {
 		log.Error("failed to clean dummy data", zap.Error(err))
 		return c.JSON(500, map[string]string{"error": err.Error()})
@@ -300,7 +306,7 @@ func (h *Handler) CheckQuantity(c echo.Context) error {
 		ctx,
 		`SELECT COUNT(*) 
 		 FROM coupons 
-		 WHERE coupon_policy_id = $1`,
+		 WHERE coupon_policy_id = $1 AND status <> 'UNASSIGNED' AND NOT quota_released`,
 		cp.ID,
 	).Scan(&totalIssued)
 	if err != nil {
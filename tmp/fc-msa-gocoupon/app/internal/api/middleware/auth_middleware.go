@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"example.com/coupon-service/internal/api/problem"
+	"example.com/coupon-service/internal/auth"
+	"example.com/coupon-service/internal/instrument/logging"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const ClaimsKey = "claims"
+
+// AuthMiddleware verifies the bearer token and puts its user ID and claims in the context,
+// where UserIDMiddleware picks the user up instead of trusting X-USER-ID.
+// A nil verifier means auth is disabled and every request is passed through untouched.
+func AuthMiddleware(verifier *auth.Verifier) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if verifier == nil || strings.Contains(c.Path(), "/swagger/") {
+				return next(c)
+			}
+
+			ctx := c.Request().Context()
+			log := logging.GetLoggerFromContext(ctx)
+
+			token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !ok || token == "" {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer`)
+				return problem.Error(c, auth.ErrTokenMissing)
+			}
+
+			claims, err := verifier.Verify(ctx, token)
+			if err != nil {
+				log.Warn("failed to verify bearer token", zap.Error(err))
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+				if errors.Is(err, auth.ErrTokenExpired) {
+					return problem.Error(c, auth.ErrTokenExpired)
+				}
+				return problem.Error(c, auth.ErrTokenInvalid)
+			}
+
+			ctx = context.WithValue(ctx, UserIDKey, claims.UserID)
+			ctx = context.WithValue(ctx, ClaimsKey, claims)
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			return next(c)
+		}
+	}
+}
+
+// RequireAdminScope lets only tokens carrying the verifier's admin scope through.
+// A nil verifier means auth is disabled, and admin routes then fail closed with a 403.
+func RequireAdminScope(verifier *auth.Verifier) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if verifier == nil {
+				return problem.Error(c, auth.ErrAuthDisabled)
+			}
+
+			claims, ok := c.Request().Context().Value(ClaimsKey).(*auth.Claims)
+			if !ok {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer`)
+				return problem.Error(c, auth.ErrTokenMissing)
+			}
+			if !claims.HasScope(verifier.AdminScope()) {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="insufficient_scope", scope="`+verifier.AdminScope()+`"`)
+				return problem.Error(c, auth.ErrScopeMissing)
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+
+	"example.com/coupon-service/internal/api/problem"
+	"example.com/coupon-service/internal/idempotency"
+	"example.com/coupon-service/internal/instrument/logging"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotent-Replayed"
+)
+
+// IdempotencyMiddleware stores the first response for an Idempotency-Key and replays it for retries.
+// Keys are scoped by user, method and route, so it must run after UserIDMiddleware.
+// Requests without the header are passed through untouched.
+func IdempotencyMiddleware(store idempotency.IStore) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			idempotencyKey := c.Request().Header.Get(IdempotencyKeyHeader)
+			if idempotencyKey == "" {
+				return next(c)
+			}
+
+			ctx := c.Request().Context()
+			log := logging.GetLoggerFromContext(ctx)
+
+			if len(idempotencyKey) > 255 {
+				return problem.BadRequest(c, "Idempotency-Key header must be at most 255 characters")
+			}
+
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return problem.BadRequest(c, err.Error())
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			key := idempotencyRecordKey(c, idempotencyKey)
+			hash := sha256.Sum256(body)
+			requestHash := hex.EncodeToString(hash[:])
+
+			// Replay Stored Response
+			replay := func(record *idempotency.Record) error {
+				if record.RequestHash != requestHash {
+					log.Warn("idempotency key reused with a different request", zap.String("idempotency_key", idempotencyKey))
+					return problem.Write(c, problem.New(problem.CodeIdempotencyKeyReused,
+						"Idempotency-Key was already used with a different request body",
+					))
+				}
+
+				log.Info("replaying idempotent response", zap.String("idempotency_key", idempotencyKey), zap.Int("status_code", record.StatusCode))
+				c.Response().Header().Set(IdempotencyReplayedHeader, "true")
+				return c.Blob(record.StatusCode, record.ContentType, record.Body)
+			}
+
+			record, err := store.Get(ctx, key)
+			if err != nil {
+				log.Error("failed to get idempotency record", zap.String("idempotency_key", idempotencyKey), zap.Error(err))
+				return problem.Write(c, problem.New(problem.CodeServiceUnavailable, "idempotency store unavailable"))
+			}
+			if record != nil {
+				return replay(record)
+			}
+
+			// Guard Concurrent Retries
+			locked, err := store.Lock(ctx, key)
+			if err != nil || !locked {
+				log.Warn("idempotent request already in progress", zap.String("idempotency_key", idempotencyKey), zap.Error(err))
+				return problem.Write(c, problem.New(problem.CodeIdempotencyInProgress,
+					"a request with this Idempotency-Key is already in progress",
+				))
+			}
+			defer store.Unlock(ctx, key)
+
+			// Recheck Under Lock
+			// The first request may have saved its response and unlocked between the Get above and Lock
+			record, err = store.Get(ctx, key)
+			if err != nil {
+				log.Error("failed to get idempotency record", zap.String("idempotency_key", idempotencyKey), zap.Error(err))
+				return problem.Write(c, problem.New(problem.CodeServiceUnavailable, "idempotency store unavailable"))
+			}
+			if record != nil {
+				return replay(record)
+			}
+
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			// Server errors are not stored so the client can retry them
+			status := c.Response().Status
+			if status >= http.StatusInternalServerError {
+				return nil
+			}
+
+			_ = store.Save(ctx, &idempotency.Record{
+				Key:         key,
+				RequestHash: requestHash,
+				StatusCode:  status,
+				ContentType: c.Response().Header().Get(echo.HeaderContentType),
+				Body:        recorder.body.Bytes(),
+			})
+
+			return nil
+		}
+	}
+}
+
+// idempotencyRecordKey scopes an Idempotency-Key by user, method and route.
+func idempotencyRecordKey(c echo.Context, idempotencyKey string) string {
+	userID, _ := c.Request().Context().Value(UserIDKey).(string)
+	return userID + ":" + c.Request().Method + ":" + c.Path() + ":" + idempotencyKey
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"example.com/coupon-service/internal/idempotency"
+	"example.com/coupon-service/internal/instrument/logging"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+var _ idempotency.IStore = (*fakeIdempotencyStore)(nil)
+
+// fakeIdempotencyStore keeps records and locks in memory. onGet runs once, after the next Get
+// has read the store and before it returns, so a test can interleave another request there.
+type fakeIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*idempotency.Record
+	locks   map[string]bool
+	onGet   func()
+}
+
+func newFakeIdempotencyStore() *fakeIdempotencyStore {
+	return &fakeIdempotencyStore{
+		records: make(map[string]*idempotency.Record),
+		locks:   make(map[string]bool),
+	}
+}
+
+func (s *fakeIdempotencyStore) Get(ctx context.Context, key string) (*idempotency.Record, error) {
+	s.mu.Lock()
+	record := s.records[key]
+	onGet := s.onGet
+	s.onGet = nil
+	s.mu.Unlock()
+
+	if onGet != nil {
+		onGet()
+	}
+	return record, nil
+}
+
+func (s *fakeIdempotencyStore) Save(ctx context.Context, record *idempotency.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.records[record.Key]; !ok {
+		s.records[record.Key] = record
+	}
+	return nil
+}
+
+func (s *fakeIdempotencyStore) Lock(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.locks[key] {
+		return false, nil
+	}
+	s.locks[key] = true
+	return true, nil
+}
+
+func (s *fakeIdempotencyStore) Unlock(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.locks, key)
+	return nil
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	tests := []struct {
+		name         string
+		secondBody   string
+		interleave   bool
+		wantCalls    int
+		wantStatus   int
+		wantReplayed bool
+	}{
+		{name: "retry after the first response", secondBody: `{"n":1}`, wantCalls: 1, wantStatus: http.StatusCreated, wantReplayed: true},
+		{name: "retry whose get lands before the first save", secondBody: `{"n":1}`, interleave: true, wantCalls: 1, wantStatus: http.StatusCreated, wantReplayed: true},
+		{name: "key reused with another body", secondBody: `{"n":2}`, wantCalls: 1, wantStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeIdempotencyStore()
+
+			calls := 0
+			e := echo.New()
+			e.POST("/issue", func(c echo.Context) error {
+				calls++
+				return c.JSON(http.StatusCreated, map[string]int{"call": calls})
+			}, IdempotencyMiddleware(store))
+
+			send := func(body string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/issue", strings.NewReader(body))
+				req = req.WithContext(logging.WithLogger(req.Context(), zap.NewNop()))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+				req.Header.Set(IdempotencyKeyHeader, "KEY-1")
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, req)
+				return rec
+			}
+
+			var first *httptest.ResponseRecorder
+			if tt.interleave {
+				// The first request runs to completion while the retry sits between its Get and Lock
+				store.onGet = func() { first = send(`{"n":1}`) }
+			} else {
+				first = send(`{"n":1}`)
+			}
+			second := send(tt.secondBody)
+
+			if first.Code != http.StatusCreated {
+				t.Fatalf("first status = %d, want %d", first.Code, http.StatusCreated)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("handler ran %d times, want %d", calls, tt.wantCalls)
+			}
+			if second.Code != tt.wantStatus {
+				t.Errorf("second status = %d, want %d", second.Code, tt.wantStatus)
+			}
+			if replayed := second.Header().Get(IdempotencyReplayedHeader) == "true"; replayed != tt.wantReplayed {
+				t.Errorf("second replayed = %v, want %v", replayed, tt.wantReplayed)
+			}
+			if tt.wantReplayed && second.Body.String() != first.Body.String() {
+				t.Errorf("second body = %q, want the first response %q", second.Body.String(), first.Body.String())
+			}
+		})
+	}
+}
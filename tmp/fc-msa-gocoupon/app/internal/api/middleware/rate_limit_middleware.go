@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"example.com/coupon-service/internal/api/problem"
+	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/instrument/logging"
+	"example.com/coupon-service/internal/instrument/metrics"
+	"example.com/coupon-service/internal/ratelimit"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// RateLimitMiddleware rejects requests over the per-IP, per-user and per-policy limits
+// with 429 and a Retry-After header. The policy is taken from the :policy_code path parameter or
+// the policy_code field of a JSON body. A Redis failure lets the request through, so an outage of
+// the limiter does not take the service down with it.
+func RateLimitMiddleware(limiter *ratelimit.Limiter) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+			log := logging.GetLoggerFromContext(ctx)
+
+			checks := []ratelimit.Check{
+				{Scope: ratelimit.ScopeIP, Key: c.RealIP()},
+				{Scope: ratelimit.ScopeUser, Key: rateLimitUserID(c)},
+				{Scope: ratelimit.ScopePolicy, Key: policyCode(c)},
+			}
+
+			allowed, scope, retryAfter, err := limiter.Allow(ctx, checks)
+			if err != nil {
+				log.Warn("rate limiter unavailable, allowing request", zap.Error(err))
+				return next(c)
+			}
+			if !allowed {
+				key := ""
+				for _, check := range checks {
+					if check.Scope == scope {
+						key = check.Key
+					}
+				}
+
+				metrics.RateLimitRejectedTotal.WithLabelValues(string(scope), c.Path()).Inc()
+				log.Warn("rate limit exceeded",
+					zap.String("scope", string(scope)),
+					zap.String("key", key),
+					zap.String("path", c.Path()),
+					zap.Duration("retry_after", retryAfter),
+				)
+
+				c.Response().Header().Set("Retry-After", strconv.Itoa(max(int(math.Ceil(retryAfter.Seconds())), 1)))
+				p := problem.FromError(coupon.ErrCouponTooManyRequests)
+				p.Extensions = map[string]any{"scope": string(scope)}
+				return problem.Write(c, p)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// rateLimitUserID prefers the user verified by AuthMiddleware over the X-USER-ID header.
+func rateLimitUserID(c echo.Context) string {
+	if userID, ok := c.Request().Context().Value(UserIDKey).(string); ok && userID != "" {
+		return userID
+	}
+	return c.Request().Header.Get("X-USER-ID")
+}
+
+// maxPolicyCodeBodyBytes bounds how much of a body policyCode peeks into before any limit is checked.
+const maxPolicyCodeBodyBytes = 64 << 10
+
+// policyCode returns the policy a request targets, restoring the body after peeking into it.
+// A body larger than maxPolicyCodeBodyBytes is not parsed and is handed on unread past the peek.
+func policyCode(c echo.Context) string {
+	if code := c.Param("policy_code"); code != "" {
+		return code
+	}
+
+	req := c.Request()
+	if req.Body == nil || req.ContentLength == 0 || !strings.HasPrefix(req.Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		return ""
+	}
+	if req.ContentLength > maxPolicyCodeBodyBytes {
+		return ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxPolicyCodeBodyBytes+1))
+	req.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+	if err != nil || len(body) > maxPolicyCodeBodyBytes {
+		return ""
+	}
+
+	var payload struct {
+		PolicyCode string `json:"policy_code"`
+	}
+	_ = json.Unmarshal(body, &payload)
+	return payload.PolicyCode
+}
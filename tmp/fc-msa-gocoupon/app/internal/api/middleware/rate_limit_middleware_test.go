@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestPolicyCode(t *testing.T) {
+	large := `{"policy_code":"FLASH","pad":"` + strings.Repeat("x", maxPolicyCodeBodyBytes) + `"}`
+
+	tests := []struct {
+		name          string
+		body          string
+		contentType   string
+		contentLength int64
+		want          string
+	}{
+		{name: "json body", body: `{"policy_code":"FLASH"}`, contentType: echo.MIMEApplicationJSON, want: "FLASH"},
+		{name: "not json", body: `policy_code=FLASH`, contentType: echo.MIMEApplicationForm, want: ""},
+		{name: "malformed json", body: `{"policy_code":`, contentType: echo.MIMEApplicationJSON, want: ""},
+		{name: "declared too large", body: large, contentType: echo.MIMEApplicationJSON, want: ""},
+		{name: "chunked too large", body: large, contentType: echo.MIMEApplicationJSON, contentLength: -1, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/issue", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, tt.contentType)
+			if tt.contentLength != 0 {
+				req.ContentLength = tt.contentLength
+			}
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+
+			if got := policyCode(c); got != tt.want {
+				t.Errorf("policyCode() = %q, want %q", got, tt.want)
+			}
+
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tt.body {
+				t.Errorf("body after policyCode() has %d bytes, want the %d sent", len(body), len(tt.body))
+			}
+		})
+	}
+}
@@ -2,22 +2,25 @@ package middleware
 
 import (
 	"context"
-	"net/http"
 
+	"example.com/coupon-service/internal/api/problem"
 	"github.com/labstack/echo/v4"
 )
 
 const UserIDKey = "user_id"
 
+// UserIDMiddleware requires a user. The user verified by AuthMiddleware takes precedence,
+// the X-USER-ID header is only trusted when auth is disabled.
 func UserIDMiddleware() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			if userID, ok := c.Request().Context().Value(UserIDKey).(string); ok && userID != "" {
+				return next(c)
+			}
 
 			userID := c.Request().Header.Get("X-USER-ID")
 			if userID == "" {
-				return c.JSON(http.StatusUnauthorized, map[string]string{
-					"error": "missing X-USER-ID header",
-				})
+				return problem.Unauthorized(c, "missing X-USER-ID header")
 			}
 
 			ctx := context.WithValue(c.Request().Context(), UserIDKey, userID)
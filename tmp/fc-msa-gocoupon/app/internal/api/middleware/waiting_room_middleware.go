@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"example.com/coupon-service/internal/admission"
+	"example.com/coupon-service/internal/api/problem"
+	"example.com/coupon-service/internal/idempotency"
+	"example.com/coupon-service/internal/instrument/logging"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const QueueTokenHeader = "X-Queue-Token"
+
+// WaitingRoomMiddleware lets issue requests for policies with a waiting room through only if
+// the X-Queue-Token belongs to an admitted user. Other policies are passed through untouched.
+// It reads policy_code from the body, so it must run after UserIDMiddleware and before
+// IdempotencyMiddleware, keeping rejections out of the stored responses. A retry whose
+// Idempotency-Key already has a stored response skips admission, which may have lapsed by
+// then, and is left to IdempotencyMiddleware to replay.
+func WaitingRoomMiddleware(queue *admission.Queue, store idempotency.IStore) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+			log := logging.GetLoggerFromContext(ctx)
+
+			// Skip Admission For Completed Requests
+			if idempotencyKey := c.Request().Header.Get(IdempotencyKeyHeader); idempotencyKey != "" {
+				record, err := store.Get(ctx, idempotencyRecordKey(c, idempotencyKey))
+				if err != nil {
+					log.Warn("failed to get idempotency record, checking admission", zap.String("idempotency_key", idempotencyKey), zap.Error(err))
+				}
+				if record != nil {
+					return next(c)
+				}
+			}
+
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return problem.BadRequest(c, err.Error())
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			var payload struct {
+				PolicyCode string `json:"policy_code"`
+			}
+			if err := json.Unmarshal(body, &payload); err != nil || payload.PolicyCode == "" {
+				// Left to the handler to reject
+				return next(c)
+			}
+
+			enabled, err := queue.IsEnabled(ctx, payload.PolicyCode)
+			if err != nil {
+				log.Error("failed to check waiting room", zap.String("policy_code", payload.PolicyCode), zap.Error(err))
+				return problem.Write(c, problem.New(problem.CodeServiceUnavailable, "waiting room unavailable"))
+			}
+			if !enabled {
+				return next(c)
+			}
+
+			token := c.Request().Header.Get(QueueTokenHeader)
+			if token == "" {
+				return problem.Write(c, problem.New(problem.CodeWaitingRoomNotAdmitted,
+					"this coupon has a waiting room, enter it first and retry with the X-Queue-Token header",
+				))
+			}
+
+			userID, _ := ctx.Value(UserIDKey).(string)
+			ticket, err := queue.Check(ctx, token, payload.PolicyCode, userID)
+			if err != nil {
+				if errors.Is(err, admission.ErrTokenInvalid) || errors.Is(err, admission.ErrTokenExpired) {
+					return problem.Error(c, err)
+				}
+				log.Error("failed to check waiting room admission", zap.String("policy_code", payload.PolicyCode), zap.String("user_id", userID), zap.Error(err))
+				return problem.Write(c, problem.New(problem.CodeServiceUnavailable, "waiting room unavailable"))
+			}
+
+			switch ticket.Status {
+			case admission.TicketStatusAdmitted:
+				return next(c)
+			case admission.TicketStatusSoldOut:
+				p := problem.New(problem.CodeCouponQuantityExhausted, "coupon sold out")
+				p.Extensions = map[string]any{"ticket": ticket}
+				return problem.Write(c, p)
+			default:
+				p := problem.New(problem.CodeWaitingRoomNotAdmitted, "not admitted by the waiting room yet")
+				p.Extensions = map[string]any{"ticket": ticket}
+				return problem.Write(c, p)
+			}
+		}
+	}
+}
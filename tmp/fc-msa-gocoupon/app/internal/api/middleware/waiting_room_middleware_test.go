@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/coupon-service/internal/idempotency"
+	"example.com/coupon-service/internal/instrument/logging"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// A retry of a completed issue replays its response even once the admission has lapsed.
+// The queue is nil, so any request that reaches the waiting room check would panic.
+func TestWaitingRoomMiddlewareSkipsCompletedRequests(t *testing.T) {
+	body := `{"policy_code":"FLASH"}`
+	hash := sha256.Sum256([]byte(body))
+
+	store := newFakeIdempotencyStore()
+	_ = store.Save(context.Background(), &idempotency.Record{
+		Key:         ":" + http.MethodPost + ":/issue:KEY-1",
+		RequestHash: hex.EncodeToString(hash[:]),
+		StatusCode:  http.StatusCreated,
+		ContentType: echo.MIMEApplicationJSON,
+		Body:        []byte(`{"code":"FIRST"}`),
+	})
+
+	calls := 0
+	e := echo.New()
+	e.POST("/issue", func(c echo.Context) error {
+		calls++
+		return c.NoContent(http.StatusCreated)
+	}, WaitingRoomMiddleware(nil, store), IdempotencyMiddleware(store))
+
+	req := httptest.NewRequest(http.MethodPost, "/issue", strings.NewReader(body))
+	req = req.WithContext(logging.WithLogger(req.Context(), zap.NewNop()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(IdempotencyKeyHeader, "KEY-1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if calls != 0 {
+		t.Errorf("handler ran %d times, want the stored response replayed", calls)
+	}
+	if rec.Code != http.StatusCreated || rec.Body.String() != `{"code":"FIRST"}` {
+		t.Errorf("response = %d %q, want the stored 201", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get(IdempotencyReplayedHeader) != "true" {
+		t.Errorf("%s header missing", IdempotencyReplayedHeader)
+	}
+}
@@ -0,0 +1,219 @@
+package problem
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"example.com/coupon-service/internal/admission"
+	"example.com/coupon-service/internal/auth"
+	"example.com/coupon-service/internal/coupon"
+)
+
+// Code is a stable, machine-readable error code. Codes are part of the API contract,
+// add new ones instead of renaming.
+type Code string
+
+const (
+	CodeInvalidRequest  Code = "INVALID_REQUEST"
+	CodeUnauthenticated Code = "UNAUTHENTICATED"
+	CodeInternal        Code = "INTERNAL_ERROR"
+
+	CodeCouponPolicyNotFound      Code = "COUPON_POLICY_NOT_FOUND"
+	CodeCouponPolicyNotActive     Code = "COUPON_POLICY_NOT_ACTIVE"
+	CodeCouponPolicyExpired       Code = "COUPON_POLICY_EXPIRED"
+	CodeCouponPolicyPaused        Code = "COUPON_POLICY_PAUSED"
+	CodeCouponPolicyRetired       Code = "COUPON_POLICY_RETIRED"
+	CodeCouponPolicyPoolOnly      Code = "COUPON_POLICY_POOL_ONLY"
+	CodeCouponPolicyInvalid       Code = "COUPON_POLICY_INVALID"
+	CodeCouponPolicyInvalidStatus Code = "COUPON_POLICY_INVALID_STATUS"
+	CodeCouponPolicyAlreadyExists Code = "COUPON_POLICY_ALREADY_EXISTS"
+	CodeCouponQuantityExhausted   Code = "COUPON_QUANTITY_EXHAUSTED"
+	CodeCouponQuantityRace        Code = "COUPON_QUANTITY_RACE"
+	CodeCouponUserLimitExceeded   Code = "COUPON_USER_LIMIT_EXCEEDED"
+	CodeCouponUserAlreadyClaimed  Code = "COUPON_USER_ALREADY_CLAIMED"
+	CodeCouponNotFound            Code = "COUPON_NOT_FOUND"
+	CodeCouponNotOwner            Code = "COUPON_NOT_OWNER"
+	CodeCouponConflict            Code = "COUPON_CONFLICT"
+	CodeCouponAlreadyUsed         Code = "COUPON_ALREADY_USED"
+	CodeCouponNotUsed             Code = "COUPON_NOT_USED"
+	CodeCouponCanceled            Code = "COUPON_CANCELED"
+	CodeCouponRevoked             Code = "COUPON_REVOKED"
+	CodeCouponExpired             Code = "COUPON_EXPIRED"
+	CodeCouponPending             Code = "COUPON_PENDING"
+	CodeCouponReserved            Code = "COUPON_RESERVED"
+	CodeCouponNotReserved         Code = "COUPON_NOT_RESERVED"
+	CodeCouponReservationExpired  Code = "COUPON_RESERVATION_EXPIRED"
+	CodeCouponReservationTTL      Code = "COUPON_RESERVATION_TTL_INVALID"
+	CodeCouponInvalidForOrder     Code = "COUPON_INVALID_FOR_ORDER"
+	CodeCouponInvalidForProduct   Code = "COUPON_INVALID_FOR_PRODUCT"
+	CodeCouponOrderAmountTooLow   Code = "COUPON_ORDER_AMOUNT_TOO_LOW"
+	CodeCouponCodeInvalid         Code = "COUPON_CODE_INVALID"
+	CodeCouponCodeConflict        Code = "COUPON_CODE_CONFLICT"
+	CodeCouponCursorInvalid       Code = "COUPON_CURSOR_INVALID"
+	CodeCouponFilterInvalid       Code = "COUPON_FILTER_INVALID"
+	CodeIssueRequestNotFound      Code = "ISSUE_REQUEST_NOT_FOUND"
+	CodeTooManyRequests           Code = "TOO_MANY_REQUESTS"
+	CodeServiceUnavailable        Code = "SERVICE_UNAVAILABLE"
+	CodeTimeout                   Code = "TIMEOUT"
+	CodeIdempotencyKeyReused      Code = "IDEMPOTENCY_KEY_REUSED"
+	CodeIdempotencyInProgress     Code = "IDEMPOTENCY_IN_PROGRESS"
+
+	CodeTokenInvalid      Code = "TOKEN_INVALID"
+	CodeTokenExpired      Code = "TOKEN_EXPIRED"
+	CodeInsufficientScope Code = "INSUFFICIENT_SCOPE"
+	CodeAuthDisabled      Code = "AUTH_DISABLED"
+
+	CodeWaitingRoomNotEnabled   Code = "WAITING_ROOM_NOT_ENABLED"
+	CodeWaitingRoomNotAdmitted  Code = "WAITING_ROOM_NOT_ADMITTED"
+	CodeWaitingRoomTokenInvalid Code = "WAITING_ROOM_TOKEN_INVALID"
+	CodeWaitingRoomTokenExpired Code = "WAITING_ROOM_TOKEN_EXPIRED"
+)
+
+type definition struct {
+	status int
+	title  string
+}
+
+var definitions = map[Code]definition{
+	CodeInvalidRequest:  {http.StatusBadRequest, "Invalid request"},
+	CodeUnauthenticated: {http.StatusUnauthorized, "Authentication required"},
+	CodeInternal:        {http.StatusInternalServerError, "Internal error"},
+
+	CodeCouponPolicyNotFound:      {http.StatusNotFound, "Coupon policy not found"},
+	CodeCouponPolicyNotActive:     {http.StatusUnprocessableEntity, "Coupon policy not active yet"},
+	CodeCouponPolicyExpired:       {http.StatusGone, "Coupon policy expired"},
+	CodeCouponPolicyPaused:        {http.StatusConflict, "Coupon policy paused"},
+	CodeCouponPolicyRetired:       {http.StatusGone, "Coupon policy retired"},
+	CodeCouponPolicyPoolOnly:      {http.StatusUnprocessableEntity, "Coupon policy only issues from its pool"},
+	CodeCouponPolicyInvalid:       {http.StatusUnprocessableEntity, "Invalid coupon policy"},
+	CodeCouponPolicyInvalidStatus: {http.StatusConflict, "Invalid coupon policy status transition"},
+	CodeCouponPolicyAlreadyExists: {http.StatusConflict, "Coupon policy already exists"},
+	CodeCouponQuantityExhausted:   {http.StatusGone, "Coupon quantity exhausted"},
+	CodeCouponQuantityRace:        {http.StatusConflict, "Coupon quantity limit reached concurrently"},
+	CodeCouponUserLimitExceeded:   {http.StatusConflict, "User claim limit reached"},
+	CodeCouponUserAlreadyClaimed:  {http.StatusConflict, "User already claimed this coupon"},
+	CodeCouponNotFound:            {http.StatusNotFound, "Coupon not found"},
+	CodeCouponNotOwner:            {http.StatusForbidden, "Not the owner of this coupon"},
+	CodeCouponConflict:            {http.StatusConflict, "Coupon changed by a concurrent request"},
+	CodeCouponAlreadyUsed:         {http.StatusConflict, "Coupon already used"},
+	CodeCouponNotUsed:             {http.StatusConflict, "Coupon not used"},
+	CodeCouponCanceled:            {http.StatusConflict, "Coupon canceled"},
+	CodeCouponRevoked:             {http.StatusConflict, "Coupon revoked"},
+	CodeCouponExpired:             {http.StatusGone, "Coupon expired"},
+	CodeCouponPending:             {http.StatusConflict, "Coupon pending"},
+	CodeCouponReserved:            {http.StatusConflict, "Coupon reserved for another order"},
+	CodeCouponNotReserved:         {http.StatusConflict, "Coupon not reserved"},
+	CodeCouponReservationExpired:  {http.StatusGone, "Coupon reservation expired"},
+	CodeCouponReservationTTL:      {http.StatusBadRequest, "Invalid coupon reservation ttl"},
+	CodeCouponInvalidForOrder:     {http.StatusUnprocessableEntity, "Coupon not valid for this order"},
+	CodeCouponInvalidForProduct:   {http.StatusUnprocessableEntity, "Coupon not applicable to the products"},
+	CodeCouponOrderAmountTooLow:   {http.StatusUnprocessableEntity, "Order amount below the coupon minimum"},
+	CodeCouponCodeInvalid:         {http.StatusUnprocessableEntity, "Invalid coupon code"},
+	CodeCouponCodeConflict:        {http.StatusConflict, "Coupon code already exists"},
+	CodeCouponCursorInvalid:       {http.StatusBadRequest, "Invalid page cursor"},
+	CodeCouponFilterInvalid:       {http.StatusBadRequest, "Invalid coupon filter"},
+	CodeIssueRequestNotFound:      {http.StatusNotFound, "Issue request not found"},
+	CodeTooManyRequests:           {http.StatusTooManyRequests, "Too many requests"},
+	CodeServiceUnavailable:        {http.StatusServiceUnavailable, "Service unavailable"},
+	CodeTimeout:                   {http.StatusServiceUnavailable, "Timeout"},
+	CodeIdempotencyKeyReused:      {http.StatusUnprocessableEntity, "Idempotency key reused with a different request"},
+	CodeIdempotencyInProgress:     {http.StatusConflict, "Request with this idempotency key in progress"},
+
+	CodeTokenInvalid:      {http.StatusUnauthorized, "Invalid token"},
+	CodeTokenExpired:      {http.StatusUnauthorized, "Token expired"},
+	CodeInsufficientScope: {http.StatusForbidden, "Insufficient scope"},
+	CodeAuthDisabled:      {http.StatusForbidden, "Admin routes are closed while auth is disabled"},
+
+	CodeWaitingRoomNotEnabled:   {http.StatusNotFound, "Coupon policy has no waiting room"},
+	CodeWaitingRoomNotAdmitted:  {http.StatusForbidden, "Not admitted by the waiting room"},
+	CodeWaitingRoomTokenInvalid: {http.StatusForbidden, "Invalid waiting room token"},
+	CodeWaitingRoomTokenExpired: {http.StatusForbidden, "Waiting room token expired"},
+}
+
+// sentinels maps errors to codes, checked in order with errors.Is so wrapped errors keep their code.
+var sentinels = []struct {
+	err  error
+	code Code
+}{
+	{coupon.ErrCouponPolicyNotFound, CodeCouponPolicyNotFound},
+	{coupon.ErrCouponPolicyNotActive, CodeCouponPolicyNotActive},
+	{coupon.ErrCouponPolicyExpired, CodeCouponPolicyExpired},
+	{coupon.ErrCouponPolicyPaused, CodeCouponPolicyPaused},
+	{coupon.ErrCouponPolicyRetired, CodeCouponPolicyRetired},
+	{coupon.ErrCouponPolicyPoolOnly, CodeCouponPolicyPoolOnly},
+	{coupon.ErrCouponPolicyInvalid, CodeCouponPolicyInvalid},
+	{coupon.ErrCouponPolicyInvalidStatus, CodeCouponPolicyInvalidStatus},
+	{coupon.ErrCouponPolicyAlreadyExists, CodeCouponPolicyAlreadyExists},
+	{coupon.ErrCouponPolicyQuantityExceed, CodeCouponQuantityExhausted},
+	{coupon.ErrCouponQuantityRaceCondition, CodeCouponQuantityRace},
+	{coupon.ErrCouponUserLimitExceeded, CodeCouponUserLimitExceeded},
+	{coupon.ErrCouponUserAlreadyClaimed, CodeCouponUserAlreadyClaimed},
+	{coupon.ErrCouponNotFound, CodeCouponNotFound},
+	{coupon.ErrCouponNotOwner, CodeCouponNotOwner},
+	{coupon.ErrCouponConflict, CodeCouponConflict},
+	{coupon.ErrCouponAlreadyUsed, CodeCouponAlreadyUsed},
+	{coupon.ErrCouponNotUsed, CodeCouponNotUsed},
+	{coupon.ErrCouponCanceled, CodeCouponCanceled},
+	{coupon.ErrCouponRevoked, CodeCouponRevoked},
+	{coupon.ErrCouponExpired, CodeCouponExpired},
+	{coupon.ErrCouponPending, CodeCouponPending},
+	{coupon.ErrCouponReserved, CodeCouponReserved},
+	{coupon.ErrCouponNotReserved, CodeCouponNotReserved},
+	{coupon.ErrCouponReservationExpired, CodeCouponReservationExpired},
+	{coupon.ErrCouponReservationTTLInvalid, CodeCouponReservationTTL},
+	{coupon.ErrCouponInvalidForOrder, CodeCouponInvalidForOrder},
+	{coupon.ErrCouponInvalidForProduct, CodeCouponInvalidForProduct},
+	{coupon.ErrCouponOrderAmountTooLow, CodeCouponOrderAmountTooLow},
+	{coupon.ErrCouponCodeInvalid, CodeCouponCodeInvalid},
+	{coupon.ErrCouponCodeConflict, CodeCouponCodeConflict},
+	{coupon.ErrCouponCursorInvalid, CodeCouponCursorInvalid},
+	{coupon.ErrCouponFilterInvalid, CodeCouponFilterInvalid},
+	{coupon.ErrIssueRequestNotFound, CodeIssueRequestNotFound},
+	{coupon.ErrCouponTooManyRequests, CodeTooManyRequests},
+	{coupon.ErrDatabaseUnavailable, CodeServiceUnavailable},
+	{coupon.ErrTimeout, CodeTimeout},
+	{context.DeadlineExceeded, CodeTimeout},
+	{coupon.ErrCouponInternal, CodeInternal},
+	{coupon.ErrCouponCounted, CodeInternal},
+	{coupon.ErrCouponCreated, CodeInternal},
+	{coupon.ErrTransactionFailed, CodeInternal},
+	{coupon.ErrUnknown, CodeInternal},
+
+	{auth.ErrTokenMissing, CodeUnauthenticated},
+	{auth.ErrTokenExpired, CodeTokenExpired},
+	{auth.ErrTokenInvalid, CodeTokenInvalid},
+	{auth.ErrTokenKeyNotFound, CodeTokenInvalid},
+	{auth.ErrScopeMissing, CodeInsufficientScope},
+	{auth.ErrAuthDisabled, CodeAuthDisabled},
+
+	{admission.ErrNotEnabled, CodeWaitingRoomNotEnabled},
+	{admission.ErrTokenInvalid, CodeWaitingRoomTokenInvalid},
+	{admission.ErrTokenExpired, CodeWaitingRoomTokenExpired},
+}
+
+// CodeOf returns the code of the first sentinel err wraps, INTERNAL_ERROR if none.
+func CodeOf(err error) Code {
+	for _, s := range sentinels {
+		if errors.Is(err, s.err) {
+			return s.code
+		}
+	}
+	return CodeInternal
+}
+
+func isKnown(err error) bool {
+	for _, s := range sentinels {
+		if errors.Is(err, s.err) {
+			return true
+		}
+	}
+	return false
+}
+
+func lookup(code Code) definition {
+	if d, ok := definitions[code]; ok {
+		return d
+	}
+	return definitions[CodeInternal]
+}
@@ -0,0 +1,105 @@
+package problem
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	MIMEApplicationProblemJSON = "application/problem+json"
+
+	// TypePrefix is prefixed to the lower-case, dash-separated code to build the problem type URI
+	TypePrefix = "urn:gocoupon:problem:"
+)
+
+// Problem is an RFC 7807 problem details body. Code is the stable, machine-readable error,
+// the same code always comes with the same status. Extensions are merged into the top-level object.
+type Problem struct {
+	Type       string         `json:"type"`
+	Title      string         `json:"title"`
+	Status     int            `json:"status"`
+	Detail     string         `json:"detail,omitempty"`
+	Instance   string         `json:"instance,omitempty"`
+	Code       string         `json:"code"`
+	TraceID    string         `json:"trace_id,omitempty"`
+	Extensions map[string]any `json:"-"`
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type alias Problem
+	body, err := json.Marshal(alias(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return body, err
+	}
+
+	merged := make(map[string]any, len(p.Extensions)+8)
+	for k, v := range p.Extensions {
+		merged[k] = v
+	}
+	// Standard members win over extensions with the same name
+	var members map[string]any
+	if err := json.Unmarshal(body, &members); err != nil {
+		return nil, err
+	}
+	for k, v := range members {
+		merged[k] = v
+	}
+	return json.Marshal(merged)
+}
+
+// New builds the problem for code, filling type, title and status from the catalog.
+func New(code Code, detail string) *Problem {
+	definition := lookup(code)
+	return &Problem{
+		Type:   TypePrefix + strings.ReplaceAll(strings.ToLower(string(code)), "_", "-"),
+		Title:  definition.title,
+		Status: definition.status,
+		Detail: detail,
+		Code:   string(code),
+	}
+}
+
+// FromError maps err to its problem, unknown errors become INTERNAL_ERROR without leaking their message.
+func FromError(err error) *Problem {
+	code := CodeOf(err)
+	if code == CodeInternal && err != nil && !isKnown(err) {
+		return New(code, "")
+	}
+	detail := ""
+	if err != nil {
+		detail = err.Error()
+	}
+	return New(code, detail)
+}
+
+// Write sends p as application/problem+json, stamped with the request path and trace ID.
+func Write(c echo.Context, p *Problem) error {
+	p.Instance = c.Request().URL.Path
+	if spanContext := trace.SpanContextFromContext(c.Request().Context()); spanContext.HasTraceID() {
+		p.TraceID = spanContext.TraceID().String()
+	}
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return c.Blob(p.Status, MIMEApplicationProblemJSON, body)
+}
+
+// Error writes the problem for err.
+func Error(c echo.Context, err error) error {
+	return Write(c, FromError(err))
+}
+
+// BadRequest writes an INVALID_REQUEST problem for a request the handler could not read.
+func BadRequest(c echo.Context, detail string) error {
+	return Write(c, New(CodeInvalidRequest, detail))
+}
+
+// Unauthorized writes an UNAUTHENTICATED problem for a request without a user.
+func Unauthorized(c echo.Context, detail string) error {
+	return Write(c, New(CodeUnauthenticated, detail))
+}
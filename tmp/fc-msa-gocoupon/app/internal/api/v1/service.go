@@ -2,20 +2,25 @@ package v1
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/couponcode"
 	"example.com/coupon-service/internal/instrument/logging"
 	"example.com/coupon-service/internal/instrument/metrics"
 	"example.com/coupon-service/internal/instrument/tracing"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
 
 type IService interface {
 	IssueCoupon(ctx context.Context, policyCode string, userID string) (*coupon.Coupon, error)
-	UseCoupon(ctx context.Context, couponCode string, userID string, orderID string) (*coupon.Coupon, error)
+	UseCoupon(ctx context.Context, couponCode string, userID string, order coupon.Order) (*coupon.Coupon, error)
+	QuoteCoupon(ctx context.Context, couponCode string, userID string, order coupon.Order) (*coupon.CouponQuote, error)
 	CancelCoupon(ctx context.Context, couponCode string, userID string) (*coupon.Coupon, error)
 	FindCouponByCode(ctx context.Context, couponCode string, userID string) (*coupon.Coupon, error)
 }
@@ -30,6 +35,20 @@ func NewService(repo IRepository) IService {
 	}
 }
 
+// parseCode normalizes a coupon code sent by the client, rejecting a malformed one or a typo
+// caught by its check character as ErrCouponCodeInvalid.
+func (s *service) parseCode(ctx context.Context, couponCode string) (string, error) {
+	log := logging.GetLoggerFromContext(ctx)
+
+	normalized, err := couponcode.Parse(couponCode)
+	if err != nil {
+		err = fmt.Errorf("%w, %v", coupon.ErrCouponCodeInvalid, err)
+		log.Warn("invalid coupon code", zap.String("coupon_code", couponCode), zap.Error(err))
+		return "", err
+	}
+	return normalized, nil
+}
+
 // Problem Current Code:
 // When handler receives concurrent requests (e.g., 100 requests at the same time)
 // Got race condition:
@@ -56,10 +75,8 @@ func NewService(repo IRepository) IService {
 //   - Quota enforcement inaccurate due to read-before-insert (more coupons than allowed)
 //   - Transaction failures / partial writes leading to inconsistent state
 //   - Database timeout or high latency under load
-//   - User eligibility check not implemented (users might get more coupons than allowed)
 //   - Policy validity edge cases (coupon issued outside valid period if request timing is tight)
 //   - Logging overhead slowing down request handling under high concurrency
-//   - Multiple requests for same user could bypass intended per-user limits
 //   - No retry or backoff on DB conflicts or transient errors
 //   - Potential deadlocks if DB row-level locking implemented incorrectly
 func (s *service) IssueCoupon(ctx context.Context, policyCode string, userID string) (*coupon.Coupon, error) {
@@ -81,10 +98,17 @@ func (s *service) IssueCoupon(ctx context.Context, policyCode string, userID str
 		return nil, coupon.ErrCouponPolicyNotFound
 	}
 
-	// Check Valid Period
-	if err := policy.IsValidPeriod(); err != nil {
+	// Check Policy Status and Valid Period
+	if err := policy.IsIssuable(); err != nil {
 		span.RecordError(err)
-		log.Warn("coupon policy not valid period", zap.String("policy_code", policyCode), zap.Error(err))
+		log.Warn("coupon policy not issuable", zap.String("policy_code", policyCode), zap.Error(err))
+		return nil, err
+	}
+
+	// Check Issuance Mode, POOL policies are issued from their pool by v5 only
+	if err := policy.CheckOnDemand(); err != nil {
+		span.RecordError(err)
+		log.Warn("coupon policy issues from a pool", zap.String("policy_code", policyCode), zap.Error(err))
 		return nil, err
 	}
 
@@ -103,37 +127,71 @@ func (s *service) IssueCoupon(ctx context.Context, policyCode string, userID str
 		return nil, err
 	}
 
-	// TODO: Check User Eligibility
-	// TODO: Check Order / Product Requirements (optional)
+	// Claim and Create in One Transaction, a failed insert rolls the user's claim back
+	var createdCoupon *coupon.Coupon
+	err = s.repo.WithTx(ctx, func(tx pgx.Tx) error {
+		// Check User Eligibility
+		if err := s.repo.ClaimCouponPolicyForUserTx(ctx, tx, policy.ID, userID, policy.MaxPerUser); err != nil {
+			span.RecordError(err)
+			if errors.Is(err, coupon.ErrCouponUserLimitExceeded) {
+				log.Warn("user claim limit reached", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
+				return policy.UserLimitError()
+			}
+			log.Error("failed to claim coupon policy for user", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
+			return coupon.ErrCouponInternal
+		}
+
+		// TODO: Check Order / Product Requirements (optional)
+
+		// Create New Coupon, retrying with a fresh code if it collides with an issued one
+		newCoupon := &coupon.Coupon{
+			ID:             uuid.New().String(),
+			Code:           policy.NewCouponCode(),
+			Status:         coupon.CouponStatusAvailable,
+			UsedAt:         nil,
+			UserID:         userID,
+			OrderID:        nil,
+			CouponPolicyID: policy.ID,
+			ExpiresAt:      policy.CouponExpiresAt(time.Now()),
+		}
+		event := coupon.NewCouponEvent(coupon.CouponEventTypeIssued, "", userID, nil, tracing.TraceID(ctx))
+		created, err := s.repo.CreateCouponTx(ctx, tx, newCoupon, event)
+		for attempt := 1; errors.Is(err, coupon.ErrCouponCodeConflict) && attempt < couponcode.MaxAttempts; attempt++ {
+			newCoupon.Code = policy.NewCouponCode()
+			created, err = s.repo.CreateCouponTx(ctx, tx, newCoupon, event)
+		}
+		if err != nil {
+			span.RecordError(err)
+			log.Error("failed to issue coupon not created", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
+			return coupon.ErrCouponInternal
+		}
+
+		createdCoupon = created
+		return nil
+	})
 
-	// Create New Coupon
-	newCoupon := &coupon.Coupon{
-		ID:             uuid.New().String(),
-		Code:           uuid.New().String(),
-		Status:         coupon.CouponStatusAvailable,
-		UsedAt:         nil,
-		UserID:         userID,
-		OrderID:        nil,
-		CouponPolicyID: policy.ID,
-	}
-	newCoupon, err = s.repo.CreateCoupon(ctx, newCoupon)
 	if err != nil {
-		span.RecordError(err)
-		log.Error("failed to issue coupon not created", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
-		return nil, coupon.ErrCouponInternal
+		return nil, err
 	}
 
 	// Return New Coupon
-	log.Info("issue coupon successfully", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.String("coupon_code", newCoupon.Code))
-	return newCoupon, nil
+	log.Info("issue coupon successfully", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.String("coupon_code", createdCoupon.Code))
+	return createdCoupon, nil
 }
 
-func (s *service) UseCoupon(ctx context.Context, couponCode string, userID string, orderID string) (*coupon.Coupon, error) {
+func (s *service) UseCoupon(ctx context.Context, couponCode string, userID string, order coupon.Order) (*coupon.Coupon, error) {
 	ctx, span := tracing.StartSpan(ctx, "V1.Service.UseCoupon")
 	defer span.End()
 
 	log := logging.GetLoggerFromContext(ctx)
 
+	// Check Coupon Code Format
+	couponCode, err := s.parseCode(ctx, couponCode)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
 	// Retrieve Coupon Policy
 	c, err := s.repo.FindCouponByCode(ctx, couponCode)
 	if err != nil || c == nil {
@@ -150,34 +208,130 @@ func (s *service) UseCoupon(ctx context.Context, couponCode string, userID strin
 		return nil, err
 	}
 
-	// TODO: Retrieve Coupon Policy
-	// TODO: Check Policy Validity
-
 	// Check Coupon Status
-	if err := c.Use(orderID); err != nil {
+	if err := c.CheckUsable(); err != nil {
+		span.RecordError(err)
+		log.Warn("failed to use coupon not match status", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("order_id", order.ID), zap.Error(err))
+		return nil, err
+	}
+
+	// Retrieve Coupon Policy
+	policy, err := s.repo.FindCouponPolicyByID(ctx, c.CouponPolicyID)
+	if err != nil || policy == nil {
+		span.RecordError(err)
+		log.Warn("failed to get coupon policy not found", zap.String("coupon_code", couponCode), zap.String("policy_id", c.CouponPolicyID), zap.Error(err))
+		return nil, coupon.ErrCouponPolicyNotFound
+	}
+
+	// Calculate Discount
+	discount, err := policy.CalculateDiscount(order)
+	if err != nil {
+		span.RecordError(err)
+		log.Warn("failed to use coupon order not eligible", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("order_id", order.ID), zap.Error(err))
+		return nil, err
+	}
+
+	// Use Coupon
+	previousStatus := c.Status
+	if err := c.Use(order, discount); err != nil {
 		span.RecordError(err)
-		log.Warn("failed to use coupon not match status", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("order_id", orderID), zap.Error(err))
+		log.Warn("failed to use coupon not match status", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("order_id", order.ID), zap.Error(err))
 		return nil, err
 	}
 
 	// Update Coupon
-	updatedCoupon, err := s.repo.UpdateCoupon(ctx, c)
+	event := coupon.NewCouponEvent(coupon.CouponEventTypeUsed, previousStatus, userID, c.OrderID, tracing.TraceID(ctx))
+	updatedCoupon, err := s.repo.UpdateCoupon(ctx, c, event)
 	if err != nil {
 		span.RecordError(err)
+		if errors.Is(err, coupon.ErrCouponConflict) {
+			log.Warn("failed to update coupon changed concurrently", zap.String("coupon_code", couponCode), zap.Error(err))
+			return nil, err
+		}
 		log.Error("failed to update coupon", zap.String("coupon_code", couponCode), zap.Error(err))
 		return nil, coupon.ErrCouponInternal
 	}
 
-	log.Info("coupon used successfully", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("order_id", orderID))
+	log.Info("coupon used successfully", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("order_id", order.ID), zap.Int("discount_amount", discount))
 	return updatedCoupon, nil
 }
 
+// QuoteCoupon returns the discount the coupon would give on the order without using it.
+func (s *service) QuoteCoupon(ctx context.Context, couponCode string, userID string, order coupon.Order) (*coupon.CouponQuote, error) {
+	ctx, span := tracing.StartSpan(ctx, "V1.Service.QuoteCoupon")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	// Check Coupon Code Format
+	couponCode, err := s.parseCode(ctx, couponCode)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	// Retrieve Coupon
+	c, err := s.repo.FindCouponByCode(ctx, couponCode)
+	if err != nil || c == nil {
+		span.RecordError(err)
+		log.Warn("failed to get coupon by code", zap.String("coupon_code", couponCode), zap.Error(err))
+		return nil, coupon.ErrCouponNotFound
+	}
+
+	// Check Coupon Owner
+	if c.UserID != userID {
+		err := coupon.ErrCouponNotOwner
+		span.RecordError(err)
+		log.Warn("failed to quote coupon not owner", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	// Check Coupon Status
+	if err := c.CheckUsable(); err != nil {
+		span.RecordError(err)
+		log.Warn("failed to quote coupon not match status", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	// Retrieve Coupon Policy
+	policy, err := s.repo.FindCouponPolicyByID(ctx, c.CouponPolicyID)
+	if err != nil || policy == nil {
+		span.RecordError(err)
+		log.Warn("failed to get coupon policy not found", zap.String("coupon_code", couponCode), zap.String("policy_id", c.CouponPolicyID), zap.Error(err))
+		return nil, coupon.ErrCouponPolicyNotFound
+	}
+
+	// Calculate Discount
+	discount, err := policy.CalculateDiscount(order)
+	if err != nil {
+		span.RecordError(err)
+		log.Warn("failed to quote coupon order not eligible", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	amount := order.Total()
+	return &coupon.CouponQuote{
+		CouponCode:     c.Code,
+		PolicyCode:     policy.Code,
+		OrderAmount:    amount,
+		DiscountAmount: discount,
+		FinalAmount:    amount - discount,
+	}, nil
+}
+
 func (s *service) CancelCoupon(ctx context.Context, couponCode string, userID string) (*coupon.Coupon, error) {
 	ctx, span := tracing.StartSpan(ctx, "V1.Service.CancelCoupon")
 	defer span.End()
 
 	log := logging.GetLoggerFromContext(ctx)
 
+	// Check Coupon Code Format
+	couponCode, err := s.parseCode(ctx, couponCode)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
 	// Retrieve Coupon Policy
 	c, err := s.repo.FindCouponByCode(ctx, couponCode)
 	if err != nil || c == nil {
@@ -194,17 +348,31 @@ func (s *service) CancelCoupon(ctx context.Context, couponCode string, userID st
 		return nil, err
 	}
 
-	// Check Coupon Status
-	if err := c.Cancel(); err != nil {
+	// Retrieve Coupon Policy
+	policy, err := s.repo.FindCouponPolicyByID(ctx, c.CouponPolicyID)
+	if err != nil || policy == nil {
+		span.RecordError(err)
+		log.Error("failed to get coupon policy by id", zap.String("coupon_code", couponCode), zap.String("policy_id", c.CouponPolicyID), zap.Error(err))
+		return nil, coupon.ErrCouponInternal
+	}
+
+	// Check Coupon Status, cancel clears the order so the event keeps it
+	previousStatus, previousOrderID := c.Status, c.OrderID
+	if err := c.CancelWith(policy.CancelMode); err != nil {
 		span.RecordError(err)
 		log.Warn("failed to cancel coupon not match status", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.Error(err))
 		return nil, err
 	}
 
 	// Update Coupon
-	updatedCoupon, err := s.repo.UpdateCoupon(ctx, c)
+	event := coupon.NewCouponEvent(coupon.CouponEventTypeCanceled, previousStatus, userID, previousOrderID, tracing.TraceID(ctx))
+	updatedCoupon, err := s.repo.UpdateCoupon(ctx, c, event)
 	if err != nil {
 		span.RecordError(err)
+		if errors.Is(err, coupon.ErrCouponConflict) {
+			log.Warn("failed to update coupon changed concurrently", zap.String("coupon_code", couponCode), zap.Error(err))
+			return nil, err
+		}
 		log.Error("failed to update coupon", zap.String("coupon_code", couponCode), zap.Error(err))
 		return nil, coupon.ErrCouponInternal
 	}
@@ -219,6 +387,13 @@ func (s *service) FindCouponByCode(ctx context.Context, couponCode string, userI
 
 	log := logging.GetLoggerFromContext(ctx)
 
+	// Check Coupon Code Format
+	couponCode, err := s.parseCode(ctx, couponCode)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
 	// Retrieve Coupon Policy
 	c, err := s.repo.FindCouponByCode(ctx, couponCode)
 	if err != nil || c == nil {
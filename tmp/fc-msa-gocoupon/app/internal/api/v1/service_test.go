@@ -0,0 +1,67 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/coupontest"
+	"example.com/coupon-service/internal/instrument/logging"
+	"go.uber.org/zap"
+)
+
+var _ IRepository = (*coupontest.Store)(nil)
+
+// v1 counts the issued coupons and inserts the new one in separate statements without a lock, so
+// concurrent requests all pass the count and issue past the quota. That overshoot is the known
+// failure of v1 and is expected whenever the users can claim more than the quota. The per-user
+// limit still holds, coupon_user_claims enforces it with a CHECK.
+func TestIssueCouponConcurrent(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), zap.NewNop())
+
+	for _, s := range coupontest.Scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			store, policy := s.NewStore()
+			svc := NewService(store)
+
+			issue := func(ctx context.Context, userID string) (*coupon.Coupon, error) {
+				return svc.IssueCoupon(ctx, policy.Code, userID)
+			}
+
+			// POOL policies are issued by v5 only
+			if s.Pool {
+				if err := s.Reject(ctx, issue, coupon.ErrCouponPolicyPoolOnly); err != nil {
+					t.Error(err)
+				}
+				if issued := store.IssuedPerUser(policy.ID); len(issued) > 0 {
+					t.Errorf("issued pool coupons to %d users, want none from v1", len(issued))
+				}
+				return
+			}
+
+			succeeded, unexpected := s.Run(ctx, issue)
+			for _, err := range unexpected {
+				t.Error(err)
+			}
+
+			var overshoot error
+			for _, err := range s.Check(succeeded, store.IssuedPerUser(policy.ID)) {
+				if errors.Is(err, coupontest.ErrQuotaExceeded) {
+					overshoot = err
+					continue
+				}
+				t.Error(err)
+			}
+
+			switch {
+			case overshoot != nil && s.Oversubscribed():
+				t.Logf("known v1 overshoot: %v", overshoot)
+			case overshoot != nil:
+				t.Error(overshoot)
+			case s.Oversubscribed():
+				t.Error("v1 stayed within the quota, if the count and insert race was fixed update this test")
+			}
+		})
+	}
+}
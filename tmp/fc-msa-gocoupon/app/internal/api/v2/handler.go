@@ -4,6 +4,7 @@ import (
 	"errors"
 
 	"example.com/coupon-service/internal/api/middleware"
+	"example.com/coupon-service/internal/api/problem"
 	"example.com/coupon-service/internal/coupon"
 	"example.com/coupon-service/internal/instrument/logging"
 	"example.com/coupon-service/internal/instrument/tracing"
@@ -26,13 +27,21 @@ func NewHandler(service IService) *Handler {
 // @Description  Issues a coupon under a specific policy code for the authenticated user
 // @Tags         coupons
 // @Accept       json
-// @Produce      json
+// @Produce      json,application/problem+json
 // @Param        X-USER-ID  header  string  true  "User ID"
+// @Param        Idempotency-Key  header  string  false  "Idempotency key, replays the first response on retry"
 // @Param        payload    body    coupon.IssueCouponRequest  true  "Issue coupon payload"
 // @Success      200  {object}  coupon.Coupon
-// @Failure      400  {object}  map[string]string
-// @Failure      401  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      410  {object}  problem.Problem
+// @Failure      422  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
 // @Router       /coupons/issue [post]
 func (h *Handler) IssueCoupon(c echo.Context) error {
 	ctx, span := tracing.StartSpan(c.Request().Context(), "V2.Handler.IssueCoupon")
@@ -44,7 +53,7 @@ func (h *Handler) IssueCoupon(c echo.Context) error {
 	if err := c.Bind(&payload); err != nil {
 		span.RecordError(err)
 		log.Warn("invalid body request", zap.Error(err))
-		return c.JSON(400, map[string]string{"error": err.Error()})
+		return problem.BadRequest(c, err.Error())
 	}
 
 	userID, ok := ctx.Value(middleware.UserIDKey).(string)
@@ -52,7 +61,7 @@ func (h *Handler) IssueCoupon(c echo.Context) error {
 		err := errors.New("invalid x-user-id header")
 		span.RecordError(err)
 		log.Warn("invalid x-user-id header")
-		return c.JSON(401, map[string]string{"error": err.Error()})
+		return problem.Unauthorized(c, err.Error())
 	}
 
 	result, err := h.service.IssueCoupon(ctx, payload.PolicyCode, userID)
@@ -63,7 +72,7 @@ func (h *Handler) IssueCoupon(c echo.Context) error {
 			zap.String("user_id", userID),
 			zap.Error(err),
 		)
-		return c.JSON(500, map[string]string{"error": err.Error()})
+		return problem.Error(c, err)
 	}
 
 	log.Info("issue coupon successfully",
@@ -79,13 +88,21 @@ func (h *Handler) IssueCoupon(c echo.Context) error {
 // @Description  Marks a coupon as used for the given order by the authenticated user
 // @Tags         coupons
 // @Accept       json
-// @Produce      json
+// @Produce      json,application/problem+json
 // @Param        X-USER-ID  header  string  true  "User ID"
+// @Param        Idempotency-Key  header  string  false  "Idempotency key, replays the first response on retry"
 // @Param        payload    body    coupon.UseCouponRequest  true  "Use coupon payload"
 // @Success      200  {object}  coupon.Coupon
-// @Failure      400  {object}  map[string]string
-// @Failure      401  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      410  {object}  problem.Problem
+// @Failure      422  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
 // @Router       /coupons/use [post]
 func (h *Handler) UseCoupon(c echo.Context) error {
 	ctx, span := tracing.StartSpan(c.Request().Context(), "V2.Handler.IssueCoupon")
@@ -97,7 +114,7 @@ func (h *Handler) UseCoupon(c echo.Context) error {
 	if err := c.Bind(&payload); err != nil {
 		span.RecordError(err)
 		log.Warn("invalid body request", zap.Error(err))
-		return c.JSON(400, map[string]string{"error": err.Error()})
+		return problem.BadRequest(c, err.Error())
 	}
 
 	userID, ok := ctx.Value(middleware.UserIDKey).(string)
@@ -105,32 +122,97 @@ func (h *Handler) UseCoupon(c echo.Context) error {
 		err := errors.New("invalid x-user-id header")
 		span.RecordError(err)
 		log.Warn("invalid x-user-id header")
-		return c.JSON(401, map[string]string{"error": "invalid user id"})
+		return problem.Unauthorized(c, "invalid user id")
 	}
 
-	result, err := h.service.UseCoupon(ctx, payload.CouponCode, userID, payload.OrderID)
+	result, err := h.service.UseCoupon(ctx, payload.CouponCode, userID, coupon.Order{
+		ID:     payload.OrderID,
+		Amount: payload.OrderAmount,
+		Items:  payload.Items,
+	})
 	if err != nil || result == nil {
 		span.RecordError(err)
 		log.Error("failed to use coupon", zap.String("coupon_code", payload.CouponCode), zap.String("user_id", userID), zap.Error(err))
-		return c.JSON(500, map[string]string{"error": err.Error()})
+		return problem.Error(c, err)
 	}
 
 	log.Info("use coupon successfully", zap.String("coupon_code", payload.CouponCode), zap.String("user_id", userID), zap.String("coupon_code", result.Code))
 	return c.JSON(200, result)
 }
 
+// QuoteCoupon godoc
+// @Summary      Quote a coupon discount for an order
+// @Description  Returns the discount a coupon would give on the order without using the coupon
+// @Tags         coupons
+// @Accept       json
+// @Produce      json,application/problem+json
+// @Param        X-USER-ID  header  string  true  "User ID"
+// @Param        payload    body    coupon.QuoteCouponRequest  true  "Quote coupon payload"
+// @Success      200  {object}  coupon.CouponQuote
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      410  {object}  problem.Problem
+// @Failure      422  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /coupons/quote [post]
+func (h *Handler) QuoteCoupon(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "V2.Handler.QuoteCoupon")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	var payload coupon.QuoteCouponRequest
+	if err := c.Bind(&payload); err != nil {
+		span.RecordError(err)
+		log.Warn("invalid body request", zap.Error(err))
+		return problem.BadRequest(c, err.Error())
+	}
+
+	userID, ok := ctx.Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		err := errors.New("invalid x-user-id header")
+		span.RecordError(err)
+		log.Warn("invalid x-user-id header")
+		return problem.Unauthorized(c, "invalid user id")
+	}
+
+	result, err := h.service.QuoteCoupon(ctx, payload.CouponCode, userID, coupon.Order{
+		Amount: payload.OrderAmount,
+		Items:  payload.Items,
+	})
+	if err != nil || result == nil {
+		span.RecordError(err)
+		log.Error("failed to quote coupon", zap.String("coupon_code", payload.CouponCode), zap.String("user_id", userID), zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	log.Info("quote coupon successfully", zap.String("coupon_code", payload.CouponCode), zap.String("user_id", userID), zap.Int("discount_amount", result.DiscountAmount))
+	return c.JSON(200, result)
+}
+
 // CancelCoupon godoc
 // @Summary      Cancel a coupon
-// @Description  Cancels a coupon for the authenticated user
+// @Description  Cancels a used coupon for the authenticated user as its policy cancel_mode says: VOID cancels it, RESTORE makes it AVAILABLE again, RELEASE cancels it and gives its unit back to the quota
 // @Tags         coupons
 // @Accept       json
-// @Produce      json
+// @Produce      json,application/problem+json
 // @Param        X-USER-ID  header  string  true  "User ID"
+// @Param        Idempotency-Key  header  string  false  "Idempotency key, replays the first response on retry"
 // @Param        payload    body    coupon.CancelCouponRequest  true  "Cancel coupon payload"
 // @Success      200  {object}  coupon.Coupon
-// @Failure      400  {object}  map[string]string
-// @Failure      401  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
 // @Router       /coupons/cancel [post]
 func (h *Handler) CancelCoupon(c echo.Context) error {
 	ctx, span := tracing.StartSpan(c.Request().Context(), "V2.Handler.CancelCoupon")
@@ -142,7 +224,7 @@ func (h *Handler) CancelCoupon(c echo.Context) error {
 	if err := c.Bind(&payload); err != nil {
 		span.RecordError(err)
 		log.Warn("invalid body request", zap.Error(err))
-		return c.JSON(400, map[string]string{"error": err.Error()})
+		return problem.BadRequest(c, err.Error())
 	}
 
 	userID, ok := ctx.Value(middleware.UserIDKey).(string)
@@ -150,14 +232,14 @@ func (h *Handler) CancelCoupon(c echo.Context) error {
 		err := errors.New("invalid x-user-id header")
 		span.RecordError(err)
 		log.Warn("invalid x-user-id header")
-		return c.JSON(401, map[string]string{"error": "invalid user id"})
+		return problem.Unauthorized(c, "invalid user id")
 	}
 
 	result, err := h.service.CancelCoupon(ctx, payload.CouponCode, userID)
 	if err != nil || result == nil {
 		span.RecordError(err)
 		log.Error("failed to cancel coupon", zap.String("coupon_code", payload.CouponCode), zap.String("user_id", userID), zap.Error(err))
-		return c.JSON(500, map[string]string{"error": err.Error()})
+		return problem.Error(c, err)
 	}
 
 	log.Info("cancel coupon successfully", zap.String("coupon_code", payload.CouponCode), zap.String("user_id", userID), zap.String("coupon_code", result.Code))
@@ -169,13 +251,18 @@ func (h *Handler) CancelCoupon(c echo.Context) error {
 // @Description  Retrieves coupon information for the authenticated user
 // @Tags         coupons
 // @Accept       json
-// @Produce      json
+// @Produce      json,application/problem+json
 // @Param        X-USER-ID     header  string  true  "User ID"
 // @Param        coupon_code   path    string  true  "Coupon Code"
 // @Success      200  {object}  coupon.Coupon
-// @Failure      400  {object}  map[string]string
-// @Failure      401  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      422  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
 // @Router       /coupons/{coupon_code} [get]
 func (h *Handler) FindCouponByCode(c echo.Context) error {
 	ctx, span := tracing.StartSpan(c.Request().Context(), "V2.Handler.FindCouponByCode")
@@ -188,7 +275,7 @@ func (h *Handler) FindCouponByCode(c echo.Context) error {
 		err := errors.New("invalid coupon_code")
 		span.RecordError(err)
 		log.Error("invalid coupon_code")
-		return c.JSON(400, map[string]string{"error": "coupon_code is required"})
+		return problem.BadRequest(c, "coupon_code is required")
 	}
 
 	userID, ok := ctx.Value(middleware.UserIDKey).(string)
@@ -196,14 +283,14 @@ func (h *Handler) FindCouponByCode(c echo.Context) error {
 		err := errors.New("invalid x-user-id header")
 		span.RecordError(err)
 		log.Warn("invalid x-user-id header")
-		return c.JSON(401, map[string]string{"error": "invalid user id"})
+		return problem.Unauthorized(c, "invalid user id")
 	}
 
 	result, err := h.service.FindCouponByCode(ctx, couponCode, userID)
 	if err != nil || result == nil {
 		span.RecordError(err)
 		log.Error("failed to find coupon by code", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.Error(err))
-		return c.JSON(500, map[string]string{"error": err.Error()})
+		return problem.Error(c, err)
 	}
 
 	log.Info("find coupon by code successfully", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("coupon_code", result.Code))
@@ -9,15 +9,17 @@ import (
 	"example.com/coupon-service/internal/instrument/logging"
 	"example.com/coupon-service/internal/instrument/tracing"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"go.uber.org/zap"
 )
 
 type IRepository interface {
 	FindCouponPolicyByCodeForUpdateTx(ctx context.Context, tx pgx.Tx, code string) (*coupon.CouponPolicy, error)
 	CountIssuedCouponsTx(ctx context.Context, tx pgx.Tx, policyID string) (int, error)
-	CreateCouponTx(ctx context.Context, tx pgx.Tx, c *coupon.Coupon) (*coupon.Coupon, error)
+	CreateCouponTx(ctx context.Context, tx pgx.Tx, c *coupon.Coupon, event *coupon.CouponEvent) (*coupon.Coupon, error)
+	ClaimCouponPolicyForUserTx(ctx context.Context, tx pgx.Tx, policyID string, userID string, maxPerUser int) error
 	FindCouponByCode(ctx context.Context, code string) (*coupon.Coupon, error)
-	UpdateCoupon(ctx context.Context, coupon *coupon.Coupon) (*coupon.Coupon, error)
+	UpdateCoupon(ctx context.Context, coupon *coupon.Coupon, event *coupon.CouponEvent) (*coupon.Coupon, error)
 	FindCouponPolicyByID(ctx context.Context, id string) (*coupon.CouponPolicy, error)
 	WithTx(ctx context.Context, fn func(pgx.Tx) error) error
 }
@@ -51,6 +53,18 @@ func (r *repository) FindCouponPolicyByCodeForUpdateTx(ctx context.Context, tx p
 			discount_value,
 			minimum_order_amount,
 			maximum_discount_amount,
+			max_per_user,
+			status,
+			include_product_ids,
+			exclude_product_ids,
+			include_categories,
+			exclude_categories,
+			valid_days,
+			issuance_mode,
+			code_prefix,
+			code_length,
+			waiting_room,
+			cancel_mode,
 			created_at,
 			updated_at
 		FROM coupon_policies
@@ -72,6 +86,18 @@ func (r *repository) FindCouponPolicyByCodeForUpdateTx(ctx context.Context, tx p
 		&policy.DiscountValue,
 		&policy.MinimumOrderAmount,
 		&policy.MaximumDiscountAmount,
+		&policy.MaxPerUser,
+		&policy.Status,
+		&policy.IncludeProductIDs,
+		&policy.ExcludeProductIDs,
+		&policy.IncludeCategories,
+		&policy.ExcludeCategories,
+		&policy.ValidDays,
+		&policy.IssuanceMode,
+		&policy.CodePrefix,
+		&policy.CodeLength,
+		&policy.WaitingRoom,
+		&policy.CancelMode,
 		&policy.CreatedAt,
 		&policy.UpdatedAt,
 	)
@@ -94,7 +120,7 @@ func (r *repository) CountIssuedCouponsTx(ctx context.Context, tx pgx.Tx, policy
 	row := tx.QueryRow(ctx, `
         SELECT COUNT(*)
         FROM coupons
-        WHERE coupon_policy_id = $1
+        WHERE coupon_policy_id = $1 AND status <> 'UNASSIGNED' AND NOT quota_released
     `, policyID)
 
 	var count int
@@ -108,36 +134,69 @@ func (r *repository) CountIssuedCouponsTx(ctx context.Context, tx pgx.Tx, policy
 	return count, nil
 }
 
-func (r *repository) CreateCouponTx(ctx context.Context, tx pgx.Tx, c *coupon.Coupon) (*coupon.Coupon, error) {
+func (r *repository) CreateCouponTx(ctx context.Context, tx pgx.Tx, c *coupon.Coupon, event *coupon.CouponEvent) (*coupon.Coupon, error) {
 	ctx, span := tracing.StartSpan(ctx, "V2.Repository.CreateCouponTx")
 	defer span.End()
 
 	log := logging.GetLoggerFromContext(ctx)
 
 	row := tx.QueryRow(ctx, `
-		INSERT INTO coupons (
-			id,
-			code,
-			status,
-			used_at,
-			user_id,
-			order_id,
-			coupon_policy_id,
-			created_at,
-			updated_at
-		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, NOW(), NOW()
+		WITH written AS (
+			INSERT INTO coupons (
+				id,
+				code,
+				status,
+				used_at,
+				user_id,
+				order_id,
+				coupon_policy_id,
+				expires_at,
+				created_at,
+				updated_at
+			) VALUES (
+				$1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW()
+			)
+			ON CONFLICT (code) DO NOTHING
+			RETURNING
+				id,
+				code,
+				status,
+				used_at,
+				user_id,
+				order_id,
+				order_amount,
+				discount_amount,
+				coupon_policy_id,
+				expires_at,
+				created_at,
+				updated_at
+		), event AS (
+			INSERT INTO coupon_events (
+				coupon_id,
+				type,
+				previous_status,
+				status,
+				actor,
+				order_id,
+				trace_id
+			)
+			SELECT id, $9::coupon_event_type, $10::coupon_status, status, $11::TEXT, $12::TEXT, $13::TEXT
+			FROM written
 		)
-		RETURNING 
+		SELECT
 			id,
 			code,
 			status,
 			used_at,
 			user_id,
 			order_id,
+			order_amount,
+			discount_amount,
 			coupon_policy_id,
+			expires_at,
 			created_at,
 			updated_at
+		FROM written
 	`,
 		c.ID,
 		c.Code,
@@ -146,6 +205,12 @@ func (r *repository) CreateCouponTx(ctx context.Context, tx pgx.Tx, c *coupon.Co
 		c.UserID,
 		c.OrderID,
 		c.CouponPolicyID,
+		c.ExpiresAt.UTC(),
+		event.Type,
+		event.PreviousStatus,
+		event.Actor,
+		event.OrderID,
+		event.TraceID,
 	)
 
 	var result coupon.Coupon
@@ -156,12 +221,19 @@ func (r *repository) CreateCouponTx(ctx context.Context, tx pgx.Tx, c *coupon.Co
 		&result.UsedAt,
 		&result.UserID,
 		&result.OrderID,
+		&result.OrderAmount,
+		&result.DiscountAmount,
 		&result.CouponPolicyID,
+		&result.ExpiresAt,
 		&result.CreatedAt,
 		&result.UpdatedAt,
 	)
 	if err != nil {
 		span.RecordError(err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Warn("coupon code collision", zap.String("coupon_code", c.Code))
+			return nil, coupon.ErrCouponCodeConflict
+		}
 		log.Error("failed to create coupon", zap.Error(err))
 		return nil, errors.New("")
 	}
@@ -184,9 +256,13 @@ func (r *repository) FindCouponByCode(ctx context.Context, code string) (*coupon
 			used_at,
 			user_id,
 			order_id,
+			order_amount,
+			discount_amount,
 			coupon_policy_id,
+			expires_at,
 			created_at,
-			updated_at
+			updated_at,
+			version
 		FROM coupons
 		WHERE code = $1
 		LIMIT 1
@@ -200,9 +276,13 @@ func (r *repository) FindCouponByCode(ctx context.Context, code string) (*coupon
 		&c.UsedAt,
 		&c.UserID,
 		&c.OrderID,
+		&c.OrderAmount,
+		&c.DiscountAmount,
 		&c.CouponPolicyID,
+		&c.ExpiresAt,
 		&c.CreatedAt,
 		&c.UpdatedAt,
+		&c.Version,
 	)
 	if err != nil {
 		span.RecordError(err)
@@ -214,37 +294,87 @@ func (r *repository) FindCouponByCode(ctx context.Context, code string) (*coupon
 	return &c, nil
 }
 
-func (r *repository) UpdateCoupon(ctx context.Context, c *coupon.Coupon) (*coupon.Coupon, error) {
+// UpdateCoupon writes the coupon and its history event in one statement, only if the coupon is
+// still at the status and version it was read with. A concurrent write makes it return ErrCouponConflict.
+func (r *repository) UpdateCoupon(ctx context.Context, c *coupon.Coupon, event *coupon.CouponEvent) (*coupon.Coupon, error) {
 	ctx, span := tracing.StartSpan(ctx, "V2.Repository.UpdateCoupon")
 	defer span.End()
 
 	log := logging.GetLoggerFromContext(ctx)
 
 	row := r.pg.Pool.QueryRow(ctx, `
-		UPDATE coupons
-		SET
-			status = $1,
-			used_at = $2,
-			user_id = $3,
-			order_id = $4,
-			updated_at = NOW()
-		WHERE id = $5
-		RETURNING
+		WITH written AS (
+			UPDATE coupons
+			SET
+				status = $1,
+				used_at = $2,
+				user_id = $3,
+				order_id = $4,
+				order_amount = $5,
+				discount_amount = $6,
+				quota_released = quota_released OR $13,
+				version = version + 1,
+				updated_at = NOW()
+			WHERE id = $7 AND status = $9::coupon_status AND version = $14
+			RETURNING
+				id,
+				code,
+				status,
+				used_at,
+				user_id,
+				order_id,
+				order_amount,
+				discount_amount,
+				quota_released,
+				coupon_policy_id,
+				expires_at,
+				created_at,
+				updated_at,
+				version
+		), event AS (
+			INSERT INTO coupon_events (
+				coupon_id,
+				type,
+				previous_status,
+				status,
+				actor,
+				order_id,
+				trace_id
+			)
+			SELECT id, $8::coupon_event_type, $9::coupon_status, status, $10::TEXT, $11::TEXT, $12::TEXT
+			FROM written
+		)
+		SELECT
 			id,
 			code,
 			status,
 			used_at,
 			user_id,
 			order_id,
+			order_amount,
+			discount_amount,
+			quota_released,
 			coupon_policy_id,
+			expires_at,
 			created_at,
-			updated_at
+			updated_at,
+			version
+		FROM written
 	`,
 		c.Status,
 		c.UsedAt,
 		c.UserID,
 		c.OrderID,
+		c.OrderAmount,
+		c.DiscountAmount,
 		c.ID,
+		event.Type,
+		event.PreviousStatus,
+		event.Actor,
+		event.OrderID,
+		event.TraceID,
+		c.QuotaReleased,
+		c.Version,
 	)
 
 	var result coupon.Coupon
@@ -255,12 +385,21 @@ func (r *repository) UpdateCoupon(ctx context.Context, c *coupon.Coupon) (*coupo
 		&result.UsedAt,
 		&result.UserID,
 		&result.OrderID,
+		&result.OrderAmount,
+		&result.DiscountAmount,
+		&result.QuotaReleased,
 		&result.CouponPolicyID,
+		&result.ExpiresAt,
 		&result.CreatedAt,
 		&result.UpdatedAt,
+		&result.Version,
 	)
 	if err != nil {
 		span.RecordError(err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Warn("coupon changed since it was read", zap.String("coupon_id", c.ID), zap.Int("version", c.Version))
+			return nil, coupon.ErrCouponConflict
+		}
 		log.Error("failed to update coupon", zap.String("coupon_id", c.ID), zap.Error(err))
 		return nil, errors.New("failed to update coupon")
 	}
@@ -288,6 +427,18 @@ func (r *repository) FindCouponPolicyByID(ctx context.Context, id string) (*coup
 			discount_value,
 			minimum_order_amount,
 			maximum_discount_amount,
+			max_per_user,
+			status,
+			include_product_ids,
+			exclude_product_ids,
+			include_categories,
+			exclude_categories,
+			valid_days,
+			issuance_mode,
+			code_prefix,
+			code_length,
+			waiting_room,
+			cancel_mode,
 			created_at,
 			updated_at
 		FROM coupon_policies
@@ -309,6 +460,18 @@ func (r *repository) FindCouponPolicyByID(ctx context.Context, id string) (*coup
 		&policy.DiscountValue,
 		&policy.MinimumOrderAmount,
 		&policy.MaximumDiscountAmount,
+		&policy.MaxPerUser,
+		&policy.Status,
+		&policy.IncludeProductIDs,
+		&policy.ExcludeProductIDs,
+		&policy.IncludeCategories,
+		&policy.ExcludeCategories,
+		&policy.ValidDays,
+		&policy.IssuanceMode,
+		&policy.CodePrefix,
+		&policy.CodeLength,
+		&policy.WaitingRoom,
+		&policy.CancelMode,
 		&policy.CreatedAt,
 		&policy.UpdatedAt,
 	)
@@ -335,3 +498,43 @@ func (r *repository) WithTx(ctx context.Context, fn func(pgx.Tx) error) error {
 
 	return tx.Commit(ctx)
 }
+
+func (r *repository) ClaimCouponPolicyForUserTx(ctx context.Context, tx pgx.Tx, policyID string, userID string, maxPerUser int) error {
+	ctx, span := tracing.StartSpan(ctx, "V2.Repository.ClaimCouponPolicyForUserTx")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO coupon_user_claims (
+			coupon_policy_id,
+			user_id,
+			claimed,
+			max_per_user,
+			created_at,
+			updated_at
+		) VALUES (
+			$1, $2, 1, $3, NOW(), NOW()
+		)
+		ON CONFLICT (coupon_policy_id, user_id) DO UPDATE
+		SET
+			claimed = coupon_user_claims.claimed + 1,
+			max_per_user = EXCLUDED.max_per_user,
+			updated_at = NOW()
+	`, policyID, userID, maxPerUser)
+	if err != nil {
+		span.RecordError(err)
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23514" {
+			log.Warn("user claim limit reached", zap.String("policy_id", policyID), zap.String("user_id", userID), zap.Int("max_per_user", maxPerUser))
+			return coupon.ErrCouponUserLimitExceeded
+		}
+
+		log.Error("failed to claim coupon policy for user", zap.String("policy_id", policyID), zap.String("user_id", userID), zap.Error(err))
+		return err
+	}
+
+	log.Info("claimed coupon policy for user", zap.String("policy_id", policyID), zap.String("user_id", userID))
+	return nil
+}
@@ -2,9 +2,12 @@ package v2
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/couponcode"
 	"example.com/coupon-service/internal/instrument/logging"
 	"example.com/coupon-service/internal/instrument/metrics"
 	"example.com/coupon-service/internal/instrument/tracing"
@@ -16,7 +19,8 @@ import (
 
 type IService interface {
 	IssueCoupon(ctx context.Context, policyCode string, userID string) (*coupon.Coupon, error)
-	UseCoupon(ctx context.Context, couponCode string, userID string, orderID string) (*coupon.Coupon, error)
+	UseCoupon(ctx context.Context, couponCode string, userID string, order coupon.Order) (*coupon.Coupon, error)
+	QuoteCoupon(ctx context.Context, couponCode string, userID string, order coupon.Order) (*coupon.CouponQuote, error)
 	CancelCoupon(ctx context.Context, couponCode string, userID string) (*coupon.Coupon, error)
 	FindCouponByCode(ctx context.Context, couponCode string, userID string) (*coupon.Coupon, error)
 }
@@ -33,6 +37,20 @@ func NewService(
 	}
 }
 
+// parseCode normalizes a coupon code sent by the client, rejecting a malformed one or a typo
+// caught by its check character as ErrCouponCodeInvalid.
+func (s *service) parseCode(ctx context.Context, couponCode string) (string, error) {
+	log := logging.GetLoggerFromContext(ctx)
+
+	normalized, err := couponcode.Parse(couponCode)
+	if err != nil {
+		err = fmt.Errorf("%w, %v", coupon.ErrCouponCodeInvalid, err)
+		log.Warn("invalid coupon code", zap.String("coupon_code", couponCode), zap.Error(err))
+		return "", err
+	}
+	return normalized, nil
+}
+
 // Problem Summary:
 // The IssueCoupon flow historically suffered from race conditions when multiple
 // concurrent requests attempted to issue coupons for the same coupon policy.
@@ -83,8 +101,8 @@ func NewService(
 //   - Must ensure consistent lock ordering everywhere in the codebase.
 //
 // 5. User Eligibility / Abuse:
-//   - No per-user coupon limit enforced (user may issue multiple coupons).
-//   - Missing unique constraint on (user_id, policy_id) for one-per-user rule.
+//   - Per-user limit is enforced by coupon_user_claims, which adds a second
+//     row lock per (policy, user) inside the same transaction.
 //   - No idempotency key (users can double-click and issue two coupons).
 //   - No rate-limiting → user can spam requests.
 //
@@ -144,10 +162,17 @@ func (s *service) IssueCoupon(ctx context.Context, policyCode string, userID str
 			return coupon.ErrCouponPolicyNotFound
 		}
 
-		// Check Valid Period
-		if err := policy.IsValidPeriod(); err != nil {
+		// Check Policy Status and Valid Period
+		if err := policy.IsIssuable(); err != nil {
 			span.RecordError(err)
-			log.Warn("coupon policy not valid period", zap.String("policy_code", policyCode), zap.Error(err))
+			log.Warn("coupon policy not issuable", zap.String("policy_code", policyCode), zap.Error(err))
+			return err
+		}
+
+		// Check Issuance Mode, POOL policies are issued from their pool by v5 only
+		if err := policy.CheckOnDemand(); err != nil {
+			span.RecordError(err)
+			log.Warn("coupon policy issues from a pool", zap.String("policy_code", policyCode), zap.Error(err))
 			return err
 		}
 
@@ -166,28 +191,44 @@ func (s *service) IssueCoupon(ctx context.Context, policyCode string, userID str
 			return err
 		}
 
-		// TODO: Check User Eligibility
+		// Check User Eligibility
+		if err := s.repo.ClaimCouponPolicyForUserTx(ctx, tx, policy.ID, userID, policy.MaxPerUser); err != nil {
+			span.RecordError(err)
+			if errors.Is(err, coupon.ErrCouponUserLimitExceeded) {
+				log.Warn("user claim limit reached", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
+				return policy.UserLimitError()
+			}
+			log.Error("failed to claim coupon policy for user", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
+			return coupon.ErrCouponInternal
+		}
+
 		// TODO: Check Order / Product Requirements (optional)
 
-		// Create New Coupon
+		// Create New Coupon, retrying with a fresh code if it collides with an issued one
 		tempCoupon := &coupon.Coupon{
 			ID:             uuid.New().String(),
-			Code:           uuid.New().String(),
+			Code:           policy.NewCouponCode(),
 			Status:         coupon.CouponStatusAvailable,
 			UsedAt:         nil,
 			UserID:         userID,
 			OrderID:        nil,
 			CouponPolicyID: policy.ID,
+			ExpiresAt:      policy.CouponExpiresAt(time.Now()),
 		}
 
-		tempCoupon, err = s.repo.CreateCouponTx(ctx, tx, tempCoupon)
+		event := coupon.NewCouponEvent(coupon.CouponEventTypeIssued, "", userID, nil, tracing.TraceID(ctx))
+		created, err := s.repo.CreateCouponTx(ctx, tx, tempCoupon, event)
+		for attempt := 1; errors.Is(err, coupon.ErrCouponCodeConflict) && attempt < couponcode.MaxAttempts; attempt++ {
+			tempCoupon.Code = policy.NewCouponCode()
+			created, err = s.repo.CreateCouponTx(ctx, tx, tempCoupon, event)
+		}
 		if err != nil {
 			span.RecordError(err)
 			log.Error("failed to issue coupon not created", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
 			return coupon.ErrCouponInternal
 		}
 
-		createdCoupon = tempCoupon
+		createdCoupon = created
 		return nil
 	})
 
@@ -200,12 +241,19 @@ func (s *service) IssueCoupon(ctx context.Context, policyCode string, userID str
 	return createdCoupon, nil
 }
 
-func (s *service) UseCoupon(ctx context.Context, couponCode string, userID string, orderID string) (*coupon.Coupon, error) {
+func (s *service) UseCoupon(ctx context.Context, couponCode string, userID string, order coupon.Order) (*coupon.Coupon, error) {
 	ctx, span := tracing.StartSpan(ctx, "V2.Service.UseCoupon")
 	defer span.End()
 
 	log := logging.GetLoggerFromContext(ctx)
 
+	// Check Coupon Code Format
+	couponCode, err := s.parseCode(ctx, couponCode)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
 	// Retrieve Coupon Policy
 	c, err := s.repo.FindCouponByCode(ctx, couponCode)
 	if err != nil || c == nil {
@@ -222,34 +270,130 @@ func (s *service) UseCoupon(ctx context.Context, couponCode string, userID strin
 		return nil, err
 	}
 
-	// TODO: Retrieve Coupon Policy
-	// TODO: Check Policy Validity
-
 	// Check Coupon Status
-	if err := c.Use(orderID); err != nil {
+	if err := c.CheckUsable(); err != nil {
+		span.RecordError(err)
+		log.Warn("failed to use coupon not match status", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("order_id", order.ID), zap.Error(err))
+		return nil, err
+	}
+
+	// Retrieve Coupon Policy
+	policy, err := s.repo.FindCouponPolicyByID(ctx, c.CouponPolicyID)
+	if err != nil || policy == nil {
 		span.RecordError(err)
-		log.Warn("failed to use coupon not match status", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("order_id", orderID), zap.Error(err))
+		log.Warn("failed to get coupon policy not found", zap.String("coupon_code", couponCode), zap.String("policy_id", c.CouponPolicyID), zap.Error(err))
+		return nil, coupon.ErrCouponPolicyNotFound
+	}
+
+	// Calculate Discount
+	discount, err := policy.CalculateDiscount(order)
+	if err != nil {
+		span.RecordError(err)
+		log.Warn("failed to use coupon order not eligible", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("order_id", order.ID), zap.Error(err))
+		return nil, err
+	}
+
+	// Use Coupon
+	previousStatus := c.Status
+	if err := c.Use(order, discount); err != nil {
+		span.RecordError(err)
+		log.Warn("failed to use coupon not match status", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("order_id", order.ID), zap.Error(err))
 		return nil, err
 	}
 
 	// Update Coupon
-	updatedCoupon, err := s.repo.UpdateCoupon(ctx, c)
+	event := coupon.NewCouponEvent(coupon.CouponEventTypeUsed, previousStatus, userID, c.OrderID, tracing.TraceID(ctx))
+	updatedCoupon, err := s.repo.UpdateCoupon(ctx, c, event)
 	if err != nil {
 		span.RecordError(err)
+		if errors.Is(err, coupon.ErrCouponConflict) {
+			log.Warn("failed to update coupon changed concurrently", zap.String("coupon_code", couponCode), zap.Error(err))
+			return nil, err
+		}
 		log.Error("failed to update coupon", zap.String("coupon_code", couponCode), zap.Error(err))
 		return nil, coupon.ErrCouponInternal
 	}
 
-	log.Info("coupon used successfully", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("order_id", orderID))
+	log.Info("coupon used successfully", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("order_id", order.ID), zap.Int("discount_amount", discount))
 	return updatedCoupon, nil
 }
 
+// QuoteCoupon returns the discount the coupon would give on the order without using it.
+func (s *service) QuoteCoupon(ctx context.Context, couponCode string, userID string, order coupon.Order) (*coupon.CouponQuote, error) {
+	ctx, span := tracing.StartSpan(ctx, "V2.Service.QuoteCoupon")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	// Check Coupon Code Format
+	couponCode, err := s.parseCode(ctx, couponCode)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	// Retrieve Coupon
+	c, err := s.repo.FindCouponByCode(ctx, couponCode)
+	if err != nil || c == nil {
+		span.RecordError(err)
+		log.Warn("failed to get coupon by code", zap.String("coupon_code", couponCode), zap.Error(err))
+		return nil, coupon.ErrCouponNotFound
+	}
+
+	// Check Coupon Owner
+	if c.UserID != userID {
+		err := coupon.ErrCouponNotOwner
+		span.RecordError(err)
+		log.Warn("failed to quote coupon not owner", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	// Check Coupon Status
+	if err := c.CheckUsable(); err != nil {
+		span.RecordError(err)
+		log.Warn("failed to quote coupon not match status", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	// Retrieve Coupon Policy
+	policy, err := s.repo.FindCouponPolicyByID(ctx, c.CouponPolicyID)
+	if err != nil || policy == nil {
+		span.RecordError(err)
+		log.Warn("failed to get coupon policy not found", zap.String("coupon_code", couponCode), zap.String("policy_id", c.CouponPolicyID), zap.Error(err))
+		return nil, coupon.ErrCouponPolicyNotFound
+	}
+
+	// Calculate Discount
+	discount, err := policy.CalculateDiscount(order)
+	if err != nil {
+		span.RecordError(err)
+		log.Warn("failed to quote coupon order not eligible", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	amount := order.Total()
+	return &coupon.CouponQuote{
+		CouponCode:     c.Code,
+		PolicyCode:     policy.Code,
+		OrderAmount:    amount,
+		DiscountAmount: discount,
+		FinalAmount:    amount - discount,
+	}, nil
+}
+
 func (s *service) CancelCoupon(ctx context.Context, couponCode string, userID string) (*coupon.Coupon, error) {
 	ctx, span := tracing.StartSpan(ctx, "V2.Service.CancelCoupon")
 	defer span.End()
 
 	log := logging.GetLoggerFromContext(ctx)
 
+	// Check Coupon Code Format
+	couponCode, err := s.parseCode(ctx, couponCode)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
 	// Retrieve Coupon Policy
 	c, err := s.repo.FindCouponByCode(ctx, couponCode)
 	if err != nil || c == nil {
@@ -266,17 +410,31 @@ func (s *service) CancelCoupon(ctx context.Context, couponCode string, userID st
 		return nil, err
 	}
 
-	// Check Coupon Status
-	if err := c.Cancel(); err != nil {
+	// Retrieve Coupon Policy
+	policy, err := s.repo.FindCouponPolicyByID(ctx, c.CouponPolicyID)
+	if err != nil || policy == nil {
+		span.RecordError(err)
+		log.Error("failed to get coupon policy by id", zap.String("coupon_code", couponCode), zap.String("policy_id", c.CouponPolicyID), zap.Error(err))
+		return nil, coupon.ErrCouponInternal
+	}
+
+	// Check Coupon Status, cancel clears the order so the event keeps it
+	previousStatus, previousOrderID := c.Status, c.OrderID
+	if err := c.CancelWith(policy.CancelMode); err != nil {
 		span.RecordError(err)
 		log.Warn("failed to cancel coupon not match status", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.Error(err))
 		return nil, err
 	}
 
 	// Update Coupon
-	updatedCoupon, err := s.repo.UpdateCoupon(ctx, c)
+	event := coupon.NewCouponEvent(coupon.CouponEventTypeCanceled, previousStatus, userID, previousOrderID, tracing.TraceID(ctx))
+	updatedCoupon, err := s.repo.UpdateCoupon(ctx, c, event)
 	if err != nil {
 		span.RecordError(err)
+		if errors.Is(err, coupon.ErrCouponConflict) {
+			log.Warn("failed to update coupon changed concurrently", zap.String("coupon_code", couponCode), zap.Error(err))
+			return nil, err
+		}
 		log.Error("failed to update coupon", zap.String("coupon_code", couponCode), zap.Error(err))
 		return nil, coupon.ErrCouponInternal
 	}
@@ -291,6 +449,13 @@ func (s *service) FindCouponByCode(ctx context.Context, couponCode string, userI
 
 	log := logging.GetLoggerFromContext(ctx)
 
+	// Check Coupon Code Format
+	couponCode, err := s.parseCode(ctx, couponCode)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
 	// Retrieve Coupon Policy
 	c, err := s.repo.FindCouponByCode(ctx, couponCode)
 	if err != nil || c == nil {
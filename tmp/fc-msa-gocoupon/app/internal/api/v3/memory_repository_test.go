@@ -0,0 +1,19 @@
+package v3
+
+import (
+	"context"
+
+	"example.com/coupon-service/internal/coupontest"
+)
+
+// memoryRepository is the in-memory store with the v3 DecrCouponPolicyQuantity, which does not return the remaining quantity.
+type memoryRepository struct {
+	*coupontest.Store
+}
+
+var _ IRepository = memoryRepository{}
+
+func (r memoryRepository) DecrCouponPolicyQuantity(ctx context.Context, code string) error {
+	_, err := r.Store.DecrCouponPolicyQuantity(ctx, code)
+	return err
+}
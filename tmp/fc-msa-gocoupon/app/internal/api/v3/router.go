@@ -3,6 +3,7 @@ package v3
 import (
 	"example.com/coupon-service/internal/api/middleware"
 	"example.com/coupon-service/internal/config"
+	"example.com/coupon-service/internal/idempotency"
 	"github.com/labstack/echo/v4"
 
 	_ "example.com/coupon-service/internal/api/v3/docs"
@@ -17,15 +18,20 @@ import (
 // @securityDefinitions.apikey ApiKeyAuth
 // @in header
 // @name X-USER-ID
-func RegisterAPIV3(group *echo.Group, pg *config.Postgres, rdb *config.Redis) {
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+func RegisterAPIV3(group *echo.Group, pg *config.Postgres, rdb *config.Redis, idempotencyStore idempotency.IStore) {
 	repository := NewRepository(pg, rdb)
 	service := NewService(repository)
 	handler := NewHandler(service)
 
 	coupons := group.Group("/v3/coupons")
-	coupons.POST("/issue", handler.IssueCoupon, middleware.UserIDMiddleware())
-	coupons.POST("/use", handler.UseCoupon, middleware.UserIDMiddleware())
-	coupons.POST("/cancel", handler.CancelCoupon, middleware.UserIDMiddleware())
+	coupons.POST("/issue", handler.IssueCoupon, middleware.UserIDMiddleware(), middleware.IdempotencyMiddleware(idempotencyStore))
+	coupons.POST("/use", handler.UseCoupon, middleware.UserIDMiddleware(), middleware.IdempotencyMiddleware(idempotencyStore))
+	coupons.POST("/cancel", handler.CancelCoupon, middleware.UserIDMiddleware(), middleware.IdempotencyMiddleware(idempotencyStore))
+	coupons.POST("/quote", handler.QuoteCoupon, middleware.UserIDMiddleware())
 	coupons.GET("/:coupon_code", handler.FindCouponByCode, middleware.UserIDMiddleware())
 
 	coupons.GET("/swagger/*", echoSwagger.EchoWrapHandler(
@@ -0,0 +1,47 @@
+package v3
+
+import (
+	"context"
+	"testing"
+
+	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/coupontest"
+	"example.com/coupon-service/internal/instrument/logging"
+	"go.uber.org/zap"
+)
+
+// v3 checks the redis quota and user claims under the policy row lock and gives them back when
+// the transaction fails, so it must hold every invariant.
+func TestIssueCouponConcurrent(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), zap.NewNop())
+
+	for _, s := range coupontest.Scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			store, policy := s.NewStore()
+			svc := NewService(memoryRepository{store})
+
+			issue := func(ctx context.Context, userID string) (*coupon.Coupon, error) {
+				return svc.IssueCoupon(ctx, policy.Code, userID)
+			}
+
+			// POOL policies are issued by v5 only
+			if s.Pool {
+				if err := s.Reject(ctx, issue, coupon.ErrCouponPolicyPoolOnly); err != nil {
+					t.Error(err)
+				}
+				if issued := store.IssuedPerUser(policy.ID); len(issued) > 0 {
+					t.Errorf("issued pool coupons to %d users, want none from v3", len(issued))
+				}
+				return
+			}
+
+			succeeded, unexpected := s.Run(ctx, issue)
+			for _, err := range unexpected {
+				t.Error(err)
+			}
+			for _, err := range s.Check(succeeded, store.IssuedPerUser(policy.ID)) {
+				t.Error(err)
+			}
+		})
+	}
+}
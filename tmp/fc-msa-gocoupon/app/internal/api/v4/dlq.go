@@ -0,0 +1,110 @@
+package v4
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"example.com/coupon-service/internal/config"
+	"example.com/coupon-service/internal/instrument/logging"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// DLQReplayer moves dead-lettered messages back to the topic they failed on.
+// It commits under its own consumer group, so a replayed message is not replayed twice.
+type DLQReplayer struct {
+	reader *kafka.Reader
+	writer *kafka.Writer
+}
+
+func NewDLQReplayer(cfg *config.Config) *DLQReplayer {
+	return &DLQReplayer{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     cfg.Kafka.Brokers,
+			Topic:       TopicCouponIssueDLQ,
+			GroupID:     cfg.Kafka.GroupID + "-dlq-replay",
+			StartOffset: kafka.FirstOffset,
+			MaxWait:     500 * time.Millisecond,
+			MinBytes:    1,
+			MaxBytes:    10e6,
+		}),
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(cfg.Kafka.Brokers...),
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			MaxAttempts:  5,
+		},
+	}
+}
+
+// Replay republishes up to limit messages (0 for all), stopping once the DLQ has been idle for idleTimeout.
+// With dryRun the messages are only logged and no offsets are committed.
+func (r *DLQReplayer) Replay(ctx context.Context, limit int, idleTimeout time.Duration, dryRun bool) (int, error) {
+	log := logging.GetLoggerFromContext(ctx)
+
+	replayed := 0
+	for limit == 0 || replayed < limit {
+		fetchCtx, cancel := context.WithTimeout(ctx, idleTimeout)
+		m, err := r.reader.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				log.Info("dlq is idle, stopping replay", zap.Int("replayed", replayed))
+				return replayed, nil
+			}
+			return replayed, err
+		}
+
+		topic := TopicCouponIssue
+		var headers []kafka.Header
+		for _, h := range m.Headers {
+			if h.Key == HeaderDLQOriginalTopic && len(h.Value) > 0 {
+				topic = string(h.Value)
+			}
+			if h.Key == HeaderDLQError {
+				log.Info("dead-lettered message",
+					zap.Int("partition", m.Partition),
+					zap.Int64("offset", m.Offset),
+					zap.String("error", string(h.Value)),
+				)
+			}
+			if !strings.HasPrefix(h.Key, "x-dlq-") {
+				headers = append(headers, h)
+			}
+		}
+		headers = append(headers, kafka.Header{Key: HeaderDLQReplayedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))})
+
+		if dryRun {
+			replayed++
+			continue
+		}
+
+		if err := r.writer.WriteMessages(ctx, kafka.Message{
+			Topic:   topic,
+			Key:     m.Key,
+			Value:   m.Value,
+			Headers: headers,
+			Time:    time.Now(),
+		}); err != nil {
+			log.Error("failed to replay dlq message", zap.Int("partition", m.Partition), zap.Int64("offset", m.Offset), zap.Error(err))
+			return replayed, err
+		}
+
+		if err := r.reader.CommitMessages(ctx, m); err != nil {
+			log.Error("failed to commit dlq message", zap.Int("partition", m.Partition), zap.Int64("offset", m.Offset), zap.Error(err))
+			return replayed, err
+		}
+
+		replayed++
+		log.Info("dlq message replayed", zap.String("topic", topic), zap.Int("partition", m.Partition), zap.Int64("offset", m.Offset))
+	}
+
+	return replayed, nil
+}
+
+func (r *DLQReplayer) Close() {
+	_ = r.reader.Close()
+	_ = r.writer.Close()
+}
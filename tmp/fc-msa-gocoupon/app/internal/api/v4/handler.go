@@ -1,9 +1,16 @@
 package v4
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
 
 	"example.com/coupon-service/internal/api/middleware"
+	"example.com/coupon-service/internal/api/problem"
 	"example.com/coupon-service/internal/coupon"
 	"example.com/coupon-service/internal/instrument/logging"
 	"example.com/coupon-service/internal/instrument/tracing"
@@ -11,6 +18,13 @@ import (
 	"go.uber.org/zap"
 )
 
+const (
+	// IssueRequestStreamTimeout bounds one SSE connection, EventSource clients reconnect and read the status again
+	IssueRequestStreamTimeout = 60 * time.Second
+	// IssueRequestStreamKeepAlive keeps idle proxies from closing the SSE connection
+	IssueRequestStreamKeepAlive = 15 * time.Second
+)
+
 type Handler struct {
 	service IService
 }
@@ -26,13 +40,21 @@ func NewHandler(service IService) *Handler {
 // @Description  Issues a coupon under a specific policy code for the authenticated user
 // @Tags         coupons
 // @Accept       json
-// @Produce      json
+// @Produce      json,application/problem+json
 // @Param        X-USER-ID  header  string  true  "User ID"
+// @Param        Idempotency-Key  header  string  false  "Idempotency key, replays the first response on retry"
 // @Param        payload    body    coupon.IssueCouponRequest  true  "Issue coupon payload"
 // @Success      200  {object}  coupon.Coupon
-// @Failure      400  {object}  map[string]string
-// @Failure      401  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      410  {object}  problem.Problem
+// @Failure      422  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
 // @Router       /coupons/issue [post]
 func (h *Handler) IssueCoupon(c echo.Context) error {
 	ctx, span := tracing.StartSpan(c.Request().Context(), "V4.Handler.IssueCoupon")
@@ -44,7 +66,7 @@ func (h *Handler) IssueCoupon(c echo.Context) error {
 	if err := c.Bind(&payload); err != nil {
 		span.RecordError(err)
 		log.Warn("invalid body request", zap.Error(err))
-		return c.JSON(400, map[string]string{"error": err.Error()})
+		return problem.BadRequest(c, err.Error())
 	}
 
 	userID, ok := ctx.Value(middleware.UserIDKey).(string)
@@ -52,7 +74,7 @@ func (h *Handler) IssueCoupon(c echo.Context) error {
 		err := errors.New("invalid x-user-id header")
 		span.RecordError(err)
 		log.Warn("invalid x-user-id header")
-		return c.JSON(401, map[string]string{"error": err.Error()})
+		return problem.Unauthorized(c, err.Error())
 	}
 
 	result, err := h.service.IssueCoupon(ctx, payload.PolicyCode, userID)
@@ -63,7 +85,7 @@ func (h *Handler) IssueCoupon(c echo.Context) error {
 			zap.String("user_id", userID),
 			zap.Error(err),
 		)
-		return c.JSON(500, map[string]string{"error": err.Error()})
+		return problem.Error(c, err)
 	}
 
 	log.Info("issue coupon successfully",
@@ -79,13 +101,21 @@ func (h *Handler) IssueCoupon(c echo.Context) error {
 // @Description  Marks a coupon as used for the given order by the authenticated user
 // @Tags         coupons
 // @Accept       json
-// @Produce      json
+// @Produce      json,application/problem+json
 // @Param        X-USER-ID  header  string  true  "User ID"
+// @Param        Idempotency-Key  header  string  false  "Idempotency key, replays the first response on retry"
 // @Param        payload    body    coupon.UseCouponRequest  true  "Use coupon payload"
 // @Success      200  {object}  coupon.Coupon
-// @Failure      400  {object}  map[string]string
-// @Failure      401  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      410  {object}  problem.Problem
+// @Failure      422  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
 // @Router       /coupons/use [post]
 func (h *Handler) UseCoupon(c echo.Context) error {
 	ctx, span := tracing.StartSpan(c.Request().Context(), "V4.Handler.IssueCoupon")
@@ -97,7 +127,7 @@ func (h *Handler) UseCoupon(c echo.Context) error {
 	if err := c.Bind(&payload); err != nil {
 		span.RecordError(err)
 		log.Warn("invalid body request", zap.Error(err))
-		return c.JSON(400, map[string]string{"error": err.Error()})
+		return problem.BadRequest(c, err.Error())
 	}
 
 	userID, ok := ctx.Value(middleware.UserIDKey).(string)
@@ -105,32 +135,97 @@ func (h *Handler) UseCoupon(c echo.Context) error {
 		err := errors.New("invalid x-user-id header")
 		span.RecordError(err)
 		log.Warn("invalid x-user-id header")
-		return c.JSON(401, map[string]string{"error": "invalid user id"})
+		return problem.Unauthorized(c, "invalid user id")
 	}
 
-	result, err := h.service.UseCoupon(ctx, payload.CouponCode, userID, payload.OrderID)
+	result, err := h.service.UseCoupon(ctx, payload.CouponCode, userID, coupon.Order{
+		ID:     payload.OrderID,
+		Amount: payload.OrderAmount,
+		Items:  payload.Items,
+	})
 	if err != nil || result == nil {
 		span.RecordError(err)
 		log.Error("failed to use coupon", zap.String("coupon_code", payload.CouponCode), zap.String("user_id", userID), zap.Error(err))
-		return c.JSON(500, map[string]string{"error": err.Error()})
+		return problem.Error(c, err)
 	}
 
 	log.Info("use coupon successfully", zap.String("coupon_code", payload.CouponCode), zap.String("user_id", userID), zap.String("coupon_code", result.Code))
 	return c.JSON(200, result)
 }
 
+// QuoteCoupon godoc
+// @Summary      Quote a coupon discount for an order
+// @Description  Returns the discount a coupon would give on the order without using the coupon
+// @Tags         coupons
+// @Accept       json
+// @Produce      json,application/problem+json
+// @Param        X-USER-ID  header  string  true  "User ID"
+// @Param        payload    body    coupon.QuoteCouponRequest  true  "Quote coupon payload"
+// @Success      200  {object}  coupon.CouponQuote
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      410  {object}  problem.Problem
+// @Failure      422  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /coupons/quote [post]
+func (h *Handler) QuoteCoupon(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "V4.Handler.QuoteCoupon")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	var payload coupon.QuoteCouponRequest
+	if err := c.Bind(&payload); err != nil {
+		span.RecordError(err)
+		log.Warn("invalid body request", zap.Error(err))
+		return problem.BadRequest(c, err.Error())
+	}
+
+	userID, ok := ctx.Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		err := errors.New("invalid x-user-id header")
+		span.RecordError(err)
+		log.Warn("invalid x-user-id header")
+		return problem.Unauthorized(c, "invalid user id")
+	}
+
+	result, err := h.service.QuoteCoupon(ctx, payload.CouponCode, userID, coupon.Order{
+		Amount: payload.OrderAmount,
+		Items:  payload.Items,
+	})
+	if err != nil || result == nil {
+		span.RecordError(err)
+		log.Error("failed to quote coupon", zap.String("coupon_code", payload.CouponCode), zap.String("user_id", userID), zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	log.Info("quote coupon successfully", zap.String("coupon_code", payload.CouponCode), zap.String("user_id", userID), zap.Int("discount_amount", result.DiscountAmount))
+	return c.JSON(200, result)
+}
+
 // CancelCoupon godoc
 // @Summary      Cancel a coupon
-// @Description  Cancels a coupon for the authenticated user
+// @Description  Cancels a used coupon for the authenticated user as its policy cancel_mode says: VOID cancels it, RESTORE makes it AVAILABLE again, RELEASE cancels it and gives its unit back to the quota
 // @Tags         coupons
 // @Accept       json
-// @Produce      json
+// @Produce      json,application/problem+json
 // @Param        X-USER-ID  header  string  true  "User ID"
+// @Param        Idempotency-Key  header  string  false  "Idempotency key, replays the first response on retry"
 // @Param        payload    body    coupon.CancelCouponRequest  true  "Cancel coupon payload"
 // @Success      200  {object}  coupon.Coupon
-// @Failure      400  {object}  map[string]string
-// @Failure      401  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
 // @Router       /coupons/cancel [post]
 func (h *Handler) CancelCoupon(c echo.Context) error {
 	ctx, span := tracing.StartSpan(c.Request().Context(), "V4.Handler.CancelCoupon")
@@ -142,7 +237,7 @@ func (h *Handler) CancelCoupon(c echo.Context) error {
 	if err := c.Bind(&payload); err != nil {
 		span.RecordError(err)
 		log.Warn("invalid body request", zap.Error(err))
-		return c.JSON(400, map[string]string{"error": err.Error()})
+		return problem.BadRequest(c, err.Error())
 	}
 
 	userID, ok := ctx.Value(middleware.UserIDKey).(string)
@@ -150,32 +245,274 @@ func (h *Handler) CancelCoupon(c echo.Context) error {
 		err := errors.New("invalid x-user-id header")
 		span.RecordError(err)
 		log.Warn("invalid x-user-id header")
-		return c.JSON(401, map[string]string{"error": "invalid user id"})
+		return problem.Unauthorized(c, "invalid user id")
 	}
 
 	result, err := h.service.CancelCoupon(ctx, payload.CouponCode, userID)
 	if err != nil || result == nil {
 		span.RecordError(err)
 		log.Error("failed to cancel coupon", zap.String("coupon_code", payload.CouponCode), zap.String("user_id", userID), zap.Error(err))
-		return c.JSON(500, map[string]string{"error": err.Error()})
+		return problem.Error(c, err)
 	}
 
 	log.Info("cancel coupon successfully", zap.String("coupon_code", payload.CouponCode), zap.String("user_id", userID), zap.String("coupon_code", result.Code))
 	return c.JSON(200, result)
 }
 
+// FindCoupons godoc
+// @Summary      List my coupons
+// @Description  Lists the coupons of the authenticated user newest first, with keyset pagination. Pass next_cursor as cursor to get the next page, it is omitted on the last page.
+// @Tags         coupons
+// @Produce      json,application/problem+json
+// @Param        X-USER-ID    header  string  true   "User ID"
+// @Param        status       query   string  false  "Coupon status (PENDING, AVAILABLE, RESERVED, USED, EXPIRED, CANCELED, REVOKED)"
+// @Param        policy_code  query   string  false  "Coupon Policy Code"
+// @Param        cursor       query   string  false  "next_cursor of the previous page"
+// @Param        limit        query   int     false  "Page size, 20 by default and at most 100"
+// @Success      200  {object}  coupon.CouponPage
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /coupons [get]
+func (h *Handler) FindCoupons(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "V4.Handler.FindCoupons")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	userID, ok := ctx.Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		err := errors.New("invalid x-user-id header")
+		span.RecordError(err)
+		log.Warn("invalid x-user-id header")
+		return problem.Unauthorized(c, "invalid user id")
+	}
+
+	filter := coupon.CouponFilter{
+		Status:     coupon.CouponStatus(c.QueryParam("status")),
+		PolicyCode: c.QueryParam("policy_code"),
+	}
+	if limit := c.QueryParam("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			span.RecordError(err)
+			log.Warn("invalid limit", zap.String("limit", limit))
+			return problem.BadRequest(c, "limit must be a number")
+		}
+		filter.Limit = n
+	}
+
+	result, err := h.service.FindCoupons(ctx, userID, filter, c.QueryParam("cursor"))
+	if err != nil || result == nil {
+		span.RecordError(err)
+		log.Error("failed to find coupons", zap.String("user_id", userID), zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	log.Info("find coupons successfully", zap.String("user_id", userID), zap.Int("count", len(result.Items)))
+	return c.JSON(200, result)
+}
+
+// ReserveCoupon godoc
+// @Summary      Reserve a coupon for an order
+// @Description  Holds the coupon for the order during checkout. Confirm it once the order is paid or release it if payment fails, an abandoned reservation is released after ttl_seconds (900 by default, at most 3600). Reserving again for the same order extends the reservation
+// @Tags         coupons
+// @Accept       json
+// @Produce      json,application/problem+json
+// @Param        X-USER-ID  header  string  true  "User ID"
+// @Param        Idempotency-Key  header  string  false  "Idempotency key, replays the first response on retry"
+// @Param        payload    body    coupon.ReserveCouponRequest  true  "Reserve coupon payload"
+// @Success      200  {object}  coupon.Coupon
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      410  {object}  problem.Problem
+// @Failure      422  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /coupons/reserve [post]
+func (h *Handler) ReserveCoupon(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "V4.Handler.ReserveCoupon")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	var payload coupon.ReserveCouponRequest
+	if err := c.Bind(&payload); err != nil {
+		span.RecordError(err)
+		log.Warn("invalid body request", zap.Error(err))
+		return problem.BadRequest(c, err.Error())
+	}
+	if payload.OrderID == "" {
+		err := errors.New("invalid order_id")
+		span.RecordError(err)
+		log.Warn("invalid order_id")
+		return problem.BadRequest(c, "order_id is required")
+	}
+
+	userID, ok := ctx.Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		err := errors.New("invalid x-user-id header")
+		span.RecordError(err)
+		log.Warn("invalid x-user-id header")
+		return problem.Unauthorized(c, "invalid user id")
+	}
+
+	order := coupon.Order{
+		ID:     payload.OrderID,
+		Amount: payload.OrderAmount,
+		Items:  payload.Items,
+	}
+	result, err := h.service.ReserveCoupon(ctx, payload.CouponCode, userID, order, time.Duration(payload.TTLSeconds)*time.Second)
+	if err != nil || result == nil {
+		span.RecordError(err)
+		log.Error("failed to reserve coupon", zap.String("coupon_code", payload.CouponCode), zap.String("user_id", userID), zap.String("order_id", payload.OrderID), zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	log.Info("reserve coupon successfully", zap.String("coupon_code", result.Code), zap.String("user_id", userID), zap.String("order_id", payload.OrderID))
+	return c.JSON(200, result)
+}
+
+// ConfirmCoupon godoc
+// @Summary      Confirm a coupon reservation
+// @Description  Marks a coupon reserved for the order as used, with the discount computed at reservation
+// @Tags         coupons
+// @Accept       json
+// @Produce      json,application/problem+json
+// @Param        X-USER-ID  header  string  true  "User ID"
+// @Param        Idempotency-Key  header  string  false  "Idempotency key, replays the first response on retry"
+// @Param        payload    body    coupon.ConfirmCouponRequest  true  "Confirm coupon payload"
+// @Success      200  {object}  coupon.Coupon
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      410  {object}  problem.Problem
+// @Failure      422  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /coupons/confirm [post]
+func (h *Handler) ConfirmCoupon(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "V4.Handler.ConfirmCoupon")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	var payload coupon.ConfirmCouponRequest
+	if err := c.Bind(&payload); err != nil {
+		span.RecordError(err)
+		log.Warn("invalid body request", zap.Error(err))
+		return problem.BadRequest(c, err.Error())
+	}
+	if payload.OrderID == "" {
+		err := errors.New("invalid order_id")
+		span.RecordError(err)
+		log.Warn("invalid order_id")
+		return problem.BadRequest(c, "order_id is required")
+	}
+
+	userID, ok := ctx.Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		err := errors.New("invalid x-user-id header")
+		span.RecordError(err)
+		log.Warn("invalid x-user-id header")
+		return problem.Unauthorized(c, "invalid user id")
+	}
+
+	result, err := h.service.ConfirmCoupon(ctx, payload.CouponCode, userID, payload.OrderID)
+	if err != nil || result == nil {
+		span.RecordError(err)
+		log.Error("failed to confirm coupon", zap.String("coupon_code", payload.CouponCode), zap.String("user_id", userID), zap.String("order_id", payload.OrderID), zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	log.Info("confirm coupon successfully", zap.String("coupon_code", result.Code), zap.String("user_id", userID), zap.String("order_id", payload.OrderID))
+	return c.JSON(200, result)
+}
+
+// ReleaseCoupon godoc
+// @Summary      Release a coupon reservation
+// @Description  Returns a coupon reserved for the order to AVAILABLE, for an order whose payment failed
+// @Tags         coupons
+// @Accept       json
+// @Produce      json,application/problem+json
+// @Param        X-USER-ID  header  string  true  "User ID"
+// @Param        Idempotency-Key  header  string  false  "Idempotency key, replays the first response on retry"
+// @Param        payload    body    coupon.ReleaseCouponRequest  true  "Release coupon payload"
+// @Success      200  {object}  coupon.Coupon
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      422  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /coupons/release [post]
+func (h *Handler) ReleaseCoupon(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "V4.Handler.ReleaseCoupon")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	var payload coupon.ReleaseCouponRequest
+	if err := c.Bind(&payload); err != nil {
+		span.RecordError(err)
+		log.Warn("invalid body request", zap.Error(err))
+		return problem.BadRequest(c, err.Error())
+	}
+	if payload.OrderID == "" {
+		err := errors.New("invalid order_id")
+		span.RecordError(err)
+		log.Warn("invalid order_id")
+		return problem.BadRequest(c, "order_id is required")
+	}
+
+	userID, ok := ctx.Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		err := errors.New("invalid x-user-id header")
+		span.RecordError(err)
+		log.Warn("invalid x-user-id header")
+		return problem.Unauthorized(c, "invalid user id")
+	}
+
+	result, err := h.service.ReleaseCoupon(ctx, payload.CouponCode, userID, payload.OrderID)
+	if err != nil || result == nil {
+		span.RecordError(err)
+		log.Error("failed to release coupon", zap.String("coupon_code", payload.CouponCode), zap.String("user_id", userID), zap.String("order_id", payload.OrderID), zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	log.Info("release coupon successfully", zap.String("coupon_code", result.Code), zap.String("user_id", userID), zap.String("order_id", payload.OrderID))
+	return c.JSON(200, result)
+}
+
 // FindCouponByCode godoc
 // @Summary      Find coupon by code
 // @Description  Retrieves coupon information for the authenticated user
 // @Tags         coupons
 // @Accept       json
-// @Produce      json
+// @Produce      json,application/problem+json
 // @Param        X-USER-ID     header  string  true  "User ID"
 // @Param        coupon_code   path    string  true  "Coupon Code"
 // @Success      200  {object}  coupon.Coupon
-// @Failure      400  {object}  map[string]string
-// @Failure      401  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      422  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
 // @Router       /coupons/{coupon_code} [get]
 func (h *Handler) FindCouponByCode(c echo.Context) error {
 	ctx, span := tracing.StartSpan(c.Request().Context(), "V4.Handler.FindCouponByCode")
@@ -188,7 +525,7 @@ func (h *Handler) FindCouponByCode(c echo.Context) error {
 		err := errors.New("invalid coupon_code")
 		span.RecordError(err)
 		log.Error("invalid coupon_code")
-		return c.JSON(400, map[string]string{"error": "coupon_code is required"})
+		return problem.BadRequest(c, "coupon_code is required")
 	}
 
 	userID, ok := ctx.Value(middleware.UserIDKey).(string)
@@ -196,16 +533,220 @@ func (h *Handler) FindCouponByCode(c echo.Context) error {
 		err := errors.New("invalid x-user-id header")
 		span.RecordError(err)
 		log.Warn("invalid x-user-id header")
-		return c.JSON(401, map[string]string{"error": "invalid user id"})
+		return problem.Unauthorized(c, "invalid user id")
 	}
 
 	result, err := h.service.FindCouponByCode(ctx, couponCode, userID)
 	if err != nil || result == nil {
 		span.RecordError(err)
 		log.Error("failed to find coupon by code", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.Error(err))
-		return c.JSON(500, map[string]string{"error": err.Error()})
+		return problem.Error(c, err)
 	}
 
 	log.Info("find coupon by code successfully", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("coupon_code", result.Code))
 	return c.JSON(200, result)
 }
+
+// FindCouponHistory godoc
+// @Summary      Find the history of a coupon
+// @Description  Returns the coupon with the timeline of its status changes (ISSUED, USED, CANCELED, EXPIRED, REVOKED), oldest first
+// @Tags         coupons
+// @Produce      json,application/problem+json
+// @Param        X-USER-ID     header  string  true  "User ID"
+// @Param        coupon_code   path    string  true  "Coupon Code"
+// @Success      200  {object}  coupon.CouponHistory
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      422  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /coupons/{coupon_code}/history [get]
+func (h *Handler) FindCouponHistory(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "V4.Handler.FindCouponHistory")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	couponCode := c.Param("coupon_code")
+	if couponCode == "" {
+		err := errors.New("invalid coupon_code")
+		span.RecordError(err)
+		log.Error("invalid coupon_code")
+		return problem.BadRequest(c, "coupon_code is required")
+	}
+
+	userID, ok := ctx.Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		err := errors.New("invalid x-user-id header")
+		span.RecordError(err)
+		log.Warn("invalid x-user-id header")
+		return problem.Unauthorized(c, "invalid user id")
+	}
+
+	result, err := h.service.FindCouponHistory(ctx, couponCode, userID)
+	if err != nil || result == nil {
+		span.RecordError(err)
+		log.Error("failed to find coupon history", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	log.Info("find coupon history successfully", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.Int("count", len(result.Events)))
+	return c.JSON(200, result)
+}
+
+// FindIssueRequest godoc
+// @Summary      Get the status of an issue request
+// @Description  Returns the asynchronous issue request, PENDING until the consumer persists the coupon (AVAILABLE) or dead-letters it (FAILED)
+// @Tags         coupons
+// @Produce      json,application/problem+json
+// @Param        X-USER-ID   header  string  true  "User ID"
+// @Param        request_id  path    string  true  "Request ID, the coupon ID returned by issue"
+// @Success      200  {object}  coupon.IssueRequest
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /coupons/requests/{request_id} [get]
+func (h *Handler) FindIssueRequest(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "V4.Handler.FindIssueRequest")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	requestID := c.Param("request_id")
+	if requestID == "" {
+		err := errors.New("invalid request_id")
+		span.RecordError(err)
+		log.Error("invalid request_id")
+		return problem.BadRequest(c, "request_id is required")
+	}
+
+	userID, ok := ctx.Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		err := errors.New("invalid x-user-id header")
+		span.RecordError(err)
+		log.Warn("invalid x-user-id header")
+		return problem.Unauthorized(c, "invalid user id")
+	}
+
+	result, err := h.service.FindIssueRequest(ctx, requestID, userID)
+	if err != nil || result == nil {
+		span.RecordError(err)
+		log.Error("failed to find issue request", zap.String("request_id", requestID), zap.String("user_id", userID), zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	log.Info("find issue request successfully", zap.String("request_id", requestID), zap.String("user_id", userID), zap.String("status", string(result.Status)))
+	return c.JSON(200, result)
+}
+
+// StreamIssueRequest godoc
+// @Summary      Stream the status of an issue request
+// @Description  Server-sent events, sends a status event with the current request and another once it is AVAILABLE or FAILED, then closes
+// @Tags         coupons
+// @Produce      text/event-stream
+// @Param        X-USER-ID   header  string  true  "User ID"
+// @Param        request_id  path    string  true  "Request ID, the coupon ID returned by issue"
+// @Success      200  {object}  coupon.IssueRequest
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /coupons/requests/{request_id}/events [get]
+func (h *Handler) StreamIssueRequest(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "V4.Handler.StreamIssueRequest")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	requestID := c.Param("request_id")
+	if requestID == "" {
+		err := errors.New("invalid request_id")
+		span.RecordError(err)
+		log.Error("invalid request_id")
+		return problem.BadRequest(c, "request_id is required")
+	}
+
+	userID, ok := ctx.Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		err := errors.New("invalid x-user-id header")
+		span.RecordError(err)
+		log.Warn("invalid x-user-id header")
+		return problem.Unauthorized(c, "invalid user id")
+	}
+
+	// Errors before the stream opens are returned as json like the other endpoints
+	current, err := h.service.FindIssueRequest(ctx, requestID, userID)
+	if err != nil || current == nil {
+		span.RecordError(err)
+		log.Error("failed to find issue request", zap.String("request_id", requestID), zap.String("user_id", userID), zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	if err := writeIssueRequestEvent(res, current); err != nil || current.IsFinal() {
+		return nil
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, IssueRequestStreamTimeout)
+	defer cancel()
+
+	type waitResult struct {
+		req *coupon.IssueRequest
+		err error
+	}
+	done := make(chan waitResult, 1)
+	go func() {
+		req, err := h.service.WaitIssueRequest(waitCtx, requestID, userID)
+		done <- waitResult{req: req, err: err}
+	}()
+
+	keepAlive := time.NewTicker(IssueRequestStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case result := <-done:
+			if result.err != nil {
+				// Timeout or client gone, a reconnecting client reads the current status first
+				log.Info("issue request stream closed before settled", zap.String("request_id", requestID), zap.Error(result.err))
+				return nil
+			}
+			_ = writeIssueRequestEvent(res, result.req)
+			log.Info("issue request stream settled", zap.String("request_id", requestID), zap.String("user_id", userID), zap.String("status", string(result.req.Status)))
+			return nil
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(res, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		}
+	}
+}
+
+func writeIssueRequestEvent(res *echo.Response, req *coupon.IssueRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(res, "event: status\nid: %d\ndata: %s\n\n", req.UpdatedAt.UnixMilli(), data); err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
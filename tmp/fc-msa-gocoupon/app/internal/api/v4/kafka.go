@@ -3,17 +3,48 @@ package v4
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"example.com/coupon-service/internal/config"
 	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/domainevent"
 	"example.com/coupon-service/internal/instrument/logging"
 	"example.com/coupon-service/internal/instrument/tracing"
 	"github.com/segmentio/kafka-go"
 	"go.uber.org/zap"
 )
 
-const TopicCouponIssue = "coupon-issue-requests"
+const (
+	TopicCouponIssue    = "coupon-issue-requests"
+	TopicCouponIssueDLQ = "coupon-issue-requests.dlq"
+)
+
+// Headers set on dead-lettered messages, so a replay knows where the message came from and why it failed.
+const (
+	HeaderDLQError             = "x-dlq-error"
+	HeaderDLQAttempts          = "x-dlq-attempts"
+	HeaderDLQFailedAt          = "x-dlq-failed-at"
+	HeaderDLQOriginalTopic     = "x-dlq-original-topic"
+	HeaderDLQOriginalPartition = "x-dlq-original-partition"
+	HeaderDLQOriginalOffset    = "x-dlq-original-offset"
+	HeaderDLQReplayedAt        = "x-dlq-replayed-at"
+)
+
+// CouponProcessedTTL bounds how long a processed coupon ID is remembered in redis,
+// it only has to outlive Kafka redelivery after a rebalance or restart.
+const CouponProcessedTTL = 24 * time.Hour
+
+// IKafkaProducer is what issuers need to hand a coupon to the consumer, so they can run without a broker.
+type IKafkaProducer interface {
+	SendIssueCoupon(ctx context.Context, message coupon.IssueCouponMessage) error
+}
 
 type KafkaProducer struct {
 	writer *kafka.Writer
@@ -53,7 +84,9 @@ func (p *KafkaProducer) SendIssueCoupon(ctx context.Context, message coupon.Issu
 
 	if err := p.writer.WriteMessages(sendCtx, kafka.Message{
 		Topic: TopicCouponIssue,
-		Key:   []byte(message.PolicyID),
+		// Keyed by user rather than policy, so a single flash-sale policy spreads over every
+		// partition and consumer worker while one user's requests stay in order
+		Key:   []byte(message.UserID),
 		Value: jsonValue,
 		Time:  time.Now(),
 	}); err != nil {
@@ -72,15 +105,83 @@ func (p *KafkaProducer) SendIssueCoupon(ctx context.Context, message coupon.Issu
 	return nil
 }
 
+// SendDeadLetter publishes a message that could not be processed to the DLQ topic,
+// keeping its key and value and recording the failure in headers.
+func (p *KafkaProducer) SendDeadLetter(ctx context.Context, msg kafka.Message, cause error, attempts int) error {
+	ctx, span := tracing.StartSpan(ctx, "V4.KafkaProducer.SendDeadLetter")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	headers := append([]kafka.Header{}, msg.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderDLQError, Value: []byte(cause.Error())},
+		kafka.Header{Key: HeaderDLQAttempts, Value: []byte(strconv.Itoa(attempts))},
+		kafka.Header{Key: HeaderDLQFailedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))},
+		kafka.Header{Key: HeaderDLQOriginalTopic, Value: []byte(msg.Topic)},
+		kafka.Header{Key: HeaderDLQOriginalPartition, Value: []byte(strconv.Itoa(msg.Partition))},
+		kafka.Header{Key: HeaderDLQOriginalOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+	)
+
+	sendCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if err := p.writer.WriteMessages(sendCtx, kafka.Message{
+		Topic:   TopicCouponIssueDLQ,
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+		Time:    time.Now(),
+	}); err != nil {
+		span.RecordError(err)
+		log.Error("failed to send message to dlq", zap.String("topic", msg.Topic), zap.Int("partition", msg.Partition), zap.Int64("offset", msg.Offset), zap.Error(err))
+		return err
+	}
+
+	log.Warn("message sent to dlq",
+		zap.String("topic", msg.Topic),
+		zap.Int("partition", msg.Partition),
+		zap.Int64("offset", msg.Offset),
+		zap.Int("attempts", attempts),
+		zap.String("error", cause.Error()),
+	)
+
+	return nil
+}
+
+func (p *KafkaProducer) Close() error {
+	return p.writer.Close()
+}
+
+// errPoisonMessage marks a message that can never succeed, so it skips the retries and goes straight to the DLQ.
+var errPoisonMessage = errors.New("poison message")
+
 type KafkaConsumer struct {
-	reader  *kafka.Reader
-	service IService
+	reader          *kafka.Reader
+	producer        *KafkaProducer
+	repo            IRepository
+	service         IService
+	maxRetries      int
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+	workers         int
+	queueSize       int
+	offsets         *offsetTracker
+
+	// quit stops fetching, workCtx is canceled only when the drain deadline passes
+	quit       chan struct{}
+	quitOnce   sync.Once
+	done       chan struct{}
+	started    atomic.Bool
+	workCtx    context.Context
+	cancelWork context.CancelFunc
 }
 
 func NewKafkaConsumer(
 	cfg *config.Config,
 	pg *config.Postgres,
 	rdb *config.Redis,
+	events domainevent.IPublisher,
 ) *KafkaConsumer {
 	reader := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:  cfg.Kafka.Brokers,
@@ -91,34 +192,213 @@ func NewKafkaConsumer(
 		MaxBytes: 10e6,
 	})
 
-	service := NewService(NewRepository(pg, rdb), NewKafkaProducer(cfg.Kafka.Brokers))
+	repo := NewRepository(pg, rdb)
+	producer := NewKafkaProducer(cfg.Kafka.Brokers)
+	service := NewService(repo, events)
+
+	maxRetries := cfg.Kafka.Consumer.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = 5
+	}
+	retryBackoff := cfg.Kafka.Consumer.RetryBackoff
+	if retryBackoff <= 0 {
+		retryBackoff = 200 * time.Millisecond
+	}
+	maxRetryBackoff := cfg.Kafka.Consumer.MaxRetryBackoff
+	if maxRetryBackoff <= 0 {
+		maxRetryBackoff = 10 * time.Second
+	}
+	workers := cfg.Kafka.Consumer.Workers
+	if workers <= 0 {
+		workers = 16
+	}
+	queueSize := cfg.Kafka.Consumer.QueueSize
+	if queueSize <= 0 {
+		queueSize = 64
+	}
+
+	workCtx, cancelWork := context.WithCancel(context.Background())
 
 	return &KafkaConsumer{
-		reader:  reader,
-		service: service,
+		reader:          reader,
+		producer:        producer,
+		repo:            repo,
+		service:         service,
+		maxRetries:      maxRetries,
+		retryBackoff:    retryBackoff,
+		maxRetryBackoff: maxRetryBackoff,
+		workers:         workers,
+		queueSize:       queueSize,
+		offsets:         newOffsetTracker(),
+		quit:            make(chan struct{}),
+		done:            make(chan struct{}),
+		workCtx:         workCtx,
+		cancelWork:      cancelWork,
 	}
 }
 
+// Start fetches messages into a fixed pool of workers until ctx is canceled or Shutdown is called.
+// Messages with the same key always go to the same worker, so they are processed in order, and a
+// full worker queue blocks the fetch loop instead of piling up goroutines. An offset is committed
+// only after it and every earlier offset of its partition were processed or dead-lettered, so a
+// crash or a Postgres outage redelivers instead of losing a message.
 func (c *KafkaConsumer) Start(ctx context.Context) error {
 	log := logging.GetLoggerFromContext(ctx)
-	log.Info("kafka consumer started...", zap.String("topic", TopicCouponIssue))
+	log.Info("kafka consumer started...", zap.String("topic", TopicCouponIssue), zap.Int("workers", c.workers))
+
+	c.started.Store(true)
+	defer close(c.done)
+
+	fetchCtx, stopFetch := context.WithCancel(ctx)
+	defer stopFetch()
+	go func() {
+		select {
+		case <-c.quit:
+			stopFetch()
+		case <-fetchCtx.Done():
+		}
+	}()
+
+	queues := make([]chan kafka.Message, c.workers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan kafka.Message, c.queueSize)
+		wg.Add(1)
+		go func(queue <-chan kafka.Message) {
+			defer wg.Done()
+			c.runWorker(queue)
+		}(queues[i])
+	}
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		wg.Wait()
+		log.Info("kafka consumer workers drained")
+	}()
 
 	for {
-		m, err := c.reader.ReadMessage(ctx)
+		m, err := c.reader.FetchMessage(fetchCtx)
 		if err != nil {
-			if err == context.Canceled {
+			if fetchCtx.Err() != nil || errors.Is(err, io.EOF) {
 				log.Warn("kafka consumer stopping due cancellation")
 				return nil
 			}
-			log.Error("failed read message from kafka", zap.Error(err))
+			log.Error("failed fetch message from kafka", zap.Error(err))
 			continue
 		}
 
-		go c.handleMessage(context.Background(), m)
+		c.offsets.Track(m)
+
+		// Backpressure, blocks the fetch loop while the worker queue is full
+		select {
+		case queues[c.workerIndex(m)] <- m:
+		case <-fetchCtx.Done():
+			// Left uncommitted, it is redelivered after restart
+			log.Warn("kafka consumer stopping due cancellation")
+			return nil
+		}
 	}
 }
 
-func (c *KafkaConsumer) handleMessage(ctx context.Context, msg kafka.Message) {
+func (c *KafkaConsumer) runWorker(queue <-chan kafka.Message) {
+	log := logging.GetLogger()
+
+	for m := range queue {
+		if err := c.processMessage(c.workCtx, m); err != nil {
+			// Drain deadline passed, the offset stays uncommitted and is redelivered after restart
+			log.Warn("kafka message abandoned before commit", zap.Int("partition", m.Partition), zap.Int64("offset", m.Offset), zap.Error(err))
+			continue
+		}
+
+		commit, ok := c.offsets.Done(m)
+		if !ok {
+			continue
+		}
+		if err := c.reader.CommitMessages(context.Background(), commit); err != nil {
+			log.Error("failed to commit kafka message", zap.Int("partition", commit.Partition), zap.Int64("offset", commit.Offset), zap.Error(err))
+		}
+	}
+}
+
+// workerIndex routes messages by key so per-key ordering holds across the pool.
+func (c *KafkaConsumer) workerIndex(m kafka.Message) int {
+	h := fnv.New32a()
+	if len(m.Key) > 0 {
+		_, _ = h.Write(m.Key)
+	} else {
+		_, _ = h.Write([]byte(strconv.Itoa(m.Partition)))
+	}
+	return int(h.Sum32() % uint32(c.workers))
+}
+
+// processMessage handles the message with bounded retries and dead-letters it once they are exhausted.
+// It only returns an error if ctx is canceled before the message was settled.
+func (c *KafkaConsumer) processMessage(ctx context.Context, msg kafka.Message) error {
+	log := logging.GetLoggerFromContext(ctx)
+
+	var err error
+	attempts := 0
+	for {
+		attempts++
+		err = c.handleMessage(ctx, msg)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, errPoisonMessage) || attempts > c.maxRetries {
+			break
+		}
+
+		backoff := c.backoff(attempts)
+		log.Warn("retrying kafka message",
+			zap.Int("partition", msg.Partition),
+			zap.Int64("offset", msg.Offset),
+			zap.Int("attempt", attempts),
+			zap.Duration("backoff", backoff),
+			zap.Error(err),
+		)
+		if err := sleepContext(ctx, backoff); err != nil {
+			return err
+		}
+	}
+
+	// Dead-letter, retrying the DLQ write itself until it succeeds so the offset is never committed past a lost message
+	for dlqAttempts := 1; ; dlqAttempts++ {
+		if dlqErr := c.producer.SendDeadLetter(ctx, msg, err, attempts); dlqErr == nil {
+			c.failIssueRequest(ctx, msg, err)
+			return nil
+		}
+		if err := sleepContext(ctx, c.backoff(dlqAttempts)); err != nil {
+			return err
+		}
+	}
+}
+
+// failIssueRequest lets the user know a dead-lettered issue message failed. It is best effort,
+// the offset is committed either way and an unreadable message has no request to fail.
+func (c *KafkaConsumer) failIssueRequest(ctx context.Context, msg kafka.Message, cause error) {
+	log := logging.GetLoggerFromContext(ctx)
+
+	var data coupon.IssueCouponMessage
+	if err := json.Unmarshal(msg.Value, &data); err != nil || data.CouponID == "" {
+		return
+	}
+
+	if err := c.service.FailIssueCoupon(ctx, data, cause); err != nil {
+		log.Error("failed to mark dead-lettered issue request failed", zap.String("coupon_id", data.CouponID), zap.Error(err))
+	}
+}
+
+// backoff returns the exponential delay before the given retry attempt, capped at maxRetryBackoff.
+func (c *KafkaConsumer) backoff(attempt int) time.Duration {
+	backoff := c.retryBackoff << (attempt - 1)
+	if backoff <= 0 || backoff > c.maxRetryBackoff {
+		return c.maxRetryBackoff
+	}
+	return backoff
+}
+
+func (c *KafkaConsumer) handleMessage(ctx context.Context, msg kafka.Message) error {
 	ctx, span := tracing.StartSpan(ctx, "V4.KafkaConsumer.handleMessage")
 	defer span.End()
 	log := logging.GetLoggerFromContext(ctx)
@@ -127,7 +407,7 @@ func (c *KafkaConsumer) handleMessage(ctx context.Context, msg kafka.Message) {
 	if err := json.Unmarshal(msg.Value, &data); err != nil {
 		span.RecordError(err)
 		log.Error("failed unmarshal coupon message", zap.Error(err))
-		return
+		return fmt.Errorf("%w, %v", errPoisonMessage, err)
 	}
 
 	log.Info("received message from kafka",
@@ -137,26 +417,68 @@ func (c *KafkaConsumer) handleMessage(ctx context.Context, msg kafka.Message) {
 		zap.String("user_id", data.UserID),
 	)
 
-	// TODO: IDEMPOTENCY CHECK
-	// example pseudo
-	// key := "coupon:processed:" + data.RequestID
-	// exist := redis.Exists(key)
-	// if exist { return }
+	// Idempotency Check, ProcessIssueCoupon also skips coupon IDs already stored in postgres
+	processed, err := c.repo.IsCouponProcessed(ctx, data.CouponID)
+	if err != nil {
+		log.Warn("failed to check processed coupon, falling back to postgres", zap.String("coupon_id", data.CouponID), zap.Error(err))
+	}
+	if processed {
+		log.Warn("skipping already processed coupon message", zap.String("coupon_id", data.CouponID))
+		return nil
+	}
 
 	if err := c.service.ProcessIssueCoupon(ctx, data); err != nil {
 		span.RecordError(err)
 		log.Error("failed to process issue coupon", zap.Error(err))
-		return
+		// A postgres claim limit means redis was flushed and let an extra claim through, retrying cannot help
+		if errors.Is(err, coupon.ErrCouponUserLimitExceeded) {
+			return fmt.Errorf("%w, %v", errPoisonMessage, err)
+		}
+		return err
 	}
 
+	_ = c.repo.MarkCouponProcessed(ctx, data.CouponID, CouponProcessedTTL)
+
 	log.Info("success processed coupon issuance",
 		zap.String("policy_id", data.PolicyID),
 		zap.String("policy_code", data.PolicyCode),
 		zap.String("coupon_id", data.CouponID),
 		zap.String("user_id", data.UserID),
 	)
+	return nil
 }
 
-func (c *KafkaConsumer) Close() {
+// Shutdown stops fetching and waits for the workers to finish the messages already queued.
+// If ctx expires first, in-flight processing is canceled and the remaining offsets are left
+// uncommitted for redelivery. The reader and producer are closed in both cases.
+func (c *KafkaConsumer) Shutdown(ctx context.Context) error {
+	c.quitOnce.Do(func() { close(c.quit) })
+
+	var err error
+	if c.started.Load() {
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			err = ctx.Err()
+			c.cancelWork()
+			<-c.done
+		}
+	}
+	c.cancelWork()
+
 	_ = c.reader.Close()
+	_ = c.producer.Close()
+	return err
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
@@ -0,0 +1,39 @@
+package v4
+
+import (
+	"testing"
+	"time"
+
+	"example.com/coupon-service/internal/config"
+	"example.com/coupon-service/internal/coupontest"
+)
+
+func TestNewKafkaConsumerDefaults(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxRetries     int
+		wantMaxRetries int
+	}{
+		{name: "unset", maxRetries: 0, wantMaxRetries: 5},
+		{name: "negative", maxRetries: -1, wantMaxRetries: 5},
+		{name: "set", maxRetries: 2, wantMaxRetries: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Kafka.Brokers = []string{"localhost:0"}
+			cfg.Kafka.Consumer.MaxRetries = tt.maxRetries
+
+			c := NewKafkaConsumer(cfg, &config.Postgres{}, &config.Redis{}, &coupontest.Publisher{})
+			t.Cleanup(func() { _ = c.reader.Close() })
+
+			if c.maxRetries != tt.wantMaxRetries {
+				t.Errorf("maxRetries = %d, want %d", c.maxRetries, tt.wantMaxRetries)
+			}
+			if c.retryBackoff != 200*time.Millisecond || c.maxRetryBackoff != 10*time.Second || c.workers != 16 || c.queueSize != 64 {
+				t.Errorf("retryBackoff = %s, maxRetryBackoff = %s, workers = %d, queueSize = %d, want the defaults", c.retryBackoff, c.maxRetryBackoff, c.workers, c.queueSize)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package v4
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"time"
 
@@ -9,29 +10,52 @@ import (
 	"example.com/coupon-service/internal/coupon"
 	"example.com/coupon-service/internal/instrument/logging"
 	"example.com/coupon-service/internal/instrument/tracing"
+	"example.com/coupon-service/internal/outbox"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
 
 type IRepository interface {
 	FindCouponPolicyByCodeForUpdateTx(ctx context.Context, tx pgx.Tx, code string) (*coupon.CouponPolicy, error)
 	CountIssuedCouponsTx(ctx context.Context, tx pgx.Tx, policyID string) (int, error)
-	CreateCouponTx(ctx context.Context, tx pgx.Tx, c *coupon.Coupon) (*coupon.Coupon, error)
+	CreateCouponTx(ctx context.Context, tx pgx.Tx, c *coupon.Coupon, event *coupon.CouponEvent) (*coupon.Coupon, error)
+	ExistsCouponByIDTx(ctx context.Context, tx pgx.Tx, id string) (bool, error)
+	ClaimCouponPolicyForUserTx(ctx context.Context, tx pgx.Tx, policyID string, userID string, maxPerUser int) error
+	CreateOutboxMessageTx(ctx context.Context, tx pgx.Tx, msg *outbox.Message) error
+	CreateIssueRequestTx(ctx context.Context, tx pgx.Tx, req *coupon.IssueRequest) error
+	CompleteIssueRequestTx(ctx context.Context, tx pgx.Tx, message coupon.IssueCouponMessage, couponCode string) (*coupon.IssueRequest, error)
+	FailIssueRequest(ctx context.Context, message coupon.IssueCouponMessage, reason string) (*coupon.IssueRequest, error)
+	FindIssueRequestByID(ctx context.Context, id string) (*coupon.IssueRequest, error)
 	FindCouponByCode(ctx context.Context, code string) (*coupon.Coupon, error)
-	UpdateCoupon(ctx context.Context, coupon *coupon.Coupon) (*coupon.Coupon, error)
+	FindCoupons(ctx context.Context, filter coupon.CouponFilter) ([]coupon.Coupon, error)
+	FindCouponEvents(ctx context.Context, couponID string) ([]coupon.CouponEvent, error)
+	UpdateCoupon(ctx context.Context, coupon *coupon.Coupon, event *coupon.CouponEvent) (*coupon.Coupon, error)
 	FindCouponPolicyByID(ctx context.Context, id string) (*coupon.CouponPolicy, error)
 	WithTx(ctx context.Context, fn func(pgx.Tx) error) error
 
 	SetCouponPolicyQuantity(ctx context.Context, code string, quantity int, endTime time.Time) error
 	GetCouponPolicyQuantity(ctx context.Context, code string) (int, error)
 	IncrCouponPolicyQuantity(ctx context.Context, code string) error
-	DecrCouponPolicyQuantity(ctx context.Context, code string) error
+	DecrCouponPolicyQuantity(ctx context.Context, code string) (int, error)
+	IncrCouponPolicyUserClaim(ctx context.Context, code string, userID string, maxPerUser int, endTime time.Time) error
+	DecrCouponPolicyUserClaim(ctx context.Context, code string, userID string) error
+	IsCouponProcessed(ctx context.Context, couponID string) (bool, error)
+	MarkCouponProcessed(ctx context.Context, couponID string, ttl time.Duration) error
 	AcquireRedisLock(ctx context.Context, key string, ttl time.Duration) (bool, error)
 	ReleaseRedisLock(ctx context.Context, key string) error
+	PublishIssueRequest(ctx context.Context, req *coupon.IssueRequest) error
+	SubscribeIssueRequest(ctx context.Context, id string) (<-chan *coupon.IssueRequest, func() error, error)
 }
 
 var (
 	CouponPolicyQuantityKeyPrefix = "coupon:policy:quantity:"
+	CouponPolicyClaimsKeyPrefix   = "coupon:policy:claims:"
+	CouponProcessedKeyPrefix      = "coupon:processed:"
+
+	// CouponIssueRequestChannelPrefix is the pub/sub channel the consumer publishes settled issue requests to
+	CouponIssueRequestChannelPrefix = "coupon:issue:request:"
 )
 
 type repository struct {
@@ -65,6 +89,18 @@ func (r *repository) FindCouponPolicyByCodeForUpdateTx(ctx context.Context, tx p
 			discount_value,
 			minimum_order_amount,
 			maximum_discount_amount,
+			max_per_user,
+			status,
+			include_product_ids,
+			exclude_product_ids,
+			include_categories,
+			exclude_categories,
+			valid_days,
+			issuance_mode,
+			code_prefix,
+			code_length,
+			waiting_room,
+			cancel_mode,
 			created_at,
 			updated_at
 		FROM coupon_policies
@@ -86,6 +122,18 @@ func (r *repository) FindCouponPolicyByCodeForUpdateTx(ctx context.Context, tx p
 		&policy.DiscountValue,
 		&policy.MinimumOrderAmount,
 		&policy.MaximumDiscountAmount,
+		&policy.MaxPerUser,
+		&policy.Status,
+		&policy.IncludeProductIDs,
+		&policy.ExcludeProductIDs,
+		&policy.IncludeCategories,
+		&policy.ExcludeCategories,
+		&policy.ValidDays,
+		&policy.IssuanceMode,
+		&policy.CodePrefix,
+		&policy.CodeLength,
+		&policy.WaitingRoom,
+		&policy.CancelMode,
 		&policy.CreatedAt,
 		&policy.UpdatedAt,
 	)
@@ -108,7 +156,7 @@ func (r *repository) CountIssuedCouponsTx(ctx context.Context, tx pgx.Tx, policy
 	row := tx.QueryRow(ctx, `
         SELECT COUNT(*)
         FROM coupons
-        WHERE coupon_policy_id = $1
+        WHERE coupon_policy_id = $1 AND status <> 'UNASSIGNED' AND NOT quota_released
     `, policyID)
 
 	var count int
@@ -122,36 +170,69 @@ func (r *repository) CountIssuedCouponsTx(ctx context.Context, tx pgx.Tx, policy
 	return count, nil
 }
 
-func (r *repository) CreateCouponTx(ctx context.Context, tx pgx.Tx, c *coupon.Coupon) (*coupon.Coupon, error) {
+func (r *repository) CreateCouponTx(ctx context.Context, tx pgx.Tx, c *coupon.Coupon, event *coupon.CouponEvent) (*coupon.Coupon, error) {
 	ctx, span := tracing.StartSpan(ctx, "V4.Repository.CreateCouponTx")
 	defer span.End()
 
 	log := logging.GetLoggerFromContext(ctx)
 
 	row := tx.QueryRow(ctx, `
-		INSERT INTO coupons (
-			id,
-			code,
-			status,
-			used_at,
-			user_id,
-			order_id,
-			coupon_policy_id,
-			created_at,
-			updated_at
-		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, NOW(), NOW()
+		WITH written AS (
+			INSERT INTO coupons (
+				id,
+				code,
+				status,
+				used_at,
+				user_id,
+				order_id,
+				coupon_policy_id,
+				expires_at,
+				created_at,
+				updated_at
+			) VALUES (
+				$1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW()
+			)
+			ON CONFLICT (code) DO NOTHING
+			RETURNING
+				id,
+				code,
+				status,
+				used_at,
+				user_id,
+				order_id,
+				order_amount,
+				discount_amount,
+				coupon_policy_id,
+				expires_at,
+				created_at,
+				updated_at
+		), event AS (
+			INSERT INTO coupon_events (
+				coupon_id,
+				type,
+				previous_status,
+				status,
+				actor,
+				order_id,
+				trace_id
+			)
+			SELECT id, $9::coupon_event_type, $10::coupon_status, status, $11::TEXT, $12::TEXT, $13::TEXT
+			FROM written
 		)
-		RETURNING 
+		SELECT
 			id,
 			code,
 			status,
 			used_at,
 			user_id,
 			order_id,
+			order_amount,
+			discount_amount,
 			coupon_policy_id,
+			expires_at,
 			created_at,
 			updated_at
+		FROM written
 	`,
 		c.ID,
 		c.Code,
@@ -160,6 +241,12 @@ func (r *repository) CreateCouponTx(ctx context.Context, tx pgx.Tx, c *coupon.Co
 		c.UserID,
 		c.OrderID,
 		c.CouponPolicyID,
+		c.ExpiresAt.UTC(),
+		event.Type,
+		event.PreviousStatus,
+		event.Actor,
+		event.OrderID,
+		event.TraceID,
 	)
 
 	var result coupon.Coupon
@@ -170,12 +257,19 @@ func (r *repository) CreateCouponTx(ctx context.Context, tx pgx.Tx, c *coupon.Co
 		&result.UsedAt,
 		&result.UserID,
 		&result.OrderID,
+		&result.OrderAmount,
+		&result.DiscountAmount,
 		&result.CouponPolicyID,
+		&result.ExpiresAt,
 		&result.CreatedAt,
 		&result.UpdatedAt,
 	)
 	if err != nil {
 		span.RecordError(err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Warn("coupon code collision", zap.String("coupon_code", c.Code))
+			return nil, coupon.ErrCouponCodeConflict
+		}
 		log.Error("failed to create coupon", zap.Error(err))
 		return nil, errors.New("")
 	}
@@ -184,6 +278,30 @@ func (r *repository) CreateCouponTx(ctx context.Context, tx pgx.Tx, c *coupon.Co
 	return &result, nil
 }
 
+func (r *repository) ExistsCouponByIDTx(ctx context.Context, tx pgx.Tx, id string) (bool, error) {
+	ctx, span := tracing.StartSpan(ctx, "V4.Repository.ExistsCouponByIDTx")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	row := tx.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM coupons
+			WHERE id = $1
+		)
+	`, id)
+
+	var exists bool
+	if err := row.Scan(&exists); err != nil {
+		span.RecordError(err)
+		log.Error("failed to check coupon existence", zap.String("coupon_id", id), zap.Error(err))
+		return false, err
+	}
+
+	return exists, nil
+}
+
 func (r *repository) FindCouponByCode(ctx context.Context, code string) (*coupon.Coupon, error) {
 	ctx, span := tracing.StartSpan(ctx, "V4.Repository.FindCouponByCode")
 	defer span.End()
@@ -198,9 +316,15 @@ func (r *repository) FindCouponByCode(ctx context.Context, code string) (*coupon
 			used_at,
 			user_id,
 			order_id,
+			order_amount,
+			discount_amount,
+			reserved_until,
+			quota_released,
 			coupon_policy_id,
+			expires_at,
 			created_at,
-			updated_at
+			updated_at,
+			version
 		FROM coupons
 		WHERE code = $1
 		LIMIT 1
@@ -214,9 +338,15 @@ func (r *repository) FindCouponByCode(ctx context.Context, code string) (*coupon
 		&c.UsedAt,
 		&c.UserID,
 		&c.OrderID,
+		&c.OrderAmount,
+		&c.DiscountAmount,
+		&c.ReservedUntil,
+		&c.QuotaReleased,
 		&c.CouponPolicyID,
+		&c.ExpiresAt,
 		&c.CreatedAt,
 		&c.UpdatedAt,
+		&c.Version,
 	)
 	if err != nil {
 		span.RecordError(err)
@@ -228,37 +358,237 @@ func (r *repository) FindCouponByCode(ctx context.Context, code string) (*coupon
 	return &c, nil
 }
 
-func (r *repository) UpdateCoupon(ctx context.Context, c *coupon.Coupon) (*coupon.Coupon, error) {
+// FindCoupons returns up to filter.Limit+1 coupons after filter.Cursor, newest first,
+// the extra row telling the caller there is a next page.
+func (r *repository) FindCoupons(ctx context.Context, filter coupon.CouponFilter) ([]coupon.Coupon, error) {
+	ctx, span := tracing.StartSpan(ctx, "V4.Repository.FindCoupons")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	var (
+		cursorCreatedAt *time.Time
+		cursorID        string
+	)
+	if filter.Cursor != nil {
+		cursorCreatedAt = &filter.Cursor.CreatedAt
+		cursorID = filter.Cursor.ID
+	}
+
+	rows, err := r.pg.Pool.Query(ctx, `
+		SELECT
+			id,
+			code,
+			status,
+			used_at,
+			user_id,
+			order_id,
+			order_amount,
+			discount_amount,
+			reserved_until,
+			quota_released,
+			coupon_policy_id,
+			expires_at,
+			created_at,
+			updated_at
+		FROM coupons
+		WHERE user_id = $1
+			AND ($2 = '' OR coupon_policy_id = (SELECT id FROM coupon_policies WHERE code = $2))
+			AND ($3 = '' OR status::TEXT = $3)
+			AND ($4::TIMESTAMPTZ IS NULL OR (created_at, id) < ($4::TIMESTAMPTZ, $5::TEXT))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $6
+	`, filter.UserID, filter.PolicyCode, string(filter.Status), cursorCreatedAt, cursorID, filter.Limit+1)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to fetch coupons", zap.String("user_id", filter.UserID), zap.Error(err))
+		return nil, coupon.ErrCouponInternal
+	}
+	defer rows.Close()
+
+	coupons := make([]coupon.Coupon, 0, filter.Limit+1)
+	for rows.Next() {
+		var c coupon.Coupon
+		err := rows.Scan(
+			&c.ID,
+			&c.Code,
+			&c.Status,
+			&c.UsedAt,
+			&c.UserID,
+			&c.OrderID,
+			&c.OrderAmount,
+			&c.DiscountAmount,
+			&c.ReservedUntil,
+			&c.QuotaReleased,
+			&c.CouponPolicyID,
+			&c.ExpiresAt,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+		)
+		if err != nil {
+			span.RecordError(err)
+			log.Error("failed to scan coupon", zap.Error(err))
+			return nil, coupon.ErrCouponInternal
+		}
+		coupons = append(coupons, c)
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		log.Error("failed to iterate coupons", zap.Error(err))
+		return nil, coupon.ErrCouponInternal
+	}
+
+	log.Info("fetched coupons successfully", zap.String("user_id", filter.UserID), zap.Int("count", len(coupons)))
+	return coupons, nil
+}
+
+// FindCouponEvents returns the history of the coupon, oldest first.
+func (r *repository) FindCouponEvents(ctx context.Context, couponID string) ([]coupon.CouponEvent, error) {
+	ctx, span := tracing.StartSpan(ctx, "V4.Repository.FindCouponEvents")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	rows, err := r.pg.Pool.Query(ctx, `
+		SELECT
+			id,
+			coupon_id,
+			type,
+			previous_status,
+			status,
+			actor,
+			order_id,
+			trace_id,
+			reason,
+			created_at
+		FROM coupon_events
+		WHERE coupon_id = $1
+		ORDER BY id
+	`, couponID)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to fetch coupon events", zap.String("coupon_id", couponID), zap.Error(err))
+		return nil, coupon.ErrCouponInternal
+	}
+	defer rows.Close()
+
+	events := make([]coupon.CouponEvent, 0)
+	for rows.Next() {
+		var e coupon.CouponEvent
+		err := rows.Scan(
+			&e.ID,
+			&e.CouponID,
+			&e.Type,
+			&e.PreviousStatus,
+			&e.Status,
+			&e.Actor,
+			&e.OrderID,
+			&e.TraceID,
+			&e.Reason,
+			&e.CreatedAt,
+		)
+		if err != nil {
+			span.RecordError(err)
+			log.Error("failed to scan coupon event", zap.Error(err))
+			return nil, coupon.ErrCouponInternal
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		log.Error("failed to iterate coupon events", zap.Error(err))
+		return nil, coupon.ErrCouponInternal
+	}
+
+	log.Info("fetched coupon events successfully", zap.String("coupon_id", couponID), zap.Int("count", len(events)))
+	return events, nil
+}
+
+// UpdateCoupon writes the coupon and its history event in one statement, only if the coupon is
+// still at the status and version it was read with. A concurrent write makes it return ErrCouponConflict.
+func (r *repository) UpdateCoupon(ctx context.Context, c *coupon.Coupon, event *coupon.CouponEvent) (*coupon.Coupon, error) {
 	ctx, span := tracing.StartSpan(ctx, "V4.Repository.UpdateCoupon")
 	defer span.End()
 
 	log := logging.GetLoggerFromContext(ctx)
 
 	row := r.pg.Pool.QueryRow(ctx, `
-		UPDATE coupons
-		SET
-			status = $1,
-			used_at = $2,
-			user_id = $3,
-			order_id = $4,
-			updated_at = NOW()
-		WHERE id = $5
-		RETURNING
+		WITH written AS (
+			UPDATE coupons
+			SET
+				status = $1,
+				used_at = $2,
+				user_id = $3,
+				order_id = $4,
+				order_amount = $5,
+				discount_amount = $6,
+				reserved_until = $13,
+				quota_released = quota_released OR $14,
+				version = version + 1,
+				updated_at = NOW()
+			WHERE id = $7 AND status = $9::coupon_status AND version = $15
+			RETURNING
+				id,
+				code,
+				status,
+				used_at,
+				user_id,
+				order_id,
+				order_amount,
+				discount_amount,
+				reserved_until,
+				quota_released,
+				coupon_policy_id,
+				expires_at,
+				created_at,
+				updated_at,
+				version
+		), event AS (
+			INSERT INTO coupon_events (
+				coupon_id,
+				type,
+				previous_status,
+				status,
+				actor,
+				order_id,
+				trace_id
+			)
+			SELECT id, $8::coupon_event_type, $9::coupon_status, status, $10::TEXT, $11::TEXT, $12::TEXT
+			FROM written
+		)
+		SELECT
 			id,
 			code,
 			status,
 			used_at,
 			user_id,
 			order_id,
+			order_amount,
+			discount_amount,
+			reserved_until,
+			quota_released,
 			coupon_policy_id,
+			expires_at,
 			created_at,
-			updated_at
+			updated_at,
+			version
+		FROM written
 	`,
 		c.Status,
 		c.UsedAt,
 		c.UserID,
 		c.OrderID,
+		c.OrderAmount,
+		c.DiscountAmount,
 		c.ID,
+		event.Type,
+		event.PreviousStatus,
+		event.Actor,
+		event.OrderID,
+		event.TraceID,
+		c.ReservedUntil,
+		c.QuotaReleased,
+		c.Version,
 	)
 
 	var result coupon.Coupon
@@ -269,12 +599,22 @@ func (r *repository) UpdateCoupon(ctx context.Context, c *coupon.Coupon) (*coupo
 		&result.UsedAt,
 		&result.UserID,
 		&result.OrderID,
+		&result.OrderAmount,
+		&result.DiscountAmount,
+		&result.ReservedUntil,
+		&result.QuotaReleased,
 		&result.CouponPolicyID,
+		&result.ExpiresAt,
 		&result.CreatedAt,
 		&result.UpdatedAt,
+		&result.Version,
 	)
 	if err != nil {
 		span.RecordError(err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Warn("coupon changed since it was read", zap.String("coupon_id", c.ID), zap.Int("version", c.Version))
+			return nil, coupon.ErrCouponConflict
+		}
 		log.Error("failed to update coupon", zap.String("coupon_id", c.ID), zap.Error(err))
 		return nil, errors.New("failed to update coupon")
 	}
@@ -302,6 +642,18 @@ func (r *repository) FindCouponPolicyByID(ctx context.Context, id string) (*coup
 			discount_value,
 			minimum_order_amount,
 			maximum_discount_amount,
+			max_per_user,
+			status,
+			include_product_ids,
+			exclude_product_ids,
+			include_categories,
+			exclude_categories,
+			valid_days,
+			issuance_mode,
+			code_prefix,
+			code_length,
+			waiting_room,
+			cancel_mode,
 			created_at,
 			updated_at
 		FROM coupon_policies
@@ -323,6 +675,18 @@ func (r *repository) FindCouponPolicyByID(ctx context.Context, id string) (*coup
 		&policy.DiscountValue,
 		&policy.MinimumOrderAmount,
 		&policy.MaximumDiscountAmount,
+		&policy.MaxPerUser,
+		&policy.Status,
+		&policy.IncludeProductIDs,
+		&policy.ExcludeProductIDs,
+		&policy.IncludeCategories,
+		&policy.ExcludeCategories,
+		&policy.ValidDays,
+		&policy.IssuanceMode,
+		&policy.CodePrefix,
+		&policy.CodeLength,
+		&policy.WaitingRoom,
+		&policy.CancelMode,
 		&policy.CreatedAt,
 		&policy.UpdatedAt,
 	)
@@ -408,7 +772,8 @@ func (r *repository) IncrCouponPolicyQuantity(ctx context.Context, policyCode st
 	return nil
 }
 
-func (r *repository) DecrCouponPolicyQuantity(ctx context.Context, policyCode string) error {
+// DecrCouponPolicyQuantity reserves a unit of the quota and returns the units left after it.
+func (r *repository) DecrCouponPolicyQuantity(ctx context.Context, policyCode string) (int, error) {
 	ctx, span := tracing.StartSpan(ctx, "V4.Repository.IncrCouponPolicyQuantity")
 	defer span.End()
 
@@ -419,11 +784,11 @@ func (r *repository) DecrCouponPolicyQuantity(ctx context.Context, policyCode st
 	if err != nil {
 		span.RecordError(err)
 		log.Error("failed to increment issued coupon count", zap.String("policy_code", policyCode), zap.Error(err))
-		return err
+		return 0, err
 	}
 
 	log.Info("incremented issued coupon count", zap.String("policy_code", policyCode), zap.Int64("new_value", newVal))
-	return nil
+	return int(newVal), nil
 }
 
 func (r *repository) AcquireRedisLock(ctx context.Context, key string, ttl time.Duration) (bool, error) {
@@ -435,3 +800,405 @@ func (r *repository) ReleaseRedisLock(ctx context.Context, key string) error {
 	_, err := r.rdb.Client.Del(ctx, key).Result()
 	return err
 }
+
+func (r *repository) ClaimCouponPolicyForUserTx(ctx context.Context, tx pgx.Tx, policyID string, userID string, maxPerUser int) error {
+	ctx, span := tracing.StartSpan(ctx, "V4.Repository.ClaimCouponPolicyForUserTx")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO coupon_user_claims (
+			coupon_policy_id,
+			user_id,
+			claimed,
+			max_per_user,
+			created_at,
+			updated_at
+		) VALUES (
+			$1, $2, 1, $3, NOW(), NOW()
+		)
+		ON CONFLICT (coupon_policy_id, user_id) DO UPDATE
+		SET
+			claimed = coupon_user_claims.claimed + 1,
+			max_per_user = EXCLUDED.max_per_user,
+			updated_at = NOW()
+	`, policyID, userID, maxPerUser)
+	if err != nil {
+		span.RecordError(err)
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23514" {
+			log.Warn("user claim limit reached", zap.String("policy_id", policyID), zap.String("user_id", userID), zap.Int("max_per_user", maxPerUser))
+			return coupon.ErrCouponUserLimitExceeded
+		}
+
+		log.Error("failed to claim coupon policy for user", zap.String("policy_id", policyID), zap.String("user_id", userID), zap.Error(err))
+		return err
+	}
+
+	log.Info("claimed coupon policy for user", zap.String("policy_id", policyID), zap.String("user_id", userID))
+	return nil
+}
+
+func (r *repository) CreateOutboxMessageTx(ctx context.Context, tx pgx.Tx, msg *outbox.Message) error {
+	ctx, span := tracing.StartSpan(ctx, "V4.Repository.CreateOutboxMessageTx")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	headers := msg.Headers
+	if headers == nil {
+		headers = map[string]string{}
+	}
+
+	err := tx.QueryRow(ctx, `
+		INSERT INTO outbox (
+			topic,
+			message_key,
+			payload,
+			headers,
+			available_at,
+			created_at
+		) VALUES (
+			$1, $2, $3, $4, NOW(), NOW()
+		)
+		RETURNING id, created_at
+	`, msg.Topic, msg.Key, msg.Payload, headers).Scan(&msg.ID, &msg.CreatedAt)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to create outbox message", zap.String("topic", msg.Topic), zap.String("key", msg.Key), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) CreateIssueRequestTx(ctx context.Context, tx pgx.Tx, req *coupon.IssueRequest) error {
+	ctx, span := tracing.StartSpan(ctx, "V4.Repository.CreateIssueRequestTx")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	err := tx.QueryRow(ctx, `
+		INSERT INTO coupon_issue_requests (
+			id,
+			coupon_policy_id,
+			user_id,
+			coupon_code,
+			status,
+			created_at,
+			updated_at
+		) VALUES (
+			$1, $2, $3, $4, $5, NOW(), NOW()
+		)
+		RETURNING created_at, updated_at
+	`, req.ID, req.CouponPolicyID, req.UserID, req.CouponCode, req.Status).Scan(&req.CreatedAt, &req.UpdatedAt)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to create issue request", zap.String("request_id", req.ID), zap.String("user_id", req.UserID), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// CompleteIssueRequestTx marks the request AVAILABLE with the code the coupon was persisted with.
+// Issuers that do not write a PENDING row (v5) get one here, so the status endpoint covers them once settled.
+func (r *repository) CompleteIssueRequestTx(ctx context.Context, tx pgx.Tx, message coupon.IssueCouponMessage, couponCode string) (*coupon.IssueRequest, error) {
+	ctx, span := tracing.StartSpan(ctx, "V4.Repository.CompleteIssueRequestTx")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	row := tx.QueryRow(ctx, `
+		INSERT INTO coupon_issue_requests (
+			id,
+			coupon_policy_id,
+			user_id,
+			coupon_code,
+			status,
+			created_at,
+			updated_at
+		) VALUES (
+			$1, $2, $3, $4, 'AVAILABLE', NOW(), NOW()
+		)
+		ON CONFLICT (id) DO UPDATE SET
+			coupon_code = EXCLUDED.coupon_code,
+			status = 'AVAILABLE',
+			error = NULL,
+			updated_at = NOW()
+		RETURNING
+			id,
+			coupon_policy_id,
+			user_id,
+			coupon_code,
+			status,
+			error,
+			created_at,
+			updated_at
+	`, message.CouponID, message.PolicyID, message.UserID, couponCode)
+
+	req, err := scanIssueRequest(row)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to complete issue request", zap.String("request_id", message.CouponID), zap.Error(err))
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// FailIssueRequest marks the request FAILED, returning nil if it was already AVAILABLE.
+func (r *repository) FailIssueRequest(ctx context.Context, message coupon.IssueCouponMessage, reason string) (*coupon.IssueRequest, error) {
+	ctx, span := tracing.StartSpan(ctx, "V4.Repository.FailIssueRequest")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	row := r.pg.Pool.QueryRow(ctx, `
+		INSERT INTO coupon_issue_requests (
+			id,
+			coupon_policy_id,
+			user_id,
+			coupon_code,
+			status,
+			error,
+			created_at,
+			updated_at
+		) VALUES (
+			$1, $2, $3, $4, 'FAILED', $5, NOW(), NOW()
+		)
+		ON CONFLICT (id) DO UPDATE SET
+			status = 'FAILED',
+			error = EXCLUDED.error,
+			updated_at = NOW()
+		WHERE coupon_issue_requests.status <> 'AVAILABLE'
+		RETURNING
+			id,
+			coupon_policy_id,
+			user_id,
+			coupon_code,
+			status,
+			error,
+			created_at,
+			updated_at
+	`, message.CouponID, message.PolicyID, message.UserID, message.CouponCode, reason)
+
+	req, err := scanIssueRequest(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		log.Warn("issue request already available, not marking failed", zap.String("request_id", message.CouponID))
+		return nil, nil
+	}
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to mark issue request failed", zap.String("request_id", message.CouponID), zap.Error(err))
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func (r *repository) FindIssueRequestByID(ctx context.Context, id string) (*coupon.IssueRequest, error) {
+	ctx, span := tracing.StartSpan(ctx, "V4.Repository.FindIssueRequestByID")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	row := r.pg.Pool.QueryRow(ctx, `
+		SELECT
+			id,
+			coupon_policy_id,
+			user_id,
+			coupon_code,
+			status,
+			error,
+			created_at,
+			updated_at
+		FROM coupon_issue_requests
+		WHERE id = $1
+	`, id)
+
+	req, err := scanIssueRequest(row)
+	if err != nil {
+		span.RecordError(err)
+		log.Warn("failed to fetch issue request", zap.String("request_id", id), zap.Error(err))
+		return nil, coupon.ErrIssueRequestNotFound
+	}
+
+	return req, nil
+}
+
+func scanIssueRequest(row pgx.Row) (*coupon.IssueRequest, error) {
+	var req coupon.IssueRequest
+	err := row.Scan(
+		&req.ID,
+		&req.CouponPolicyID,
+		&req.UserID,
+		&req.CouponCode,
+		&req.Status,
+		&req.Error,
+		&req.CreatedAt,
+		&req.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+var incrCouponPolicyUserClaimScript = redis.NewScript(`
+	local claimed = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+	if claimed >= tonumber(ARGV[2]) then
+		return -1
+	end
+	claimed = redis.call('HINCRBY', KEYS[1], ARGV[1], 1)
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+	return claimed
+`)
+
+var decrCouponPolicyUserClaimScript = redis.NewScript(`
+	local claimed = redis.call('HINCRBY', KEYS[1], ARGV[1], -1)
+	if claimed <= 0 then
+		redis.call('HDEL', KEYS[1], ARGV[1])
+	end
+	return claimed
+`)
+
+// IncrCouponPolicyUserClaim atomically checks and increments the user's claim counter,
+// returning coupon.ErrCouponUserLimitExceeded once maxPerUser has been reached.
+func (r *repository) IncrCouponPolicyUserClaim(ctx context.Context, policyCode string, userID string, maxPerUser int, endTime time.Time) error {
+	ctx, span := tracing.StartSpan(ctx, "V4.Repository.IncrCouponPolicyUserClaim")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	key := CouponPolicyClaimsKeyPrefix + policyCode
+	ttl := time.Until(endTime)
+	if ttl <= 0 {
+		ttl = time.Millisecond
+	}
+
+	claimed, err := incrCouponPolicyUserClaimScript.Run(ctx, r.rdb.Client, []string{key}, userID, maxPerUser, ttl.Milliseconds()).Int()
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to increment user claim", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
+		return err
+	}
+
+	if claimed < 0 {
+		log.Warn("user claim limit reached (redis)", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Int("max_per_user", maxPerUser))
+		return coupon.ErrCouponUserLimitExceeded
+	}
+
+	log.Info("incremented user claim", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Int("claimed", claimed))
+	return nil
+}
+
+func (r *repository) DecrCouponPolicyUserClaim(ctx context.Context, policyCode string, userID string) error {
+	ctx, span := tracing.StartSpan(ctx, "V4.Repository.DecrCouponPolicyUserClaim")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	key := CouponPolicyClaimsKeyPrefix + policyCode
+	claimed, err := decrCouponPolicyUserClaimScript.Run(ctx, r.rdb.Client, []string{key}, userID).Int()
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to decrement user claim", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
+		return err
+	}
+
+	log.Info("decremented user claim", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Int("claimed", claimed))
+	return nil
+}
+
+func (r *repository) IsCouponProcessed(ctx context.Context, couponID string) (bool, error) {
+	ctx, span := tracing.StartSpan(ctx, "V4.Repository.IsCouponProcessed")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	key := CouponProcessedKeyPrefix + couponID
+	n, err := r.rdb.Client.Exists(ctx, key).Result()
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to check processed coupon", zap.String("coupon_id", couponID), zap.Error(err))
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+func (r *repository) MarkCouponProcessed(ctx context.Context, couponID string, ttl time.Duration) error {
+	ctx, span := tracing.StartSpan(ctx, "V4.Repository.MarkCouponProcessed")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	key := CouponProcessedKeyPrefix + couponID
+	if err := r.rdb.Client.Set(ctx, key, 1, ttl).Err(); err != nil {
+		span.RecordError(err)
+		log.Error("failed to mark coupon processed", zap.String("coupon_id", couponID), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) PublishIssueRequest(ctx context.Context, req *coupon.IssueRequest) error {
+	ctx, span := tracing.StartSpan(ctx, "V4.Repository.PublishIssueRequest")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	payload, err := json.Marshal(req)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to marshal issue request", zap.String("request_id", req.ID), zap.Error(err))
+		return err
+	}
+
+	if err := r.rdb.Client.Publish(ctx, CouponIssueRequestChannelPrefix+req.ID, payload).Err(); err != nil {
+		span.RecordError(err)
+		log.Error("failed to publish issue request", zap.String("request_id", req.ID), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// SubscribeIssueRequest returns the settled requests published for id. The subscription is
+// confirmed before returning, so a status read afterwards cannot miss an update.
+func (r *repository) SubscribeIssueRequest(ctx context.Context, id string) (<-chan *coupon.IssueRequest, func() error, error) {
+	ctx, span := tracing.StartSpan(ctx, "V4.Repository.SubscribeIssueRequest")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	pubsub := r.rdb.Client.Subscribe(ctx, CouponIssueRequestChannelPrefix+id)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		span.RecordError(err)
+		log.Error("failed to subscribe issue request", zap.String("request_id", id), zap.Error(err))
+		return nil, nil, err
+	}
+
+	updates := make(chan *coupon.IssueRequest, 1)
+	go func() {
+		defer close(updates)
+		for msg := range pubsub.Channel() {
+			var req coupon.IssueRequest
+			if err := json.Unmarshal([]byte(msg.Payload), &req); err != nil {
+				log.Warn("failed to unmarshal issue request update", zap.String("request_id", id), zap.Error(err))
+				continue
+			}
+			select {
+			case updates <- &req:
+			default:
+			}
+		}
+	}()
+
+	return updates, pubsub.Close, nil
+}
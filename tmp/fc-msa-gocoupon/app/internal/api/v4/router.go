@@ -1,11 +1,14 @@
 package v4
 
 import (
+	"example.com/coupon-service/internal/admission"
 	"example.com/coupon-service/internal/api/middleware"
 	"example.com/coupon-service/internal/config"
+	"example.com/coupon-service/internal/domainevent"
+	"example.com/coupon-service/internal/idempotency"
 	"github.com/labstack/echo/v4"
 
-	_ "example.com/coupon-service/internal/api/v3/docs"
+	_ "example.com/coupon-service/internal/api/v4/docs"
 	echoSwagger "github.com/swaggo/echo-swagger"
 )
 
@@ -17,17 +20,28 @@ import (
 // @securityDefinitions.apikey ApiKeyAuth
 // @in header
 // @name X-USER-ID
-func RegisterAPIV4(group *echo.Group, cfg *config.Config, pg *config.Postgres, rdb *config.Redis) {
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+func RegisterAPIV4(group *echo.Group, cfg *config.Config, pg *config.Postgres, rdb *config.Redis, idempotencyStore idempotency.IStore, admissionQueue *admission.Queue, events domainevent.IPublisher) {
 	repository := NewRepository(pg, rdb)
-	kafkaProducer := NewKafkaProducer(cfg.Kafka.Brokers)
-	service := NewService(repository, kafkaProducer)
+	service := NewService(repository, events)
 	handler := NewHandler(service)
 
 	coupons := group.Group("/v4/coupons")
-	coupons.POST("/issue", handler.IssueCoupon, middleware.UserIDMiddleware())
-	coupons.POST("/use", handler.UseCoupon, middleware.UserIDMiddleware())
-	coupons.POST("/cancel", handler.CancelCoupon, middleware.UserIDMiddleware())
+	coupons.POST("/issue", handler.IssueCoupon, middleware.UserIDMiddleware(), middleware.WaitingRoomMiddleware(admissionQueue, idempotencyStore), middleware.IdempotencyMiddleware(idempotencyStore))
+	coupons.POST("/use", handler.UseCoupon, middleware.UserIDMiddleware(), middleware.IdempotencyMiddleware(idempotencyStore))
+	coupons.POST("/cancel", handler.CancelCoupon, middleware.UserIDMiddleware(), middleware.IdempotencyMiddleware(idempotencyStore))
+	coupons.POST("/reserve", handler.ReserveCoupon, middleware.UserIDMiddleware(), middleware.IdempotencyMiddleware(idempotencyStore))
+	coupons.POST("/confirm", handler.ConfirmCoupon, middleware.UserIDMiddleware(), middleware.IdempotencyMiddleware(idempotencyStore))
+	coupons.POST("/release", handler.ReleaseCoupon, middleware.UserIDMiddleware(), middleware.IdempotencyMiddleware(idempotencyStore))
+	coupons.POST("/quote", handler.QuoteCoupon, middleware.UserIDMiddleware())
+	coupons.GET("", handler.FindCoupons, middleware.UserIDMiddleware())
+	coupons.GET("/requests/:request_id", handler.FindIssueRequest, middleware.UserIDMiddleware())
+	coupons.GET("/requests/:request_id/events", handler.StreamIssueRequest, middleware.UserIDMiddleware())
 	coupons.GET("/:coupon_code", handler.FindCouponByCode, middleware.UserIDMiddleware())
+	coupons.GET("/:coupon_code/history", handler.FindCouponHistory, middleware.UserIDMiddleware())
 
 	coupons.GET("/swagger/*", echoSwagger.EchoWrapHandler(
 		echoSwagger.InstanceName("couponsApiV4"),
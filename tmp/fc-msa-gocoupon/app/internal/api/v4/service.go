@@ -2,12 +2,18 @@ package v4
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/couponcode"
+	"example.com/coupon-service/internal/domainevent"
 	"example.com/coupon-service/internal/instrument/logging"
 	"example.com/coupon-service/internal/instrument/metrics"
 	"example.com/coupon-service/internal/instrument/tracing"
+	"example.com/coupon-service/internal/outbox"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/prometheus/client_golang/prometheus"
@@ -17,26 +23,60 @@ import (
 type IService interface {
 	IssueCoupon(ctx context.Context, policyCode string, userID string) (*coupon.Coupon, error)
 	ProcessIssueCoupon(ctx context.Context, message coupon.IssueCouponMessage) error
-	UseCoupon(ctx context.Context, couponCode string, userID string, orderID string) (*coupon.Coupon, error)
+	FailIssueCoupon(ctx context.Context, message coupon.IssueCouponMessage, cause error) error
+	FindIssueRequest(ctx context.Context, requestID string, userID string) (*coupon.IssueRequest, error)
+	WaitIssueRequest(ctx context.Context, requestID string, userID string) (*coupon.IssueRequest, error)
+	UseCoupon(ctx context.Context, couponCode string, userID string, order coupon.Order) (*coupon.Coupon, error)
+	QuoteCoupon(ctx context.Context, couponCode string, userID string, order coupon.Order) (*coupon.CouponQuote, error)
 	CancelCoupon(ctx context.Context, couponCode string, userID string) (*coupon.Coupon, error)
+	ReserveCoupon(ctx context.Context, couponCode string, userID string, order coupon.Order, ttl time.Duration) (*coupon.Coupon, error)
+	ConfirmCoupon(ctx context.Context, couponCode string, userID string, orderID string) (*coupon.Coupon, error)
+	ReleaseCoupon(ctx context.Context, couponCode string, userID string, orderID string) (*coupon.Coupon, error)
 	FindCouponByCode(ctx context.Context, couponCode string, userID string) (*coupon.Coupon, error)
+	FindCoupons(ctx context.Context, userID string, filter coupon.CouponFilter, cursor string) (*coupon.CouponPage, error)
+	FindCouponHistory(ctx context.Context, couponCode string, userID string) (*coupon.CouponHistory, error)
 }
 
 type service struct {
-	repo         IRepository
-	kafkaProcuer *KafkaProducer
+	repo   IRepository
+	events domainevent.IPublisher
 }
 
-func NewService(
-	repo IRepository,
-	kafkaProducer *KafkaProducer,
-) IService {
+func NewService(repo IRepository, events domainevent.IPublisher) IService {
 	return &service{
-		repo:         repo,
-		kafkaProcuer: kafkaProducer,
+		repo:   repo,
+		events: events,
 	}
 }
 
+// publishEvent announces a committed state change. It is best effort, the change is not
+// rolled back and the coupon history still records it if the event is lost.
+func (s *service) publishEvent(ctx context.Context, eventType domainevent.Type, key string, data any) {
+	log := logging.GetLoggerFromContext(ctx)
+
+	event, err := domainevent.New(eventType, key, tracing.TraceID(ctx), data)
+	if err == nil {
+		err = s.events.Publish(ctx, event)
+	}
+	if err != nil {
+		log.Error("failed to publish domain event", zap.String("type", string(eventType)), zap.String("key", key), zap.Error(err))
+	}
+}
+
+// parseCode normalizes a coupon code sent by the client, rejecting a malformed one or a typo
+// caught by its check character as ErrCouponCodeInvalid.
+func (s *service) parseCode(ctx context.Context, couponCode string) (string, error) {
+	log := logging.GetLoggerFromContext(ctx)
+
+	normalized, err := couponcode.Parse(couponCode)
+	if err != nil {
+		err = fmt.Errorf("%w, %v", coupon.ErrCouponCodeInvalid, err)
+		log.Warn("invalid coupon code", zap.String("coupon_code", couponCode), zap.Error(err))
+		return "", err
+	}
+	return normalized, nil
+}
+
 // Problem Summary:
 // Previous Failure Scenario:
 // Root Causes:
@@ -53,7 +93,13 @@ func (s *service) IssueCoupon(ctx context.Context, policyCode string, userID str
 	)
 	defer couponIssueDuration.ObserveDuration()
 
-	var createdCoupon *coupon.Coupon
+	var (
+		createdCoupon   *coupon.Coupon
+		reservedCode    string
+		claimReserved   bool
+		quotaReserved   bool
+		exhaustedPolicy *coupon.CouponPolicy
+	)
 
 	err := s.repo.WithTx(ctx, func(tx pgx.Tx) error {
 		// Retrieve Coupon Policy
@@ -63,14 +109,34 @@ func (s *service) IssueCoupon(ctx context.Context, policyCode string, userID str
 			log.Warn("failed to get coupon policy not found", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
 			return coupon.ErrCouponPolicyNotFound
 		}
+		reservedCode = policy.Code
+
+		// Check Policy Status and Valid Period
+		if err := policy.IsIssuable(); err != nil {
+			span.RecordError(err)
+			log.Warn("coupon policy not issuable", zap.String("policy_code", policyCode), zap.Error(err))
+			return err
+		}
 
-		// Check Valid Period
-		if err := policy.IsValidPeriod(); err != nil {
+		// Check Issuance Mode, POOL policies are issued from their pool by v5 only
+		if err := policy.CheckOnDemand(); err != nil {
 			span.RecordError(err)
-			log.Warn("coupon policy not valid period", zap.String("policy_code", policyCode), zap.Error(err))
+			log.Warn("coupon policy issues from a pool", zap.String("policy_code", policyCode), zap.Error(err))
 			return err
 		}
 
+		// Check User Eligibility (redis)
+		if err := s.repo.IncrCouponPolicyUserClaim(ctx, policy.Code, userID, policy.MaxPerUser, policy.EndTime); err != nil {
+			span.RecordError(err)
+			if errors.Is(err, coupon.ErrCouponUserLimitExceeded) {
+				log.Warn("user claim limit reached (redis)", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
+				return policy.UserLimitError()
+			}
+			log.Error("failed to increment user claim", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
+			return coupon.ErrCouponInternal
+		}
+		claimReserved = true
+
 		// Check Available Quantity
 		available, err := s.repo.GetCouponPolicyQuantity(ctx, policy.Code)
 		if err != nil {
@@ -92,21 +158,34 @@ func (s *service) IssueCoupon(ctx context.Context, policyCode string, userID str
 			return err
 		}
 
-		err = s.repo.DecrCouponPolicyQuantity(ctx, policy.Code)
+		remaining, err := s.repo.DecrCouponPolicyQuantity(ctx, policy.Code)
 		if err != nil {
 			span.RecordError(err)
 			log.Error("failed to decrement redis quota", zap.String("policy_code", policyCode), zap.Error(err))
 			return coupon.ErrCouponInternal
 		}
+		quotaReserved = true
+		if remaining == 0 {
+			exhaustedPolicy = policy
+		}
 
-		// TODO: Check User Eligibility
-		// TODO: Check Order / Product Requirements (optional)
+		// Check User Eligibility (postgres), backstop for a flushed or lagging redis counter
+		if err := s.repo.ClaimCouponPolicyForUserTx(ctx, tx, policy.ID, userID, policy.MaxPerUser); err != nil {
+			span.RecordError(err)
+			if errors.Is(err, coupon.ErrCouponUserLimitExceeded) {
+				log.Warn("user claim limit reached", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
+				return policy.UserLimitError()
+			}
+			log.Error("failed to claim coupon policy for user", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
+			return coupon.ErrCouponInternal
+		}
 
 		// Request Create New Coupon
 		tempCoupon := &coupon.Coupon{
-			ID:     uuid.New().String(),
-			Code:   uuid.New().String(),
-			Status: coupon.CouponStatusPending,
+			ID:        uuid.New().String(),
+			Code:      policy.NewCouponCode(),
+			Status:    coupon.CouponStatusPending,
+			ExpiresAt: policy.CouponExpiresAt(time.Now()),
 		}
 
 		issueCouponMsg := coupon.IssueCouponMessage{
@@ -115,12 +194,38 @@ func (s *service) IssueCoupon(ctx context.Context, policyCode string, userID str
 			CouponID:   tempCoupon.ID,
 			CouponCode: tempCoupon.Code,
 			UserID:     userID,
+			ExpiresAt:  tempCoupon.ExpiresAt,
+		}
+
+		payload, err := json.Marshal(issueCouponMsg)
+		if err != nil {
+			span.RecordError(err)
+			log.Error("failed to marshal issue coupon message", zap.String("policy_code", policyCode), zap.Error(err))
+			return coupon.ErrCouponInternal
+		}
+
+		// Enqueue Issue Message (outbox), published by the relay only if this transaction commits.
+		// Keyed by user, same as the direct producer, so one user's requests stay in order
+		if err := s.repo.CreateOutboxMessageTx(ctx, tx, &outbox.Message{
+			Topic:   TopicCouponIssue,
+			Key:     userID,
+			Payload: payload,
+		}); err != nil {
+			span.RecordError(err)
+			log.Error("failed to enqueue issue coupon message", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
+			return coupon.ErrCouponInternal
 		}
 
-		if err := s.kafkaProcuer.SendIssueCoupon(ctx, issueCouponMsg); err != nil {
+		// Track Issue Request, the returned coupon ID doubles as the request ID for status polling
+		if err := s.repo.CreateIssueRequestTx(ctx, tx, &coupon.IssueRequest{
+			ID:             tempCoupon.ID,
+			CouponPolicyID: policy.ID,
+			UserID:         userID,
+			CouponCode:     tempCoupon.Code,
+			Status:         coupon.IssueRequestStatusPending,
+		}); err != nil {
 			span.RecordError(err)
-			_ = s.repo.IncrCouponPolicyQuantity(ctx, policy.Code)
-			log.Error("failed to issue coupon not created", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
+			log.Error("failed to create issue request", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
 			return coupon.ErrCouponInternal
 		}
 
@@ -129,9 +234,30 @@ func (s *service) IssueCoupon(ctx context.Context, policyCode string, userID str
 	})
 
 	if err != nil {
+		// Release Redis Reservations, also reached when the commit itself fails
+		if quotaReserved {
+			_ = s.repo.IncrCouponPolicyQuantity(ctx, reservedCode)
+		}
+		if claimReserved {
+			_ = s.repo.DecrCouponPolicyUserClaim(ctx, reservedCode, userID)
+		}
+		if createdCoupon != nil {
+			span.RecordError(err)
+			log.Error("failed to commit issue coupon", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
+			return nil, coupon.ErrCouponInternal
+		}
 		return nil, err
 	}
 
+	// Announce Exhausted Policy, only the issue that took the last unit sees zero
+	if exhaustedPolicy != nil {
+		s.publishEvent(ctx, domainevent.TypePolicyExhausted, exhaustedPolicy.ID, domainevent.PolicyExhausted{
+			PolicyID:      exhaustedPolicy.ID,
+			PolicyCode:    exhaustedPolicy.Code,
+			TotalQuantity: exhaustedPolicy.TotalQuantity,
+		})
+	}
+
 	// Return New Coupon
 	log.Info("issue coupon successfully", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.String("coupon_code", createdCoupon.Code))
 	return createdCoupon, nil
@@ -143,9 +269,47 @@ func (s *service) ProcessIssueCoupon(ctx context.Context, message coupon.IssueCo
 
 	log := logging.GetLoggerFromContext(ctx)
 
-	var createdCoupon *coupon.Coupon
+	var (
+		createdCoupon *coupon.Coupon
+		issueRequest  *coupon.IssueRequest
+	)
 
 	err := s.repo.WithTx(ctx, func(tx pgx.Tx) error {
+		// Skip Redelivered Message
+		exists, err := s.repo.ExistsCouponByIDTx(ctx, tx, message.CouponID)
+		if err != nil {
+			span.RecordError(err)
+			log.Error("failed to check coupon existence", zap.String("coupon_id", message.CouponID), zap.Error(err))
+			return coupon.ErrCouponInternal
+		}
+		if exists {
+			log.Warn("coupon already processed, skipping duplicate message", zap.String("policy_code", message.PolicyCode), zap.String("coupon_id", message.CouponID))
+			return nil
+		}
+
+		// Resolve Coupon Expiry, messages published before expires_at was added carry none
+		expiresAt := message.ExpiresAt
+		if expiresAt.IsZero() || message.RecordClaim {
+			policy, err := s.repo.FindCouponPolicyByID(ctx, message.PolicyID)
+			if err != nil || policy == nil {
+				span.RecordError(err)
+				log.Error("failed to get coupon policy not found", zap.String("policy_id", message.PolicyID), zap.Error(err))
+				return coupon.ErrCouponPolicyNotFound
+			}
+			if expiresAt.IsZero() {
+				expiresAt = policy.CouponExpiresAt(time.Now())
+			}
+
+			// Record User Claim, for issuers that only claimed in redis
+			if message.RecordClaim {
+				if err := s.repo.ClaimCouponPolicyForUserTx(ctx, tx, policy.ID, message.UserID, policy.MaxPerUser); err != nil {
+					span.RecordError(err)
+					log.Error("failed to record user claim", zap.String("policy_code", message.PolicyCode), zap.String("user_id", message.UserID), zap.Error(err))
+					return err
+				}
+			}
+		}
+
 		// Create New Coupon
 		tempCoupon := &coupon.Coupon{
 			ID:             message.CouponID,
@@ -155,17 +319,44 @@ func (s *service) ProcessIssueCoupon(ctx context.Context, message coupon.IssueCo
 			UserID:         message.UserID,
 			OrderID:        nil,
 			CouponPolicyID: message.PolicyID,
+			ExpiresAt:      expiresAt,
 		}
 
-		tempCoupon, err := s.repo.CreateCouponTx(ctx, tx, tempCoupon)
+		event := coupon.NewCouponEvent(coupon.CouponEventTypeIssued, "", message.UserID, nil, tracing.TraceID(ctx))
+
+		// The redis quota is not returned on failure, the consumer retries and dead-letters the
+		// message so the PENDING coupon is still created later and keeps its reserved unit.
+		created, err := s.repo.CreateCouponTx(ctx, tx, tempCoupon, event)
+
+		// The code was already returned to the user as PENDING, so a collision keeps the coupon
+		// ID and replaces only the code. With 32^12 codes per prefix this should never happen.
+		for attempt := 1; errors.Is(err, coupon.ErrCouponCodeConflict) && attempt < couponcode.MaxAttempts; attempt++ {
+			policy, findErr := s.repo.FindCouponPolicyByID(ctx, message.PolicyID)
+			if findErr != nil || policy == nil {
+				span.RecordError(findErr)
+				log.Error("failed to get coupon policy not found", zap.String("policy_id", message.PolicyID), zap.Error(findErr))
+				return coupon.ErrCouponPolicyNotFound
+			}
+
+			tempCoupon.Code = policy.NewCouponCode()
+			log.Warn("coupon code collision, issuing with a new code", zap.String("coupon_id", message.CouponID), zap.String("pending_code", message.CouponCode), zap.String("coupon_code", tempCoupon.Code))
+			created, err = s.repo.CreateCouponTx(ctx, tx, tempCoupon, event)
+		}
 		if err != nil {
 			span.RecordError(err)
-			_ = s.repo.IncrCouponPolicyQuantity(ctx, message.PolicyCode)
 			log.Error("failed to issue coupon not created", zap.String("policy_code", message.PolicyCode), zap.String("user_id", message.UserID), zap.Error(err))
 			return coupon.ErrCouponInternal
 		}
 
-		createdCoupon = tempCoupon
+		// Settle Issue Request, in the same transaction so the status never runs ahead of the coupon
+		issueRequest, err = s.repo.CompleteIssueRequestTx(ctx, tx, message, created.Code)
+		if err != nil {
+			span.RecordError(err)
+			log.Error("failed to complete issue request", zap.String("coupon_id", message.CouponID), zap.Error(err))
+			return coupon.ErrCouponInternal
+		}
+
+		createdCoupon = created
 		return nil
 	})
 
@@ -173,17 +364,129 @@ func (s *service) ProcessIssueCoupon(ctx context.Context, message coupon.IssueCo
 		return err
 	}
 
+	if createdCoupon == nil {
+		return nil
+	}
+
+	// Notify Status Watchers, pollers still see the committed status if this is lost
+	_ = s.repo.PublishIssueRequest(ctx, issueRequest)
+
+	s.publishEvent(ctx, domainevent.TypeCouponIssued, createdCoupon.ID, domainevent.CouponIssued{
+		CouponID:   createdCoupon.ID,
+		CouponCode: createdCoupon.Code,
+		PolicyID:   createdCoupon.CouponPolicyID,
+		UserID:     createdCoupon.UserID,
+		ExpiresAt:  createdCoupon.ExpiresAt,
+	})
+
 	// Return New Coupon
 	log.Info("process issue coupon successfully", zap.String("policy_code", message.PolicyCode), zap.String("user_id", message.UserID), zap.String("coupon_code", createdCoupon.Code))
 	return nil
 }
 
-func (s *service) UseCoupon(ctx context.Context, couponCode string, userID string, orderID string) (*coupon.Coupon, error) {
+// FailIssueCoupon marks the request of a dead-lettered message FAILED and notifies its watchers.
+// The reserved redis quota is kept, a DLQ replay can still persist the coupon and flip it to AVAILABLE.
+func (s *service) FailIssueCoupon(ctx context.Context, message coupon.IssueCouponMessage, cause error) error {
+	ctx, span := tracing.StartSpan(ctx, "V4.Service.FailIssueCoupon")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	issueRequest, err := s.repo.FailIssueRequest(ctx, message, cause.Error())
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to mark issue request failed", zap.String("coupon_id", message.CouponID), zap.Error(err))
+		return coupon.ErrCouponInternal
+	}
+	if issueRequest == nil {
+		return nil
+	}
+
+	_ = s.repo.PublishIssueRequest(ctx, issueRequest)
+
+	log.Warn("issue request failed", zap.String("policy_code", message.PolicyCode), zap.String("coupon_id", message.CouponID), zap.String("user_id", message.UserID), zap.Error(cause))
+	return nil
+}
+
+func (s *service) FindIssueRequest(ctx context.Context, requestID string, userID string) (*coupon.IssueRequest, error) {
+	ctx, span := tracing.StartSpan(ctx, "V4.Service.FindIssueRequest")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	// Retrieve Issue Request
+	req, err := s.repo.FindIssueRequestByID(ctx, requestID)
+	if err != nil || req == nil {
+		span.RecordError(err)
+		log.Warn("failed to get issue request", zap.String("request_id", requestID), zap.Error(err))
+		return nil, coupon.ErrIssueRequestNotFound
+	}
+
+	// Check Request Owner
+	if req.UserID != userID {
+		err := coupon.ErrCouponNotOwner
+		span.RecordError(err)
+		log.Warn("failed to get issue request not owner", zap.String("request_id", requestID), zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// WaitIssueRequest blocks until the request is settled or ctx is done, returning the final request.
+func (s *service) WaitIssueRequest(ctx context.Context, requestID string, userID string) (*coupon.IssueRequest, error) {
+	ctx, span := tracing.StartSpan(ctx, "V4.Service.WaitIssueRequest")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	// Subscribe First, so an update published between the read below and the wait is not missed
+	updates, unsubscribe, err := s.repo.SubscribeIssueRequest(ctx, requestID)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to subscribe issue request", zap.String("request_id", requestID), zap.Error(err))
+		return nil, coupon.ErrCouponInternal
+	}
+	defer func() { _ = unsubscribe() }()
+
+	// Check Current Status
+	req, err := s.FindIssueRequest(ctx, requestID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if req.IsFinal() {
+		return req, nil
+	}
+
+	// Wait For Consumer
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				return nil, coupon.ErrCouponInternal
+			}
+			if update.IsFinal() {
+				return update, nil
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *service) UseCoupon(ctx context.Context, couponCode string, userID string, order coupon.Order) (*coupon.Coupon, error) {
 	ctx, span := tracing.StartSpan(ctx, "V4.Service.UseCoupon")
 	defer span.End()
 
 	log := logging.GetLoggerFromContext(ctx)
 
+	// Check Coupon Code Format
+	couponCode, err := s.parseCode(ctx, couponCode)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
 	// Retrieve Coupon Policy
 	c, err := s.repo.FindCouponByCode(ctx, couponCode)
 	if err != nil || c == nil {
@@ -200,34 +503,141 @@ func (s *service) UseCoupon(ctx context.Context, couponCode string, userID strin
 		return nil, err
 	}
 
-	// TODO: Retrieve Coupon Policy
-	// TODO: Check Policy Validity
-
 	// Check Coupon Status
-	if err := c.Use(orderID); err != nil {
+	if err := c.CheckUsable(); err != nil {
+		span.RecordError(err)
+		log.Warn("failed to use coupon not match status", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("order_id", order.ID), zap.Error(err))
+		return nil, err
+	}
+
+	// Retrieve Coupon Policy
+	policy, err := s.repo.FindCouponPolicyByID(ctx, c.CouponPolicyID)
+	if err != nil || policy == nil {
+		span.RecordError(err)
+		log.Warn("failed to get coupon policy not found", zap.String("coupon_code", couponCode), zap.String("policy_id", c.CouponPolicyID), zap.Error(err))
+		return nil, coupon.ErrCouponPolicyNotFound
+	}
+
+	// Calculate Discount
+	discount, err := policy.CalculateDiscount(order)
+	if err != nil {
 		span.RecordError(err)
-		log.Warn("failed to use coupon not match status", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("order_id", orderID), zap.Error(err))
+		log.Warn("failed to use coupon order not eligible", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("order_id", order.ID), zap.Error(err))
+		return nil, err
+	}
+
+	// Use Coupon
+	previousStatus := c.Status
+	if err := c.Use(order, discount); err != nil {
+		span.RecordError(err)
+		log.Warn("failed to use coupon not match status", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("order_id", order.ID), zap.Error(err))
 		return nil, err
 	}
 
 	// Update Coupon
-	updatedCoupon, err := s.repo.UpdateCoupon(ctx, c)
+	event := coupon.NewCouponEvent(coupon.CouponEventTypeUsed, previousStatus, userID, c.OrderID, tracing.TraceID(ctx))
+	updatedCoupon, err := s.repo.UpdateCoupon(ctx, c, event)
 	if err != nil {
 		span.RecordError(err)
+		if errors.Is(err, coupon.ErrCouponConflict) {
+			log.Warn("failed to update coupon changed concurrently", zap.String("coupon_code", couponCode), zap.Error(err))
+			return nil, err
+		}
 		log.Error("failed to update coupon", zap.String("coupon_code", couponCode), zap.Error(err))
 		return nil, coupon.ErrCouponInternal
 	}
 
-	log.Info("coupon used successfully", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("order_id", orderID))
+	s.publishEvent(ctx, domainevent.TypeCouponUsed, updatedCoupon.ID, domainevent.CouponUsed{
+		CouponID:       updatedCoupon.ID,
+		CouponCode:     updatedCoupon.Code,
+		PolicyID:       updatedCoupon.CouponPolicyID,
+		UserID:         updatedCoupon.UserID,
+		OrderID:        order.ID,
+		OrderAmount:    order.Total(),
+		DiscountAmount: discount,
+		UsedAt:         *c.UsedAt,
+	})
+
+	log.Info("coupon used successfully", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("order_id", order.ID), zap.Int("discount_amount", discount))
 	return updatedCoupon, nil
 }
 
+// QuoteCoupon returns the discount the coupon would give on the order without using it.
+func (s *service) QuoteCoupon(ctx context.Context, couponCode string, userID string, order coupon.Order) (*coupon.CouponQuote, error) {
+	ctx, span := tracing.StartSpan(ctx, "V4.Service.QuoteCoupon")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	// Check Coupon Code Format
+	couponCode, err := s.parseCode(ctx, couponCode)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	// Retrieve Coupon
+	c, err := s.repo.FindCouponByCode(ctx, couponCode)
+	if err != nil || c == nil {
+		span.RecordError(err)
+		log.Warn("failed to get coupon by code", zap.String("coupon_code", couponCode), zap.Error(err))
+		return nil, coupon.ErrCouponNotFound
+	}
+
+	// Check Coupon Owner
+	if c.UserID != userID {
+		err := coupon.ErrCouponNotOwner
+		span.RecordError(err)
+		log.Warn("failed to quote coupon not owner", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	// Check Coupon Status
+	if err := c.CheckUsable(); err != nil {
+		span.RecordError(err)
+		log.Warn("failed to quote coupon not match status", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	// Retrieve Coupon Policy
+	policy, err := s.repo.FindCouponPolicyByID(ctx, c.CouponPolicyID)
+	if err != nil || policy == nil {
+		span.RecordError(err)
+		log.Warn("failed to get coupon policy not found", zap.String("coupon_code", couponCode), zap.String("policy_id", c.CouponPolicyID), zap.Error(err))
+		return nil, coupon.ErrCouponPolicyNotFound
+	}
+
+	// Calculate Discount
+	discount, err := policy.CalculateDiscount(order)
+	if err != nil {
+		span.RecordError(err)
+		log.Warn("failed to quote coupon order not eligible", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	amount := order.Total()
+	return &coupon.CouponQuote{
+		CouponCode:     c.Code,
+		PolicyCode:     policy.Code,
+		OrderAmount:    amount,
+		DiscountAmount: discount,
+		FinalAmount:    amount - discount,
+	}, nil
+}
+
 func (s *service) CancelCoupon(ctx context.Context, couponCode string, userID string) (*coupon.Coupon, error) {
 	ctx, span := tracing.StartSpan(ctx, "V4.Service.CancelCoupon")
 	defer span.End()
 
 	log := logging.GetLoggerFromContext(ctx)
 
+	// Check Coupon Code Format
+	couponCode, err := s.parseCode(ctx, couponCode)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
 	// Retrieve Coupon Policy
 	c, err := s.repo.FindCouponByCode(ctx, couponCode)
 	if err != nil || c == nil {
@@ -244,31 +654,267 @@ func (s *service) CancelCoupon(ctx context.Context, couponCode string, userID st
 		return nil, err
 	}
 
-	// Check Coupon Status
-	if err := c.Cancel(); err != nil {
+	// Retrieve Coupon Policy
+	policy, err := s.repo.FindCouponPolicyByID(ctx, c.CouponPolicyID)
+	if err != nil || policy == nil {
+		span.RecordError(err)
+		log.Error("failed to get coupon policy by id", zap.String("coupon_code", couponCode), zap.String("policy_id", c.CouponPolicyID), zap.Error(err))
+		return nil, coupon.ErrCouponInternal
+	}
+
+	// Check Coupon Status, cancel clears the order so the event keeps it
+	previousStatus, previousOrderID := c.Status, c.OrderID
+	if err := c.CancelWith(policy.CancelMode); err != nil {
 		span.RecordError(err)
 		log.Warn("failed to cancel coupon not match status", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.Error(err))
 		return nil, err
 	}
 
 	// Update Coupon
-	updatedCoupon, err := s.repo.UpdateCoupon(ctx, c)
+	event := coupon.NewCouponEvent(coupon.CouponEventTypeCanceled, previousStatus, userID, previousOrderID, tracing.TraceID(ctx))
+	updatedCoupon, err := s.repo.UpdateCoupon(ctx, c, event)
 	if err != nil {
 		span.RecordError(err)
+		if errors.Is(err, coupon.ErrCouponConflict) {
+			log.Warn("failed to update coupon changed concurrently", zap.String("coupon_code", couponCode), zap.Error(err))
+			return nil, err
+		}
 		log.Error("failed to update coupon", zap.String("coupon_code", couponCode), zap.Error(err))
 		return nil, coupon.ErrCouponInternal
 	}
 
-	log.Info("coupon cancel successfully", zap.String("coupon_code", couponCode), zap.String("user_id", userID))
+	// Release Quota, the reconciler corrects the counter if this fails
+	if c.QuotaReleased {
+		if err := s.repo.IncrCouponPolicyQuantity(ctx, policy.Code); err != nil {
+			span.RecordError(err)
+			log.Warn("failed to release coupon policy quantity", zap.String("policy_code", policy.Code), zap.String("coupon_code", couponCode), zap.Error(err))
+		}
+	}
+
+	s.publishEvent(ctx, domainevent.TypeCouponCanceled, updatedCoupon.ID, domainevent.CouponCanceled{
+		CouponID:      updatedCoupon.ID,
+		CouponCode:    updatedCoupon.Code,
+		PolicyID:      updatedCoupon.CouponPolicyID,
+		UserID:        updatedCoupon.UserID,
+		OrderID:       previousOrderID,
+		Status:        string(updatedCoupon.Status),
+		QuotaReleased: updatedCoupon.QuotaReleased,
+	})
+
+	log.Info("coupon cancel successfully", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("cancel_mode", string(policy.CancelMode)))
+	return updatedCoupon, nil
+}
+
+// ReserveCoupon holds the coupon for the order during checkout. The order confirms the reservation
+// once paid or releases it if payment fails, and an abandoned reservation is released after ttl.
+func (s *service) ReserveCoupon(ctx context.Context, couponCode string, userID string, order coupon.Order, ttl time.Duration) (*coupon.Coupon, error) {
+	ctx, span := tracing.StartSpan(ctx, "V4.Service.ReserveCoupon")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	// Check Reservation TTL
+	if ttl == 0 {
+		ttl = coupon.DefaultReservationTTL
+	}
+	if ttl < 0 || ttl > coupon.MaxReservationTTL {
+		err := fmt.Errorf("%w, ttl must be at most %v", coupon.ErrCouponReservationTTLInvalid, coupon.MaxReservationTTL)
+		span.RecordError(err)
+		log.Warn("invalid reservation ttl", zap.String("coupon_code", couponCode), zap.Duration("ttl", ttl), zap.Error(err))
+		return nil, err
+	}
+
+	// Check Coupon Code Format
+	couponCode, err := s.parseCode(ctx, couponCode)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	// Retrieve Coupon
+	c, err := s.repo.FindCouponByCode(ctx, couponCode)
+	if err != nil || c == nil {
+		span.RecordError(err)
+		log.Warn("failed to get coupon by code", zap.String("coupon_code", couponCode), zap.Error(err))
+		return nil, coupon.ErrCouponNotFound
+	}
+
+	// Check Coupon Owner
+	if c.UserID != userID {
+		err := coupon.ErrCouponNotOwner
+		span.RecordError(err)
+		log.Warn("failed to reserve coupon not owner", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	// Retrieve Coupon Policy
+	policy, err := s.repo.FindCouponPolicyByID(ctx, c.CouponPolicyID)
+	if err != nil || policy == nil {
+		span.RecordError(err)
+		log.Warn("failed to get coupon policy not found", zap.String("coupon_code", couponCode), zap.String("policy_id", c.CouponPolicyID), zap.Error(err))
+		return nil, coupon.ErrCouponPolicyNotFound
+	}
+
+	// Calculate Discount
+	discount, err := policy.CalculateDiscount(order)
+	if err != nil {
+		span.RecordError(err)
+		log.Warn("failed to reserve coupon order not eligible", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("order_id", order.ID), zap.Error(err))
+		return nil, err
+	}
+
+	// Reserve Coupon
+	previousStatus := c.Status
+	if err := c.Reserve(order, discount, time.Now().Add(ttl)); err != nil {
+		span.RecordError(err)
+		log.Warn("failed to reserve coupon not match status", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("order_id", order.ID), zap.Error(err))
+		return nil, err
+	}
+
+	// Update Coupon
+	event := coupon.NewCouponEvent(coupon.CouponEventTypeReserved, previousStatus, userID, c.OrderID, tracing.TraceID(ctx))
+	updatedCoupon, err := s.repo.UpdateCoupon(ctx, c, event)
+	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, coupon.ErrCouponConflict) {
+			log.Warn("failed to update coupon changed concurrently", zap.String("coupon_code", couponCode), zap.Error(err))
+			return nil, err
+		}
+		log.Error("failed to update coupon", zap.String("coupon_code", couponCode), zap.Error(err))
+		return nil, coupon.ErrCouponInternal
+	}
+
+	log.Info("coupon reserved successfully", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.String("order_id", order.ID), zap.Duration("ttl", ttl))
+	return updatedCoupon, nil
+}
+
+// ConfirmCoupon marks a coupon reserved for the order as USED, with the discount fixed at reservation.
+func (s *service) ConfirmCoupon(ctx context.Context, couponCode string, userID string, orderID string) (*coupon.Coupon, error) {
+	ctx, span := tracing.StartSpan(ctx, "V4.Service.ConfirmCoupon")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	c, err := s.findReservedCoupon(ctx, couponCode, userID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	// Confirm Reservation
+	previousStatus := c.Status
+	if err := c.Confirm(orderID, time.Now()); err != nil {
+		span.RecordError(err)
+		log.Warn("failed to confirm coupon not match reservation", zap.String("coupon_code", c.Code), zap.String("user_id", userID), zap.String("order_id", orderID), zap.Error(err))
+		return nil, err
+	}
+
+	// Update Coupon
+	event := coupon.NewCouponEvent(coupon.CouponEventTypeUsed, previousStatus, userID, c.OrderID, tracing.TraceID(ctx))
+	updatedCoupon, err := s.repo.UpdateCoupon(ctx, c, event)
+	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, coupon.ErrCouponConflict) {
+			log.Warn("failed to update coupon changed concurrently", zap.String("coupon_code", c.Code), zap.Error(err))
+			return nil, err
+		}
+		log.Error("failed to update coupon", zap.String("coupon_code", c.Code), zap.Error(err))
+		return nil, coupon.ErrCouponInternal
+	}
+
+	s.publishEvent(ctx, domainevent.TypeCouponUsed, updatedCoupon.ID, domainevent.CouponUsed{
+		CouponID:       updatedCoupon.ID,
+		CouponCode:     updatedCoupon.Code,
+		PolicyID:       updatedCoupon.CouponPolicyID,
+		UserID:         updatedCoupon.UserID,
+		OrderID:        orderID,
+		OrderAmount:    *c.OrderAmount,
+		DiscountAmount: *c.DiscountAmount,
+		UsedAt:         *c.UsedAt,
+	})
+
+	log.Info("coupon reservation confirmed successfully", zap.String("coupon_code", c.Code), zap.String("user_id", userID), zap.String("order_id", orderID))
+	return updatedCoupon, nil
+}
+
+// ReleaseCoupon returns a coupon reserved for the order to AVAILABLE, for an order whose payment failed.
+func (s *service) ReleaseCoupon(ctx context.Context, couponCode string, userID string, orderID string) (*coupon.Coupon, error) {
+	ctx, span := tracing.StartSpan(ctx, "V4.Service.ReleaseCoupon")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	c, err := s.findReservedCoupon(ctx, couponCode, userID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	// Release Reservation
+	previousStatus := c.Status
+	if err := c.Release(orderID); err != nil {
+		span.RecordError(err)
+		log.Warn("failed to release coupon not match reservation", zap.String("coupon_code", c.Code), zap.String("user_id", userID), zap.String("order_id", orderID), zap.Error(err))
+		return nil, err
+	}
+
+	// Update Coupon
+	event := coupon.NewCouponEvent(coupon.CouponEventTypeReleased, previousStatus, userID, &orderID, tracing.TraceID(ctx))
+	updatedCoupon, err := s.repo.UpdateCoupon(ctx, c, event)
+	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, coupon.ErrCouponConflict) {
+			log.Warn("failed to update coupon changed concurrently", zap.String("coupon_code", c.Code), zap.Error(err))
+			return nil, err
+		}
+		log.Error("failed to update coupon", zap.String("coupon_code", c.Code), zap.Error(err))
+		return nil, coupon.ErrCouponInternal
+	}
+
+	log.Info("coupon reservation released successfully", zap.String("coupon_code", c.Code), zap.String("user_id", userID), zap.String("order_id", orderID))
 	return updatedCoupon, nil
 }
 
+// findReservedCoupon retrieves the coupon of a confirm or release and checks its owner.
+func (s *service) findReservedCoupon(ctx context.Context, couponCode string, userID string) (*coupon.Coupon, error) {
+	log := logging.GetLoggerFromContext(ctx)
+
+	// Check Coupon Code Format
+	couponCode, err := s.parseCode(ctx, couponCode)
+	if err != nil {
+		return nil, err
+	}
+
+	// Retrieve Coupon
+	c, err := s.repo.FindCouponByCode(ctx, couponCode)
+	if err != nil || c == nil {
+		log.Warn("failed to get coupon by code", zap.String("coupon_code", couponCode), zap.Error(err))
+		return nil, coupon.ErrCouponNotFound
+	}
+
+	// Check Coupon Owner
+	if c.UserID != userID {
+		err := coupon.ErrCouponNotOwner
+		log.Warn("failed to settle coupon reservation not owner", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	return c, nil
+}
+
 func (s *service) FindCouponByCode(ctx context.Context, couponCode string, userID string) (*coupon.Coupon, error) {
 	ctx, span := tracing.StartSpan(ctx, "V4.Service.FindCouponByCode")
 	defer span.End()
 
 	log := logging.GetLoggerFromContext(ctx)
 
+	// Check Coupon Code Format
+	couponCode, err := s.parseCode(ctx, couponCode)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
 	// Retrieve Coupon Policy
 	c, err := s.repo.FindCouponByCode(ctx, couponCode)
 	if err != nil || c == nil {
@@ -298,3 +944,82 @@ func (s *service) FindCouponByCode(ctx context.Context, couponCode string, userI
 	log.Info("returning coupon with attached policy", zap.String("coupon_id", c.ID), zap.String("coupon_code", couponCode), zap.String("user_id", userID))
 	return c, nil
 }
+
+// FindCoupons lists the coupons of userID newest first, a page at a time.
+// cursor is the next_cursor of the previous page, empty for the first one.
+func (s *service) FindCoupons(ctx context.Context, userID string, filter coupon.CouponFilter, cursor string) (*coupon.CouponPage, error) {
+	ctx, span := tracing.StartSpan(ctx, "V4.Service.FindCoupons")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	// Check Filter
+	filter.UserID = userID
+	if err := filter.Validate(); err != nil {
+		span.RecordError(err)
+		log.Warn("invalid coupon filter", zap.String("user_id", userID), zap.String("status", string(filter.Status)), zap.Error(err))
+		return nil, err
+	}
+
+	decoded, err := coupon.DecodeCouponCursor(cursor)
+	if err != nil {
+		span.RecordError(err)
+		log.Warn("invalid coupon cursor", zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+	filter.Cursor = decoded
+
+	// Retrieve Coupons
+	coupons, err := s.repo.FindCoupons(ctx, filter)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to find coupons", zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	page := coupon.NewCouponPage(coupons, filter.Limit)
+	log.Info("found coupons successfully", zap.String("user_id", userID), zap.Int("count", len(page.Items)))
+	return page, nil
+}
+
+// FindCouponHistory returns the coupon of userID with every status change it went through.
+func (s *service) FindCouponHistory(ctx context.Context, couponCode string, userID string) (*coupon.CouponHistory, error) {
+	ctx, span := tracing.StartSpan(ctx, "V4.Service.FindCouponHistory")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	// Check Coupon Code Format
+	couponCode, err := s.parseCode(ctx, couponCode)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	// Retrieve Coupon
+	c, err := s.repo.FindCouponByCode(ctx, couponCode)
+	if err != nil || c == nil {
+		span.RecordError(err)
+		log.Warn("failed to get coupon by code", zap.String("coupon_code", couponCode), zap.Error(err))
+		return nil, coupon.ErrCouponNotFound
+	}
+
+	// Check Coupon Owner
+	if c.UserID != userID {
+		err := coupon.ErrCouponNotOwner
+		span.RecordError(err)
+		log.Warn("failed to get coupon history not owner", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	// Retrieve Coupon Events
+	events, err := s.repo.FindCouponEvents(ctx, c.ID)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to find coupon events", zap.String("coupon_id", c.ID), zap.Error(err))
+		return nil, err
+	}
+
+	log.Info("found coupon history successfully", zap.String("coupon_code", couponCode), zap.String("user_id", userID), zap.Int("count", len(events)))
+	return &coupon.CouponHistory{Coupon: c, Events: events}, nil
+}
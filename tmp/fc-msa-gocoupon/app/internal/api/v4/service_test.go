@@ -0,0 +1,323 @@
+package v4
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/coupontest"
+	"example.com/coupon-service/internal/domainevent"
+	"example.com/coupon-service/internal/instrument/logging"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+var _ IRepository = (*coupontest.Store)(nil)
+
+const testUserID = "USER_1"
+
+func newTestPolicy(cancelMode coupon.CouponPolicyCancelMode) *coupon.CouponPolicy {
+	now := time.Now()
+	return &coupon.CouponPolicy{
+		ID:            uuid.NewString(),
+		Code:          "RACE-" + uuid.NewString()[:8],
+		Name:          "Race",
+		TotalQuantity: 10,
+		StartTime:     now.Add(-time.Hour),
+		EndTime:       now.Add(time.Hour),
+		DiscountType:  coupon.DiscountTypeFixedAmount,
+		DiscountValue: 1000,
+		MaxPerUser:    1,
+		Status:        coupon.CouponPolicyStatusActive,
+		IssuanceMode:  coupon.CouponPolicyIssuanceModeOnDemand,
+		CancelMode:    cancelMode,
+	}
+}
+
+func newTestCoupon(policy *coupon.CouponPolicy, status coupon.CouponStatus) *coupon.Coupon {
+	now := time.Now()
+	c := &coupon.Coupon{
+		ID:             uuid.NewString(),
+		Code:           policy.NewCouponCode(),
+		Status:         status,
+		UserID:         testUserID,
+		CouponPolicyID: policy.ID,
+		ExpiresAt:      policy.EndTime,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if status == coupon.CouponStatusUsed {
+		orderID, amount, discount := "ORDER-0", 10000, 1000
+		c.UsedAt, c.OrderID, c.OrderAmount, c.DiscountAmount = &now, &orderID, &amount, &discount
+	}
+	return c
+}
+
+// race runs fn n times at once, each with its index, and returns the errors by index.
+func race(n int, fn func(i int) error) []error {
+	errs := make([]error, n)
+	start := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			errs[i] = fn(i)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return errs
+}
+
+// v4 reserves the quota in redis under the policy row lock and records the claim in the same
+// transaction as the outbox message, so it must hold every invariant once the outbox is drained.
+func TestIssueCouponConcurrent(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), zap.NewNop())
+
+	for _, s := range coupontest.Scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			store, policy := s.NewStore()
+			events := &coupontest.Publisher{}
+			svc := NewService(store, events)
+
+			issue := func(ctx context.Context, userID string) (*coupon.Coupon, error) {
+				return svc.IssueCoupon(ctx, policy.Code, userID)
+			}
+
+			// POOL policies are issued by v5 only
+			if s.Pool {
+				if err := s.Reject(ctx, issue, coupon.ErrCouponPolicyPoolOnly); err != nil {
+					t.Error(err)
+				}
+				if issued := store.IssuedPerUser(policy.ID); len(issued) > 0 {
+					t.Errorf("issued pool coupons to %d users, want none from v4", len(issued))
+				}
+				return
+			}
+
+			succeeded, unexpected := s.Run(ctx, issue)
+			for _, err := range unexpected {
+				t.Error(err)
+			}
+
+			// Drain Outbox, as the relay and the consumer would
+			for _, m := range store.OutboxMessages() {
+				var message coupon.IssueCouponMessage
+				if err := json.Unmarshal(m.Payload, &message); err != nil {
+					t.Fatal(err)
+				}
+				if err := svc.ProcessIssueCoupon(ctx, message); err != nil {
+					t.Fatalf("process %s: %v", message.CouponID, err)
+				}
+			}
+
+			for _, err := range s.Check(succeeded, store.IssuedPerUser(policy.ID)) {
+				t.Error(err)
+			}
+
+			want := 0
+			if s.Oversubscribed() {
+				want = 1
+			}
+			if n := len(events.Published(domainevent.TypePolicyExhausted)); n != want {
+				t.Errorf("published %d policy.exhausted events, want %d", n, want)
+			}
+		})
+	}
+}
+
+func TestUseCouponConcurrentRedemptions(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), zap.NewNop())
+
+	policy := newTestPolicy(coupon.CouponPolicyCancelModeVoid)
+	store := coupontest.NewStore(policy)
+	events := &coupontest.Publisher{}
+	svc := NewService(store, events)
+
+	c := newTestCoupon(policy, coupon.CouponStatusAvailable)
+	store.AddCoupon(c)
+
+	const attempts = 64
+	errs := race(attempts, func(i int) error {
+		_, err := svc.UseCoupon(ctx, c.Code, testUserID, coupon.Order{ID: fmt.Sprintf("ORDER-%d", i), Amount: 10000})
+		return err
+	})
+
+	winner := -1
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			if winner >= 0 {
+				t.Fatalf("orders %d and %d both redeemed the coupon", winner, i)
+			}
+			winner = i
+		case errors.Is(err, coupon.ErrCouponConflict), errors.Is(err, coupon.ErrCouponAlreadyUsed):
+		default:
+			t.Fatalf("order %d: unexpected error %v", i, err)
+		}
+	}
+	if winner < 0 {
+		t.Fatal("no redemption succeeded")
+	}
+
+	stored := store.Coupon(c.Code)
+	if stored.Status != coupon.CouponStatusUsed {
+		t.Fatalf("status = %s, want %s", stored.Status, coupon.CouponStatusUsed)
+	}
+	if want := fmt.Sprintf("ORDER-%d", winner); stored.OrderID == nil || *stored.OrderID != want {
+		t.Fatalf("order_id = %v, want %s", stored.OrderID, want)
+	}
+	if stored.Version != 1 {
+		t.Fatalf("version = %d, want 1", stored.Version)
+	}
+	if n := len(store.CouponEvents()); n != 1 {
+		t.Fatalf("recorded %d coupon events, want 1", n)
+	}
+	if n := len(events.Published(domainevent.TypeCouponUsed)); n != 1 {
+		t.Fatalf("published %d coupon.used events, want 1", n)
+	}
+}
+
+func TestCancelCouponConcurrentReleasesQuotaOnce(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), zap.NewNop())
+
+	policy := newTestPolicy(coupon.CouponPolicyCancelModeRelease)
+	store := coupontest.NewStore(policy)
+	svc := NewService(store, &coupontest.Publisher{})
+
+	c := newTestCoupon(policy, coupon.CouponStatusUsed)
+	store.AddCoupon(c)
+	if err := store.SetCouponPolicyQuantity(ctx, policy.Code, 0, policy.EndTime); err != nil {
+		t.Fatal(err)
+	}
+
+	const attempts = 64
+	errs := race(attempts, func(i int) error {
+		_, err := svc.CancelCoupon(ctx, c.Code, testUserID)
+		return err
+	})
+
+	canceled := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			canceled++
+		case errors.Is(err, coupon.ErrCouponConflict), errors.Is(err, coupon.ErrCouponNotUsed):
+		default:
+			t.Fatalf("cancel %d: unexpected error %v", i, err)
+		}
+	}
+	if canceled != 1 {
+		t.Fatalf("%d cancels succeeded, want 1", canceled)
+	}
+
+	quantity, err := store.GetCouponPolicyQuantity(ctx, policy.Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quantity != 1 {
+		t.Fatalf("quantity = %d, want the released unit counted once", quantity)
+	}
+	if stored := store.Coupon(c.Code); stored.Status != coupon.CouponStatusCanceled || !stored.QuotaReleased {
+		t.Fatalf("coupon = %s released=%t, want %s released", stored.Status, stored.QuotaReleased, coupon.CouponStatusCanceled)
+	}
+}
+
+func TestReserveCouponTTL(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), zap.NewNop())
+
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		want    time.Duration
+		wantErr error
+	}{
+		{name: "unset uses the default", ttl: 0, want: coupon.DefaultReservationTTL},
+		{name: "custom", ttl: 30 * time.Minute, want: 30 * time.Minute},
+		{name: "maximum", ttl: coupon.MaxReservationTTL, want: coupon.MaxReservationTTL},
+		{name: "negative", ttl: -time.Second, wantErr: coupon.ErrCouponReservationTTLInvalid},
+		{name: "above the maximum", ttl: coupon.MaxReservationTTL + time.Second, wantErr: coupon.ErrCouponReservationTTLInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := newTestPolicy(coupon.CouponPolicyCancelModeVoid)
+			store := coupontest.NewStore(policy)
+			svc := NewService(store, &coupontest.Publisher{})
+
+			c := newTestCoupon(policy, coupon.CouponStatusAvailable)
+			store.AddCoupon(c)
+
+			before := time.Now()
+			_, err := svc.ReserveCoupon(ctx, c.Code, testUserID, coupon.Order{ID: "ORDER-1", Amount: 10000}, tt.ttl)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReserveCoupon() error = %v, want %v", err, tt.wantErr)
+			}
+
+			stored := store.Coupon(c.Code)
+			if err != nil {
+				if stored.Status != coupon.CouponStatusAvailable || stored.ReservedUntil != nil {
+					t.Errorf("coupon = %s reserved until %v, want it left AVAILABLE", stored.Status, stored.ReservedUntil)
+				}
+				return
+			}
+			if stored.Status != coupon.CouponStatusReserved || stored.ReservedUntil == nil {
+				t.Fatalf("coupon = %s reserved until %v, want %s", stored.Status, stored.ReservedUntil, coupon.CouponStatusReserved)
+			}
+			if until := *stored.ReservedUntil; until.Before(before.Add(tt.want)) || until.After(time.Now().Add(tt.want)) {
+				t.Errorf("ReservedUntil = %s, want %s from the call", until, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfirmCouponAfterReservationLapsed(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), zap.NewNop())
+
+	tests := []struct {
+		name      string
+		until     time.Duration
+		expiresAt time.Duration
+		wantErr   error
+	}{
+		{name: "within the reservation", until: time.Minute, expiresAt: time.Hour},
+		{name: "reservation lapsed before the sweeper", until: -time.Second, expiresAt: time.Hour, wantErr: coupon.ErrCouponReservationExpired},
+		{name: "coupon expired during the reservation", until: time.Minute, expiresAt: -time.Second, wantErr: coupon.ErrCouponExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := newTestPolicy(coupon.CouponPolicyCancelModeVoid)
+			store := coupontest.NewStore(policy)
+			svc := NewService(store, &coupontest.Publisher{})
+
+			now := time.Now()
+			orderID, amount, discount, until := "ORDER-1", 10000, 1000, now.Add(tt.until)
+			c := newTestCoupon(policy, coupon.CouponStatusReserved)
+			c.OrderID, c.OrderAmount, c.DiscountAmount, c.ReservedUntil = &orderID, &amount, &discount, &until
+			c.ExpiresAt = now.Add(tt.expiresAt)
+			store.AddCoupon(c)
+
+			_, err := svc.ConfirmCoupon(ctx, c.Code, testUserID, orderID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ConfirmCoupon() error = %v, want %v", err, tt.wantErr)
+			}
+
+			want := coupon.CouponStatusUsed
+			if err != nil {
+				want = coupon.CouponStatusReserved
+			}
+			if stored := store.Coupon(c.Code); stored.Status != want {
+				t.Errorf("status = %s, want %s", stored.Status, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package v5
+
+import (
+	"errors"
+
+	"example.com/coupon-service/internal/api/middleware"
+	"example.com/coupon-service/internal/api/problem"
+	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/instrument/logging"
+	"example.com/coupon-service/internal/instrument/tracing"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+type Handler struct {
+	service IService
+}
+
+func NewHandler(service IService) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// IssueCoupon godoc
+// @Summary      Issue a coupon for a user
+// @Description  Reserves a coupon under a specific policy code in Redis and persists it asynchronously
+// @Tags         coupons
+// @Accept       json
+// @Produce      json,application/problem+json
+// @Param        X-USER-ID  header  string  true  "User ID"
+// @Param        Idempotency-Key  header  string  false  "Idempotency key, replays the first response on retry"
+// @Param        payload    body    coupon.IssueCouponRequest  true  "Issue coupon payload"
+// @Success      200  {object}  coupon.Coupon
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      410  {object}  problem.Problem
+// @Failure      422  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /coupons/issue [post]
+func (h *Handler) IssueCoupon(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "V5.Handler.IssueCoupon")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	var payload coupon.IssueCouponRequest
+	if err := c.Bind(&payload); err != nil {
+		span.RecordError(err)
+		log.Warn("invalid body request", zap.Error(err))
+		return problem.BadRequest(c, err.Error())
+	}
+
+	userID, ok := ctx.Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		err := errors.New("invalid x-user-id header")
+		span.RecordError(err)
+		log.Warn("invalid x-user-id header")
+		return problem.Unauthorized(c, err.Error())
+	}
+
+	result, err := h.service.IssueCoupon(ctx, payload.PolicyCode, userID)
+	if err != nil || result == nil {
+		span.RecordError(err)
+		log.Error("failed to issue coupon",
+			zap.String("policy_code", payload.PolicyCode),
+			zap.String("user_id", userID),
+			zap.Error(err),
+		)
+		return problem.Error(c, err)
+	}
+
+	log.Info("issue coupon successfully",
+		zap.String("policy_code", payload.PolicyCode),
+		zap.String("user_id", userID),
+		zap.String("coupon_code", result.Code),
+	)
+	return c.JSON(200, result)
+}
@@ -0,0 +1,35 @@
+package v5
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"example.com/coupon-service/internal/coupontest"
+)
+
+// memoryRepository is the in-memory store with the reserve script of v5 on top.
+type memoryRepository struct {
+	*coupontest.Store
+}
+
+var _ IRepository = memoryRepository{}
+
+func (r memoryRepository) ReserveCouponIssue(ctx context.Context, policyCode string, userID string, now time.Time) (*IssueReservation, error) {
+	policy, pooledCode, err := r.Store.ReserveIssue(ctx, policyCode, userID)
+	if errors.Is(err, coupontest.ErrCacheMiss) {
+		return nil, errCouponPolicyCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &IssueReservation{
+		PolicyID:         policy.ID,
+		MaxPerUser:       policy.MaxPerUser,
+		ExpiresAt:        policy.CouponExpiresAt(now),
+		PooledCouponCode: pooledCode,
+		CodePrefix:       policy.CodePrefix,
+		CodeLength:       policy.CodeLength,
+	}, nil
+}
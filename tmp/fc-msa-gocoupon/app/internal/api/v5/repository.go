@@ -0,0 +1,575 @@
+package v5
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"example.com/coupon-service/internal/config"
+	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/couponpool"
+	"example.com/coupon-service/internal/instrument/logging"
+	"example.com/coupon-service/internal/instrument/tracing"
+	"example.com/coupon-service/internal/reconciler"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+type IRepository interface {
+	FindCouponPolicyByCode(ctx context.Context, code string) (*coupon.CouponPolicy, error)
+	CountRemainingQuantity(ctx context.Context, policyCode string) (int, error)
+
+	ReserveCouponIssue(ctx context.Context, policyCode string, userID string, now time.Time) (*IssueReservation, error)
+	SetCouponPolicyMetadata(ctx context.Context, policy *coupon.CouponPolicy) error
+	SetCouponPolicyQuantityNX(ctx context.Context, code string, quantity int, endTime time.Time) error
+	IncrCouponPolicyQuantity(ctx context.Context, code string) error
+	DecrCouponPolicyUserClaim(ctx context.Context, code string, userID string) error
+	ReturnPooledCouponCode(ctx context.Context, policyCode string, couponCode string) error
+
+	AssignPooledCouponTx(ctx context.Context, tx pgx.Tx, code string, userID string, expiresAt time.Time, event *coupon.CouponEvent) (*coupon.Coupon, error)
+	ClaimCouponPolicyForUserTx(ctx context.Context, tx pgx.Tx, policyID string, userID string, maxPerUser int) error
+	WithTx(ctx context.Context, fn func(pgx.Tx) error) error
+}
+
+// The quantity and claims keys are shared with v3/v4, so every version draws from the same quota.
+var (
+	CouponPolicyQuantityKeyPrefix = "coupon:policy:quantity:"
+	CouponPolicyClaimsKeyPrefix   = "coupon:policy:claims:"
+	CouponPolicyMetadataKeyPrefix = "coupon:policy:meta:"
+)
+
+// CouponPolicyMetadataTTL bounds how long a cached policy can be stale if an admin
+// invalidation is missed. The admin API deletes the key on every policy change.
+const CouponPolicyMetadataTTL = 10 * time.Minute
+
+// errCouponPolicyCacheMiss is returned when the policy metadata or quota is not cached yet.
+var errCouponPolicyCacheMiss = errors.New("coupon policy not cached")
+
+// IssueReservation is a quota unit and user claim taken in redis for one coupon.
+// PooledCouponCode is set when the code was popped from the pool of a POOL policy.
+type IssueReservation struct {
+	PolicyID         string
+	MaxPerUser       int
+	ExpiresAt        time.Time
+	PooledCouponCode string
+	CodePrefix       string
+	CodeLength       int
+}
+
+type repository struct {
+	pg  *config.Postgres
+	rdb *config.Redis
+}
+
+func NewRepository(pg *config.Postgres, rdb *config.Redis) IRepository {
+	return &repository{
+		pg:  pg,
+		rdb: rdb,
+	}
+}
+
+func (r *repository) FindCouponPolicyByCode(ctx context.Context, code string) (*coupon.CouponPolicy, error) {
+	ctx, span := tracing.StartSpan(ctx, "V5.Repository.FindCouponPolicyByCode")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	row := r.pg.Pool.QueryRow(ctx, `
+		SELECT 
+			id,
+			code,
+			name,
+			description,
+			total_quantity,
+			start_time,
+			end_time,
+			discount_type,
+			discount_value,
+			minimum_order_amount,
+			maximum_discount_amount,
+			max_per_user,
+			status,
+			include_product_ids,
+			exclude_product_ids,
+			include_categories,
+			exclude_categories,
+			valid_days,
+			issuance_mode,
+			code_prefix,
+			code_length,
+			waiting_room,
+			cancel_mode,
+			created_at,
+			updated_at
+		FROM coupon_policies
+		WHERE code = $1
+	`, code)
+
+	var policy coupon.CouponPolicy
+
+	err := row.Scan(
+		&policy.ID,
+		&policy.Code,
+		&policy.Name,
+		&policy.Description,
+		&policy.TotalQuantity,
+		&policy.StartTime,
+		&policy.EndTime,
+		&policy.DiscountType,
+		&policy.DiscountValue,
+		&policy.MinimumOrderAmount,
+		&policy.MaximumDiscountAmount,
+		&policy.MaxPerUser,
+		&policy.Status,
+		&policy.IncludeProductIDs,
+		&policy.ExcludeProductIDs,
+		&policy.IncludeCategories,
+		&policy.ExcludeCategories,
+		&policy.ValidDays,
+		&policy.IssuanceMode,
+		&policy.CodePrefix,
+		&policy.CodeLength,
+		&policy.WaitingRoom,
+		&policy.CancelMode,
+		&policy.CreatedAt,
+		&policy.UpdatedAt,
+	)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to fetch coupon policy by code", zap.String("policy_code", code), zap.Error(err))
+		return nil, coupon.ErrCouponPolicyNotFound
+	}
+
+	log.Info("fetched coupon policy successfully", zap.String("policy_code", code))
+	return &policy, nil
+}
+
+// CountRemainingQuantity returns what is left of the policy's quota with the reconciler's count,
+// so issue requests still in the v4 outbox are not handed out a second time.
+func (r *repository) CountRemainingQuantity(ctx context.Context, policyCode string) (int, error) {
+	ctx, span := tracing.StartSpan(ctx, "V5.Repository.CountRemainingQuantity")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	result, err := reconciler.CountQuota(ctx, r.pg.Pool, policyCode)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to count remaining coupon policy quantity", zap.String("policy_code", policyCode), zap.Error(err))
+		return 0, coupon.ErrCouponCounted
+	}
+
+	log.Info("counted remaining coupon policy quantity successfully", zap.String("policy_code", policyCode), zap.Int("issued_count", result.Issued), zap.Int("in_flight_count", result.InFlight), zap.Int("quantity", result.Expected))
+	return result.Expected, nil
+}
+
+// reserveCouponIssueScript checks the cached policy status and period, the user's claim count
+// and the remaining quota, then takes one unit of each. Everything runs in one script, so no
+// other request can observe or change the counters between the check and the decrement.
+//
+// POOL policies also pop a pre-generated code in the same script. An empty or missing pool
+// is not a rejection, the caller falls back to generating the coupon on demand.
+//
+// KEYS: metadata hash, quantity counter, user claims hash, pool list
+// ARGV: user ID, now (unix ms)
+// Returns {0, policy_id, expires_at_ms, max_per_user, pooled_code, code_prefix, code_length} on success or {code, detail} on rejection.
+var reserveCouponIssueScript = redis.NewScript(`
+	if redis.call('EXISTS', KEYS[1]) == 0 then
+		return {-1}
+	end
+	local quantity = redis.call('GET', KEYS[2])
+	if not quantity then
+		return {-2}
+	end
+
+	local meta = redis.call('HMGET', KEYS[1], 'id', 'status', 'start_ms', 'end_ms', 'max_per_user', 'valid_ms', 'mode', 'code_prefix', 'code_length')
+	local now = tonumber(ARGV[2])
+	local end_ms = tonumber(meta[4])
+
+	if meta[2] == 'PAUSED' then
+		return {-3}
+	end
+	if meta[2] == 'RETIRED' then
+		return {-4}
+	end
+	if now < tonumber(meta[3]) then
+		return {-5, meta[3]}
+	end
+	if now > end_ms then
+		return {-6, meta[4]}
+	end
+
+	local max_per_user = tonumber(meta[5])
+	local claimed = tonumber(redis.call('HGET', KEYS[3], ARGV[1]) or '0')
+	if claimed >= max_per_user then
+		return {-7, max_per_user}
+	end
+
+	if tonumber(quantity) <= 0 then
+		return {-8}
+	end
+
+	redis.call('DECR', KEYS[2])
+	redis.call('HINCRBY', KEYS[3], ARGV[1], 1)
+	redis.call('PEXPIRE', KEYS[3], math.max(end_ms - now, 1))
+
+	local expires_at = end_ms
+	local valid_ms = tonumber(meta[6])
+	if valid_ms > 0 then
+		expires_at = now + valid_ms
+	end
+
+	local pooled_code = ''
+	if meta[7] == 'POOL' then
+		pooled_code = redis.call('LPOP', KEYS[4]) or ''
+	end
+
+	return {0, meta[1], expires_at, max_per_user, pooled_code, meta[8] or '', tonumber(meta[9] or '0')}
+`)
+
+func (r *repository) ReserveCouponIssue(ctx context.Context, policyCode string, userID string, now time.Time) (*IssueReservation, error) {
+	ctx, span := tracing.StartSpan(ctx, "V5.Repository.ReserveCouponIssue")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	keys := []string{
+		CouponPolicyMetadataKeyPrefix + policyCode,
+		CouponPolicyQuantityKeyPrefix + policyCode,
+		CouponPolicyClaimsKeyPrefix + policyCode,
+		couponpool.CouponPolicyPoolKeyPrefix + policyCode,
+	}
+
+	result, err := reserveCouponIssueScript.Run(ctx, r.rdb.Client, keys, userID, now.UnixMilli()).Slice()
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to reserve coupon issue", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	status, _ := result[0].(int64)
+	switch status {
+	case 0:
+		policyID, _ := result[1].(string)
+		expiresAt, _ := result[2].(int64)
+		maxPerUser, _ := result[3].(int64)
+		pooledCode, _ := result[4].(string)
+		codePrefix, _ := result[5].(string)
+		codeLength, _ := result[6].(int64)
+		return &IssueReservation{
+			PolicyID:         policyID,
+			MaxPerUser:       int(maxPerUser),
+			ExpiresAt:        time.UnixMilli(expiresAt).UTC(),
+			PooledCouponCode: pooledCode,
+			CodePrefix:       codePrefix,
+			CodeLength:       int(codeLength),
+		}, nil
+	case -1, -2:
+		return nil, errCouponPolicyCacheMiss
+	case -3:
+		return nil, coupon.ErrCouponPolicyPaused
+	case -4:
+		return nil, coupon.ErrCouponPolicyRetired
+	case -5:
+		return nil, fmt.Errorf("%w, starts at %s", coupon.ErrCouponPolicyNotActive, unixMilliDetail(result))
+	case -6:
+		return nil, fmt.Errorf("%w, ends at %s", coupon.ErrCouponPolicyExpired, unixMilliDetail(result))
+	case -7:
+		maxPerUser, _ := result[1].(int64)
+		policy := coupon.CouponPolicy{MaxPerUser: int(maxPerUser)}
+		return nil, policy.UserLimitError()
+	case -8:
+		return nil, coupon.ErrCouponPolicyQuantityExceed
+	}
+
+	err = fmt.Errorf("unexpected reserve coupon issue result %v", status)
+	span.RecordError(err)
+	return nil, err
+}
+
+// SetCouponPolicyMetadata caches the fields the reserve script needs.
+func (r *repository) SetCouponPolicyMetadata(ctx context.Context, policy *coupon.CouponPolicy) error {
+	ctx, span := tracing.StartSpan(ctx, "V5.Repository.SetCouponPolicyMetadata")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	var validMs int64
+	if policy.ValidDays != nil {
+		validMs = (time.Duration(*policy.ValidDays) * 24 * time.Hour).Milliseconds()
+	}
+
+	key := CouponPolicyMetadataKeyPrefix + policy.Code
+	_, err := r.rdb.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key,
+			"id", policy.ID,
+			"status", string(policy.Status),
+			"start_ms", policy.StartTime.UnixMilli(),
+			"end_ms", policy.EndTime.UnixMilli(),
+			"max_per_user", policy.MaxPerUser,
+			"valid_ms", validMs,
+			"mode", string(policy.IssuanceMode),
+			"code_prefix", policy.CodePrefix,
+			"code_length", policy.CodeLength,
+		)
+		pipe.Expire(ctx, key, CouponPolicyMetadataTTL)
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to set coupon policy metadata", zap.String("policy_code", policy.Code), zap.Error(err))
+		return err
+	}
+
+	log.Info("coupon policy metadata cached", zap.String("policy_code", policy.Code))
+	return nil
+}
+
+// SetCouponPolicyQuantityNX seeds the quota only if no other request or version already did,
+// so a concurrent cache warm-up never overwrites a counter that is already being decremented.
+func (r *repository) SetCouponPolicyQuantityNX(ctx context.Context, policyCode string, quantity int, endTime time.Time) error {
+	ctx, span := tracing.StartSpan(ctx, "V5.Repository.SetCouponPolicyQuantityNX")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	key := CouponPolicyQuantityKeyPrefix + policyCode
+	ttl := time.Until(endTime)
+	if ttl <= 0 {
+		ttl = time.Millisecond
+	}
+
+	ok, err := r.rdb.Client.SetNX(ctx, key, quantity, ttl).Result()
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to set coupon policy quantity", zap.String("policy_code", policyCode), zap.Error(err))
+		return err
+	}
+
+	log.Info("coupon policy quantity seeded", zap.String("policy_code", policyCode), zap.Int("quantity", quantity), zap.Bool("set", ok))
+	return nil
+}
+
+func (r *repository) IncrCouponPolicyQuantity(ctx context.Context, policyCode string) error {
+	ctx, span := tracing.StartSpan(ctx, "V5.Repository.IncrCouponPolicyQuantity")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	key := CouponPolicyQuantityKeyPrefix + policyCode
+	newVal, err := r.rdb.Client.Incr(ctx, key).Result()
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to increment coupon policy quantity", zap.String("policy_code", policyCode), zap.Error(err))
+		return err
+	}
+
+	log.Info("incremented coupon policy quantity", zap.String("policy_code", policyCode), zap.Int64("new_value", newVal))
+	return nil
+}
+
+// ReturnPooledCouponCode pushes a popped pool code back to the head of the pool, for an
+// assignment that rolled back. The code is still UNASSIGNED, so it is handed out next.
+func (r *repository) ReturnPooledCouponCode(ctx context.Context, policyCode string, couponCode string) error {
+	ctx, span := tracing.StartSpan(ctx, "V5.Repository.ReturnPooledCouponCode")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	key := couponpool.CouponPolicyPoolKeyPrefix + policyCode
+	if err := r.rdb.Client.LPush(ctx, key, couponCode).Err(); err != nil {
+		span.RecordError(err)
+		log.Error("failed to return pool coupon code", zap.String("policy_code", policyCode), zap.String("coupon_code", couponCode), zap.Error(err))
+		return err
+	}
+
+	log.Info("returned pool coupon code", zap.String("policy_code", policyCode), zap.String("coupon_code", couponCode))
+	return nil
+}
+
+var decrCouponPolicyUserClaimScript = redis.NewScript(`
+	local claimed = redis.call('HINCRBY', KEYS[1], ARGV[1], -1)
+	if claimed <= 0 then
+		redis.call('HDEL', KEYS[1], ARGV[1])
+	end
+	return claimed
+`)
+
+func (r *repository) DecrCouponPolicyUserClaim(ctx context.Context, policyCode string, userID string) error {
+	ctx, span := tracing.StartSpan(ctx, "V5.Repository.DecrCouponPolicyUserClaim")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	key := CouponPolicyClaimsKeyPrefix + policyCode
+	claimed, err := decrCouponPolicyUserClaimScript.Run(ctx, r.rdb.Client, []string{key}, userID).Int()
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to decrement user claim", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
+		return err
+	}
+
+	log.Info("decremented user claim", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Int("claimed", claimed))
+	return nil
+}
+
+// AssignPooledCouponTx hands an UNASSIGNED pool coupon to the user. It returns nil if the code
+// was already assigned or reclaimed, which happens when a pool is reloaded with stale codes.
+func (r *repository) AssignPooledCouponTx(ctx context.Context, tx pgx.Tx, code string, userID string, expiresAt time.Time, event *coupon.CouponEvent) (*coupon.Coupon, error) {
+	ctx, span := tracing.StartSpan(ctx, "V5.Repository.AssignPooledCouponTx")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	row := tx.QueryRow(ctx, `
+		WITH written AS (
+			UPDATE coupons
+			SET
+				status = 'AVAILABLE',
+				user_id = $2,
+				expires_at = $3,
+				version = version + 1,
+				updated_at = NOW()
+			WHERE code = $1 AND status = 'UNASSIGNED'
+			RETURNING
+				id,
+				code,
+				status,
+				used_at,
+				user_id,
+				order_id,
+				order_amount,
+				discount_amount,
+				coupon_policy_id,
+				expires_at,
+				created_at,
+				updated_at
+		), event AS (
+			INSERT INTO coupon_events (
+				coupon_id,
+				type,
+				previous_status,
+				status,
+				actor,
+				order_id,
+				trace_id
+			)
+			SELECT id, $4::coupon_event_type, $5::coupon_status, status, $6::TEXT, $7::TEXT, $8::TEXT
+			FROM written
+		)
+		SELECT
+			id,
+			code,
+			status,
+			used_at,
+			user_id,
+			order_id,
+			order_amount,
+			discount_amount,
+			coupon_policy_id,
+			expires_at,
+			created_at,
+			updated_at
+		FROM written
+	`, code, userID, expiresAt.UTC(), event.Type, event.PreviousStatus, event.Actor, event.OrderID, event.TraceID)
+
+	var result coupon.Coupon
+	err := row.Scan(
+		&result.ID,
+		&result.Code,
+		&result.Status,
+		&result.UsedAt,
+		&result.UserID,
+		&result.OrderID,
+		&result.OrderAmount,
+		&result.DiscountAmount,
+		&result.CouponPolicyID,
+		&result.ExpiresAt,
+		&result.CreatedAt,
+		&result.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Warn("pool coupon no longer unassigned", zap.String("coupon_code", code), zap.String("user_id", userID))
+			return nil, nil
+		}
+		span.RecordError(err)
+		log.Error("failed to assign pool coupon", zap.String("coupon_code", code), zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	log.Info("pool coupon assigned", zap.String("coupon_id", result.ID), zap.String("coupon_code", result.Code), zap.String("user_id", userID))
+	return &result, nil
+}
+
+func (r *repository) ClaimCouponPolicyForUserTx(ctx context.Context, tx pgx.Tx, policyID string, userID string, maxPerUser int) error {
+	ctx, span := tracing.StartSpan(ctx, "V5.Repository.ClaimCouponPolicyForUserTx")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO coupon_user_claims (
+			coupon_policy_id,
+			user_id,
+			claimed,
+			max_per_user,
+			created_at,
+			updated_at
+		) VALUES (
+			$1, $2, 1, $3, NOW(), NOW()
+		)
+		ON CONFLICT (coupon_policy_id, user_id) DO UPDATE
+		SET
+			claimed = coupon_user_claims.claimed + 1,
+			max_per_user = EXCLUDED.max_per_user,
+			updated_at = NOW()
+	`, policyID, userID, maxPerUser)
+	if err != nil {
+		span.RecordError(err)
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23514" {
+			log.Warn("user claim limit reached", zap.String("policy_id", policyID), zap.String("user_id", userID), zap.Int("max_per_user", maxPerUser))
+			return coupon.ErrCouponUserLimitExceeded
+		}
+
+		log.Error("failed to claim coupon policy for user", zap.String("policy_id", policyID), zap.String("user_id", userID), zap.Error(err))
+		return err
+	}
+
+	log.Info("claimed coupon policy for user", zap.String("policy_id", policyID), zap.String("user_id", userID))
+	return nil
+}
+
+func (r *repository) WithTx(ctx context.Context, fn func(pgx.Tx) error) error {
+	tx, err := r.pg.Pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func unixMilliDetail(result []interface{}) string {
+	if len(result) < 2 {
+		return ""
+	}
+
+	var ms int64
+	switch v := result[1].(type) {
+	case int64:
+		ms = v
+	case string:
+		_, _ = fmt.Sscan(v, &ms)
+	}
+	return time.UnixMilli(ms).UTC().String()
+}
@@ -0,0 +1,33 @@
+package v5
+
+import (
+	"example.com/coupon-service/internal/admission"
+	"example.com/coupon-service/internal/api/middleware"
+	"example.com/coupon-service/internal/config"
+	"example.com/coupon-service/internal/idempotency"
+	"github.com/labstack/echo/v4"
+
+	v4 "example.com/coupon-service/internal/api/v4"
+)
+
+// @title Coupon API V5
+// @version 5.0
+// @description Coupon API V5, lock-free issuance. Use, cancel and lookup stay on v4.
+// @BasePath /api/v5
+
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-USER-ID
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+func RegisterAPIV5(group *echo.Group, cfg *config.Config, pg *config.Postgres, rdb *config.Redis, idempotencyStore idempotency.IStore, admissionQueue *admission.Queue) {
+	repository := NewRepository(pg, rdb)
+	kafkaProducer := v4.NewKafkaProducer(cfg.Kafka.Brokers)
+	service := NewService(repository, kafkaProducer)
+	handler := NewHandler(service)
+
+	coupons := group.Group("/v5/coupons")
+	coupons.POST("/issue", handler.IssueCoupon, middleware.UserIDMiddleware(), middleware.WaitingRoomMiddleware(admissionQueue, idempotencyStore), middleware.IdempotencyMiddleware(idempotencyStore))
+}
@@ -0,0 +1,205 @@
+package v5
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/couponcode"
+	"example.com/coupon-service/internal/instrument/logging"
+	"example.com/coupon-service/internal/instrument/metrics"
+	"example.com/coupon-service/internal/instrument/tracing"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	v4 "example.com/coupon-service/internal/api/v4"
+)
+
+type IService interface {
+	IssueCoupon(ctx context.Context, policyCode string, userID string) (*coupon.Coupon, error)
+}
+
+type service struct {
+	repo          IRepository
+	kafkaProducer v4.IKafkaProducer
+}
+
+func NewService(
+	repo IRepository,
+	kafkaProducer v4.IKafkaProducer,
+) IService {
+	return &service{
+		repo:          repo,
+		kafkaProducer: kafkaProducer,
+	}
+}
+
+// Problem Summary:
+// v4 locks the policy row in Postgres for every request and checks the Redis quota with a
+// separate GET and DECR, so the hot row serializes a flash sale and the two calls can race.
+// Fix Implemented:
+// Policy metadata is cached in Redis and one Lua script checks the status, valid period and
+// per-user claims, then takes the quota unit. The request path never touches Postgres except
+// to warm the cache. The coupon is persisted asynchronously by the v4 Kafka consumer.
+// POOL policies pop a pre-generated code in the same script and assign its row by primary key,
+// so the hot path neither generates codes nor inserts rows. An empty pool falls back to on-demand.
+// Potential Issues / What could go wrong:
+// A cache warm-up seeds the quota with the reconciler's count, issued coupons plus v4 issue requests
+// still in the outbox. Messages v5 sent straight to Kafka are invisible to Postgres until consumed,
+// so after a Redis flush the reconciler only corrects the counter once it has caught up.
+// A failed Kafka send is compensated best-effort, like v4.
+func (s *service) IssueCoupon(ctx context.Context, policyCode string, userID string) (*coupon.Coupon, error) {
+	ctx, span := tracing.StartSpan(ctx, "V5.Service.IssueCoupon")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	couponIssueDuration := prometheus.NewTimer(
+		metrics.CouponIssueDuration.WithLabelValues(policyCode, "v5"),
+	)
+	defer couponIssueDuration.ObserveDuration()
+
+	// Reserve Quota and User Claim (redis)
+	reservation, err := s.repo.ReserveCouponIssue(ctx, policyCode, userID, time.Now())
+	if errors.Is(err, errCouponPolicyCacheMiss) {
+		if err := s.warmCouponPolicyCache(ctx, policyCode); err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		reservation, err = s.repo.ReserveCouponIssue(ctx, policyCode, userID, time.Now())
+	}
+	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, errCouponPolicyCacheMiss) {
+			log.Error("coupon policy cache still missing after warm-up", zap.String("policy_code", policyCode))
+			return nil, coupon.ErrCouponInternal
+		}
+		log.Warn("failed to reserve coupon issue", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	// Assign Pooled Coupon (pool mode)
+	if reservation.PooledCouponCode != "" {
+		assigned, err := s.assignPooledCoupon(ctx, userID, reservation)
+		if err != nil {
+			span.RecordError(err)
+			_ = s.repo.ReturnPooledCouponCode(ctx, policyCode, reservation.PooledCouponCode)
+			_ = s.repo.IncrCouponPolicyQuantity(ctx, policyCode)
+			_ = s.repo.DecrCouponPolicyUserClaim(ctx, policyCode, userID)
+			log.Warn("failed to assign pool coupon", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
+			return nil, err
+		}
+
+		if assigned != nil {
+			log.Info("issue pool coupon successfully", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.String("coupon_code", assigned.Code))
+			return assigned, nil
+		}
+
+		log.Warn("stale pool coupon code, falling back to on-demand issue", zap.String("policy_code", policyCode), zap.String("coupon_code", reservation.PooledCouponCode))
+	}
+
+	// Request Create New Coupon
+	tempCoupon := &coupon.Coupon{
+		ID:             uuid.New().String(),
+		Code:           couponcode.Generate(reservation.CodePrefix, reservation.CodeLength),
+		Status:         coupon.CouponStatusPending,
+		UserID:         userID,
+		CouponPolicyID: reservation.PolicyID,
+		ExpiresAt:      reservation.ExpiresAt,
+	}
+
+	issueCouponMsg := coupon.IssueCouponMessage{
+		PolicyID:    reservation.PolicyID,
+		PolicyCode:  policyCode,
+		CouponID:    tempCoupon.ID,
+		CouponCode:  tempCoupon.Code,
+		UserID:      userID,
+		ExpiresAt:   tempCoupon.ExpiresAt,
+		RecordClaim: true,
+	}
+
+	if err := s.kafkaProducer.SendIssueCoupon(ctx, issueCouponMsg); err != nil {
+		span.RecordError(err)
+		_ = s.repo.IncrCouponPolicyQuantity(ctx, policyCode)
+		_ = s.repo.DecrCouponPolicyUserClaim(ctx, policyCode, userID)
+		log.Error("failed to issue coupon not created", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
+		return nil, coupon.ErrCouponInternal
+	}
+
+	// Return New Coupon
+	log.Info("issue coupon successfully", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.String("coupon_code", tempCoupon.Code))
+	return tempCoupon, nil
+}
+
+// assignPooledCoupon assigns the popped pool coupon and records the user claim in one transaction.
+// It returns nil without error if the code was stale, leaving the reservation for the on-demand path.
+func (s *service) assignPooledCoupon(ctx context.Context, userID string, reservation *IssueReservation) (*coupon.Coupon, error) {
+	log := logging.GetLoggerFromContext(ctx)
+
+	var assigned *coupon.Coupon
+
+	err := s.repo.WithTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		event := coupon.NewCouponEvent(coupon.CouponEventTypeIssued, coupon.CouponStatusUnassigned, userID, nil, tracing.TraceID(ctx))
+		assigned, err = s.repo.AssignPooledCouponTx(ctx, tx, reservation.PooledCouponCode, userID, reservation.ExpiresAt, event)
+		if err != nil {
+			return coupon.ErrCouponInternal
+		}
+		if assigned == nil {
+			return nil
+		}
+
+		// Check User Eligibility (postgres), backstop for a flushed or lagging redis counter
+		if err := s.repo.ClaimCouponPolicyForUserTx(ctx, tx, reservation.PolicyID, userID, reservation.MaxPerUser); err != nil {
+			if errors.Is(err, coupon.ErrCouponUserLimitExceeded) {
+				policy := coupon.CouponPolicy{MaxPerUser: reservation.MaxPerUser}
+				return policy.UserLimitError()
+			}
+			log.Error("failed to claim coupon policy for user", zap.String("policy_id", reservation.PolicyID), zap.String("user_id", userID), zap.Error(err))
+			return coupon.ErrCouponInternal
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return assigned, nil
+}
+
+// warmCouponPolicyCache loads the policy from Postgres without locking it and caches its
+// metadata and remaining quota. Paused or expired policies are cached too, so the script
+// rejects them without going back to Postgres.
+func (s *service) warmCouponPolicyCache(ctx context.Context, policyCode string) error {
+	log := logging.GetLoggerFromContext(ctx)
+
+	// Retrieve Coupon Policy
+	policy, err := s.repo.FindCouponPolicyByCode(ctx, policyCode)
+	if err != nil || policy == nil {
+		log.Warn("failed to get coupon policy not found", zap.String("policy_code", policyCode), zap.Error(err))
+		return coupon.ErrCouponPolicyNotFound
+	}
+
+	// Seed Redis Quota, net of issue requests still in flight
+	quantity, err := s.repo.CountRemainingQuantity(ctx, policy.Code)
+	if err != nil {
+		log.Error("failed to count remaining coupon policy quantity", zap.String("policy_code", policyCode), zap.Error(err))
+		return coupon.ErrCouponInternal
+	}
+
+	if err := s.repo.SetCouponPolicyQuantityNX(ctx, policy.Code, quantity, policy.EndTime); err != nil {
+		return coupon.ErrCouponInternal
+	}
+
+	// Cache Policy Metadata
+	if err := s.repo.SetCouponPolicyMetadata(ctx, policy); err != nil {
+		return coupon.ErrCouponInternal
+	}
+
+	log.Info("coupon policy cache warmed", zap.String("policy_code", policyCode), zap.Int("quantity", quantity))
+	return nil
+}
@@ -0,0 +1,55 @@
+package v5
+
+import (
+	"context"
+	"testing"
+
+	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/coupontest"
+	"example.com/coupon-service/internal/instrument/logging"
+	"go.uber.org/zap"
+)
+
+// v5 takes the quota unit and the user claim in one redis script, so it must hold every invariant,
+// counting both the pool coupons it assigned and the issue messages it sent to Kafka.
+func TestIssueCouponConcurrent(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), zap.NewNop())
+
+	for _, s := range coupontest.Scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			store, policy := s.NewStore()
+			producer := &coupontest.KafkaProducer{}
+			svc := NewService(memoryRepository{store}, producer)
+
+			succeeded, unexpected := s.Run(ctx, func(ctx context.Context, userID string) (*coupon.Coupon, error) {
+				return svc.IssueCoupon(ctx, policy.Code, userID)
+			})
+			for _, err := range unexpected {
+				t.Error(err)
+			}
+
+			issued := store.IssuedPerUser(policy.ID)
+			for _, m := range producer.Messages() {
+				issued[m.UserID]++
+			}
+			if s.Pool && len(producer.Messages()) > 0 {
+				t.Errorf("sent %d issue messages, want the pool to cover every issue", len(producer.Messages()))
+			}
+
+			// Codes popped for a rolled back assignment go back to the pool
+			if s.Pool {
+				total := 0
+				for _, n := range issued {
+					total += n
+				}
+				if n := store.PoolLength(policy.Code); n != s.TotalQuantity-total {
+					t.Errorf("pool holds %d codes, want %d left after %d issued", n, s.TotalQuantity-total, total)
+				}
+			}
+
+			for _, err := range s.Check(succeeded, issued) {
+				t.Error(err)
+			}
+		})
+	}
+}
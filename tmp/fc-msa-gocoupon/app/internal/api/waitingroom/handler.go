@@ -0,0 +1,118 @@
+package waitingroom
+
+import (
+	"errors"
+
+	"example.com/coupon-service/internal/admission"
+	"example.com/coupon-service/internal/api/middleware"
+	"example.com/coupon-service/internal/api/problem"
+	"example.com/coupon-service/internal/instrument/logging"
+	"example.com/coupon-service/internal/instrument/tracing"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+type Handler struct {
+	queue *admission.Queue
+}
+
+func NewHandler(queue *admission.Queue) *Handler {
+	return &Handler{
+		queue: queue,
+	}
+}
+
+// Enter godoc
+// @Summary      Enter the waiting room of a coupon policy
+// @Description  Queues the user and returns a signed token to poll the status with and to send to issue once ADMITTED. Entering again keeps the place in the queue.
+// @Tags         waiting-room
+// @Produce      json,application/problem+json
+// @Param        X-USER-ID    header  string  true  "User ID"
+// @Param        policy_code  path    string  true  "Coupon Policy Code"
+// @Success      200  {object}  admission.Ticket
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /{policy_code}/enter [post]
+func (h *Handler) Enter(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "WaitingRoom.Handler.Enter")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	policyCode := c.Param("policy_code")
+	if policyCode == "" {
+		err := errors.New("invalid policy_code")
+		span.RecordError(err)
+		log.Error("invalid policy_code")
+		return problem.BadRequest(c, "policy_code is required")
+	}
+
+	userID, ok := ctx.Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		err := errors.New("invalid x-user-id header")
+		span.RecordError(err)
+		log.Warn("invalid x-user-id header")
+		return problem.Unauthorized(c, "invalid user id")
+	}
+
+	result, err := h.queue.Enter(ctx, policyCode, userID)
+	if err != nil || result == nil {
+		span.RecordError(err)
+		log.Error("failed to enter waiting room", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	log.Info("enter waiting room successfully", zap.String("policy_code", policyCode), zap.String("user_id", userID), zap.String("status", string(result.Status)))
+	return c.JSON(200, result)
+}
+
+// Status godoc
+// @Summary      Get the waiting room status of a token
+// @Description  Returns WAITING with the queue position, ADMITTED with the admission deadline, SOLD_OUT once the quota ran out, or EXPIRED if the user has to enter again
+// @Tags         waiting-room
+// @Produce      json,application/problem+json
+// @Param        X-USER-ID      header  string  true  "User ID"
+// @Param        X-Queue-Token  header  string  true  "Token returned by enter"
+// @Success      200  {object}  admission.Ticket
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      503  {object}  problem.Problem
+// @Router       /status [get]
+func (h *Handler) Status(c echo.Context) error {
+	ctx, span := tracing.StartSpan(c.Request().Context(), "WaitingRoom.Handler.Status")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	token := c.Request().Header.Get(middleware.QueueTokenHeader)
+	if token == "" {
+		err := errors.New("invalid x-queue-token header")
+		span.RecordError(err)
+		log.Warn("invalid x-queue-token header")
+		return problem.BadRequest(c, "missing X-Queue-Token header")
+	}
+
+	userID, ok := ctx.Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		err := errors.New("invalid x-user-id header")
+		span.RecordError(err)
+		log.Warn("invalid x-user-id header")
+		return problem.Unauthorized(c, "invalid user id")
+	}
+
+	result, err := h.queue.Status(ctx, token, userID)
+	if err != nil || result == nil {
+		span.RecordError(err)
+		log.Warn("failed to get waiting room status", zap.String("user_id", userID), zap.Error(err))
+		return problem.Error(c, err)
+	}
+
+	return c.JSON(200, result)
+}
@@ -0,0 +1,27 @@
+package waitingroom
+
+import (
+	"example.com/coupon-service/internal/admission"
+	"example.com/coupon-service/internal/api/middleware"
+	"github.com/labstack/echo/v4"
+)
+
+// @title Coupon Waiting Room API
+// @version 1.0
+// @description Admission queue in front of issue for flash-sale coupon policies
+// @BasePath /api/waiting-room
+
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-USER-ID
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+func RegisterAPIWaitingRoom(group *echo.Group, queue *admission.Queue) {
+	handler := NewHandler(queue)
+
+	room := group.Group("/waiting-room")
+	room.POST("/:policy_code/enter", handler.Enter, middleware.UserIDMiddleware())
+	room.GET("/status", handler.Status, middleware.UserIDMiddleware())
+}
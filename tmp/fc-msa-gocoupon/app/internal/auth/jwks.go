@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minRefreshInterval stops tokens with unknown kids from hammering the JWKS endpoint.
+const minRefreshInterval = 30 * time.Second
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// jwks caches the RSA signing keys of a JWKS by kid. The source is an http(s) URL or a local file,
+// and is fetched again every refreshInterval, or sooner when a token names an unknown kid.
+// Both intervals count from the last attempt, so a failing source is not retried on every token.
+type jwks struct {
+	source          string
+	refreshInterval time.Duration
+	client          *http.Client
+
+	// refreshMu lets one refresh run at a time, callers that waited on it reuse its result
+	refreshMu sync.Mutex
+
+	mu          sync.RWMutex
+	keys        map[string]*rsa.PublicKey
+	attemptedAt time.Time
+	attemptErr  error
+}
+
+func newJWKS(source string, refreshInterval time.Duration) *jwks {
+	if refreshInterval <= 0 {
+		refreshInterval = 10 * time.Minute
+	}
+
+	return &jwks{
+		source:          source,
+		refreshInterval: refreshInterval,
+		client:          &http.Client{Timeout: 5 * time.Second},
+		keys:            make(map[string]*rsa.PublicKey),
+	}
+}
+
+// key returns the key for kid. A token without a kid is accepted only while the JWKS holds a single key.
+func (j *jwks) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	j.mu.RLock()
+	key, found := j.lookup(kid)
+	attemptedAt := j.attemptedAt
+	j.mu.RUnlock()
+
+	stale := time.Since(attemptedAt) > j.refreshInterval
+	canRefresh := time.Since(attemptedAt) > minRefreshInterval
+
+	if (found && !stale) || (!found && !canRefresh) {
+		if !found {
+			return nil, ErrTokenKeyNotFound
+		}
+		return key, nil
+	}
+
+	if err := j.refreshSince(ctx, attemptedAt); err != nil {
+		// Keep serving the cached keys while the source is unavailable
+		if found {
+			return key, nil
+		}
+		return nil, fmt.Errorf("%w, %v", ErrTokenKeyNotFound, err)
+	}
+
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if key, found := j.lookup(kid); found {
+		return key, nil
+	}
+	return nil, ErrTokenKeyNotFound
+}
+
+func (j *jwks) lookup(kid string) (*rsa.PublicKey, bool) {
+	if kid == "" {
+		if len(j.keys) != 1 {
+			return nil, false
+		}
+		for _, key := range j.keys {
+			return key, true
+		}
+	}
+	key, ok := j.keys[kid]
+	return key, ok
+}
+
+// refreshSince refreshes the keys unless another caller attempted it after seen, in which case
+// that attempt's result is returned, so concurrent callers with unknown kids share one fetch.
+func (j *jwks) refreshSince(ctx context.Context, seen time.Time) error {
+	j.refreshMu.Lock()
+	defer j.refreshMu.Unlock()
+
+	j.mu.RLock()
+	attemptedAt, attemptErr := j.attemptedAt, j.attemptErr
+	j.mu.RUnlock()
+	if attemptedAt.After(seen) {
+		return attemptErr
+	}
+
+	return j.refresh(ctx)
+}
+
+// refresh fetches the keys and records the attempt, keeping the cached keys if it fails.
+func (j *jwks) refresh(ctx context.Context) error {
+	keys, err := j.load(ctx)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.attemptedAt = time.Now()
+	j.attemptErr = err
+	if err != nil {
+		return err
+	}
+	j.keys = keys
+	return nil
+}
+
+func (j *jwks) load(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	body, err := j.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") || (k.Alg != "" && k.Alg != AlgorithmRS256) {
+			continue
+		}
+		key, err := rsaPublicKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwk %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks has no RS256 signing keys")
+	}
+
+	return keys, nil
+}
+
+func (j *jwks) fetch(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(j.source, "http://") && !strings.HasPrefix(j.source, "https://") {
+		return os.ReadFile(strings.TrimPrefix(j.source, "file://"))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := j.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks responded %d", res.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
+
+func rsaPublicKey(k jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid exponent")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
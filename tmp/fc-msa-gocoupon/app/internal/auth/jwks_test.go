@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJWKSRefresh(t *testing.T) {
+	ctx := context.Background()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// status the JWKS endpoint answers after the initial load
+		status int
+		// time since the last attempt when the tokens arrive
+		since     time.Duration
+		callers   int
+		kid       string
+		wantErr   error
+		wantFetch int
+	}{
+		{name: "known kid while fresh", status: http.StatusOK, since: time.Minute, callers: 10, kid: testKid, wantFetch: 0},
+		{name: "unknown kid right after a refresh", status: http.StatusOK, since: time.Second, callers: 10, kid: "key-2", wantErr: ErrTokenKeyNotFound, wantFetch: 0},
+		{name: "concurrent unknown kids share one refresh", status: http.StatusOK, since: time.Minute, callers: 50, kid: "key-2", wantErr: ErrTokenKeyNotFound, wantFetch: 1},
+		{name: "failed refresh is not retried by the next token", status: http.StatusInternalServerError, since: time.Minute, callers: 50, kid: "key-2", wantErr: ErrTokenKeyNotFound, wantFetch: 1},
+		{name: "stale keys are refreshed once", status: http.StatusOK, since: time.Hour, callers: 50, kid: testKid, wantFetch: 1},
+		{name: "stale keys are served while the source fails", status: http.StatusInternalServerError, since: time.Hour, callers: 50, kid: testKid, wantFetch: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				fetches atomic.Int32
+				loaded  atomic.Bool
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if loaded.Load() {
+					fetches.Add(1)
+					// Hold the refresh long enough for every caller to queue behind it
+					time.Sleep(20 * time.Millisecond)
+					if tt.status != http.StatusOK {
+						w.WriteHeader(tt.status)
+						return
+					}
+				}
+				_ = json.NewEncoder(w).Encode(map[string]any{"keys": []jsonWebKey{testJWK(testKid, &key.PublicKey)}})
+			}))
+			defer server.Close()
+
+			j := newJWKS(server.URL, 10*time.Minute)
+			if err := j.refresh(ctx); err != nil {
+				t.Fatal(err)
+			}
+			loaded.Store(true)
+			j.attemptedAt = time.Now().Add(-tt.since)
+
+			var wg sync.WaitGroup
+			errs := make(chan error, tt.callers)
+			for i := 0; i < tt.callers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := j.key(ctx, tt.kid)
+					errs <- err
+				}()
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("key(%q) error = %v, want %v", tt.kid, err, tt.wantErr)
+				}
+			}
+
+			// The next token after the attempt does not fetch again
+			_, _ = j.key(ctx, tt.kid)
+			if got := int(fetches.Load()); got != tt.wantFetch {
+				t.Errorf("fetched the jwks %d times, want %d", got, tt.wantFetch)
+			}
+		})
+	}
+}
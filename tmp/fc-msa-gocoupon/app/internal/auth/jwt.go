@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"example.com/coupon-service/internal/config"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+
+	DefaultUserClaim  = "sub"
+	DefaultAdminScope = "coupon:admin"
+)
+
+var (
+	ErrTokenMissing     = errors.New("missing bearer token")
+	ErrTokenInvalid     = errors.New("invalid token")
+	ErrTokenExpired     = errors.New("token expired")
+	ErrTokenKeyNotFound = errors.New("token signing key not found")
+	ErrScopeMissing     = errors.New("token lacks the required scope")
+	ErrAuthDisabled     = errors.New("admin routes are closed while auth is disabled")
+)
+
+// Claims is what the service takes from a verified token.
+type Claims struct {
+	UserID string
+	Scopes []string
+}
+
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verifier checks JWTs signed with HS256 and a shared secret, or RS256 and a key from a JWKS.
+// Only the configured algorithm is accepted, so an RS256 public key can never be used as an HS256 secret.
+type Verifier struct {
+	algorithm  string
+	secret     []byte
+	jwks       *jwks
+	issuer     string
+	audience   string
+	userClaim  string
+	adminScope string
+	leeway     time.Duration
+}
+
+func NewVerifier(ctx context.Context, cfg *config.Config) (*Verifier, error) {
+	v := &Verifier{
+		algorithm:  strings.ToUpper(cfg.Auth.Algorithm),
+		issuer:     cfg.Auth.Issuer,
+		audience:   cfg.Auth.Audience,
+		userClaim:  cfg.Auth.UserClaim,
+		adminScope: cfg.Auth.AdminScope,
+		leeway:     cfg.Auth.Leeway,
+	}
+	if v.userClaim == "" {
+		v.userClaim = DefaultUserClaim
+	}
+	if v.adminScope == "" {
+		v.adminScope = DefaultAdminScope
+	}
+
+	switch v.algorithm {
+	case AlgorithmHS256:
+		if cfg.Auth.Secret == "" {
+			return nil, errors.New("auth.secret is required for HS256")
+		}
+		v.secret = []byte(cfg.Auth.Secret)
+	case AlgorithmRS256:
+		if cfg.Auth.JWKSURL == "" {
+			return nil, errors.New("auth.jwks_url is required for RS256")
+		}
+		v.jwks = newJWKS(cfg.Auth.JWKSURL, cfg.Auth.JWKSRefresh)
+		if err := v.jwks.refresh(ctx); err != nil {
+			return nil, fmt.Errorf("failed to load jwks: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported auth.algorithm %q", cfg.Auth.Algorithm)
+	}
+
+	return v, nil
+}
+
+// AdminScope is the scope policy management and dummy endpoints require.
+func (v *Verifier) AdminScope() string {
+	return v.adminScope
+}
+
+// Verify checks the signature, algorithm, expiry, issuer and audience of token and returns its claims.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenInvalid
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if h.Alg != v.algorithm {
+		return nil, fmt.Errorf("%w, unexpected alg %q", ErrTokenInvalid, h.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	signed := parts[0] + "." + parts[1]
+
+	switch v.algorithm {
+	case AlgorithmHS256:
+		if !hmac.Equal(signature, signHS256(v.secret, signed)) {
+			return nil, ErrTokenInvalid
+		}
+	case AlgorithmRS256:
+		key, err := v.jwks.key(ctx, h.Kid)
+		if err != nil {
+			return nil, err
+		}
+		digest := sha256.Sum256([]byte(signed))
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, ErrTokenInvalid
+		}
+	}
+
+	var payload map[string]any
+	if err := decodeSegment(parts[1], &payload); err != nil {
+		return nil, ErrTokenInvalid
+	}
+
+	return v.validate(payload, time.Now())
+}
+
+func (v *Verifier) validate(payload map[string]any, now time.Time) (*Claims, error) {
+	exp, ok := numericClaim(payload, "exp")
+	if !ok {
+		return nil, fmt.Errorf("%w, missing exp", ErrTokenInvalid)
+	}
+	if now.After(time.Unix(exp, 0).Add(v.leeway)) {
+		return nil, ErrTokenExpired
+	}
+	if nbf, ok := numericClaim(payload, "nbf"); ok && now.Add(v.leeway).Before(time.Unix(nbf, 0)) {
+		return nil, fmt.Errorf("%w, not valid yet", ErrTokenInvalid)
+	}
+
+	if v.issuer != "" {
+		if iss, _ := payload["iss"].(string); iss != v.issuer {
+			return nil, fmt.Errorf("%w, unexpected iss", ErrTokenInvalid)
+		}
+	}
+	if v.audience != "" && !slices.Contains(stringsClaim(payload["aud"]), v.audience) {
+		return nil, fmt.Errorf("%w, unexpected aud", ErrTokenInvalid)
+	}
+
+	userID, _ := payload[v.userClaim].(string)
+	if userID == "" {
+		return nil, fmt.Errorf("%w, missing %s", ErrTokenInvalid, v.userClaim)
+	}
+
+	// OAuth2 puts scopes in a space separated "scope", some issuers use a "scp" list instead
+	scopes := stringsClaim(payload["scp"])
+	if scope, ok := payload["scope"].(string); ok {
+		scopes = append(scopes, strings.Fields(scope)...)
+	}
+
+	return &Claims{UserID: userID, Scopes: scopes}, nil
+}
+
+// SignHS256 returns an HS256 token for claims, for tests and local tooling.
+func SignHS256(secret []byte, claims map[string]any) (string, error) {
+	h, err := json.Marshal(header{Alg: AlgorithmHS256})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signHS256(secret, signed)), nil
+}
+
+func signHS256(secret []byte, signed string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return mac.Sum(nil)
+}
+
+func decodeSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func numericClaim(payload map[string]any, name string) (int64, bool) {
+	n, ok := payload[name].(float64)
+	return int64(n), ok
+}
+
+// stringsClaim reads a claim that may be a single string or a list of strings.
+func stringsClaim(value any) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,319 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example.com/coupon-service/internal/config"
+)
+
+const (
+	testSecret   = "test-secret"
+	testIssuer   = "gocoupon-test"
+	testAudience = "gocoupon-service"
+	testKid      = "key-1"
+)
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hs256 := newTestVerifier(t, AlgorithmHS256, "")
+	rs256 := newTestVerifier(t, AlgorithmRS256, writeJWKS(t, testKid, &key.PublicKey))
+
+	now := time.Now()
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{
+			"sub": "USER_1",
+			"iss": testIssuer,
+			"aud": testAudience,
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+	signHS := func(c map[string]any) string {
+		token, err := SignHS256([]byte(testSecret), c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name      string
+		verifier  *Verifier
+		token     string
+		wantErr   error
+		wantUser  string
+		wantAdmin bool
+	}{
+		{
+			name:     "hs256 user token",
+			verifier: hs256,
+			token:    signHS(claims(nil)),
+			wantUser: "USER_1",
+		},
+		{
+			name:      "hs256 admin token",
+			verifier:  hs256,
+			token:     signHS(claims(map[string]any{"sub": "ADMIN_1", "scope": "coupon:read " + DefaultAdminScope})),
+			wantUser:  "ADMIN_1",
+			wantAdmin: true,
+		},
+		{
+			name:      "admin scope from a scp list",
+			verifier:  hs256,
+			token:     signHS(claims(map[string]any{"scp": []string{DefaultAdminScope}})),
+			wantUser:  "USER_1",
+			wantAdmin: true,
+		},
+		{
+			name:     "missing admin scope",
+			verifier: hs256,
+			token:    signHS(claims(map[string]any{"scope": "coupon:read coupon:write"})),
+			wantUser: "USER_1",
+		},
+		{
+			name:     "hs256 wrong secret",
+			verifier: hs256,
+			token:    mustSign(t)(SignHS256([]byte("other-secret"), claims(nil))),
+			wantErr:  ErrTokenInvalid,
+		},
+		{
+			name:     "expired token",
+			verifier: hs256,
+			token:    signHS(claims(map[string]any{"exp": now.Add(-time.Minute).Unix()})),
+			wantErr:  ErrTokenExpired,
+		},
+		{
+			name:     "expired within the leeway",
+			verifier: hs256,
+			token:    signHS(claims(map[string]any{"exp": now.Add(-10 * time.Second).Unix()})),
+			wantUser: "USER_1",
+		},
+		{
+			name:     "missing exp",
+			verifier: hs256,
+			token:    signHS(claims(map[string]any{"exp": nil})),
+			wantErr:  ErrTokenInvalid,
+		},
+		{
+			name:     "not valid yet",
+			verifier: hs256,
+			token:    signHS(claims(map[string]any{"nbf": now.Add(time.Hour).Unix()})),
+			wantErr:  ErrTokenInvalid,
+		},
+		{
+			name:     "wrong audience",
+			verifier: hs256,
+			token:    signHS(claims(map[string]any{"aud": "other-service"})),
+			wantErr:  ErrTokenInvalid,
+		},
+		{
+			name:     "audience in a list",
+			verifier: hs256,
+			token:    signHS(claims(map[string]any{"aud": []string{"other-service", testAudience}})),
+			wantUser: "USER_1",
+		},
+		{
+			name:     "wrong issuer",
+			verifier: hs256,
+			token:    signHS(claims(map[string]any{"iss": "someone-else"})),
+			wantErr:  ErrTokenInvalid,
+		},
+		{
+			name:     "missing user claim",
+			verifier: hs256,
+			token:    signHS(claims(map[string]any{"sub": ""})),
+			wantErr:  ErrTokenInvalid,
+		},
+		{
+			name:     "malformed token",
+			verifier: hs256,
+			token:    "not-a-jwt",
+			wantErr:  ErrTokenInvalid,
+		},
+		{
+			name:     "rs256 token from the jwks file",
+			verifier: rs256,
+			token:    signRS256(t, key, testKid, claims(nil)),
+			wantUser: "USER_1",
+		},
+		{
+			name:     "rs256 token without a kid and a single key",
+			verifier: rs256,
+			token:    signRS256(t, key, "", claims(nil)),
+			wantUser: "USER_1",
+		},
+		{
+			name:     "rs256 token signed with another key",
+			verifier: rs256,
+			token:    signRS256(t, otherKey, testKid, claims(nil)),
+			wantErr:  ErrTokenInvalid,
+		},
+		{
+			name:     "rs256 token with an unknown kid",
+			verifier: rs256,
+			token:    signRS256(t, key, "key-2", claims(nil)),
+			wantErr:  ErrTokenKeyNotFound,
+		},
+		{
+			name:     "rs256 expired token",
+			verifier: rs256,
+			token:    signRS256(t, key, testKid, claims(map[string]any{"exp": now.Add(-time.Minute).Unix()})),
+			wantErr:  ErrTokenExpired,
+		},
+		{
+			name:     "hs256 token against the rs256 verifier",
+			verifier: rs256,
+			token:    signHS(claims(nil)),
+			wantErr:  ErrTokenInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.verifier.Verify(ctx, tt.token)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+
+			if got.UserID != tt.wantUser {
+				t.Errorf("UserID = %q, want %q", got.UserID, tt.wantUser)
+			}
+			if admin := got.HasScope(tt.verifier.AdminScope()); admin != tt.wantAdmin {
+				t.Errorf("HasScope(%q) = %v, want %v", tt.verifier.AdminScope(), admin, tt.wantAdmin)
+			}
+		})
+	}
+}
+
+func TestNewVerifier(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		secret    string
+		jwksURL   string
+	}{
+		{name: "hs256 without a secret", algorithm: AlgorithmHS256},
+		{name: "rs256 without a jwks url", algorithm: AlgorithmRS256},
+		{name: "rs256 with a missing jwks file", algorithm: AlgorithmRS256, jwksURL: filepath.Join(t.TempDir(), "missing.json")},
+		{name: "unsupported algorithm", algorithm: "none", secret: testSecret},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Auth.Algorithm = tt.algorithm
+			cfg.Auth.Secret = tt.secret
+			cfg.Auth.JWKSURL = tt.jwksURL
+
+			if _, err := NewVerifier(context.Background(), cfg); err == nil {
+				t.Error("NewVerifier() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func newTestVerifier(t *testing.T, algorithm string, jwksURL string) *Verifier {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.Auth.Algorithm = algorithm
+	cfg.Auth.Secret = testSecret
+	cfg.Auth.JWKSURL = jwksURL
+	cfg.Auth.Issuer = testIssuer
+	cfg.Auth.Audience = testAudience
+	cfg.Auth.Leeway = 30 * time.Second
+
+	v, err := NewVerifier(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func mustSign(t *testing.T) func(string, error) string {
+	return func(token string, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+}
+
+// writeJWKS writes a JWKS holding key under kid to a temporary file and returns its path.
+func writeJWKS(t *testing.T, kid string, key *rsa.PublicKey) string {
+	t.Helper()
+
+	b, err := json.Marshal(map[string]any{"keys": []jsonWebKey{testJWK(kid, key)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testJWK(kid string, key *rsa.PublicKey) jsonWebKey {
+	return jsonWebKey{
+		Kid: kid,
+		Kty: "RSA",
+		Use: "sig",
+		Alg: AlgorithmRS256,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+
+	h, err := json.Marshal(header{Alg: AlgorithmRS256, Kid: kid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
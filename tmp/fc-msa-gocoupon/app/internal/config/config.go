@@ -34,8 +34,16 @@ type Config struct {
 	} `mapstructure:"redis"`
 
 	Kafka struct {
-		Brokers []string `mapstructure:"brokers"`
-		GroupID string   `mapstructure:"group_id"`
+		Brokers  []string `mapstructure:"brokers"`
+		GroupID  string   `mapstructure:"group_id"`
+		Consumer struct {
+			MaxRetries      int           `mapstructure:"max_retries"`
+			RetryBackoff    time.Duration `mapstructure:"retry_backoff"`
+			MaxRetryBackoff time.Duration `mapstructure:"max_retry_backoff"`
+			Workers         int           `mapstructure:"workers"`
+			QueueSize       int           `mapstructure:"queue_size"`
+			DrainTimeout    time.Duration `mapstructure:"drain_timeout"`
+		} `mapstructure:"consumer"`
 	}
 
 	Metric struct {
@@ -46,6 +54,68 @@ type Config struct {
 	Zipkin struct {
 		Url string `mapstructure:"url"`
 	} `mapstructure:"zipkin"`
+
+	Idempotency struct {
+		TTL           time.Duration `mapstructure:"ttl"`
+		LockTTL       time.Duration `mapstructure:"lock_ttl"`
+		PurgeEnabled  bool          `mapstructure:"purge_enabled"`
+		PurgeInterval time.Duration `mapstructure:"purge_interval"`
+	} `mapstructure:"idempotency"`
+
+	Sweeper struct {
+		Enabled             bool          `mapstructure:"enabled"`
+		Interval            time.Duration `mapstructure:"interval"`
+		ReservationInterval time.Duration `mapstructure:"reservation_interval"`
+		BatchSize           int           `mapstructure:"batch_size"`
+	} `mapstructure:"sweeper"`
+
+	Outbox struct {
+		Interval   time.Duration `mapstructure:"interval"`
+		BatchSize  int           `mapstructure:"batch_size"`
+		MaxBackoff time.Duration `mapstructure:"max_backoff"`
+		Retention  time.Duration `mapstructure:"retention"`
+	} `mapstructure:"outbox"`
+
+	Reconciler struct {
+		Enabled       bool          `mapstructure:"enabled"`
+		Interval      time.Duration `mapstructure:"interval"`
+		MaxCorrection int           `mapstructure:"max_correction"`
+	} `mapstructure:"reconciler"`
+
+	WaitingRoom struct {
+		Enabled      bool          `mapstructure:"enabled"`
+		Secret       string        `mapstructure:"secret"`
+		AdmitRate    int           `mapstructure:"admit_rate"`
+		Interval     time.Duration `mapstructure:"interval"`
+		TokenTTL     time.Duration `mapstructure:"token_ttl"`
+		AdmissionTTL time.Duration `mapstructure:"admission_ttl"`
+	} `mapstructure:"waiting_room"`
+
+	RateLimit struct {
+		Enabled bool          `mapstructure:"enabled"`
+		User    RateLimitRule `mapstructure:"user"`
+		IP      RateLimitRule `mapstructure:"ip"`
+		Policy  RateLimitRule `mapstructure:"policy"`
+	} `mapstructure:"rate_limit"`
+
+	Auth struct {
+		Enabled     bool          `mapstructure:"enabled"`
+		Algorithm   string        `mapstructure:"algorithm"`
+		Secret      string        `mapstructure:"secret"`
+		JWKSURL     string        `mapstructure:"jwks_url"`
+		JWKSRefresh time.Duration `mapstructure:"jwks_refresh"`
+		Issuer      string        `mapstructure:"issuer"`
+		Audience    string        `mapstructure:"audience"`
+		UserClaim   string        `mapstructure:"user_claim"`
+		AdminScope  string        `mapstructure:"admin_scope"`
+		Leeway      time.Duration `mapstructure:"leeway"`
+	} `mapstructure:"auth"`
+}
+
+// RateLimitRule allows Limit requests per sliding Window, a zero Limit disables the rule.
+type RateLimitRule struct {
+	Limit  int           `mapstructure:"limit"`
+	Window time.Duration `mapstructure:"window"`
 }
 
 func NewConfig(filepath string) (*Config, error) {
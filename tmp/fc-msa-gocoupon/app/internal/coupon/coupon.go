@@ -2,6 +2,13 @@ package coupon
 
 import "time"
 
+const (
+	// DefaultReservationTTL is how long a reservation holds a coupon when the caller sets no TTL
+	DefaultReservationTTL = 15 * time.Minute
+	// MaxReservationTTL bounds how long an abandoned checkout can keep a coupon from its owner
+	MaxReservationTTL = time.Hour
+)
+
 type CouponStatus string
 
 const (
@@ -10,6 +17,15 @@ const (
 	CouponStatusUsed      CouponStatus = "USED"
 	CouponStatusExpired   CouponStatus = "EXPIRED"
 	CouponStatusCanceled  CouponStatus = "CANCELED"
+
+	// CouponStatusRevoked marks a coupon an admin took back before it was used, it is terminal
+	CouponStatusRevoked CouponStatus = "REVOKED"
+
+	// CouponStatusReserved marks a coupon held for an order until it is confirmed, released or its reservation times out
+	CouponStatusReserved CouponStatus = "RESERVED"
+
+	// CouponStatusUnassigned marks a pre-generated pool coupon that no user holds yet
+	CouponStatusUnassigned CouponStatus = "UNASSIGNED"
 )
 
 type Coupon struct {
@@ -19,15 +35,23 @@ type Coupon struct {
 	UsedAt         *time.Time   `json:"used_at,omitempty"`
 	UserID         string       `json:"user_id"`
 	OrderID        *string      `json:"order_id,omitempty"`
+	OrderAmount    *int         `json:"order_amount,omitempty"`
+	DiscountAmount *int         `json:"discount_amount,omitempty"`
+	ReservedUntil  *time.Time   `json:"reserved_until,omitempty"`
+	QuotaReleased  bool         `json:"quota_released,omitempty"`
 	CouponPolicyID string       `json:"coupon_policy_id"`
+	ExpiresAt      time.Time    `json:"expires_at"`
 	CreatedAt      time.Time    `json:"created_at"`
 	UpdatedAt      time.Time    `json:"updated_at"`
 
+	// Version is bumped by every write, a coupon is only written at the version it was read with
+	Version int `json:"-"`
+
 	CouponPolicy *CouponPolicy `json:"coupon_policy,omitempty"`
 }
 
-// Use marks the coupon as used with given orderId, or returns an error
-func (c *Coupon) Use(orderId string) error {
+// CheckUsable returns an error if the coupon status does not allow it to be used
+func (c *Coupon) CheckUsable() error {
 	if c.Status == CouponStatusUsed {
 		return ErrCouponAlreadyUsed
 	}
@@ -37,17 +61,112 @@ func (c *Coupon) Use(orderId string) error {
 	if c.Status == CouponStatusCanceled {
 		return ErrCouponCanceled
 	}
+	if c.Status == CouponStatusRevoked {
+		return ErrCouponRevoked
+	}
 	if c.Status == CouponStatusPending {
 		return ErrCouponPending
 	}
+	if c.Status == CouponStatusReserved {
+		return ErrCouponReserved
+	}
+	if c.IsExpired(time.Now()) {
+		return ErrCouponExpired
+	}
+
+	return nil
+}
+
+// IsExpired returns true if the coupon's validity window has passed at now, even if
+// the expiry sweeper has not moved it to EXPIRED yet.
+func (c *Coupon) IsExpired(now time.Time) bool {
+	if c.Status == CouponStatusExpired {
+		return true
+	}
+
+	return !c.ExpiresAt.IsZero() && !now.Before(c.ExpiresAt)
+}
+
+// Use marks the coupon as used for the given order and discount, or returns an error
+func (c *Coupon) Use(order Order, discountAmount int) error {
+	if err := c.CheckUsable(); err != nil {
+		return err
+	}
 
 	now := time.Now()
+	orderAmount := order.Total()
 	c.Status = CouponStatusUsed
-	c.OrderID = &orderId
+	c.OrderID = &order.ID
+	c.OrderAmount = &orderAmount
+	c.DiscountAmount = &discountAmount
 	c.UsedAt = &now
 	return nil
 }
 
+// Reserve holds the coupon for the order until until, with the discount it will give once confirmed.
+// Reserving again for the same order extends the reservation, so a retried checkout step succeeds,
+// as long as the coupon has not expired meanwhile.
+func (c *Coupon) Reserve(order Order, discountAmount int, until time.Time) error {
+	if c.IsExpired(time.Now()) {
+		return ErrCouponExpired
+	}
+	if c.Status != CouponStatusReserved || c.OrderID == nil || *c.OrderID != order.ID {
+		if err := c.CheckUsable(); err != nil {
+			return err
+		}
+	}
+
+	orderAmount := order.Total()
+	c.Status = CouponStatusReserved
+	c.OrderID = &order.ID
+	c.OrderAmount = &orderAmount
+	c.DiscountAmount = &discountAmount
+	c.ReservedUntil = &until
+	return nil
+}
+
+// Confirm marks a coupon reserved for orderID as USED, or returns an error
+func (c *Coupon) Confirm(orderID string, now time.Time) error {
+	if err := c.checkReservedFor(orderID); err != nil {
+		return err
+	}
+	if c.ReservedUntil != nil && !now.Before(*c.ReservedUntil) {
+		return ErrCouponReservationExpired
+	}
+	if c.IsExpired(now) {
+		return ErrCouponExpired
+	}
+
+	c.Status = CouponStatusUsed
+	c.UsedAt = &now
+	c.ReservedUntil = nil
+	return nil
+}
+
+// Release returns a coupon reserved for orderID to AVAILABLE, or returns an error
+func (c *Coupon) Release(orderID string) error {
+	if err := c.checkReservedFor(orderID); err != nil {
+		return err
+	}
+
+	c.Status = CouponStatusAvailable
+	c.OrderID = nil
+	c.OrderAmount = nil
+	c.DiscountAmount = nil
+	c.ReservedUntil = nil
+	return nil
+}
+
+func (c *Coupon) checkReservedFor(orderID string) error {
+	if c.Status != CouponStatusReserved {
+		return ErrCouponNotReserved
+	}
+	if c.OrderID == nil || *c.OrderID != orderID {
+		return ErrCouponReserved
+	}
+	return nil
+}
+
 // Cancel reverts the coupon to CANCELED if previously used, or returns an error
 func (c *Coupon) Cancel() error {
 	if c.Status != CouponStatusUsed {
@@ -56,6 +175,63 @@ func (c *Coupon) Cancel() error {
 
 	c.Status = CouponStatusCanceled
 	c.OrderID = nil
+	c.OrderAmount = nil
+	c.DiscountAmount = nil
 	c.UsedAt = nil
 	return nil
 }
+
+// CancelWith cancels a used coupon as the policy's cancel mode says, or returns an error.
+// RELEASE marks the coupon QuotaReleased, the caller gives its unit back to the quota.
+func (c *Coupon) CancelWith(mode CouponPolicyCancelMode) error {
+	switch mode {
+	case CouponPolicyCancelModeRestore:
+		return c.Restore()
+	case CouponPolicyCancelModeRelease:
+		if err := c.Cancel(); err != nil {
+			return err
+		}
+		c.QuotaReleased = true
+		return nil
+	default:
+		return c.Cancel()
+	}
+}
+
+// Restore returns a used coupon to AVAILABLE for its owner, or returns an error.
+// A coupon past its expiry is expired by the sweeper as any other available coupon.
+func (c *Coupon) Restore() error {
+	if c.Status != CouponStatusUsed {
+		return ErrCouponNotUsed
+	}
+
+	c.Status = CouponStatusAvailable
+	c.OrderID = nil
+	c.OrderAmount = nil
+	c.DiscountAmount = nil
+	c.UsedAt = nil
+	return nil
+}
+
+// Revoke takes back a coupon that was not used yet, or returns the error of its status.
+// A reserved coupon can be revoked too, its pending order loses the discount.
+func (c *Coupon) Revoke() error {
+	switch c.Status {
+	case CouponStatusAvailable, CouponStatusReserved:
+	case CouponStatusRevoked:
+		return ErrCouponRevoked
+	case CouponStatusUnassigned:
+		return ErrCouponNotFound
+	default:
+		if err := c.CheckUsable(); err != nil {
+			return err
+		}
+	}
+
+	c.Status = CouponStatusRevoked
+	c.OrderID = nil
+	c.OrderAmount = nil
+	c.DiscountAmount = nil
+	c.ReservedUntil = nil
+	return nil
+}
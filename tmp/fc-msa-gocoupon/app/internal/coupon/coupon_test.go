@@ -0,0 +1,235 @@
+package coupon
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCouponIsExpired(t *testing.T) {
+	now := time.Date(2025, 12, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		status    CouponStatus
+		expiresAt time.Time
+		want      bool
+	}{
+		{name: "before expiry", status: CouponStatusAvailable, expiresAt: now.Add(time.Second), want: false},
+		{name: "at expiry", status: CouponStatusAvailable, expiresAt: now, want: true},
+		{name: "past expiry not swept yet", status: CouponStatusAvailable, expiresAt: now.Add(-time.Hour), want: true},
+		{name: "swept", status: CouponStatusExpired, expiresAt: now.Add(time.Hour), want: true},
+		{name: "no expiry", status: CouponStatusAvailable, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Coupon{Status: tt.status, ExpiresAt: tt.expiresAt}
+
+			if got := c.IsExpired(now); got != tt.want {
+				t.Errorf("IsExpired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCouponCheckUsableExpiry(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    CouponStatus
+		expiresAt time.Time
+		wantErr   error
+	}{
+		{name: "within its window", status: CouponStatusAvailable, expiresAt: time.Now().Add(time.Hour)},
+		{name: "past its window", status: CouponStatusAvailable, expiresAt: time.Now().Add(-time.Minute), wantErr: ErrCouponExpired},
+		{name: "swept", status: CouponStatusExpired, expiresAt: time.Now().Add(-time.Minute), wantErr: ErrCouponExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Coupon{Status: tt.status, ExpiresAt: tt.expiresAt}
+
+			if err := c.CheckUsable(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckUsable() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCouponReserve(t *testing.T) {
+	now := time.Now()
+	order := Order{ID: "ORDER-1", Amount: 10000}
+	reservedFor := func(orderID string, until time.Time, expiresAt time.Time) *Coupon {
+		amount, discount := 10000, 1000
+		return &Coupon{Status: CouponStatusReserved, OrderID: &orderID, OrderAmount: &amount, DiscountAmount: &discount, ReservedUntil: &until, ExpiresAt: expiresAt}
+	}
+
+	tests := []struct {
+		name    string
+		coupon  *Coupon
+		until   time.Time
+		wantErr error
+	}{
+		{name: "available", coupon: &Coupon{Status: CouponStatusAvailable, ExpiresAt: now.Add(time.Hour)}, until: now.Add(15 * time.Minute)},
+		{name: "extend for the same order", coupon: reservedFor(order.ID, now.Add(time.Minute), now.Add(time.Hour)), until: now.Add(15 * time.Minute)},
+		{name: "extend a lapsed reservation for the same order", coupon: reservedFor(order.ID, now.Add(-time.Minute), now.Add(time.Hour)), until: now.Add(15 * time.Minute)},
+		{name: "extend for the same order past expiry", coupon: reservedFor(order.ID, now.Add(time.Minute), now.Add(-time.Second)), until: now.Add(15 * time.Minute), wantErr: ErrCouponExpired},
+		{name: "held for another order", coupon: reservedFor("ORDER-2", now.Add(time.Minute), now.Add(time.Hour)), until: now.Add(15 * time.Minute), wantErr: ErrCouponReserved},
+		{name: "past expiry not swept yet", coupon: &Coupon{Status: CouponStatusAvailable, ExpiresAt: now.Add(-time.Second)}, until: now.Add(15 * time.Minute), wantErr: ErrCouponExpired},
+		{name: "used", coupon: &Coupon{Status: CouponStatusUsed, ExpiresAt: now.Add(time.Hour)}, until: now.Add(15 * time.Minute), wantErr: ErrCouponAlreadyUsed},
+		{name: "revoked", coupon: &Coupon{Status: CouponStatusRevoked, ExpiresAt: now.Add(time.Hour)}, until: now.Add(15 * time.Minute), wantErr: ErrCouponRevoked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := *tt.coupon
+
+			err := tt.coupon.Reserve(order, 1000, tt.until)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Reserve() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if tt.coupon.Status != before.Status || tt.coupon.ReservedUntil != before.ReservedUntil {
+					t.Errorf("Reserve() failed but changed the coupon to %s until %v", tt.coupon.Status, tt.coupon.ReservedUntil)
+				}
+				return
+			}
+
+			if tt.coupon.Status != CouponStatusReserved {
+				t.Errorf("Status = %s, want %s", tt.coupon.Status, CouponStatusReserved)
+			}
+			if tt.coupon.ReservedUntil == nil || !tt.coupon.ReservedUntil.Equal(tt.until) {
+				t.Errorf("ReservedUntil = %v, want %s", tt.coupon.ReservedUntil, tt.until)
+			}
+			if tt.coupon.OrderID == nil || *tt.coupon.OrderID != order.ID {
+				t.Errorf("OrderID = %v, want %s", tt.coupon.OrderID, order.ID)
+			}
+		})
+	}
+}
+
+func TestCouponConfirm(t *testing.T) {
+	now := time.Now()
+	reserved := func(orderID string, until time.Time, expiresAt time.Time) *Coupon {
+		return &Coupon{Status: CouponStatusReserved, OrderID: &orderID, ReservedUntil: &until, ExpiresAt: expiresAt}
+	}
+
+	tests := []struct {
+		name    string
+		coupon  *Coupon
+		orderID string
+		wantErr error
+	}{
+		{name: "within the reservation", coupon: reserved("ORDER-1", now.Add(time.Minute), now.Add(time.Hour)), orderID: "ORDER-1"},
+		{name: "at the end of the reservation", coupon: reserved("ORDER-1", now, now.Add(time.Hour)), orderID: "ORDER-1", wantErr: ErrCouponReservationExpired},
+		{name: "reservation lapsed", coupon: reserved("ORDER-1", now.Add(-time.Minute), now.Add(time.Hour)), orderID: "ORDER-1", wantErr: ErrCouponReservationExpired},
+		{name: "coupon expired during the reservation", coupon: reserved("ORDER-1", now.Add(time.Minute), now.Add(-time.Second)), orderID: "ORDER-1", wantErr: ErrCouponExpired},
+		{name: "another order", coupon: reserved("ORDER-1", now.Add(time.Minute), now.Add(time.Hour)), orderID: "ORDER-2", wantErr: ErrCouponReserved},
+		{name: "not reserved", coupon: &Coupon{Status: CouponStatusAvailable, ExpiresAt: now.Add(time.Hour)}, orderID: "ORDER-1", wantErr: ErrCouponNotReserved},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.coupon.Confirm(tt.orderID, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Confirm() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if tt.coupon.Status != CouponStatusUsed || tt.coupon.UsedAt == nil || tt.coupon.ReservedUntil != nil {
+				t.Errorf("Confirm() = %s used at %v reserved until %v, want USED now and no reservation", tt.coupon.Status, tt.coupon.UsedAt, tt.coupon.ReservedUntil)
+			}
+		})
+	}
+}
+
+func TestCouponRelease(t *testing.T) {
+	now := time.Now()
+	reserved := func(orderID string) *Coupon {
+		amount, discount, until := 10000, 1000, now.Add(time.Minute)
+		return &Coupon{Status: CouponStatusReserved, OrderID: &orderID, OrderAmount: &amount, DiscountAmount: &discount, ReservedUntil: &until}
+	}
+
+	tests := []struct {
+		name    string
+		coupon  *Coupon
+		orderID string
+		wantErr error
+	}{
+		{name: "reserved for the order", coupon: reserved("ORDER-1"), orderID: "ORDER-1"},
+		{name: "another order", coupon: reserved("ORDER-1"), orderID: "ORDER-2", wantErr: ErrCouponReserved},
+		{name: "not reserved", coupon: &Coupon{Status: CouponStatusAvailable}, orderID: "ORDER-1", wantErr: ErrCouponNotReserved},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.coupon.Release(tt.orderID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Release() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			c := tt.coupon
+			if c.Status != CouponStatusAvailable || c.OrderID != nil || c.OrderAmount != nil || c.DiscountAmount != nil || c.ReservedUntil != nil {
+				t.Errorf("Release() = %+v, want AVAILABLE with the order cleared", c)
+			}
+		})
+	}
+}
+
+func TestCouponCancelWith(t *testing.T) {
+	used := func() *Coupon {
+		now := time.Now()
+		orderID, amount, discount := "ORDER-1", 10000, 1000
+		return &Coupon{Status: CouponStatusUsed, OrderID: &orderID, OrderAmount: &amount, DiscountAmount: &discount, UsedAt: &now, ExpiresAt: now.Add(time.Hour)}
+	}
+
+	tests := []struct {
+		name             string
+		mode             CouponPolicyCancelMode
+		status           CouponStatus
+		wantStatus       CouponStatus
+		wantQuotaRelease bool
+		wantErr          error
+	}{
+		{name: "void", mode: CouponPolicyCancelModeVoid, status: CouponStatusUsed, wantStatus: CouponStatusCanceled},
+		{name: "restore", mode: CouponPolicyCancelModeRestore, status: CouponStatusUsed, wantStatus: CouponStatusAvailable},
+		{name: "release", mode: CouponPolicyCancelModeRelease, status: CouponStatusUsed, wantStatus: CouponStatusCanceled, wantQuotaRelease: true},
+		{name: "void not used", mode: CouponPolicyCancelModeVoid, status: CouponStatusAvailable, wantErr: ErrCouponNotUsed},
+		{name: "restore not used", mode: CouponPolicyCancelModeRestore, status: CouponStatusReserved, wantErr: ErrCouponNotUsed},
+		{name: "release not used", mode: CouponPolicyCancelModeRelease, status: CouponStatusAvailable, wantErr: ErrCouponNotUsed},
+		{name: "release already canceled", mode: CouponPolicyCancelModeRelease, status: CouponStatusCanceled, wantErr: ErrCouponNotUsed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := used()
+			c.Status = tt.status
+
+			err := c.CancelWith(tt.mode)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CancelWith(%s) error = %v, want %v", tt.mode, err, tt.wantErr)
+			}
+			if err != nil {
+				if c.Status != tt.status || c.QuotaReleased || c.OrderID == nil {
+					t.Errorf("CancelWith(%s) failed but changed the coupon to %s released=%t", tt.mode, c.Status, c.QuotaReleased)
+				}
+				return
+			}
+
+			if c.Status != tt.wantStatus {
+				t.Errorf("Status = %s, want %s", c.Status, tt.wantStatus)
+			}
+			if c.QuotaReleased != tt.wantQuotaRelease {
+				t.Errorf("QuotaReleased = %t, want %t", c.QuotaReleased, tt.wantQuotaRelease)
+			}
+			if c.OrderID != nil || c.OrderAmount != nil || c.DiscountAmount != nil || c.UsedAt != nil {
+				t.Errorf("CancelWith(%s) = %+v, want the order cleared", tt.mode, c)
+			}
+		})
+	}
+}
@@ -8,24 +8,41 @@ var (
 	ErrCouponPolicyQuantityExceed  = errors.New("coupon quantity exhausted")
 	ErrCouponAlreadyUsed           = errors.New("coupon has already been used")
 	ErrCouponCanceled              = errors.New("coupon canceled")
+	ErrCouponRevoked               = errors.New("coupon revoked")
 	ErrCouponExpired               = errors.New("coupon has expired")
 	ErrCouponPending               = errors.New("coupon is pending")
+	ErrCouponReserved              = errors.New("coupon is reserved for another order")
+	ErrCouponNotReserved           = errors.New("coupon is not reserved")
+	ErrCouponReservationExpired    = errors.New("coupon reservation has expired")
+	ErrCouponReservationTTLInvalid = errors.New("invalid coupon reservation ttl")
 	ErrCouponNotUsed               = errors.New("coupon has not been used")
 	ErrCouponNotOwner              = errors.New("not the owner of this coupon")
+	ErrCouponConflict              = errors.New("coupon was changed by a concurrent request")
 	ErrCouponTooManyRequests       = errors.New("too many concurrent coupon requests")
 	ErrCouponInvalidForOrder       = errors.New("coupon not valid for this order")
-	ErrCouponUserLimitExceeded     = errors.New("user has already claimed this coupon")
+	ErrCouponUserLimitExceeded     = errors.New("user has reached the claim limit for this coupon")
 	ErrCouponOrderAmountTooLow     = errors.New("order amount is below coupon minimum requirement")
 	ErrCouponInvalidForProduct     = errors.New("coupon not applicable for selected product")
 	ErrCouponQuantityRaceCondition = errors.New("coupon quantity limit reached (race condition)")
 	ErrCouponUserAlreadyClaimed    = errors.New("user has already claimed this coupon")
+	ErrCouponPolicyPaused          = errors.New("coupon policy is paused")
+	ErrCouponPolicyRetired         = errors.New("coupon policy is retired")
+	ErrCouponPolicyPoolOnly        = errors.New("coupon policy only issues from its pool")
+	ErrCouponPolicyInvalid         = errors.New("invalid coupon policy")
+	ErrCouponPolicyInvalidStatus   = errors.New("invalid coupon policy status transition")
+	ErrCouponPolicyAlreadyExists   = errors.New("coupon policy code already exists")
+	ErrCouponCodeInvalid           = errors.New("invalid coupon code")
+	ErrCouponCursorInvalid         = errors.New("invalid coupon cursor")
+	ErrCouponFilterInvalid         = errors.New("invalid coupon filter")
 )
 
 var (
 	ErrCouponInternal       = errors.New("internal coupon service error")
 	ErrCouponNotFound       = errors.New("coupon not found")
+	ErrIssueRequestNotFound = errors.New("coupon issue request not found")
 	ErrCouponCounted        = errors.New("failed to count issued coupons")
 	ErrCouponCreated        = errors.New("failed to create coupon")
+	ErrCouponCodeConflict   = errors.New("coupon code already exists")
 	ErrCouponPolicyNotFound = errors.New("coupon policy not found")
 	ErrDatabaseUnavailable  = errors.New("database unavailable")
 	ErrTransactionFailed    = errors.New("transaction failed")
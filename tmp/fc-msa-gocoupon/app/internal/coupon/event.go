@@ -0,0 +1,63 @@
+package coupon
+
+import "time"
+
+type CouponEventType string
+
+const (
+	CouponEventTypeIssued   CouponEventType = "ISSUED"
+	CouponEventTypeUsed     CouponEventType = "USED"
+	CouponEventTypeCanceled CouponEventType = "CANCELED"
+	CouponEventTypeExpired  CouponEventType = "EXPIRED"
+	CouponEventTypeRevoked  CouponEventType = "REVOKED"
+	CouponEventTypeReserved CouponEventType = "RESERVED"
+	CouponEventTypeReleased CouponEventType = "RELEASED"
+)
+
+// Actors of the events written by the background sweepers.
+const (
+	ActorExpirySweeper      = "system:expiry-sweeper"
+	ActorReservationSweeper = "system:reservation-sweeper"
+)
+
+// ActorAdmin is the actor of admin changes when auth is disabled and the admin has no user ID.
+const ActorAdmin = "admin"
+
+// CouponEvent is an append-only record of a coupon status change. It is written by the same
+// statement as the change, which fills CouponID and Status from the written coupon.
+// PreviousStatus is nil when the coupon was created by the change, Reason is only set on REVOKED.
+type CouponEvent struct {
+	ID             int64           `json:"id"`
+	CouponID       string          `json:"coupon_id"`
+	Type           CouponEventType `json:"type"`
+	PreviousStatus *CouponStatus   `json:"previous_status,omitempty"`
+	Status         CouponStatus    `json:"status"`
+	Actor          string          `json:"actor"`
+	OrderID        *string         `json:"order_id,omitempty"`
+	TraceID        *string         `json:"trace_id,omitempty"`
+	Reason         *string         `json:"reason,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// NewCouponEvent records a change from previousStatus by actor. An empty previousStatus means
+// the coupon is created by the change, an empty traceID that the change is not traced.
+func NewCouponEvent(eventType CouponEventType, previousStatus CouponStatus, actor string, orderID *string, traceID string) *CouponEvent {
+	event := &CouponEvent{
+		Type:    eventType,
+		Actor:   actor,
+		OrderID: orderID,
+	}
+	if previousStatus != "" {
+		event.PreviousStatus = &previousStatus
+	}
+	if traceID != "" {
+		event.TraceID = &traceID
+	}
+	return event
+}
+
+// CouponHistory is the current coupon with the timeline of its status changes, oldest first.
+type CouponHistory struct {
+	Coupon *Coupon       `json:"coupon"`
+	Events []CouponEvent `json:"events"`
+}
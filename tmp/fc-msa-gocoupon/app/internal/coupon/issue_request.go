@@ -0,0 +1,31 @@
+package coupon
+
+import "time"
+
+type IssueRequestStatus string
+
+const (
+	// IssueRequestStatusPending means the issue message is waiting in the outbox or in Kafka
+	IssueRequestStatusPending IssueRequestStatus = "PENDING"
+	// IssueRequestStatusAvailable means the consumer persisted the coupon
+	IssueRequestStatusAvailable IssueRequestStatus = "AVAILABLE"
+	// IssueRequestStatusFailed means the message was dead-lettered, a DLQ replay can still make it AVAILABLE
+	IssueRequestStatusFailed IssueRequestStatus = "FAILED"
+)
+
+// IssueRequest tracks an asynchronous coupon issuance, its ID is the coupon ID returned when the request was accepted.
+type IssueRequest struct {
+	ID             string             `json:"id"`
+	CouponPolicyID string             `json:"coupon_policy_id"`
+	UserID         string             `json:"user_id"`
+	CouponCode     string             `json:"coupon_code"`
+	Status         IssueRequestStatus `json:"status"`
+	Error          *string            `json:"error,omitempty"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+}
+
+// IsFinal returns true once the consumer has settled the request
+func (r *IssueRequest) IsFinal() bool {
+	return r.Status != IssueRequestStatusPending
+}
@@ -0,0 +1,53 @@
+package coupon
+
+import "fmt"
+
+type OrderItem struct {
+	ProductID string `json:"product_id"`
+	Category  string `json:"category"`
+	Quantity  int    `json:"quantity"`
+	UnitPrice int    `json:"unit_price"`
+}
+
+// Subtotal returns the item price multiplied by its quantity.
+func (i OrderItem) Subtotal() int {
+	return i.Quantity * i.UnitPrice
+}
+
+type Order struct {
+	ID     string      `json:"id"`
+	Amount int         `json:"amount"`
+	Items  []OrderItem `json:"items"`
+}
+
+// Total returns the order amount, or the sum of the item subtotals when no amount was given.
+func (o Order) Total() int {
+	if o.Amount > 0 {
+		return o.Amount
+	}
+
+	total := 0
+	for _, item := range o.Items {
+		total += item.Subtotal()
+	}
+	return total
+}
+
+// Validate checks that the order has a positive amount and well-formed line items.
+func (o Order) Validate() error {
+	if o.Amount < 0 {
+		return fmt.Errorf("%w, order amount must not be negative", ErrCouponInvalidForOrder)
+	}
+
+	for _, item := range o.Items {
+		if item.Quantity <= 0 || item.UnitPrice < 0 {
+			return fmt.Errorf("%w, invalid line item %q", ErrCouponInvalidForOrder, item.ProductID)
+		}
+	}
+
+	if o.Total() <= 0 {
+		return fmt.Errorf("%w, order amount is required", ErrCouponInvalidForOrder)
+	}
+
+	return nil
+}
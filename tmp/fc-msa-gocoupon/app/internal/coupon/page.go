@@ -0,0 +1,83 @@
+package coupon
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// CouponCursor is the keyset position of the last coupon of a page. Listings are ordered by
+// (created_at, id) descending, so the next page starts strictly after it.
+type CouponCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        string    `json:"i"`
+}
+
+// Encode returns the cursor as an opaque token for the next_cursor field.
+func (c CouponCursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCouponCursor parses a token returned by Encode. An empty token means the first page.
+func DecodeCouponCursor(token string) (*CouponCursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrCouponCursorInvalid
+	}
+	var c CouponCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" || c.CreatedAt.IsZero() {
+		return nil, ErrCouponCursorInvalid
+	}
+	return &c, nil
+}
+
+// CouponFilter selects the coupons of a listing. UserID or PolicyCode is always set by the caller.
+type CouponFilter struct {
+	UserID     string
+	PolicyCode string
+	Status     CouponStatus
+	Cursor     *CouponCursor
+	Limit      int
+}
+
+// Validate checks the status filter and clamps the limit to (0, MaxPageLimit].
+func (f *CouponFilter) Validate() error {
+	switch f.Status {
+	case "", CouponStatusPending, CouponStatusAvailable, CouponStatusUsed, CouponStatusExpired, CouponStatusCanceled, CouponStatusUnassigned, CouponStatusReserved, CouponStatusRevoked:
+	default:
+		return fmt.Errorf("%w, unknown status %q", ErrCouponFilterInvalid, f.Status)
+	}
+
+	if f.Limit <= 0 {
+		f.Limit = DefaultPageLimit
+	}
+	f.Limit = min(f.Limit, MaxPageLimit)
+	return nil
+}
+
+type CouponPage struct {
+	Items      []Coupon `json:"items"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// NewCouponPage builds a page from up to limit+1 coupons, the extra one only signalling a next page.
+func NewCouponPage(coupons []Coupon, limit int) *CouponPage {
+	page := &CouponPage{Items: coupons}
+	if len(coupons) > limit {
+		page.Items = coupons[:limit]
+		last := page.Items[limit-1]
+		page.NextCursor = CouponCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	return page
+}
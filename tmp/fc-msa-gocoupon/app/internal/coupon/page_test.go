@@ -0,0 +1,139 @@
+package coupon
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCouponCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor CouponCursor
+	}{
+		{name: "utc", cursor: CouponCursor{CreatedAt: time.Date(2025, 12, 1, 10, 0, 0, 0, time.UTC), ID: "5b0c3c1e-7d1a-4c1b-9f3e-2a6d8e4f1b7c"}},
+		{name: "microseconds", cursor: CouponCursor{CreatedAt: time.Date(2025, 12, 1, 10, 0, 0, 123456000, time.UTC), ID: "a"}},
+		{name: "non utc zone", cursor: CouponCursor{CreatedAt: time.Date(2025, 12, 1, 19, 0, 0, 0, time.FixedZone("KST", 9*60*60)), ID: "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeCouponCursor(tt.cursor.Encode())
+			if err != nil {
+				t.Fatalf("DecodeCouponCursor() error = %v", err)
+			}
+			if !got.CreatedAt.Equal(tt.cursor.CreatedAt) || got.ID != tt.cursor.ID {
+				t.Errorf("DecodeCouponCursor() = %+v, want %+v", got, tt.cursor)
+			}
+		})
+	}
+}
+
+func TestDecodeCouponCursor(t *testing.T) {
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantNil bool
+		wantErr error
+	}{
+		{name: "empty is the first page", token: "", wantNil: true},
+		{name: "not base64", token: "not a cursor!", wantErr: ErrCouponCursorInvalid},
+		{name: "not json", token: encode("created_at=2025-12-01"), wantErr: ErrCouponCursorInvalid},
+		{name: "missing id", token: encode(`{"c":"2025-12-01T10:00:00Z"}`), wantErr: ErrCouponCursorInvalid},
+		{name: "missing created at", token: encode(`{"i":"a"}`), wantErr: ErrCouponCursorInvalid},
+		{name: "malformed created at", token: encode(`{"c":"yesterday","i":"a"}`), wantErr: ErrCouponCursorInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeCouponCursor(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DecodeCouponCursor(%q) error = %v, want %v", tt.token, err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (got == nil) != tt.wantNil {
+				t.Errorf("DecodeCouponCursor(%q) = %+v, want nil %v", tt.token, got, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestCouponFilterValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		filter    CouponFilter
+		wantLimit int
+		wantErr   error
+	}{
+		{name: "default limit", filter: CouponFilter{}, wantLimit: DefaultPageLimit},
+		{name: "negative limit", filter: CouponFilter{Limit: -1}, wantLimit: DefaultPageLimit},
+		{name: "limit kept", filter: CouponFilter{Limit: 50}, wantLimit: 50},
+		{name: "limit clamped", filter: CouponFilter{Limit: MaxPageLimit + 1}, wantLimit: MaxPageLimit},
+		{name: "known status", filter: CouponFilter{Status: CouponStatusReserved}, wantLimit: DefaultPageLimit},
+		{name: "unknown status", filter: CouponFilter{Status: "LOST"}, wantErr: ErrCouponFilterInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.filter.Validate()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && tt.filter.Limit != tt.wantLimit {
+				t.Errorf("Limit = %d, want %d", tt.filter.Limit, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestNewCouponPage(t *testing.T) {
+	createdAt := time.Date(2025, 12, 1, 10, 0, 0, 0, time.UTC)
+	coupons := func(n int) []Coupon {
+		list := make([]Coupon, n)
+		for i := range list {
+			list[i] = Coupon{ID: fmt.Sprintf("coupon-%d", i), CreatedAt: createdAt.Add(-time.Duration(i) * time.Minute)}
+		}
+		return list
+	}
+
+	tests := []struct {
+		name      string
+		coupons   []Coupon
+		limit     int
+		wantItems int
+		wantNext  *CouponCursor
+	}{
+		{name: "empty", coupons: coupons(0), limit: 3, wantItems: 0},
+		{name: "short page", coupons: coupons(2), limit: 3, wantItems: 2},
+		{name: "exactly full", coupons: coupons(3), limit: 3, wantItems: 3},
+		{name: "one more than the limit", coupons: coupons(4), limit: 3, wantItems: 3, wantNext: &CouponCursor{CreatedAt: createdAt.Add(-2 * time.Minute), ID: "coupon-2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := NewCouponPage(tt.coupons, tt.limit)
+			if len(page.Items) != tt.wantItems {
+				t.Errorf("len(Items) = %d, want %d", len(page.Items), tt.wantItems)
+			}
+
+			if tt.wantNext == nil {
+				if page.NextCursor != "" {
+					t.Errorf("NextCursor = %q, want none", page.NextCursor)
+				}
+				return
+			}
+			next, err := DecodeCouponCursor(page.NextCursor)
+			if err != nil {
+				t.Fatalf("DecodeCouponCursor(NextCursor) error = %v", err)
+			}
+			if !next.CreatedAt.Equal(tt.wantNext.CreatedAt) || next.ID != tt.wantNext.ID {
+				t.Errorf("NextCursor = %+v, want %+v", next, tt.wantNext)
+			}
+		})
+	}
+}
@@ -1,22 +1,144 @@
 package coupon
 
+import "time"
+
 type IssueCouponRequest struct {
 	PolicyCode string `json:"policy_code"`
 }
 
 type UseCouponRequest struct {
+	CouponCode  string      `json:"coupon_code"`
+	OrderID     string      `json:"order_id"`
+	OrderAmount int         `json:"order_amount"`
+	Items       []OrderItem `json:"items"`
+}
+
+type QuoteCouponRequest struct {
+	CouponCode  string      `json:"coupon_code"`
+	OrderAmount int         `json:"order_amount"`
+	Items       []OrderItem `json:"items"`
+}
+
+type CouponQuote struct {
+	CouponCode     string `json:"coupon_code"`
+	PolicyCode     string `json:"policy_code"`
+	OrderAmount    int    `json:"order_amount"`
+	DiscountAmount int    `json:"discount_amount"`
+	FinalAmount    int    `json:"final_amount"`
+}
+
+// QuotaReconciliation reports how a policy's Redis quota compared with Postgres and what was done about it.
+// Expected is total_quantity - issued - in_flight, and Drift is redis - expected.
+type QuotaReconciliation struct {
+	PolicyCode    string                    `json:"policy_code"`
+	TotalQuantity int                       `json:"total_quantity"`
+	Issued        int                       `json:"issued"`
+	InFlight      int                       `json:"in_flight"`
+	Expected      int                       `json:"expected"`
+	Redis         *int                      `json:"redis"`
+	Drift         int                       `json:"drift"`
+	Action        QuotaReconciliationAction `json:"action"`
+	CheckedAt     time.Time                 `json:"checked_at"`
+}
+
+type QuotaReconciliationAction string
+
+const (
+	// QuotaReconciliationInSync means the Redis counter matched Postgres
+	QuotaReconciliationInSync QuotaReconciliationAction = "IN_SYNC"
+	// QuotaReconciliationCacheMiss means there was no Redis counter, issuers rebuild it on the next request
+	QuotaReconciliationCacheMiss QuotaReconciliationAction = "CACHE_MISS"
+	// QuotaReconciliationCorrected means the Redis counter was reset to the expected value
+	QuotaReconciliationCorrected QuotaReconciliationAction = "CORRECTED"
+	// QuotaReconciliationPending means the counter is low, but the drift has not been stable long enough to rule out messages still in Kafka
+	QuotaReconciliationPending QuotaReconciliationAction = "PENDING"
+	// QuotaReconciliationOutOfBound means the counter is low by more than the configured max correction and needs an operator
+	QuotaReconciliationOutOfBound QuotaReconciliationAction = "OUT_OF_BOUND"
+	// QuotaReconciliationConflict means the counter moved while reconciling, it is checked again on the next run
+	QuotaReconciliationConflict QuotaReconciliationAction = "CONFLICT"
+)
+
+type CancelCouponRequest struct {
+	CouponCode string `json:"coupon_code"`
+}
+
+// ReserveCouponRequest holds the coupon for the order, TTLSeconds defaults to DefaultReservationTTL
+type ReserveCouponRequest struct {
+	CouponCode  string      `json:"coupon_code"`
+	OrderID     string      `json:"order_id"`
+	OrderAmount int         `json:"order_amount"`
+	Items       []OrderItem `json:"items"`
+	TTLSeconds  int         `json:"ttl_seconds"`
+}
+
+type ConfirmCouponRequest struct {
 	CouponCode string `json:"coupon_code"`
 	OrderID    string `json:"order_id"`
 }
 
-type CancelCouponRequest struct {
+type ReleaseCouponRequest struct {
 	CouponCode string `json:"coupon_code"`
+	OrderID    string `json:"order_id"`
+}
+
+// RevokeCouponRequest is an admin revoking a coupon, Reason is kept in the coupon history
+type RevokeCouponRequest struct {
+	Reason string `json:"reason"`
 }
 
 type IssueCouponMessage struct {
-	PolicyID   string `json:"policy_id"`
-	PolicyCode string `json:"policy_code"`
-	CouponID   string `json:"coupon_id"`
-	CouponCode string `json:"coupon_code"`
-	UserID     string `json:"user_id"`
+	PolicyID   string    `json:"policy_id"`
+	PolicyCode string    `json:"policy_code"`
+	CouponID   string    `json:"coupon_id"`
+	CouponCode string    `json:"coupon_code"`
+	UserID     string    `json:"user_id"`
+	ExpiresAt  time.Time `json:"expires_at"`
+
+	// RecordClaim is set by issuers that only claimed in redis (v5),
+	// so the consumer records the user claim in postgres with the coupon.
+	RecordClaim bool `json:"record_claim,omitempty"`
+}
+
+type CreateCouponPolicyRequest struct {
+	Code                  string                   `json:"code"`
+	Name                  string                   `json:"name"`
+	Description           string                   `json:"description"`
+	TotalQuantity         int                      `json:"total_quantity"`
+	StartTime             time.Time                `json:"start_time"`
+	EndTime               time.Time                `json:"end_time"`
+	DiscountType          DiscountType             `json:"discount_type"`
+	DiscountValue         int                      `json:"discount_value"`
+	MinimumOrderAmount    int                      `json:"minimum_order_amount"`
+	MaximumDiscountAmount int                      `json:"maximum_discount_amount"`
+	MaxPerUser            int                      `json:"max_per_user"`
+	IncludeProductIDs     []string                 `json:"include_product_ids"`
+	ExcludeProductIDs     []string                 `json:"exclude_product_ids"`
+	IncludeCategories     []string                 `json:"include_categories"`
+	ExcludeCategories     []string                 `json:"exclude_categories"`
+	ValidDays             *int                     `json:"valid_days,omitempty"`
+	IssuanceMode          CouponPolicyIssuanceMode `json:"issuance_mode,omitempty"`
+	CodePrefix            string                   `json:"code_prefix,omitempty"`
+	CodeLength            int                      `json:"code_length,omitempty"`
+	WaitingRoom           bool                     `json:"waiting_room,omitempty"`
+	CancelMode            CouponPolicyCancelMode   `json:"cancel_mode,omitempty"`
+}
+
+type UpdateCouponPolicyRequest struct {
+	Name                  string                 `json:"name"`
+	Description           string                 `json:"description"`
+	TotalQuantity         int                    `json:"total_quantity"`
+	StartTime             time.Time              `json:"start_time"`
+	EndTime               time.Time              `json:"end_time"`
+	DiscountType          DiscountType           `json:"discount_type"`
+	DiscountValue         int                    `json:"discount_value"`
+	MinimumOrderAmount    int                    `json:"minimum_order_amount"`
+	MaximumDiscountAmount int                    `json:"maximum_discount_amount"`
+	MaxPerUser            int                    `json:"max_per_user"`
+	IncludeProductIDs     []string               `json:"include_product_ids"`
+	ExcludeProductIDs     []string               `json:"exclude_product_ids"`
+	IncludeCategories     []string               `json:"include_categories"`
+	ExcludeCategories     []string               `json:"exclude_categories"`
+	ValidDays             *int                   `json:"valid_days,omitempty"`
+	WaitingRoom           *bool                  `json:"waiting_room,omitempty"`
+	CancelMode            CouponPolicyCancelMode `json:"cancel_mode,omitempty"`
 }
@@ -2,7 +2,10 @@ package coupon
 
 import (
 	"fmt"
+	"slices"
 	"time"
+
+	"example.com/coupon-service/internal/couponcode"
 )
 
 type DiscountType string
@@ -12,20 +15,60 @@ const (
 	DiscountTypePercentage  DiscountType = "PERCENTAGE"
 )
 
+type CouponPolicyStatus string
+
+const (
+	CouponPolicyStatusActive  CouponPolicyStatus = "ACTIVE"
+	CouponPolicyStatusPaused  CouponPolicyStatus = "PAUSED"
+	CouponPolicyStatusRetired CouponPolicyStatus = "RETIRED"
+)
+
+type CouponPolicyIssuanceMode string
+
+const (
+	// CouponPolicyIssuanceModeOnDemand generates a coupon row for every issue request
+	CouponPolicyIssuanceModeOnDemand CouponPolicyIssuanceMode = "ON_DEMAND"
+	// CouponPolicyIssuanceModePool assigns coupons pre-generated by the pool job, falling back to on-demand once the pool is empty
+	CouponPolicyIssuanceModePool CouponPolicyIssuanceMode = "POOL"
+)
+
+type CouponPolicyCancelMode string
+
+const (
+	// CouponPolicyCancelModeVoid cancels the coupon for good, it keeps its unit of the quota
+	CouponPolicyCancelModeVoid CouponPolicyCancelMode = "VOID"
+	// CouponPolicyCancelModeRestore returns the coupon to its owner as AVAILABLE, so it can be used for another order
+	CouponPolicyCancelModeRestore CouponPolicyCancelMode = "RESTORE"
+	// CouponPolicyCancelModeRelease cancels the coupon and gives its unit back to the quota, so another user can be issued one
+	CouponPolicyCancelModeRelease CouponPolicyCancelMode = "RELEASE"
+)
+
 type CouponPolicy struct {
-	ID                    string       `json:"id"`
-	Code                  string       `json:"code"`
-	Name                  string       `json:"name"`
-	Description           string       `json:"description"`
-	TotalQuantity         int          `json:"total_quantity"`
-	StartTime             time.Time    `json:"start_time"`
-	EndTime               time.Time    `json:"end_time"`
-	DiscountType          DiscountType `json:"discount_type"`
-	DiscountValue         int          `json:"discount_value"`
-	MinimumOrderAmount    int          `json:"minimum_order_amount"`
-	MaximumDiscountAmount int          `json:"maximum_discount_amount"`
-	CreatedAt             time.Time    `json:"created_at"`
-	UpdatedAt             time.Time    `json:"updated_at"`
+	ID                    string                   `json:"id"`
+	Code                  string                   `json:"code"`
+	Name                  string                   `json:"name"`
+	Description           string                   `json:"description"`
+	TotalQuantity         int                      `json:"total_quantity"`
+	StartTime             time.Time                `json:"start_time"`
+	EndTime               time.Time                `json:"end_time"`
+	DiscountType          DiscountType             `json:"discount_type"`
+	DiscountValue         int                      `json:"discount_value"`
+	MinimumOrderAmount    int                      `json:"minimum_order_amount"`
+	MaximumDiscountAmount int                      `json:"maximum_discount_amount"`
+	MaxPerUser            int                      `json:"max_per_user"`
+	Status                CouponPolicyStatus       `json:"status"`
+	IncludeProductIDs     []string                 `json:"include_product_ids"`
+	ExcludeProductIDs     []string                 `json:"exclude_product_ids"`
+	IncludeCategories     []string                 `json:"include_categories"`
+	ExcludeCategories     []string                 `json:"exclude_categories"`
+	ValidDays             *int                     `json:"valid_days,omitempty"`
+	IssuanceMode          CouponPolicyIssuanceMode `json:"issuance_mode"`
+	CodePrefix            string                   `json:"code_prefix"`
+	CodeLength            int                      `json:"code_length"`
+	WaitingRoom           bool                     `json:"waiting_room"`
+	CancelMode            CouponPolicyCancelMode   `json:"cancel_mode"`
+	CreatedAt             time.Time                `json:"created_at"`
+	UpdatedAt             time.Time                `json:"updated_at"`
 
 	Coupons []Coupon `json:"coupons,omitempty"`
 }
@@ -46,3 +89,232 @@ func (c *CouponPolicy) IsValidPeriod() error {
 
 	return nil
 }
+
+// CouponExpiresAt returns when a coupon issued at issuedAt expires: ValidDays after issuance
+// if the policy sets it, otherwise at the end of the policy period.
+func (c *CouponPolicy) CouponExpiresAt(issuedAt time.Time) time.Time {
+	if c.ValidDays != nil {
+		return issuedAt.UTC().AddDate(0, 0, *c.ValidDays)
+	}
+
+	return c.EndTime.UTC()
+}
+
+// NewCouponCode generates a coupon code with the policy's prefix and length.
+func (c *CouponPolicy) NewCouponCode() string {
+	return couponcode.Generate(c.CodePrefix, c.CodeLength)
+}
+
+// IsIssuable returns an error if the policy is paused, retired or outside its valid period.
+func (c *CouponPolicy) IsIssuable() error {
+	switch c.Status {
+	case CouponPolicyStatusPaused:
+		return ErrCouponPolicyPaused
+	case CouponPolicyStatusRetired:
+		return ErrCouponPolicyRetired
+	}
+
+	return c.IsValidPeriod()
+}
+
+// CheckOnDemand returns an error for a POOL policy, its quota is held by pre-generated codes that
+// only the v5 issuer hands out, so creating coupons on the fly would issue past it.
+func (c *CouponPolicy) CheckOnDemand() error {
+	if c.IssuanceMode == CouponPolicyIssuanceModePool {
+		return fmt.Errorf("%w, issue it with the v5 API", ErrCouponPolicyPoolOnly)
+	}
+
+	return nil
+}
+
+// Validate checks the discount, time window and quantity settings of the coupon policy.
+func (c *CouponPolicy) Validate() error {
+	if c.Code == "" || len(c.Code) > 50 {
+		return fmt.Errorf("%w, code must be between 1 and 50 characters", ErrCouponPolicyInvalid)
+	}
+	if c.Name == "" {
+		return fmt.Errorf("%w, name is required", ErrCouponPolicyInvalid)
+	}
+	if c.TotalQuantity <= 0 {
+		return fmt.Errorf("%w, total_quantity must be greater than 0", ErrCouponPolicyInvalid)
+	}
+	if c.StartTime.IsZero() || c.EndTime.IsZero() {
+		return fmt.Errorf("%w, start_time and end_time are required", ErrCouponPolicyInvalid)
+	}
+	if !c.EndTime.After(c.StartTime) {
+		return fmt.Errorf("%w, end_time must be after start_time", ErrCouponPolicyInvalid)
+	}
+
+	switch c.DiscountType {
+	case DiscountTypeFixedAmount:
+		if c.DiscountValue <= 0 {
+			return fmt.Errorf("%w, fixed discount_value must be greater than 0", ErrCouponPolicyInvalid)
+		}
+	case DiscountTypePercentage:
+		if c.DiscountValue <= 0 || c.DiscountValue > 100 {
+			return fmt.Errorf("%w, percentage discount_value must be between 1 and 100", ErrCouponPolicyInvalid)
+		}
+	default:
+		return fmt.Errorf("%w, unknown discount_type %q", ErrCouponPolicyInvalid, c.DiscountType)
+	}
+
+	if c.MinimumOrderAmount < 0 {
+		return fmt.Errorf("%w, minimum_order_amount must not be negative", ErrCouponPolicyInvalid)
+	}
+	if c.MaximumDiscountAmount < 0 {
+		return fmt.Errorf("%w, maximum_discount_amount must not be negative", ErrCouponPolicyInvalid)
+	}
+	if c.MaxPerUser <= 0 {
+		return fmt.Errorf("%w, max_per_user must be greater than 0", ErrCouponPolicyInvalid)
+	}
+
+	switch c.IssuanceMode {
+	case CouponPolicyIssuanceModeOnDemand, CouponPolicyIssuanceModePool:
+	default:
+		return fmt.Errorf("%w, unknown issuance_mode %q", ErrCouponPolicyInvalid, c.IssuanceMode)
+	}
+
+	switch c.CancelMode {
+	case CouponPolicyCancelModeVoid, CouponPolicyCancelModeRestore, CouponPolicyCancelModeRelease:
+	default:
+		return fmt.Errorf("%w, unknown cancel_mode %q", ErrCouponPolicyInvalid, c.CancelMode)
+	}
+
+	if err := couponcode.ValidateFormat(c.CodePrefix, c.CodeLength); err != nil {
+		return fmt.Errorf("%w, %v", ErrCouponPolicyInvalid, err)
+	}
+
+	if c.ValidDays != nil && *c.ValidDays <= 0 {
+		return fmt.Errorf("%w, valid_days must be greater than 0", ErrCouponPolicyInvalid)
+	}
+
+	for _, list := range [][]string{c.IncludeProductIDs, c.ExcludeProductIDs, c.IncludeCategories, c.ExcludeCategories} {
+		if slices.Contains(list, "") {
+			return fmt.Errorf("%w, product and category lists must not contain empty values", ErrCouponPolicyInvalid)
+		}
+	}
+
+	return nil
+}
+
+// CalculateDiscount returns the discount the policy gives on the order,
+// applying the minimum order amount and the maximum discount cap.
+func (c *CouponPolicy) CalculateDiscount(order Order) (int, error) {
+	if err := order.Validate(); err != nil {
+		return 0, err
+	}
+
+	amount := order.Total()
+	if amount < c.MinimumOrderAmount {
+		return 0, fmt.Errorf("%w, minimum %v, got %v", ErrCouponOrderAmountTooLow, c.MinimumOrderAmount, amount)
+	}
+
+	// Product-scoped policies only discount the eligible items
+	base := amount
+	if c.IsProductScoped() {
+		eligible, err := c.EligibleAmount(order)
+		if err != nil {
+			return 0, err
+		}
+		base = eligible
+	}
+
+	var discount int
+	switch c.DiscountType {
+	case DiscountTypeFixedAmount:
+		discount = c.DiscountValue
+	case DiscountTypePercentage:
+		discount = base * c.DiscountValue / 100
+	default:
+		return 0, fmt.Errorf("%w, unknown discount_type %q", ErrCouponPolicyInvalid, c.DiscountType)
+	}
+
+	if c.MaximumDiscountAmount > 0 && discount > c.MaximumDiscountAmount {
+		discount = c.MaximumDiscountAmount
+	}
+	if discount > base {
+		discount = base
+	}
+
+	return discount, nil
+}
+
+// IsProductScoped returns true if the policy restricts which products or categories it applies to.
+func (c *CouponPolicy) IsProductScoped() bool {
+	return len(c.IncludeProductIDs) > 0 || len(c.ExcludeProductIDs) > 0 ||
+		len(c.IncludeCategories) > 0 || len(c.ExcludeCategories) > 0
+}
+
+// AppliesTo returns true if the order item is eligible for the policy discount.
+// Exclusions take precedence, and empty include lists accept every item that is not excluded.
+func (c *CouponPolicy) AppliesTo(item OrderItem) bool {
+	if slices.Contains(c.ExcludeProductIDs, item.ProductID) || slices.Contains(c.ExcludeCategories, item.Category) {
+		return false
+	}
+
+	if len(c.IncludeProductIDs) == 0 && len(c.IncludeCategories) == 0 {
+		return true
+	}
+
+	return slices.Contains(c.IncludeProductIDs, item.ProductID) || slices.Contains(c.IncludeCategories, item.Category)
+}
+
+// EligibleAmount returns the subtotal of the order items the policy applies to,
+// or an error if the order has no items or none of them are eligible.
+func (c *CouponPolicy) EligibleAmount(order Order) (int, error) {
+	if len(order.Items) == 0 {
+		return 0, fmt.Errorf("%w, order items are required for this coupon", ErrCouponInvalidForOrder)
+	}
+
+	eligible := 0
+	for _, item := range order.Items {
+		if c.AppliesTo(item) {
+			eligible += item.Subtotal()
+		}
+	}
+
+	if eligible == 0 {
+		return 0, ErrCouponInvalidForProduct
+	}
+
+	return eligible, nil
+}
+
+// UserLimitError returns the error reported when a user reaches the policy's max_per_user.
+func (c *CouponPolicy) UserLimitError() error {
+	if c.MaxPerUser == 1 {
+		return ErrCouponUserAlreadyClaimed
+	}
+
+	return fmt.Errorf("%w, max %v per user", ErrCouponUserLimitExceeded, c.MaxPerUser)
+}
+
+// Pause stops the policy from issuing coupons until it is resumed, or returns an error
+func (c *CouponPolicy) Pause() error {
+	if c.Status != CouponPolicyStatusActive {
+		return fmt.Errorf("%w, cannot pause %s policy", ErrCouponPolicyInvalidStatus, c.Status)
+	}
+
+	c.Status = CouponPolicyStatusPaused
+	return nil
+}
+
+// Resume re-activates a paused policy, or returns an error
+func (c *CouponPolicy) Resume() error {
+	if c.Status != CouponPolicyStatusPaused {
+		return fmt.Errorf("%w, cannot resume %s policy", ErrCouponPolicyInvalidStatus, c.Status)
+	}
+
+	c.Status = CouponPolicyStatusActive
+	return nil
+}
+
+// Retire permanently stops the policy from issuing coupons, or returns an error
+func (c *CouponPolicy) Retire() error {
+	if c.Status == CouponPolicyStatusRetired {
+		return fmt.Errorf("%w, policy already retired", ErrCouponPolicyInvalidStatus)
+	}
+
+	c.Status = CouponPolicyStatusRetired
+	return nil
+}
@@ -0,0 +1,82 @@
+package coupon
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"example.com/coupon-service/internal/couponcode"
+)
+
+func TestCouponExpiresAt(t *testing.T) {
+	endTime := time.Date(2025, 12, 31, 23, 59, 59, 0, time.UTC)
+	issuedAt := time.Date(2025, 12, 1, 10, 0, 0, 0, time.FixedZone("KST", 9*60*60))
+
+	tests := []struct {
+		name      string
+		validDays *int
+		want      time.Time
+	}{
+		{name: "no valid days ends with the policy", validDays: nil, want: endTime},
+		{name: "valid days count from issuance", validDays: ptr(7), want: time.Date(2025, 12, 8, 1, 0, 0, 0, time.UTC)},
+		{name: "valid days may outlive the policy", validDays: ptr(60), want: time.Date(2026, 1, 30, 1, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &CouponPolicy{EndTime: endTime, ValidDays: tt.validDays}
+
+			got := policy.CouponExpiresAt(issuedAt)
+			if !got.Equal(tt.want) {
+				t.Errorf("CouponExpiresAt() = %s, want %s", got, tt.want)
+			}
+			if got.Location() != time.UTC {
+				t.Errorf("CouponExpiresAt() location = %s, want UTC", got.Location())
+			}
+		})
+	}
+}
+
+func TestValidateValidDays(t *testing.T) {
+	tests := []struct {
+		name      string
+		validDays *int
+		wantErr   error
+	}{
+		{name: "unset", validDays: nil},
+		{name: "one day", validDays: ptr(1)},
+		{name: "zero", validDays: ptr(0), wantErr: ErrCouponPolicyInvalid},
+		{name: "negative", validDays: ptr(-1), wantErr: ErrCouponPolicyInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := validPolicy()
+			policy.ValidDays = tt.validDays
+
+			if err := policy.Validate(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func validPolicy() *CouponPolicy {
+	return &CouponPolicy{
+		Code:          "FLASH-2025",
+		Name:          "Flash Sale 2025",
+		TotalQuantity: 100,
+		StartTime:     time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC),
+		EndTime:       time.Date(2025, 12, 31, 23, 59, 59, 0, time.UTC),
+		DiscountType:  DiscountTypeFixedAmount,
+		DiscountValue: 1000,
+		MaxPerUser:    1,
+		CodeLength:    couponcode.DefaultLength,
+		IssuanceMode:  CouponPolicyIssuanceModeOnDemand,
+		CancelMode:    CouponPolicyCancelModeVoid,
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
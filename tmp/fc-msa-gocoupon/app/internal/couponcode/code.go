@@ -0,0 +1,132 @@
+package couponcode
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Alphabet drops 0/O and 1/I, which customers confuse when typing a code at checkout.
+// Its 32 characters let every random byte map to a character without modulo bias.
+const Alphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+const (
+	DefaultLength   = 12
+	MinLength       = 6
+	MaxLength       = 24
+	MaxPrefixLength = 16
+
+	// MaxAttempts bounds how many fresh codes an issuer tries when one collides with the unique index.
+	MaxAttempts = 5
+)
+
+var (
+	ErrMalformed  = errors.New("malformed code")
+	ErrCheckDigit = errors.New("check digit mismatch")
+)
+
+// Generate returns PREFIX-BODYC, or BODYC without a prefix, where BODY is length random
+// characters of Alphabet and C is its Luhn mod 32 check character.
+func Generate(prefix string, length int) string {
+	if length <= 0 {
+		length = DefaultLength
+	}
+
+	random := make([]byte, length)
+	_, _ = rand.Read(random)
+
+	body := make([]byte, length, length+1)
+	for i, b := range random {
+		body[i] = Alphabet[int(b)%len(Alphabet)]
+	}
+	body = append(body, checkCharacter(body))
+
+	if prefix == "" {
+		return string(body)
+	}
+	return prefix + "-" + string(body)
+}
+
+// Parse normalizes a code typed by a customer and verifies its format and check character,
+// so a typo is rejected without a database lookup. UUID codes issued before the generator
+// existed are passed through unchanged.
+func Parse(code string) (string, error) {
+	code = strings.TrimSpace(code)
+	if len(code) == 36 {
+		if _, err := uuid.Parse(code); err == nil {
+			return code, nil
+		}
+	}
+
+	code = strings.ToUpper(strings.ReplaceAll(code, " ", ""))
+
+	prefix, body := "", code
+	if i := strings.LastIndexByte(code, '-'); i >= 0 {
+		prefix, body = code[:i], code[i+1:]
+	}
+	if err := ValidatePrefix(prefix); err != nil {
+		return "", err
+	}
+	if len(body) < MinLength+1 || len(body) > MaxLength+1 {
+		return "", fmt.Errorf("%w, length must be between %d and %d characters", ErrMalformed, MinLength+1, MaxLength+1)
+	}
+	for i := 0; i < len(body); i++ {
+		if strings.IndexByte(Alphabet, body[i]) < 0 {
+			return "", fmt.Errorf("%w, unexpected character %q", ErrMalformed, body[i])
+		}
+	}
+
+	last := len(body) - 1
+	if checkCharacter([]byte(body[:last])) != body[last] {
+		return "", ErrCheckDigit
+	}
+
+	return code, nil
+}
+
+// ValidateFormat checks a policy's code prefix and length.
+func ValidateFormat(prefix string, length int) error {
+	if length < MinLength || length > MaxLength {
+		return fmt.Errorf("%w, code_length must be between %d and %d", ErrMalformed, MinLength, MaxLength)
+	}
+	return ValidatePrefix(prefix)
+}
+
+// ValidatePrefix accepts an empty prefix or up to MaxPrefixLength uppercase letters and digits.
+func ValidatePrefix(prefix string) error {
+	if len(prefix) > MaxPrefixLength {
+		return fmt.Errorf("%w, code_prefix must be at most %d characters", ErrMalformed, MaxPrefixLength)
+	}
+	for i := 0; i < len(prefix); i++ {
+		c := prefix[i]
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return fmt.Errorf("%w, code_prefix must contain only A-Z and 0-9", ErrMalformed)
+		}
+	}
+	return nil
+}
+
+// checkCharacter computes the Luhn mod N check character of body, which catches every
+// single-character typo and most swaps of adjacent characters.
+func checkCharacter(body []byte) byte {
+	n := len(Alphabet)
+	factor := 2
+	sum := 0
+
+	for i := len(body) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(Alphabet, body[i])
+		addend = addend/n + addend%n
+		sum += addend
+
+		if factor == 2 {
+			factor = 1
+		} else {
+			factor = 2
+		}
+	}
+
+	return Alphabet[(n-sum%n)%n]
+}
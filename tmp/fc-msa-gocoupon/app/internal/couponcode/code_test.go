@@ -0,0 +1,127 @@
+package couponcode
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name       string
+		prefix     string
+		length     int
+		wantPrefix string
+		wantBody   int
+	}{
+		{name: "default length", prefix: "", length: 0, wantBody: DefaultLength + 1},
+		{name: "shortest", prefix: "", length: MinLength, wantBody: MinLength + 1},
+		{name: "longest with a prefix", prefix: "BF2025", length: MaxLength, wantPrefix: "BF2025-", wantBody: MaxLength + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				code := Generate(tt.prefix, tt.length)
+
+				body, ok := strings.CutPrefix(code, tt.wantPrefix)
+				if !ok {
+					t.Fatalf("Generate() = %q, want prefix %q", code, tt.wantPrefix)
+				}
+				if len(body) != tt.wantBody {
+					t.Fatalf("Generate() = %q, want a body of %d characters", code, tt.wantBody)
+				}
+				if strings.Trim(body, Alphabet) != "" {
+					t.Fatalf("Generate() = %q, want only characters of the alphabet", code)
+				}
+
+				parsed, err := Parse(code)
+				if err != nil {
+					t.Fatalf("Parse(%q) error = %v", code, err)
+				}
+				if parsed != code {
+					t.Fatalf("Parse(%q) = %q, want it unchanged", code, parsed)
+				}
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	body := "ABCDEFGH2345"
+	valid := body + string(checkCharacter([]byte(body)))
+	wrongCheck := body + string(Alphabet[(strings.IndexByte(Alphabet, valid[len(valid)-1])+1)%len(Alphabet)])
+
+	tests := []struct {
+		name    string
+		code    string
+		want    string
+		wantErr error
+	}{
+		{name: "valid", code: valid, want: valid},
+		{name: "valid with a prefix", code: "BF2025-" + valid, want: "BF2025-" + valid},
+		{name: "lowercase and spaces are normalized", code: "  bf2025-" + strings.ToLower(valid[:6]) + " " + strings.ToLower(valid[6:]) + " ", want: "BF2025-" + valid},
+		{name: "legacy uuid passes through", code: "3f2b8c1e-9a4d-4f6b-8e2a-1c5d7e9f0a3b", want: "3f2b8c1e-9a4d-4f6b-8e2a-1c5d7e9f0a3b"},
+		{name: "wrong check character", code: wrongCheck, wantErr: ErrCheckDigit},
+		{name: "confusable zero", code: "0" + valid[1:], wantErr: ErrMalformed},
+		{name: "confusable letter O", code: "O" + valid[1:], wantErr: ErrMalformed},
+		{name: "too short", code: valid[:MinLength], wantErr: ErrMalformed},
+		{name: "too long", code: strings.Repeat("A", MaxLength+2), wantErr: ErrMalformed},
+		{name: "prefix with a symbol", code: "BF_2025-" + valid, wantErr: ErrMalformed},
+		{name: "prefix too long", code: strings.Repeat("A", MaxPrefixLength+1) + "-" + valid, wantErr: ErrMalformed},
+		{name: "empty", code: "", wantErr: ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.code)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse(%q) error = %v, want %v", tt.code, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %q, want %q", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+// The check character must reject every single-character typo of a generated code.
+func TestParseRejectsSingleTypos(t *testing.T) {
+	code := Generate("", DefaultLength)
+
+	for i := 0; i < len(code); i++ {
+		for j := 0; j < len(Alphabet); j++ {
+			if Alphabet[j] == code[i] {
+				continue
+			}
+			typo := code[:i] + string(Alphabet[j]) + code[i+1:]
+
+			if _, err := Parse(typo); !errors.Is(err, ErrCheckDigit) {
+				t.Errorf("Parse(%q) error = %v, want %v for a typo of %q", typo, err, ErrCheckDigit, code)
+			}
+		}
+	}
+}
+
+func TestValidateFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		length  int
+		wantErr error
+	}{
+		{name: "no prefix", prefix: "", length: DefaultLength},
+		{name: "prefix", prefix: "BF2025", length: MinLength},
+		{name: "length below the minimum", prefix: "", length: MinLength - 1, wantErr: ErrMalformed},
+		{name: "length above the maximum", prefix: "", length: MaxLength + 1, wantErr: ErrMalformed},
+		{name: "lowercase prefix", prefix: "bf", length: DefaultLength, wantErr: ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateFormat(tt.prefix, tt.length); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateFormat(%q, %d) error = %v, want %v", tt.prefix, tt.length, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package couponpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"example.com/coupon-service/internal/config"
+	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/couponcode"
+	"example.com/coupon-service/internal/instrument/logging"
+	"example.com/coupon-service/internal/instrument/tracing"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// The pool key holds the Redis list of a POOL policy's unassigned codes, which the v5 issuer pops
+// from and the reclaimer deletes. The lock key is held while a job generates or loads the pool.
+const (
+	CouponPolicyPoolKeyPrefix     = "coupon:policy:pool:"
+	CouponPolicyPoolLockKeyPrefix = "coupon:policy:pool:lock:"
+)
+
+// poolLockTTL bounds how long a crashed job can block the next one for the same policy.
+const poolLockTTL = 10 * time.Minute
+
+// ErrCouponPoolBusy is returned when another job is already generating or loading the same pool.
+var ErrCouponPoolBusy = errors.New("coupon pool job already running for this policy")
+
+// Generator pre-generates UNASSIGNED coupon rows for POOL policies and loads their codes into
+// the Redis list the v5 issuer pops from. Rows are committed before their codes are pushed,
+// so a popped code always has a row to assign.
+type Generator struct {
+	pg        *config.Postgres
+	rdb       *config.Redis
+	batchSize int
+}
+
+func NewGenerator(pg *config.Postgres, rdb *config.Redis, batchSize int) *Generator {
+	if batchSize <= 0 {
+		batchSize = 10000
+	}
+
+	return &Generator{
+		pg:        pg,
+		rdb:       rdb,
+		batchSize: batchSize,
+	}
+}
+
+type poolPolicy struct {
+	ID            string
+	Code          string
+	TotalQuantity int
+	EndTime       time.Time
+	Status        coupon.CouponPolicyStatus
+	IssuanceMode  coupon.CouponPolicyIssuanceMode
+	CodePrefix    string
+	CodeLength    int
+}
+
+// Generate adds quantity coupons to the policy pool, or every remaining unit if quantity is 0.
+// The quantity is capped so issued and pooled coupons never exceed total_quantity.
+func (g *Generator) Generate(ctx context.Context, policyCode string, quantity int) (int, error) {
+	ctx, span := tracing.StartSpan(ctx, "CouponPool.Generator.Generate")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	unlock, err := g.lock(ctx, policyCode)
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+	defer unlock()
+
+	// Retrieve Coupon Policy
+	policy, err := g.findPoolPolicy(ctx, policyCode)
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+
+	// Check Remaining Quantity
+	var issued, pooled int
+	err = g.pg.Pool.QueryRow(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE status <> 'UNASSIGNED' AND NOT quota_released),
+			COUNT(*) FILTER (WHERE status = 'UNASSIGNED')
+		FROM coupons
+		WHERE coupon_policy_id = $1
+	`, policy.ID).Scan(&issued, &pooled)
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+
+	remaining := policy.TotalQuantity - issued - pooled
+	if quantity <= 0 || quantity > remaining {
+		quantity = remaining
+	}
+	if quantity <= 0 {
+		log.Warn("coupon pool already covers the policy quantity", zap.String("policy_code", policyCode), zap.Int("issued", issued), zap.Int("pooled", pooled))
+		return 0, nil
+	}
+
+	// Generate Batches
+	key := CouponPolicyPoolKeyPrefix + policy.Code
+	generated := 0
+	for generated < quantity {
+		n := min(g.batchSize, quantity-generated)
+
+		ids := make([]string, n)
+		codes := make([]string, n)
+		for i := range n {
+			ids[i] = uuid.New().String()
+			codes[i] = couponcode.Generate(policy.CodePrefix, policy.CodeLength)
+		}
+
+		// Pool coupons expire with the policy until they are assigned, which sets the real expiry.
+		// Colliding codes are skipped and made up for by the next batch.
+		rows, err := g.pg.Pool.Query(ctx, `
+			INSERT INTO coupons (
+				id,
+				code,
+				status,
+				coupon_policy_id,
+				expires_at,
+				created_at,
+				updated_at
+			)
+			SELECT t.id, t.code, 'UNASSIGNED', $3, $4, NOW(), NOW()
+			FROM unnest($1::TEXT[], $2::TEXT[]) AS t(id, code)
+			ON CONFLICT (code) DO NOTHING
+			RETURNING code
+		`, ids, codes, policy.ID, policy.EndTime.UTC())
+		if err == nil {
+			codes, err = pgx.CollectRows(rows, pgx.RowTo[string])
+		}
+		if err != nil {
+			span.RecordError(err)
+			log.Error("failed to insert pool coupons", zap.String("policy_code", policyCode), zap.Int("generated", generated), zap.Error(err))
+			return generated, err
+		}
+		if len(codes) == 0 {
+			err := fmt.Errorf("every code in the batch collided, code_length %d is too short for this pool", policy.CodeLength)
+			span.RecordError(err)
+			return generated, err
+		}
+		if len(codes) < n {
+			log.Warn("pool coupon code collisions skipped", zap.String("policy_code", policyCode), zap.Int("collisions", n-len(codes)))
+		}
+
+		if err := g.push(ctx, key, codes, policy.EndTime); err != nil {
+			span.RecordError(err)
+			log.Error("failed to push pool coupon codes", zap.String("policy_code", policyCode), zap.Int("generated", generated), zap.Error(err))
+			return generated, err
+		}
+
+		generated += len(codes)
+		log.Info("pool coupons generated", zap.String("policy_code", policyCode), zap.Int("generated", generated), zap.Int("quantity", quantity))
+	}
+
+	return generated, nil
+}
+
+// Load rebuilds a missing Redis pool from the UNASSIGNED rows, e.g. after Redis lost its data.
+// It refuses to run while the list exists, since pushing codes that are already queued would
+// hand the same code out twice; the issuer's assignment guard would then reject the second pop.
+func (g *Generator) Load(ctx context.Context, policyCode string) (int, error) {
+	ctx, span := tracing.StartSpan(ctx, "CouponPool.Generator.Load")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	unlock, err := g.lock(ctx, policyCode)
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+	defer unlock()
+
+	policy, err := g.findPoolPolicy(ctx, policyCode)
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+
+	key := CouponPolicyPoolKeyPrefix + policy.Code
+	exists, err := g.rdb.Client.Exists(ctx, key).Result()
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+	if exists > 0 {
+		return 0, fmt.Errorf("coupon pool for %s is already loaded", policyCode)
+	}
+
+	loaded := 0
+	lastID := ""
+	for {
+		rows, err := g.pg.Pool.Query(ctx, `
+			SELECT id, code
+			FROM coupons
+			WHERE coupon_policy_id = $1 AND status = 'UNASSIGNED' AND id > $2
+			ORDER BY id
+			LIMIT $3
+		`, policy.ID, lastID, g.batchSize)
+		if err != nil {
+			span.RecordError(err)
+			return loaded, err
+		}
+
+		var codes []string
+		for rows.Next() {
+			var code string
+			if err := rows.Scan(&lastID, &code); err != nil {
+				rows.Close()
+				span.RecordError(err)
+				return loaded, err
+			}
+			codes = append(codes, code)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			span.RecordError(err)
+			return loaded, err
+		}
+
+		if len(codes) == 0 {
+			break
+		}
+
+		if err := g.push(ctx, key, codes, policy.EndTime); err != nil {
+			span.RecordError(err)
+			return loaded, err
+		}
+
+		loaded += len(codes)
+		log.Info("pool coupon codes loaded", zap.String("policy_code", policyCode), zap.Int("loaded", loaded))
+
+		if len(codes) < g.batchSize {
+			break
+		}
+	}
+
+	return loaded, nil
+}
+
+func (g *Generator) findPoolPolicy(ctx context.Context, policyCode string) (*poolPolicy, error) {
+	var p poolPolicy
+	err := g.pg.Pool.QueryRow(ctx, `
+		SELECT
+			id,
+			code,
+			total_quantity,
+			end_time,
+			status,
+			issuance_mode,
+			code_prefix,
+			code_length
+		FROM coupon_policies
+		WHERE code = $1
+	`, policyCode).Scan(&p.ID, &p.Code, &p.TotalQuantity, &p.EndTime, &p.Status, &p.IssuanceMode, &p.CodePrefix, &p.CodeLength)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, coupon.ErrCouponPolicyNotFound
+		}
+		return nil, err
+	}
+
+	if p.IssuanceMode != coupon.CouponPolicyIssuanceModePool {
+		return nil, fmt.Errorf("%w, issuance_mode is %s", coupon.ErrCouponPolicyInvalid, p.IssuanceMode)
+	}
+	if p.Status == coupon.CouponPolicyStatusRetired {
+		return nil, coupon.ErrCouponPolicyRetired
+	}
+	if !p.EndTime.After(time.Now()) {
+		return nil, fmt.Errorf("%w, ends at %s", coupon.ErrCouponPolicyExpired, p.EndTime.UTC())
+	}
+
+	return &p, nil
+}
+
+// push appends codes to the pool list, which expires with the policy.
+func (g *Generator) push(ctx context.Context, key string, codes []string, endTime time.Time) error {
+	values := make([]interface{}, len(codes))
+	for i, code := range codes {
+		values[i] = code
+	}
+
+	_, err := g.rdb.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, key, values...)
+		pipe.PExpireAt(ctx, key, endTime)
+		return nil
+	})
+	return err
+}
+
+// unlockScript deletes the lock only while it still holds the caller's token, so a job that
+// outlived poolLockTTL cannot release the lock a newer job has taken since.
+var unlockScript = redis.NewScript(`
+	if redis.call('GET', KEYS[1]) == ARGV[1] then
+		return redis.call('DEL', KEYS[1])
+	end
+	return 0
+`)
+
+func (g *Generator) lock(ctx context.Context, policyCode string) (func(), error) {
+	key := CouponPolicyPoolLockKeyPrefix + policyCode
+	token := uuid.NewString()
+
+	ok, err := g.rdb.Client.SetNX(ctx, key, token, poolLockTTL).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrCouponPoolBusy
+	}
+
+	return func() {
+		_ = unlockScript.Run(context.Background(), g.rdb.Client, []string{key}, token).Err()
+	}, nil
+}
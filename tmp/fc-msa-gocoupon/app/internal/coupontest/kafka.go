@@ -0,0 +1,59 @@
+package coupontest
+
+import (
+	"context"
+	"sync"
+
+	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/domainevent"
+)
+
+// KafkaProducer records the issue messages instead of sending them to Kafka.
+type KafkaProducer struct {
+	mu       sync.Mutex
+	messages []coupon.IssueCouponMessage
+}
+
+func (p *KafkaProducer) SendIssueCoupon(ctx context.Context, message coupon.IssueCouponMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.messages = append(p.messages, message)
+	return nil
+}
+
+// Messages returns a copy of the sent messages, in the order they were sent.
+func (p *KafkaProducer) Messages() []coupon.IssueCouponMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]coupon.IssueCouponMessage(nil), p.messages...)
+}
+
+// Publisher records the published domain events instead of writing them to Kafka.
+type Publisher struct {
+	mu     sync.Mutex
+	events []domainevent.Event
+}
+
+func (p *Publisher) Publish(ctx context.Context, events ...domainevent.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.events = append(p.events, events...)
+	return nil
+}
+
+// Published returns the recorded events of the given type.
+func (p *Publisher) Published(eventType domainevent.Type) []domainevent.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var events []domainevent.Event
+	for _, e := range p.events {
+		if e.Type == eventType {
+			events = append(events, e)
+		}
+	}
+	return events
+}
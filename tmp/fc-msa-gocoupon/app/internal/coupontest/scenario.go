@@ -0,0 +1,189 @@
+package coupontest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"example.com/coupon-service/internal/coupon"
+	"github.com/google/uuid"
+)
+
+// Violations reported by Scenario.Check, test for them with errors.Is.
+var (
+	ErrQuotaExceeded     = errors.New("more coupons issued than the policy quota")
+	ErrUserLimitExceeded = errors.New("more coupons issued to a user than max_per_user")
+	ErrUnderIssued       = errors.New("fewer coupons issued than the users could claim")
+	ErrResultMismatch    = errors.New("successful issues do not match the stored coupons")
+	ErrUnexpected        = errors.New("unexpected issue error")
+)
+
+// Scenario is a concurrent issue workload against one policy. Every user sends RequestsPerUser
+// requests and all of them start at once.
+type Scenario struct {
+	Name            string
+	TotalQuantity   int
+	MaxPerUser      int
+	Users           int
+	RequestsPerUser int
+
+	// Pool makes the policy a POOL policy with TotalQuantity pre-generated coupons
+	Pool bool
+	// FailAssigns fails the first FailAssigns pool assignments with ErrInjected
+	FailAssigns int
+}
+
+// Scenarios is the table every API version runs.
+var Scenarios = []Scenario{
+	{Name: "users race for a small quota", TotalQuantity: 100, MaxPerUser: 1, Users: 2000, RequestsPerUser: 1},
+	{Name: "users retry past their limit", TotalQuantity: 5000, MaxPerUser: 2, Users: 100, RequestsPerUser: 20},
+	{Name: "quota and user limit both bind", TotalQuantity: 250, MaxPerUser: 3, Users: 200, RequestsPerUser: 10},
+	{Name: "users race for a small pool", TotalQuantity: 100, MaxPerUser: 1, Users: 2000, RequestsPerUser: 1, Pool: true},
+	{Name: "users retry past their limit on a pool", TotalQuantity: 5000, MaxPerUser: 2, Users: 100, RequestsPerUser: 20, Pool: true},
+	{Name: "pool assignments fail and roll back", TotalQuantity: 100, MaxPerUser: 1, Users: 2000, RequestsPerUser: 1, Pool: true, FailAssigns: 20},
+}
+
+// Expected returns how many coupons a correct issuer hands out: the quota, or what the users can claim if that is less.
+// A failed assignment can give its quota unit back after every other request was turned away, so
+// each of FailAssigns may leave one coupon unissued.
+func (s Scenario) Expected() int {
+	return min(s.TotalQuantity, s.Users*min(s.MaxPerUser, s.RequestsPerUser)) - s.FailAssigns
+}
+
+// Oversubscribed reports whether the users can claim more than the quota.
+func (s Scenario) Oversubscribed() bool {
+	return s.Users*min(s.MaxPerUser, s.RequestsPerUser) > s.TotalQuantity
+}
+
+// NewStore returns a store holding an active policy for the scenario, with its pool seeded for a POOL scenario.
+func (s Scenario) NewStore() (*Store, *coupon.CouponPolicy) {
+	now := time.Now()
+	policy := &coupon.CouponPolicy{
+		ID:            uuid.NewString(),
+		Code:          "RACE",
+		Name:          s.Name,
+		TotalQuantity: s.TotalQuantity,
+		StartTime:     now.Add(-time.Hour),
+		EndTime:       now.Add(time.Hour),
+		DiscountType:  coupon.DiscountTypeFixedAmount,
+		DiscountValue: 1000,
+		MaxPerUser:    s.MaxPerUser,
+		Status:        coupon.CouponPolicyStatusActive,
+		IssuanceMode:  coupon.CouponPolicyIssuanceModeOnDemand,
+		CancelMode:    coupon.CouponPolicyCancelModeVoid,
+	}
+	if s.Pool {
+		policy.IssuanceMode = coupon.CouponPolicyIssuanceModePool
+	}
+
+	store := NewStore(policy)
+	if s.Pool {
+		store.SeedPool(policy, s.TotalQuantity)
+		store.FailAssigns(s.FailAssigns)
+	}
+	return store, policy
+}
+
+// Run makes every request of the scenario at once and returns the successful issues per user.
+// Rejections for the quota or the user limit are expected, as are up to FailAssigns internal errors.
+// Any other error is returned wrapped in ErrUnexpected.
+func (s Scenario) Run(ctx context.Context, issue func(ctx context.Context, userID string) (*coupon.Coupon, error)) (map[string]int, []error) {
+	var (
+		succeeded  = make(map[string]int)
+		failed     int
+		unexpected []error
+	)
+
+	s.each(ctx, issue, func(userID string, err error) {
+		switch {
+		case err == nil:
+			succeeded[userID]++
+		case errors.Is(err, coupon.ErrCouponPolicyQuantityExceed),
+			errors.Is(err, coupon.ErrCouponUserAlreadyClaimed),
+			errors.Is(err, coupon.ErrCouponUserLimitExceeded):
+		case errors.Is(err, coupon.ErrCouponInternal) && failed < s.FailAssigns:
+			failed++
+		default:
+			unexpected = append(unexpected, fmt.Errorf("%w for %s: %v", ErrUnexpected, userID, err))
+		}
+	})
+
+	return succeeded, unexpected
+}
+
+// Reject makes every request of the scenario at once and reports the ones that did not fail with want.
+func (s Scenario) Reject(ctx context.Context, issue func(ctx context.Context, userID string) (*coupon.Coupon, error), want error) error {
+	var total, other int
+	s.each(ctx, issue, func(userID string, err error) {
+		total++
+		if !errors.Is(err, want) {
+			other++
+		}
+	})
+
+	if other > 0 {
+		return fmt.Errorf("%w, %d of %d requests were not rejected with %q", ErrUnexpected, other, total, want)
+	}
+	return nil
+}
+
+// each starts every request of the scenario at once and hands each result to record, one at a time.
+func (s Scenario) each(ctx context.Context, issue func(ctx context.Context, userID string) (*coupon.Coupon, error), record func(userID string, err error)) {
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	start := make(chan struct{})
+	for u := 0; u < s.Users; u++ {
+		userID := fmt.Sprintf("USER_%d", u+1)
+		for r := 0; r < s.RequestsPerUser; r++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+
+				_, err := issue(ctx, userID)
+
+				mu.Lock()
+				defer mu.Unlock()
+				record(userID, err)
+			}()
+		}
+	}
+	close(start)
+	wg.Wait()
+}
+
+// Check compares the successful issues of a run and the coupons the store holds per user
+// against the policy quota and per-user limit.
+func (s Scenario) Check(succeeded map[string]int, issued map[string]int) []error {
+	var violations []error
+
+	total := 0
+	for userID, n := range issued {
+		total += n
+		if n > s.MaxPerUser {
+			violations = append(violations, fmt.Errorf("%w, %s has %d of max %d", ErrUserLimitExceeded, userID, n, s.MaxPerUser))
+		}
+		if succeeded[userID] != n {
+			violations = append(violations, fmt.Errorf("%w, %s succeeded %d times but has %d coupons", ErrResultMismatch, userID, succeeded[userID], n))
+		}
+	}
+	for userID, n := range succeeded {
+		if _, ok := issued[userID]; !ok {
+			violations = append(violations, fmt.Errorf("%w, %s succeeded %d times but has no coupon", ErrResultMismatch, userID, n))
+		}
+	}
+
+	if total > s.TotalQuantity {
+		violations = append(violations, fmt.Errorf("%w, %d issued of %d", ErrQuotaExceeded, total, s.TotalQuantity))
+	}
+	if total < s.Expected() {
+		violations = append(violations, fmt.Errorf("%w, %d issued of %d expected", ErrUnderIssued, total, s.Expected()))
+	}
+
+	return violations
+}
@@ -0,0 +1,769 @@
+// Package coupontest provides in-memory stand-ins for Postgres, Redis and Kafka, so the coupon
+// services can be tested for races without any of them running.
+package coupontest
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/outbox"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrCacheMiss stands in for redis.Nil when a key was never set.
+var ErrCacheMiss = errors.New("coupontest: key not found")
+
+// ErrInjected is returned by the calls FailAssigns sets up to fail.
+var ErrInjected = errors.New("coupontest: injected failure")
+
+// Store keeps the coupon tables and redis keys in memory. Its methods have the signatures of the
+// repositories of every API version, so a version whose IRepository it covers can use it directly
+// and the others wrap it for the methods that differ.
+//
+// Every method is atomic on its own, like one SQL statement or one Lua script. WithTx holds a
+// single lock for the whole transaction, standing in for the FOR UPDATE lock on the policy row,
+// and undoes the writes of the Tx methods if fn fails. Redis writes are never undone, as in production.
+// UpdateCoupon only writes a coupon still at the status and version it was read with.
+type Store struct {
+	txMu sync.Mutex
+	mu   sync.Mutex
+	undo []func()
+
+	policies      map[string]*coupon.CouponPolicy
+	coupons       map[string]*coupon.Coupon
+	events        []coupon.CouponEvent
+	eventSeq      int64
+	claims        map[string]int
+	outbox        []outbox.Message
+	issueRequests map[string]*coupon.IssueRequest
+
+	metadata   map[string]*coupon.CouponPolicy
+	quantity   map[string]int
+	userClaims map[string]int
+	pools      map[string][]string
+	processed  map[string]bool
+	locks      map[string]bool
+
+	failAssigns int
+}
+
+func NewStore(policies ...*coupon.CouponPolicy) *Store {
+	s := &Store{
+		policies:      make(map[string]*coupon.CouponPolicy),
+		coupons:       make(map[string]*coupon.Coupon),
+		claims:        make(map[string]int),
+		issueRequests: make(map[string]*coupon.IssueRequest),
+		metadata:      make(map[string]*coupon.CouponPolicy),
+		quantity:      make(map[string]int),
+		userClaims:    make(map[string]int),
+		pools:         make(map[string][]string),
+		processed:     make(map[string]bool),
+		locks:         make(map[string]bool),
+	}
+	for _, p := range policies {
+		policy := *p
+		s.policies[p.ID] = &policy
+	}
+	return s
+}
+
+// AddCoupon stores a copy of c as if it was issued.
+func (s *Store) AddCoupon(c *coupon.Coupon) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *c
+	s.coupons[c.Code] = &stored
+}
+
+// SeedPool generates n UNASSIGNED coupons for a POOL policy and queues their codes, like the pool generator.
+func (s *Store) SeedPool(policy *coupon.CouponPolicy, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for i := 0; i < n; i++ {
+		c := &coupon.Coupon{
+			ID:             uuid.NewString(),
+			Code:           policy.NewCouponCode(),
+			Status:         coupon.CouponStatusUnassigned,
+			CouponPolicyID: policy.ID,
+			ExpiresAt:      policy.EndTime,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		s.coupons[c.Code] = c
+		s.pools[policy.Code] = append(s.pools[policy.Code], c.Code)
+	}
+}
+
+// FailAssigns makes the next n calls to AssignPooledCouponTx fail with ErrInjected.
+func (s *Store) FailAssigns(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failAssigns = n
+}
+
+// PoolLength returns how many codes are left in the pool of the policy.
+func (s *Store) PoolLength(policyCode string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.pools[policyCode])
+}
+
+// Coupon returns a copy of the stored coupon with the given code, or nil.
+func (s *Store) Coupon(code string) *coupon.Coupon {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.coupons[code]
+	if !ok {
+		return nil
+	}
+	c := *stored
+	return &c
+}
+
+// CouponEvents returns a copy of every recorded coupon event, oldest first.
+func (s *Store) CouponEvents() []coupon.CouponEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]coupon.CouponEvent(nil), s.events...)
+}
+
+// OutboxMessages returns a copy of every committed outbox message, oldest first.
+func (s *Store) OutboxMessages() []outbox.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]outbox.Message(nil), s.outbox...)
+}
+
+// IssuedPerUser counts the coupons of the policy that take a unit of its quota, per user.
+// It is the same predicate as CountIssuedCoupons.
+func (s *Store) IssuedPerUser(policyID string) map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	issued := make(map[string]int)
+	for _, c := range s.coupons {
+		if takesQuota(c, policyID) {
+			issued[c.UserID]++
+		}
+	}
+	return issued
+}
+
+func takesQuota(c *coupon.Coupon, policyID string) bool {
+	return c.CouponPolicyID == policyID && c.Status != coupon.CouponStatusUnassigned && !c.QuotaReleased
+}
+
+// roundTrip yields before every call, so concurrent callers interleave between a read and the
+// write that depends on it the way they do between round trips to Postgres and Redis.
+func (s *Store) roundTrip() {
+	runtime.Gosched()
+}
+
+// onRollback registers the compensation of a write made by a Tx method. Callers hold s.mu.
+func (s *Store) onRollback(fn func()) {
+	s.undo = append(s.undo, fn)
+}
+
+func (s *Store) WithTx(ctx context.Context, fn func(pgx.Tx) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.Lock()
+	s.undo = nil
+	s.mu.Unlock()
+
+	err := fn(nil)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		for i := len(s.undo) - 1; i >= 0; i-- {
+			s.undo[i]()
+		}
+	}
+	s.undo = nil
+	return err
+}
+
+// Postgres
+
+func (s *Store) FindCouponPolicyByCode(ctx context.Context, code string) (*coupon.CouponPolicy, error) {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.policies {
+		if p.Code == code {
+			policy := *p
+			return &policy, nil
+		}
+	}
+	return nil, coupon.ErrCouponPolicyNotFound
+}
+
+func (s *Store) FindCouponPolicyByCodeForUpdateTx(ctx context.Context, tx pgx.Tx, code string) (*coupon.CouponPolicy, error) {
+	return s.FindCouponPolicyByCode(ctx, code)
+}
+
+func (s *Store) FindCouponPolicyByID(ctx context.Context, id string) (*coupon.CouponPolicy, error) {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.policies[id]
+	if !ok {
+		return nil, coupon.ErrCouponPolicyNotFound
+	}
+	policy := *p
+	return &policy, nil
+}
+
+func (s *Store) CountIssuedCoupons(ctx context.Context, policyID string) (int, error) {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, c := range s.coupons {
+		if takesQuota(c, policyID) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// CountRemainingQuantity is total_quantity - issued coupons, there is no outbox in flight here.
+func (s *Store) CountRemainingQuantity(ctx context.Context, policyCode string) (int, error) {
+	policy, err := s.FindCouponPolicyByCode(ctx, policyCode)
+	if err != nil {
+		return 0, err
+	}
+
+	issued, err := s.CountIssuedCoupons(ctx, policy.ID)
+	if err != nil {
+		return 0, err
+	}
+	return policy.TotalQuantity - issued, nil
+}
+
+func (s *Store) CountIssuedCouponsTx(ctx context.Context, tx pgx.Tx, policyID string) (int, error) {
+	return s.CountIssuedCoupons(ctx, policyID)
+}
+
+func (s *Store) CreateCoupon(ctx context.Context, c *coupon.Coupon, event *coupon.CouponEvent) (*coupon.Coupon, error) {
+	created, _, err := s.createCoupon(c, event)
+	return created, err
+}
+
+func (s *Store) CreateCouponTx(ctx context.Context, tx pgx.Tx, c *coupon.Coupon, event *coupon.CouponEvent) (*coupon.Coupon, error) {
+	created, undo, err := s.createCoupon(c, event)
+	if err == nil {
+		s.mu.Lock()
+		s.onRollback(undo)
+		s.mu.Unlock()
+	}
+	return created, err
+}
+
+func (s *Store) createCoupon(c *coupon.Coupon, event *coupon.CouponEvent) (*coupon.Coupon, func(), error) {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.coupons[c.Code]; ok {
+		return nil, nil, coupon.ErrCouponCodeConflict
+	}
+
+	now := time.Now()
+	stored := *c
+	stored.CreatedAt, stored.UpdatedAt = now, now
+	s.coupons[c.Code] = &stored
+	eventID := s.appendEvent(&stored, event)
+
+	undo := func() {
+		delete(s.coupons, c.Code)
+		s.removeEvent(eventID)
+	}
+	created := stored
+	return &created, undo, nil
+}
+
+func (s *Store) ExistsCouponByIDTx(ctx context.Context, tx pgx.Tx, id string) (bool, error) {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.coupons {
+		if c.ID == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ClaimCouponPolicyForUser mirrors the CHECK (claimed <= max_per_user) of coupon_user_claims.
+func (s *Store) ClaimCouponPolicyForUser(ctx context.Context, policyID string, userID string, maxPerUser int) error {
+	_, err := s.claim(policyID, userID, maxPerUser)
+	return err
+}
+
+func (s *Store) ClaimCouponPolicyForUserTx(ctx context.Context, tx pgx.Tx, policyID string, userID string, maxPerUser int) error {
+	undo, err := s.claim(policyID, userID, maxPerUser)
+	if err == nil {
+		s.mu.Lock()
+		s.onRollback(undo)
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (s *Store) claim(policyID string, userID string, maxPerUser int) (func(), error) {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := policyID + "/" + userID
+	if s.claims[key]+1 > maxPerUser {
+		return nil, coupon.ErrCouponUserLimitExceeded
+	}
+	s.claims[key]++
+	return func() { s.claims[key]-- }, nil
+}
+
+func (s *Store) FindCouponByCode(ctx context.Context, code string) (*coupon.Coupon, error) {
+	s.roundTrip()
+	if c := s.Coupon(code); c != nil {
+		return c, nil
+	}
+	return nil, coupon.ErrCouponNotFound
+}
+
+func (s *Store) FindCoupons(ctx context.Context, filter coupon.CouponFilter) ([]coupon.Coupon, error) {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	coupons := make([]coupon.Coupon, 0)
+	for _, c := range s.coupons {
+		if c.UserID != filter.UserID || (filter.Status != "" && c.Status != filter.Status) {
+			continue
+		}
+		if filter.PolicyCode != "" {
+			p, ok := s.policies[c.CouponPolicyID]
+			if !ok || p.Code != filter.PolicyCode {
+				continue
+			}
+		}
+		if filter.Cursor != nil && !c.CreatedAt.Before(filter.Cursor.CreatedAt) &&
+			!(c.CreatedAt.Equal(filter.Cursor.CreatedAt) && c.ID < filter.Cursor.ID) {
+			continue
+		}
+		coupons = append(coupons, *c)
+	}
+
+	sort.Slice(coupons, func(i, j int) bool {
+		if !coupons[i].CreatedAt.Equal(coupons[j].CreatedAt) {
+			return coupons[i].CreatedAt.After(coupons[j].CreatedAt)
+		}
+		return coupons[i].ID > coupons[j].ID
+	})
+	if len(coupons) > filter.Limit+1 {
+		coupons = coupons[:filter.Limit+1]
+	}
+	return coupons, nil
+}
+
+func (s *Store) FindCouponEvents(ctx context.Context, couponID string) ([]coupon.CouponEvent, error) {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make([]coupon.CouponEvent, 0)
+	for _, e := range s.events {
+		if e.CouponID == couponID {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// UpdateCoupon writes c only if the stored coupon is still at the status and version c was
+// read with, like the WHERE status = ... AND version = ... of the SQL.
+func (s *Store) UpdateCoupon(ctx context.Context, c *coupon.Coupon, event *coupon.CouponEvent) (*coupon.Coupon, error) {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.coupons[c.Code]
+	if !ok || event.PreviousStatus == nil || stored.Status != *event.PreviousStatus || stored.Version != c.Version {
+		return nil, coupon.ErrCouponConflict
+	}
+
+	stored.Status = c.Status
+	stored.UsedAt = c.UsedAt
+	stored.UserID = c.UserID
+	stored.OrderID = c.OrderID
+	stored.OrderAmount = c.OrderAmount
+	stored.DiscountAmount = c.DiscountAmount
+	stored.ReservedUntil = c.ReservedUntil
+	stored.QuotaReleased = stored.QuotaReleased || c.QuotaReleased
+	stored.Version++
+	stored.UpdatedAt = time.Now()
+	s.appendEvent(stored, event)
+
+	updated := *stored
+	return &updated, nil
+}
+
+// AssignPooledCouponTx hands an UNASSIGNED pool coupon to the user, or returns nil if the code is stale.
+func (s *Store) AssignPooledCouponTx(ctx context.Context, tx pgx.Tx, code string, userID string, expiresAt time.Time, event *coupon.CouponEvent) (*coupon.Coupon, error) {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failAssigns > 0 {
+		s.failAssigns--
+		return nil, ErrInjected
+	}
+
+	stored, ok := s.coupons[code]
+	if !ok || stored.Status != coupon.CouponStatusUnassigned {
+		return nil, nil
+	}
+
+	previous := *stored
+	stored.Status = coupon.CouponStatusAvailable
+	stored.UserID = userID
+	stored.ExpiresAt = expiresAt
+	stored.Version++
+	stored.UpdatedAt = time.Now()
+	eventID := s.appendEvent(stored, event)
+	s.onRollback(func() {
+		*stored = previous
+		s.removeEvent(eventID)
+	})
+
+	assigned := *stored
+	return &assigned, nil
+}
+
+// appendEvent records event for c the way the event CTE does and returns its ID. Callers hold s.mu.
+func (s *Store) appendEvent(c *coupon.Coupon, event *coupon.CouponEvent) int64 {
+	s.eventSeq++
+	e := *event
+	e.ID = s.eventSeq
+	e.CouponID = c.ID
+	e.Status = c.Status
+	e.CreatedAt = time.Now()
+	s.events = append(s.events, e)
+	return e.ID
+}
+
+// removeEvent drops a rolled back event, leaving the ones other callers appended since. Callers hold s.mu.
+func (s *Store) removeEvent(id int64) {
+	for i, e := range s.events {
+		if e.ID == id {
+			s.events = append(s.events[:i], s.events[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *Store) CreateOutboxMessageTx(ctx context.Context, tx pgx.Tx, msg *outbox.Message) error {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg.ID = int64(len(s.outbox) + 1)
+	msg.CreatedAt = time.Now()
+	s.outbox = append(s.outbox, *msg)
+	n := len(s.outbox) - 1
+	s.onRollback(func() { s.outbox = s.outbox[:n] })
+	return nil
+}
+
+func (s *Store) CreateIssueRequestTx(ctx context.Context, tx pgx.Tx, req *coupon.IssueRequest) error {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	req.CreatedAt, req.UpdatedAt = now, now
+	stored := *req
+	s.issueRequests[req.ID] = &stored
+	s.onRollback(func() { delete(s.issueRequests, req.ID) })
+	return nil
+}
+
+func (s *Store) CompleteIssueRequestTx(ctx context.Context, tx pgx.Tx, message coupon.IssueCouponMessage, couponCode string) (*coupon.IssueRequest, error) {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.issueRequests[message.CouponID]
+	now := time.Now()
+	req := &coupon.IssueRequest{
+		ID:             message.CouponID,
+		CouponPolicyID: message.PolicyID,
+		UserID:         message.UserID,
+		CouponCode:     couponCode,
+		Status:         coupon.IssueRequestStatusAvailable,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if existed {
+		req.CreatedAt = previous.CreatedAt
+	}
+	s.issueRequests[req.ID] = req
+	s.onRollback(func() {
+		if existed {
+			s.issueRequests[req.ID] = previous
+		} else {
+			delete(s.issueRequests, req.ID)
+		}
+	})
+
+	completed := *req
+	return &completed, nil
+}
+
+func (s *Store) FailIssueRequest(ctx context.Context, message coupon.IssueCouponMessage, reason string) (*coupon.IssueRequest, error) {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req, ok := s.issueRequests[message.CouponID]
+	if ok && req.Status == coupon.IssueRequestStatusAvailable {
+		return nil, nil
+	}
+	if !ok {
+		req = &coupon.IssueRequest{
+			ID:             message.CouponID,
+			CouponPolicyID: message.PolicyID,
+			UserID:         message.UserID,
+			CouponCode:     message.CouponCode,
+			CreatedAt:      time.Now(),
+		}
+		s.issueRequests[req.ID] = req
+	}
+	req.Status = coupon.IssueRequestStatusFailed
+	req.Error = &reason
+	req.UpdatedAt = time.Now()
+
+	failed := *req
+	return &failed, nil
+}
+
+func (s *Store) FindIssueRequestByID(ctx context.Context, id string) (*coupon.IssueRequest, error) {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req, ok := s.issueRequests[id]
+	if !ok {
+		return nil, coupon.ErrIssueRequestNotFound
+	}
+	found := *req
+	return &found, nil
+}
+
+// Redis
+
+func (s *Store) SetCouponPolicyQuantity(ctx context.Context, code string, quantity int, endTime time.Time) error {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.quantity[code] = quantity
+	return nil
+}
+
+func (s *Store) SetCouponPolicyQuantityNX(ctx context.Context, code string, quantity int, endTime time.Time) error {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.quantity[code]; !ok {
+		s.quantity[code] = quantity
+	}
+	return nil
+}
+
+func (s *Store) GetCouponPolicyQuantity(ctx context.Context, code string) (int, error) {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	quantity, ok := s.quantity[code]
+	if !ok {
+		return 0, ErrCacheMiss
+	}
+	return quantity, nil
+}
+
+func (s *Store) IncrCouponPolicyQuantity(ctx context.Context, code string) error {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.quantity[code]++
+	return nil
+}
+
+func (s *Store) DecrCouponPolicyQuantity(ctx context.Context, code string) (int, error) {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.quantity[code]--
+	return s.quantity[code], nil
+}
+
+// IncrCouponPolicyUserClaim checks and increments the claim counter in one step, like its Lua script.
+func (s *Store) IncrCouponPolicyUserClaim(ctx context.Context, code string, userID string, maxPerUser int, endTime time.Time) error {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := code + "/" + userID
+	if s.userClaims[key] >= maxPerUser {
+		return coupon.ErrCouponUserLimitExceeded
+	}
+	s.userClaims[key]++
+	return nil
+}
+
+func (s *Store) DecrCouponPolicyUserClaim(ctx context.Context, code string, userID string) error {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := code + "/" + userID
+	if s.userClaims[key]--; s.userClaims[key] <= 0 {
+		delete(s.userClaims, key)
+	}
+	return nil
+}
+
+func (s *Store) SetCouponPolicyMetadata(ctx context.Context, policy *coupon.CouponPolicy) error {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cached := *policy
+	s.metadata[policy.Code] = &cached
+	return nil
+}
+
+// ReserveIssue does what the v5 reserve script does in one step: it checks the cached policy and
+// the user's claims, takes a quota unit and, for a POOL policy, pops a pooled code. It returns
+// ErrCacheMiss if the policy metadata or quantity is not cached.
+func (s *Store) ReserveIssue(ctx context.Context, policyCode string, userID string) (*coupon.CouponPolicy, string, error) {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	policy, ok := s.metadata[policyCode]
+	if !ok {
+		return nil, "", ErrCacheMiss
+	}
+	quantity, ok := s.quantity[policyCode]
+	if !ok {
+		return nil, "", ErrCacheMiss
+	}
+
+	if err := policy.IsIssuable(); err != nil {
+		return nil, "", err
+	}
+	key := policyCode + "/" + userID
+	if s.userClaims[key] >= policy.MaxPerUser {
+		return nil, "", policy.UserLimitError()
+	}
+	if quantity <= 0 {
+		return nil, "", coupon.ErrCouponPolicyQuantityExceed
+	}
+
+	s.quantity[policyCode]--
+	s.userClaims[key]++
+
+	pooledCode := ""
+	if policy.IssuanceMode == coupon.CouponPolicyIssuanceModePool && len(s.pools[policyCode]) > 0 {
+		pooledCode = s.pools[policyCode][0]
+		s.pools[policyCode] = s.pools[policyCode][1:]
+	}
+
+	reserved := *policy
+	return &reserved, pooledCode, nil
+}
+
+// ReturnPooledCouponCode pushes code back to the head of the policy's pool, like LPUSH.
+func (s *Store) ReturnPooledCouponCode(ctx context.Context, policyCode string, code string) error {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pools[policyCode] = append([]string{code}, s.pools[policyCode]...)
+	return nil
+}
+
+func (s *Store) IsCouponProcessed(ctx context.Context, couponID string) (bool, error) {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.processed[couponID], nil
+}
+
+func (s *Store) MarkCouponProcessed(ctx context.Context, couponID string, ttl time.Duration) error {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.processed[couponID] = true
+	return nil
+}
+
+func (s *Store) AcquireRedisLock(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.locks[key] {
+		return false, nil
+	}
+	s.locks[key] = true
+	return true, nil
+}
+
+func (s *Store) ReleaseRedisLock(ctx context.Context, key string) error {
+	s.roundTrip()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.locks, key)
+	return nil
+}
+
+func (s *Store) PublishIssueRequest(ctx context.Context, req *coupon.IssueRequest) error {
+	return nil
+}
+
+// SubscribeIssueRequest returns a channel that never delivers, waiters fall back to polling.
+func (s *Store) SubscribeIssueRequest(ctx context.Context, id string) (<-chan *coupon.IssueRequest, func() error, error) {
+	updates := make(chan *coupon.IssueRequest)
+	return updates, func() error { return nil }, nil
+}
@@ -0,0 +1,133 @@
+package domainevent
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TopicCouponEvents carries every coupon lifecycle event. Coupon events are keyed by coupon ID,
+// so the events of one coupon stay in order, and policy events by policy ID.
+const TopicCouponEvents = "coupon-events"
+
+type Type string
+
+const (
+	TypeCouponIssued    Type = "coupon.issued"
+	TypeCouponUsed      Type = "coupon.used"
+	TypeCouponCanceled  Type = "coupon.canceled"
+	TypeCouponExpired   Type = "coupon.expired"
+	TypeCouponRevoked   Type = "coupon.revoked"
+	TypePolicyExhausted Type = "policy.exhausted"
+)
+
+// Version is the schema version of the events this package publishes. Adding an optional field
+// keeps the version, anything that breaks an existing consumer bumps it.
+const Version = 1
+
+// Schema is the JSON schema of the envelope and of the data of every event type.
+//
+//go:embed schema.json
+var Schema []byte
+
+// Event is the envelope published to TopicCouponEvents. Data holds the payload of Type,
+// decode it with Decode. ID is unique per event, consumers dedupe redeliveries on it.
+type Event struct {
+	ID         string          `json:"id"`
+	Type       Type            `json:"type"`
+	Version    int             `json:"version"`
+	Key        string          `json:"key"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	TraceID    string          `json:"trace_id,omitempty"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// New wraps data in an envelope of eventType, keyed by key.
+func New(eventType Type, key string, traceID string, data any) (Event, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to marshal %s data: %w", eventType, err)
+	}
+
+	return Event{
+		ID:         uuid.New().String(),
+		Type:       eventType,
+		Version:    Version,
+		Key:        key,
+		OccurredAt: time.Now().UTC(),
+		TraceID:    traceID,
+		Data:       payload,
+	}, nil
+}
+
+// Decode unmarshals the event data into v, which should be the payload of its Type.
+func (e Event) Decode(v any) error {
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return fmt.Errorf("failed to decode %s data: %w", e.Type, err)
+	}
+	return nil
+}
+
+// CouponIssued is published once the coupon is persisted as AVAILABLE.
+type CouponIssued struct {
+	CouponID   string    `json:"coupon_id"`
+	CouponCode string    `json:"coupon_code"`
+	PolicyID   string    `json:"policy_id"`
+	UserID     string    `json:"user_id"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// CouponUsed is published when a coupon is redeemed for an order.
+type CouponUsed struct {
+	CouponID       string    `json:"coupon_id"`
+	CouponCode     string    `json:"coupon_code"`
+	PolicyID       string    `json:"policy_id"`
+	UserID         string    `json:"user_id"`
+	OrderID        string    `json:"order_id"`
+	OrderAmount    int       `json:"order_amount"`
+	DiscountAmount int       `json:"discount_amount"`
+	UsedAt         time.Time `json:"used_at"`
+}
+
+// CouponCanceled is published when a used coupon is canceled. OrderID is the order it was used for.
+// Status is AVAILABLE if the policy restores canceled coupons to their owner, CANCELED otherwise,
+// and QuotaReleased tells the coupon gave its unit back to the quota.
+type CouponCanceled struct {
+	CouponID      string  `json:"coupon_id"`
+	CouponCode    string  `json:"coupon_code"`
+	PolicyID      string  `json:"policy_id"`
+	UserID        string  `json:"user_id"`
+	OrderID       *string `json:"order_id,omitempty"`
+	Status        string  `json:"status,omitempty"`
+	QuotaReleased bool    `json:"quota_released,omitempty"`
+}
+
+// CouponExpired is published when the expiry sweeper expires an unused coupon.
+type CouponExpired struct {
+	CouponID   string    `json:"coupon_id"`
+	CouponCode string    `json:"coupon_code"`
+	PolicyID   string    `json:"policy_id"`
+	UserID     string    `json:"user_id"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// CouponRevoked is published when an admin revokes an unused coupon. OrderID is the order a
+// reserved coupon was held for, which loses the discount.
+type CouponRevoked struct {
+	CouponID   string  `json:"coupon_id"`
+	CouponCode string  `json:"coupon_code"`
+	PolicyID   string  `json:"policy_id"`
+	UserID     string  `json:"user_id"`
+	OrderID    *string `json:"order_id,omitempty"`
+	Reason     string  `json:"reason"`
+}
+
+// PolicyExhausted is published by the issue that takes the last unit of a policy's quota.
+type PolicyExhausted struct {
+	PolicyID      string `json:"policy_id"`
+	PolicyCode    string `json:"policy_code"`
+	TotalQuantity int    `json:"total_quantity"`
+}
@@ -0,0 +1,198 @@
+package domainevent
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/coupon-service/internal/instrument/logging"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+type schemaDoc struct {
+	Properties struct {
+		Type struct {
+			Enum []Type `json:"enum"`
+		} `json:"type"`
+		Version struct {
+			Const int `json:"const"`
+		} `json:"version"`
+	} `json:"properties"`
+	Required []string `json:"required"`
+	Defs     map[string]struct {
+		Required   []string                   `json:"required"`
+		Properties map[string]json.RawMessage `json:"properties"`
+	} `json:"$defs"`
+}
+
+// Every event type, its payload and the $defs entry schema.json describes it with.
+var eventTypes = []struct {
+	eventType Type
+	def       string
+	data      any
+}{
+	{TypeCouponIssued, "CouponIssued", CouponIssued{}},
+	{TypeCouponUsed, "CouponUsed", CouponUsed{}},
+	{TypeCouponCanceled, "CouponCanceled", CouponCanceled{}},
+	{TypeCouponExpired, "CouponExpired", CouponExpired{}},
+	{TypeCouponRevoked, "CouponRevoked", CouponRevoked{}},
+	{TypePolicyExhausted, "PolicyExhausted", PolicyExhausted{}},
+}
+
+func TestSchemaVersion(t *testing.T) {
+	var schema schemaDoc
+	if err := json.Unmarshal(Schema, &schema); err != nil {
+		t.Fatalf("schema.json is not valid JSON: %v", err)
+	}
+
+	if schema.Properties.Version.Const != Version {
+		t.Errorf("schema.json version = %d, want Version %d, bump both together", schema.Properties.Version.Const, Version)
+	}
+	if !strings.Contains(string(Schema), "Version "+strconv.Itoa(Version)) {
+		t.Errorf("schema.json description does not name version %d", Version)
+	}
+
+	var types []Type
+	for _, et := range eventTypes {
+		types = append(types, et.eventType)
+	}
+	if !slices.Equal(schema.Properties.Type.Enum, types) {
+		t.Errorf("schema.json types = %v, want %v", schema.Properties.Type.Enum, types)
+	}
+
+	for _, field := range jsonFields(reflect.TypeOf(Event{})) {
+		if !field.optional && !slices.Contains(schema.Required, field.name) {
+			t.Errorf("envelope field %q is always sent but not required by schema.json", field.name)
+		}
+	}
+}
+
+func TestSchemaPayloads(t *testing.T) {
+	var schema schemaDoc
+	if err := json.Unmarshal(Schema, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, et := range eventTypes {
+		t.Run(string(et.eventType), func(t *testing.T) {
+			def, ok := schema.Defs[et.def]
+			if !ok {
+				t.Fatalf("schema.json has no $defs/%s", et.def)
+			}
+
+			fields := jsonFields(reflect.TypeOf(et.data))
+			for _, field := range fields {
+				if _, ok := def.Properties[field.name]; !ok {
+					t.Errorf("field %q is missing from $defs/%s", field.name, et.def)
+				}
+				if !field.optional && !slices.Contains(def.Required, field.name) {
+					t.Errorf("field %q is always sent but not required by $defs/%s", field.name, et.def)
+				}
+			}
+			for _, name := range def.Required {
+				if !slices.ContainsFunc(fields, func(f jsonField) bool { return f.name == name && !f.optional }) {
+					t.Errorf("$defs/%s requires %q, which %T does not always send", et.def, name, et.data)
+				}
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, et := range eventTypes {
+		t.Run(string(et.eventType), func(t *testing.T) {
+			before := time.Now()
+			event, err := New(et.eventType, "KEY", "TRACE", et.data)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			if event.Version != Version {
+				t.Errorf("Version = %d, want %d", event.Version, Version)
+			}
+			if event.Type != et.eventType || event.Key != "KEY" || event.TraceID != "TRACE" {
+				t.Errorf("New() = %+v, want type %s, key KEY and trace TRACE", event, et.eventType)
+			}
+			if event.ID == "" || event.OccurredAt.Before(before.Add(-time.Second)) || event.OccurredAt.Location() != time.UTC {
+				t.Errorf("New() ID = %q, OccurredAt = %s, want an ID and the UTC time of the call", event.ID, event.OccurredAt)
+			}
+
+			decoded := reflect.New(reflect.TypeOf(et.data))
+			if err := event.Decode(decoded.Interface()); err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestSubscriberSkipsNewerVersions(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), zap.NewNop())
+
+	message := func(eventType Type, version int) kafka.Message {
+		event, err := New(eventType, "KEY", "", CouponUsed{CouponID: "KEY"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		event.Version = version
+		b, err := json.Marshal(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return kafka.Message{Value: b}
+	}
+
+	tests := []struct {
+		name        string
+		message     kafka.Message
+		wantHandled bool
+	}{
+		{name: "current version", message: message(TypeCouponUsed, Version), wantHandled: true},
+		{name: "older version", message: message(TypeCouponUsed, Version-1), wantHandled: true},
+		{name: "newer version", message: message(TypeCouponUsed, Version+1), wantHandled: false},
+		{name: "type without a handler", message: message(TypeCouponIssued, Version), wantHandled: false},
+		{name: "unreadable", message: kafka.Message{Value: []byte("{")}, wantHandled: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled := false
+			s := &Subscriber{handlers: map[Type]Handler{
+				TypeCouponUsed: func(ctx context.Context, event Event) error {
+					handled = true
+					return nil
+				},
+			}}
+
+			if err := s.dispatch(ctx, tt.message); err != nil {
+				t.Fatalf("dispatch() error = %v", err)
+			}
+			if handled != tt.wantHandled {
+				t.Errorf("handled = %v, want %v", handled, tt.wantHandled)
+			}
+		})
+	}
+}
+
+type jsonField struct {
+	name     string
+	optional bool
+}
+
+// jsonFields returns the JSON names of the exported fields of t, optional when tagged omitempty.
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		name, opts, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, jsonField{name: name, optional: strings.Contains(opts, "omitempty")})
+	}
+	return fields
+}
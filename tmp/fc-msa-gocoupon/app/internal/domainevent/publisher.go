@@ -0,0 +1,85 @@
+package domainevent
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"example.com/coupon-service/internal/instrument/logging"
+	"example.com/coupon-service/internal/instrument/metrics"
+	"example.com/coupon-service/internal/instrument/tracing"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+type IPublisher interface {
+	Publish(ctx context.Context, events ...Event) error
+}
+
+// Publisher writes events to TopicCouponEvents. It is called after the state change committed,
+// so a failed publish loses the event instead of rolling anything back.
+type Publisher struct {
+	writer *kafka.Writer
+}
+
+func NewPublisher(brokers []string) *Publisher {
+	return &Publisher{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        TopicCouponEvents,
+			Balancer:     &kafka.Hash{},
+			BatchSize:    100,
+			BatchTimeout: 10 * time.Millisecond,
+			RequiredAcks: kafka.RequireAll,
+			MaxAttempts:  5,
+		},
+	}
+}
+
+func (p *Publisher) Publish(ctx context.Context, events ...Event) error {
+	ctx, span := tracing.StartSpan(ctx, "DomainEvent.Publisher.Publish")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	messages := make([]kafka.Message, 0, len(events))
+	for _, e := range events {
+		value, err := json.Marshal(e)
+		if err != nil {
+			span.RecordError(err)
+			log.Error("failed to marshal domain event", zap.String("type", string(e.Type)), zap.String("key", e.Key), zap.Error(err))
+			return err
+		}
+		messages = append(messages, kafka.Message{
+			Key:   []byte(e.Key),
+			Value: value,
+			Time:  e.OccurredAt,
+		})
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if err := p.writer.WriteMessages(sendCtx, messages...); err != nil {
+		for _, e := range events {
+			metrics.DomainEventPublishTotal.WithLabelValues(string(e.Type), "failed").Inc()
+		}
+		span.RecordError(err)
+		log.Error("failed to publish domain events", zap.Int("count", len(events)), zap.Error(err))
+		return err
+	}
+
+	for _, e := range events {
+		metrics.DomainEventPublishTotal.WithLabelValues(string(e.Type), "sent").Inc()
+	}
+	log.Info("domain events published", zap.Int("count", len(events)), zap.String("type", string(events[0].Type)))
+	return nil
+}
+
+func (p *Publisher) Close() error {
+	return p.writer.Close()
+}
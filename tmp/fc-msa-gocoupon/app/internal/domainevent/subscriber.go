@@ -0,0 +1,137 @@
+package domainevent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"example.com/coupon-service/internal/instrument/logging"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// Handler processes one event. Returning an error retries the event, so it must be idempotent.
+type Handler func(ctx context.Context, event Event) error
+
+// Subscriber lets another service consume TopicCouponEvents with one handler per event type.
+//
+//	sub := domainevent.NewSubscriber(brokers, "order-service")
+//	sub.Handle(domainevent.TypeCouponUsed, func(ctx context.Context, e domainevent.Event) error {
+//		var data domainevent.CouponUsed
+//		if err := e.Decode(&data); err != nil {
+//			return nil // unreadable, retrying would not help
+//		}
+//		return orders.MarkDiscounted(ctx, data.OrderID, data.DiscountAmount)
+//	})
+//	err := sub.Start(ctx)
+//
+// Events are handled one at a time in partition order, so the events of a coupon are seen in the
+// order they happened. An offset is committed only after its handler succeeded, delivery is at
+// least once. Types without a handler and versions newer than Version are skipped.
+type Subscriber struct {
+	reader          *kafka.Reader
+	handlers        map[Type]Handler
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+}
+
+func NewSubscriber(brokers []string, groupID string) *Subscriber {
+	return &Subscriber{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:  brokers,
+			Topic:    TopicCouponEvents,
+			GroupID:  groupID,
+			MaxWait:  500 * time.Millisecond,
+			MinBytes: 1,
+			MaxBytes: 10e6,
+		}),
+		handlers:        make(map[Type]Handler),
+		retryBackoff:    200 * time.Millisecond,
+		maxRetryBackoff: 10 * time.Second,
+	}
+}
+
+// Handle registers the handler of eventType, it must be called before Start.
+func (s *Subscriber) Handle(eventType Type, handler Handler) {
+	s.handlers[eventType] = handler
+}
+
+// Start consumes events until ctx is canceled, then closes the reader.
+func (s *Subscriber) Start(ctx context.Context) error {
+	log := logging.GetLoggerFromContext(ctx)
+	log.Info("domain event subscriber started...", zap.String("topic", TopicCouponEvents), zap.Int("handlers", len(s.handlers)))
+
+	defer s.reader.Close()
+
+	for {
+		m, err := s.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, io.EOF) {
+				log.Info("domain event subscriber stopped")
+				return nil
+			}
+			log.Error("failed fetch domain event from kafka", zap.Error(err))
+			continue
+		}
+
+		if err := s.dispatch(ctx, m); err != nil {
+			// Left uncommitted, it is redelivered after restart
+			log.Info("domain event subscriber stopped")
+			return nil
+		}
+
+		if err := s.reader.CommitMessages(context.Background(), m); err != nil {
+			log.Error("failed to commit domain event", zap.Int("partition", m.Partition), zap.Int64("offset", m.Offset), zap.Error(err))
+		}
+	}
+}
+
+// dispatch runs the handler of the message until it succeeds. It only returns an error if ctx
+// is canceled first.
+func (s *Subscriber) dispatch(ctx context.Context, m kafka.Message) error {
+	log := logging.GetLoggerFromContext(ctx)
+
+	var event Event
+	if err := json.Unmarshal(m.Value, &event); err != nil {
+		log.Error("skipping unreadable domain event", zap.Int("partition", m.Partition), zap.Int64("offset", m.Offset), zap.Error(err))
+		return nil
+	}
+
+	handler, ok := s.handlers[event.Type]
+	if !ok {
+		return nil
+	}
+	if event.Version > Version {
+		log.Warn("skipping domain event of a newer version", zap.String("event_id", event.ID), zap.String("type", string(event.Type)), zap.Int("version", event.Version))
+		return nil
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := handler(ctx, event)
+		if err == nil {
+			return nil
+		}
+
+		backoff := s.backoff(attempt)
+		log.Warn("retrying domain event", zap.String("event_id", event.ID), zap.String("type", string(event.Type)), zap.Int("attempt", attempt), zap.Duration("backoff", backoff), zap.Error(err))
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the exponential delay before the given retry attempt, capped at maxRetryBackoff.
+func (s *Subscriber) backoff(attempt int) time.Duration {
+	backoff := s.retryBackoff << (attempt - 1)
+	if backoff <= 0 || backoff > s.maxRetryBackoff {
+		return s.maxRetryBackoff
+	}
+	return backoff
+}
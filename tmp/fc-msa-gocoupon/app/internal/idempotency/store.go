@@ -0,0 +1,201 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"example.com/coupon-service/internal/config"
+	"example.com/coupon-service/internal/instrument/logging"
+	"example.com/coupon-service/internal/instrument/tracing"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Record is the first response produced for an idempotency key.
+type Record struct {
+	Key         string    `json:"key"`
+	RequestHash string    `json:"request_hash"`
+	StatusCode  int       `json:"status_code"`
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"body"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type IStore interface {
+	Get(ctx context.Context, key string) (*Record, error)
+	Save(ctx context.Context, record *Record) error
+	Lock(ctx context.Context, key string) (bool, error)
+	Unlock(ctx context.Context, key string) error
+}
+
+var (
+	IdempotencyRecordKeyPrefix = "idempotency:record:"
+	IdempotencyLockKeyPrefix   = "idempotency:lock:"
+)
+
+type store struct {
+	pg      *config.Postgres
+	rdb     *config.Redis
+	ttl     time.Duration
+	lockTTL time.Duration
+}
+
+// NewStore returns a store that keeps records in Redis and falls back to Postgres
+// when Redis misses or is unavailable.
+func NewStore(cfg *config.Config, pg *config.Postgres, rdb *config.Redis) IStore {
+	ttl := cfg.Idempotency.TTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	lockTTL := cfg.Idempotency.LockTTL
+	if lockTTL <= 0 {
+		lockTTL = 30 * time.Second
+	}
+
+	return &store{
+		pg:      pg,
+		rdb:     rdb,
+		ttl:     ttl,
+		lockTTL: lockTTL,
+	}
+}
+
+// Get returns the stored record for key, or nil if the key has not completed yet.
+func (s *store) Get(ctx context.Context, key string) (*Record, error) {
+	ctx, span := tracing.StartSpan(ctx, "Idempotency.Store.Get")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	value, err := s.rdb.Client.Get(ctx, IdempotencyRecordKeyPrefix+key).Bytes()
+	if err == nil {
+		var record Record
+		if err := json.Unmarshal(value, &record); err == nil {
+			return &record, nil
+		}
+		log.Warn("failed to unmarshal idempotency record (redis)", zap.String("idempotency_key", key))
+	} else if !errors.Is(err, redis.Nil) {
+		span.RecordError(err)
+		log.Warn("failed to get idempotency record (redis), falling back to postgres", zap.String("idempotency_key", key), zap.Error(err))
+	}
+
+	row := s.pg.Pool.QueryRow(ctx, `
+		SELECT
+			key,
+			request_hash,
+			status_code,
+			content_type,
+			response_body,
+			created_at
+		FROM idempotency_keys
+		WHERE key = $1 AND expires_at > NOW()
+	`, key)
+
+	var record Record
+	err = row.Scan(
+		&record.Key,
+		&record.RequestHash,
+		&record.StatusCode,
+		&record.ContentType,
+		&record.Body,
+		&record.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		span.RecordError(err)
+		log.Error("failed to get idempotency record (postgres)", zap.String("idempotency_key", key), zap.Error(err))
+		return nil, err
+	}
+
+	// Warm Redis so later replays skip Postgres
+	s.setRedisRecord(ctx, &record, s.ttl-time.Since(record.CreatedAt))
+
+	return &record, nil
+}
+
+// Save persists the record in Postgres first, so the response survives a Redis flush, then caches it in Redis.
+func (s *store) Save(ctx context.Context, record *Record) error {
+	ctx, span := tracing.StartSpan(ctx, "Idempotency.Store.Save")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	record.CreatedAt = time.Now().UTC()
+
+	_, err := s.pg.Pool.Exec(ctx, `
+		INSERT INTO idempotency_keys (
+			key,
+			request_hash,
+			status_code,
+			content_type,
+			response_body,
+			created_at,
+			expires_at
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7
+		)
+		ON CONFLICT (key) DO NOTHING
+	`,
+		record.Key,
+		record.RequestHash,
+		record.StatusCode,
+		record.ContentType,
+		record.Body,
+		record.CreatedAt,
+		record.CreatedAt.Add(s.ttl),
+	)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to save idempotency record (postgres)", zap.String("idempotency_key", record.Key), zap.Error(err))
+	}
+
+	s.setRedisRecord(ctx, record, s.ttl)
+
+	log.Info("idempotency record saved", zap.String("idempotency_key", record.Key), zap.Int("status_code", record.StatusCode))
+	return err
+}
+
+// Lock marks key as in progress so a concurrent retry does not run the handler twice.
+// When Redis is unavailable the lock is skipped and Postgres keeps the first response.
+func (s *store) Lock(ctx context.Context, key string) (bool, error) {
+	ctx, span := tracing.StartSpan(ctx, "Idempotency.Store.Lock")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	ok, err := s.rdb.Client.SetNX(ctx, IdempotencyLockKeyPrefix+key, "locked", s.lockTTL).Result()
+	if err != nil {
+		span.RecordError(err)
+		log.Warn("failed to lock idempotency key (redis), continuing without lock", zap.String("idempotency_key", key), zap.Error(err))
+		return true, nil
+	}
+
+	return ok, nil
+}
+
+func (s *store) Unlock(ctx context.Context, key string) error {
+	return s.rdb.Client.Del(ctx, IdempotencyLockKeyPrefix+key).Err()
+}
+
+func (s *store) setRedisRecord(ctx context.Context, record *Record, ttl time.Duration) {
+	log := logging.GetLoggerFromContext(ctx)
+
+	if ttl <= 0 {
+		return
+	}
+
+	value, err := json.Marshal(record)
+	if err != nil {
+		log.Warn("failed to marshal idempotency record", zap.String("idempotency_key", record.Key), zap.Error(err))
+		return
+	}
+
+	if err := s.rdb.Client.Set(ctx, IdempotencyRecordKeyPrefix+record.Key, value, ttl).Err(); err != nil {
+		log.Warn("failed to set idempotency record (redis)", zap.String("idempotency_key", record.Key), zap.Error(err))
+	}
+}
@@ -82,3 +82,8 @@ func WithTraceID(ctx context.Context, traceID string) context.Context {
 	l := instance.With(zap.String("trace_id", traceID))
 	return context.WithValue(ctx, ctxKey{}, l)
 }
+
+// WithLogger returns a context carrying l, for callers that do not run InitLogging such as tests.
+func WithLogger(ctx context.Context, l *zap.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
@@ -19,10 +19,89 @@ var (
 		},
 		[]string{"policy_code", "version"},
 	)
+
+	CouponExpiredTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "coupon_expired_total",
+			Help: "Number of coupons moved to EXPIRED by the expiry sweeper",
+		},
+	)
+
+	CouponReservationReleasedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "coupon_reservation_released_total",
+			Help: "Number of abandoned coupon reservations returned to AVAILABLE by the reservation sweeper",
+		},
+	)
+
+	OutboxPublishTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "outbox_publish_total",
+			Help: "Number of outbox messages published by the outbox relay",
+		},
+		[]string{"topic", "result"},
+	)
+
+	DomainEventPublishTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "domain_event_publish_total",
+			Help: "Number of coupon lifecycle events published to Kafka",
+		},
+		[]string{"type", "result"},
+	)
+
+	CouponQuotaDrift = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "coupon_quota_drift",
+			Help: "Redis quota minus the quota expected from Postgres, per coupon policy, as of the last reconciliation",
+		},
+		[]string{"policy_code"},
+	)
+
+	CouponQuotaReconciledTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "coupon_quota_reconciled_total",
+			Help: "Number of coupon policy quota reconciliations by resulting action",
+		},
+		[]string{"action"},
+	)
+
+	WaitingRoomQueueLength = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "waiting_room_queue_length",
+			Help: "Number of users waiting for admission, per coupon policy, as of the last admission run",
+		},
+		[]string{"policy_code"},
+	)
+
+	WaitingRoomAdmittedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "waiting_room_admitted_total",
+			Help: "Number of users admitted from the waiting room, per coupon policy",
+		},
+		[]string{"policy_code"},
+	)
+
+	RateLimitRejectedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rate_limit_rejected_total",
+			Help: "Number of requests rejected by the rate limiter, by limit scope and route",
+		},
+		[]string{"scope", "route"},
+	)
 )
 
 func init() {
 	prometheus.MustRegister(CouponIssueDuration)
+	prometheus.MustRegister(CouponExpiredTotal)
+	prometheus.MustRegister(CouponReservationReleasedTotal)
+	prometheus.MustRegister(OutboxPublishTotal)
+	prometheus.MustRegister(DomainEventPublishTotal)
+	prometheus.MustRegister(CouponQuotaDrift)
+	prometheus.MustRegister(CouponQuotaReconciledTotal)
+	prometheus.MustRegister(WaitingRoomQueueLength)
+	prometheus.MustRegister(WaitingRoomAdmittedTotal)
+	prometheus.MustRegister(RateLimitRejectedTotal)
 }
 
 func NewMetricServer(cfg *config.Config) *echo.Echo {
@@ -33,3 +33,12 @@ func StartSpan(ctx context.Context, name string) (context.Context, trace.Span) {
 	ctx, span := t.Start(ctx, name)
 	return ctx, span
 }
+
+// TraceID returns the trace ID of the span in ctx, or an empty string if there is none.
+func TraceID(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
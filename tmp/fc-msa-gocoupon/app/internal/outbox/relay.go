@@ -0,0 +1,266 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"example.com/coupon-service/internal/config"
+	"example.com/coupon-service/internal/instrument/logging"
+	"example.com/coupon-service/internal/instrument/metrics"
+	"example.com/coupon-service/internal/instrument/tracing"
+	"github.com/jackc/pgx/v5"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// Message is a row of the outbox table. It is inserted by a repository in the same
+// transaction as the state change it announces, and published later by the Relay.
+type Message struct {
+	ID        int64             `json:"id"`
+	Topic     string            `json:"topic"`
+	Key       string            `json:"key"`
+	Payload   []byte            `json:"payload"`
+	Headers   map[string]string `json:"headers"`
+	Attempts  int               `json:"attempts"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// Relay publishes unsent outbox rows to Kafka. Rows are claimed with FOR UPDATE SKIP LOCKED
+// and stay locked until they are marked sent, so replicas never publish the same row
+// concurrently. A crash between publish and commit republishes the row, so consumers must
+// dedupe; a row is never lost.
+type Relay struct {
+	pg         *config.Postgres
+	writer     *kafka.Writer
+	interval   time.Duration
+	batchSize  int
+	maxBackoff time.Duration
+	retention  time.Duration
+}
+
+func NewRelay(cfg *config.Config, pg *config.Postgres) *Relay {
+	interval := cfg.Outbox.Interval
+	if interval <= 0 {
+		interval = 200 * time.Millisecond
+	}
+	batchSize := cfg.Outbox.BatchSize
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	maxBackoff := cfg.Outbox.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 30 * time.Second
+	}
+	retention := cfg.Outbox.Retention
+	if retention <= 0 {
+		retention = 7 * 24 * time.Hour
+	}
+
+	return &Relay{
+		pg: pg,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(cfg.Kafka.Brokers...),
+			Balancer:     &kafka.Hash{},
+			BatchSize:    batchSize,
+			BatchTimeout: 10 * time.Millisecond,
+			RequiredAcks: kafka.RequireAll,
+			MaxAttempts:  3,
+		},
+		interval:   interval,
+		batchSize:  batchSize,
+		maxBackoff: maxBackoff,
+		retention:  retention,
+	}
+}
+
+// Start relays batches until ctx is canceled. A full batch is followed immediately by the
+// next one, so a backlog drains at Kafka speed instead of one batch per interval.
+func (r *Relay) Start(ctx context.Context) error {
+	log := logging.GetLogger()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	cleanup := time.NewTicker(time.Hour)
+	defer cleanup.Stop()
+
+	for {
+		relayed, err := r.RelayBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Error("failed to relay outbox batch", zap.Error(err))
+		}
+		if relayed == r.batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			_ = r.writer.Close()
+			log.Info("outbox relay stopped")
+			return nil
+		case <-cleanup.C:
+			if _, err := r.DeleteSent(ctx); err != nil && ctx.Err() == nil {
+				log.Error("failed to delete sent outbox messages", zap.Error(err))
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayBatch publishes one batch of due messages and returns how many were claimed.
+// Messages that fail are retried later with exponential backoff.
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	ctx, span := tracing.StartSpan(ctx, "Outbox.Relay.RelayBatch")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	tx, err := r.pg.Pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT
+			id,
+			topic,
+			message_key,
+			payload,
+			headers,
+			attempts,
+			created_at
+		FROM outbox
+		WHERE sent_at IS NULL AND available_at <= NOW()
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, r.batchSize)
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+
+	var messages []Message
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.Topic, &m.Key, &m.Payload, &m.Headers, &m.Attempts, &m.CreatedAt); err != nil {
+			rows.Close()
+			span.RecordError(err)
+			return 0, err
+		}
+		messages = append(messages, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	// Publish Messages
+	kafkaMessages := make([]kafka.Message, len(messages))
+	for i, m := range messages {
+		headers := make([]kafka.Header, 0, len(m.Headers))
+		for k, v := range m.Headers {
+			headers = append(headers, kafka.Header{Key: k, Value: []byte(v)})
+		}
+		kafkaMessages[i] = kafka.Message{
+			Topic:   m.Topic,
+			Key:     []byte(m.Key),
+			Value:   m.Payload,
+			Headers: headers,
+			Time:    m.CreatedAt,
+		}
+	}
+
+	writeErr := r.writer.WriteMessages(ctx, kafkaMessages...)
+
+	var writeErrs kafka.WriteErrors
+	isPartial := errors.As(writeErr, &writeErrs)
+
+	var sent []int64
+	var sentTopics []string
+	for i, m := range messages {
+		var msgErr error
+		switch {
+		case writeErr == nil:
+		case isPartial:
+			msgErr = writeErrs[i]
+		default:
+			msgErr = writeErr
+		}
+
+		if msgErr == nil {
+			sent = append(sent, m.ID)
+			sentTopics = append(sentTopics, m.Topic)
+			continue
+		}
+
+		// Schedule Retry
+		backoff := r.backoff(m.Attempts + 1)
+		if _, err := tx.Exec(ctx, `
+			UPDATE outbox
+			SET
+				attempts = attempts + 1,
+				last_error = $2,
+				available_at = NOW() + ($3 * INTERVAL '1 millisecond')
+			WHERE id = $1
+		`, m.ID, msgErr.Error(), backoff.Milliseconds()); err != nil {
+			span.RecordError(err)
+			return 0, err
+		}
+		metrics.OutboxPublishTotal.WithLabelValues(m.Topic, "failed").Inc()
+		log.Warn("failed to publish outbox message", zap.Int64("outbox_id", m.ID), zap.String("topic", m.Topic), zap.Int("attempts", m.Attempts+1), zap.Duration("backoff", backoff), zap.Error(msgErr))
+	}
+
+	// Mark Sent
+	if len(sent) > 0 {
+		if _, err := tx.Exec(ctx, `
+			UPDATE outbox
+			SET sent_at = NOW()
+			WHERE id = ANY($1)
+		`, sent); err != nil {
+			span.RecordError(err)
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+
+	for _, topic := range sentTopics {
+		metrics.OutboxPublishTotal.WithLabelValues(topic, "sent").Inc()
+	}
+
+	log.Info("outbox batch relayed", zap.Int("claimed", len(messages)), zap.Int("sent", len(sent)))
+	return len(messages), nil
+}
+
+// DeleteSent removes sent messages older than the retention period.
+func (r *Relay) DeleteSent(ctx context.Context) (int64, error) {
+	tag, err := r.pg.Pool.Exec(ctx, `
+		DELETE FROM outbox
+		WHERE sent_at IS NOT NULL AND sent_at < NOW() - ($1 * INTERVAL '1 millisecond')
+	`, r.retention.Milliseconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// backoff returns the exponential delay before the given attempt, capped at maxBackoff.
+func (r *Relay) backoff(attempt int) time.Duration {
+	backoff := r.interval << (attempt - 1)
+	if backoff <= 0 || backoff > r.maxBackoff {
+		return r.maxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,348 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	v4 "example.com/coupon-service/internal/api/v4"
+	"example.com/coupon-service/internal/config"
+	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/instrument/logging"
+	"example.com/coupon-service/internal/instrument/metrics"
+	"example.com/coupon-service/internal/instrument/tracing"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	CouponPolicyQuantityKeyPrefix = "coupon:policy:quantity:"
+)
+
+// compareAndSetQuantityScript overwrites the quota only if it still holds the value the
+// reconciler read before counting Postgres, so an issuance racing the reconciler is never lost.
+// It returns 1 when set, -1 when the value moved and -2 when the key is gone.
+var compareAndSetQuantityScript = redis.NewScript(`
+	local current = redis.call('GET', KEYS[1])
+	if not current then
+		return -2
+	end
+	if tonumber(current) ~= tonumber(ARGV[1]) then
+		return -1
+	end
+	redis.call('SET', KEYS[1], ARGV[2], 'KEEPTTL')
+	return 1
+`)
+
+// reseedQuantityScript sets the quota with a ttl in milliseconds, only if it still holds the value
+// read before counting, the empty string standing for a missing key. It returns 1 when set.
+var reseedQuantityScript = redis.NewScript(`
+	local current = redis.call('GET', KEYS[1]) or ''
+	if current ~= ARGV[1] then
+		return 0
+	end
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+	return 1
+`)
+
+const maxReseedAttempts = 3
+
+// Querier runs a single-row query, on the pool or inside a transaction.
+type Querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// CountQuota reads what Postgres says is left of a policy's quota: total_quantity - issued coupons
+// - issue requests still in the outbox. Coupons with their quota unit released do not count.
+func CountQuota(ctx context.Context, q Querier, policyCode string) (*coupon.QuotaReconciliation, error) {
+	result := &coupon.QuotaReconciliation{
+		PolicyCode: policyCode,
+		CheckedAt:  time.Now(),
+	}
+
+	err := q.QueryRow(ctx, `
+		SELECT
+			p.total_quantity,
+			(SELECT COUNT(*) FROM coupons c WHERE c.coupon_policy_id = p.id AND c.status <> 'UNASSIGNED' AND NOT c.quota_released),
+			(
+				SELECT COUNT(*)
+				FROM outbox o
+				WHERE o.topic = $2
+					AND o.payload->>'policy_id' = p.id
+					AND NOT EXISTS (SELECT 1 FROM coupons c WHERE c.id = o.payload->>'coupon_id' AND c.status <> 'UNASSIGNED')
+			)
+		FROM coupon_policies p
+		WHERE p.code = $1
+	`, policyCode, v4.TopicCouponIssue).Scan(&result.TotalQuantity, &result.Issued, &result.InFlight)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, coupon.ErrCouponPolicyNotFound
+		}
+		return nil, err
+	}
+
+	result.Expected = max(result.TotalQuantity-result.Issued-result.InFlight, 0)
+	return result, nil
+}
+
+// QuotaReconciler compares the Redis quota of every active policy with what Postgres says is left,
+// total_quantity - issued coupons - issue requests still in flight, and corrects the counter.
+//
+// A counter that is too high risks overselling and is always corrected down. A counter that is too
+// low may only reflect requests Postgres cannot see yet (v5 publishes straight to Kafka), so it is
+// corrected up only when the same drift is seen on two consecutive runs and is within maxCorrection.
+type QuotaReconciler struct {
+	pg            *config.Postgres
+	rdb           *config.Redis
+	interval      time.Duration
+	maxCorrection int
+
+	mu          sync.Mutex
+	undercounts map[string]int
+}
+
+func NewQuotaReconciler(cfg *config.Config, pg *config.Postgres, rdb *config.Redis) *QuotaReconciler {
+	interval := cfg.Reconciler.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	maxCorrection := cfg.Reconciler.MaxCorrection
+	if maxCorrection <= 0 {
+		maxCorrection = 100
+	}
+
+	return &QuotaReconciler{
+		pg:            pg,
+		rdb:           rdb,
+		interval:      interval,
+		maxCorrection: maxCorrection,
+		undercounts:   make(map[string]int),
+	}
+}
+
+// Start reconciles every active policy every interval until ctx is canceled.
+func (r *QuotaReconciler) Start(ctx context.Context) error {
+	log := logging.GetLogger()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("coupon quota reconciler stopped")
+			return nil
+		case <-ticker.C:
+			if _, err := r.ReconcileAll(ctx); err != nil && ctx.Err() == nil {
+				log.Error("failed to reconcile coupon policy quotas", zap.Error(err))
+			}
+		}
+	}
+}
+
+// ReconcileAll reconciles every active policy that has not ended. A failing policy is logged
+// and skipped so it does not block the others.
+func (r *QuotaReconciler) ReconcileAll(ctx context.Context) ([]coupon.QuotaReconciliation, error) {
+	ctx, span := tracing.StartSpan(ctx, "Reconciler.Quota.ReconcileAll")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	rows, err := r.pg.Pool.Query(ctx, `
+		SELECT code
+		FROM coupon_policies
+		WHERE status = 'ACTIVE' AND end_time > NOW()
+		ORDER BY code
+	`)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	codes, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	results := make([]coupon.QuotaReconciliation, 0, len(codes))
+	for _, code := range codes {
+		result, err := r.Reconcile(ctx, code)
+		if err != nil {
+			if ctx.Err() != nil {
+				return results, ctx.Err()
+			}
+			log.Error("failed to reconcile coupon policy quota", zap.String("policy_code", code), zap.Error(err))
+			continue
+		}
+		results = append(results, *result)
+	}
+
+	return results, nil
+}
+
+// Reconcile checks and, within bounds, corrects the Redis quota of a single policy.
+func (r *QuotaReconciler) Reconcile(ctx context.Context, policyCode string) (*coupon.QuotaReconciliation, error) {
+	ctx, span := tracing.StartSpan(ctx, "Reconciler.Quota.Reconcile")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	key := CouponPolicyQuantityKeyPrefix + policyCode
+
+	// Read Redis Quota, before Postgres so a concurrent issuance shows up as a CAS conflict
+	var current *int
+	quantity, err := r.rdb.Client.Get(ctx, key).Int()
+	switch {
+	case err == nil:
+		current = &quantity
+	case errors.Is(err, redis.Nil):
+	default:
+		span.RecordError(err)
+		return nil, err
+	}
+
+	// Count Issued and In-Flight Coupons
+	result, err := CountQuota(ctx, r.pg.Pool, policyCode)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	result.Redis = current
+
+	if current == nil {
+		result.Action = coupon.QuotaReconciliationCacheMiss
+		r.forgetUndercount(policyCode)
+		return r.report(ctx, result), nil
+	}
+
+	result.Drift = *current - result.Expected
+	metrics.CouponQuotaDrift.WithLabelValues(policyCode).Set(float64(result.Drift))
+
+	// Decide Correction
+	switch {
+	case result.Drift == 0:
+		result.Action = coupon.QuotaReconciliationInSync
+		r.forgetUndercount(policyCode)
+		return r.report(ctx, result), nil
+	case result.Drift < 0 && -result.Drift > r.maxCorrection:
+		result.Action = coupon.QuotaReconciliationOutOfBound
+		r.forgetUndercount(policyCode)
+		return r.report(ctx, result), nil
+	case result.Drift < 0 && !r.isStableUndercount(policyCode, result.Drift):
+		result.Action = coupon.QuotaReconciliationPending
+		return r.report(ctx, result), nil
+	}
+
+	// Correct Redis Quota
+	code, err := compareAndSetQuantityScript.Run(ctx, r.rdb.Client, []string{key}, *current, result.Expected).Int()
+	if err != nil {
+		span.RecordError(err)
+		log.Error("failed to correct coupon policy quantity", zap.String("policy_code", policyCode), zap.Error(err))
+		return nil, err
+	}
+
+	r.forgetUndercount(policyCode)
+	switch code {
+	case 1:
+		result.Action = coupon.QuotaReconciliationCorrected
+	case -2:
+		result.Action = coupon.QuotaReconciliationCacheMiss
+	default:
+		result.Action = coupon.QuotaReconciliationConflict
+	}
+
+	return r.report(ctx, result), nil
+}
+
+// Reseed overwrites the Redis quota of a policy with CountQuota read through q, so a caller that
+// changed the policy in a transaction seeds what it is about to commit. The quota is read before
+// counting and set by compare-and-set like Reconcile, and the whole step is retried when a
+// concurrent issuance moves it in between.
+func (r *QuotaReconciler) Reseed(ctx context.Context, q Querier, policyCode string, endTime time.Time) (int, error) {
+	ctx, span := tracing.StartSpan(ctx, "Reconciler.Quota.Reseed")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	key := CouponPolicyQuantityKeyPrefix + policyCode
+	ttl := time.Until(endTime)
+	if ttl <= 0 {
+		ttl = time.Millisecond
+	}
+
+	for attempt := 1; attempt <= maxReseedAttempts; attempt++ {
+		current, err := r.rdb.Client.Get(ctx, key).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			span.RecordError(err)
+			return 0, err
+		}
+
+		result, err := CountQuota(ctx, q, policyCode)
+		if err != nil {
+			span.RecordError(err)
+			return 0, err
+		}
+
+		ok, err := reseedQuantityScript.Run(ctx, r.rdb.Client, []string{key}, current, result.Expected, ttl.Milliseconds()).Bool()
+		if err != nil {
+			span.RecordError(err)
+			return 0, err
+		}
+		if ok {
+			r.forgetUndercount(policyCode)
+			log.Info("coupon policy quantity reseeded", zap.String("policy_code", policyCode), zap.Int("issued", result.Issued), zap.Int("in_flight", result.InFlight), zap.Int("quantity", result.Expected))
+			return result.Expected, nil
+		}
+	}
+
+	err := fmt.Errorf("coupon policy quantity kept moving after %d attempts", maxReseedAttempts)
+	span.RecordError(err)
+	return 0, err
+}
+
+// isStableUndercount records the drift and reports whether the previous run saw the same one.
+func (r *QuotaReconciler) isStableUndercount(policyCode string, drift int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous, ok := r.undercounts[policyCode]
+	r.undercounts[policyCode] = drift
+	return ok && previous == drift
+}
+
+func (r *QuotaReconciler) forgetUndercount(policyCode string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.undercounts, policyCode)
+}
+
+func (r *QuotaReconciler) report(ctx context.Context, result *coupon.QuotaReconciliation) *coupon.QuotaReconciliation {
+	log := logging.GetLoggerFromContext(ctx)
+
+	metrics.CouponQuotaReconciledTotal.WithLabelValues(string(result.Action)).Inc()
+
+	fields := []zap.Field{
+		zap.String("policy_code", result.PolicyCode),
+		zap.Int("issued", result.Issued),
+		zap.Int("in_flight", result.InFlight),
+		zap.Int("expected", result.Expected),
+		zap.Int("drift", result.Drift),
+		zap.String("action", string(result.Action)),
+	}
+
+	switch result.Action {
+	case coupon.QuotaReconciliationInSync, coupon.QuotaReconciliationCacheMiss:
+		log.Debug("coupon policy quota reconciled", fields...)
+	case coupon.QuotaReconciliationOutOfBound:
+		log.Error("coupon policy quota drift exceeds max correction", fields...)
+	default:
+		log.Warn("coupon policy quota drift detected", fields...)
+	}
+
+	return result
+}
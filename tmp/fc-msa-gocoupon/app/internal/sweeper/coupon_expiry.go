@@ -0,0 +1,175 @@
+package sweeper
+
+import (
+	"context"
+	"time"
+
+	"example.com/coupon-service/internal/config"
+	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/domainevent"
+	"example.com/coupon-service/internal/instrument/logging"
+	"example.com/coupon-service/internal/instrument/metrics"
+	"example.com/coupon-service/internal/instrument/tracing"
+	"go.uber.org/zap"
+)
+
+// CouponExpirySweeper periodically moves AVAILABLE coupons past their expires_at to EXPIRED, and
+// RESERVED ones too once their reservation has lapsed, so an abandoned checkout cannot outlive the coupon.
+// Batches are claimed with FOR UPDATE SKIP LOCKED, so several API replicas can sweep at once
+// without blocking each other or a concurrent UseCoupon.
+type CouponExpirySweeper struct {
+	pg        *config.Postgres
+	events    domainevent.IPublisher
+	interval  time.Duration
+	batchSize int
+}
+
+func NewCouponExpirySweeper(cfg *config.Config, pg *config.Postgres, events domainevent.IPublisher) *CouponExpirySweeper {
+	interval := cfg.Sweeper.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	batchSize := cfg.Sweeper.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	return &CouponExpirySweeper{
+		pg:        pg,
+		events:    events,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Start runs a sweep every interval until ctx is canceled.
+func (s *CouponExpirySweeper) Start(ctx context.Context) error {
+	log := logging.GetLogger()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("coupon expiry sweeper stopped")
+			return nil
+		case <-ticker.C:
+			if _, err := s.Sweep(ctx); err != nil && ctx.Err() == nil {
+				log.Error("failed to sweep expired coupons", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Sweep expires coupons batch by batch until a batch comes back short, and returns the total expired.
+func (s *CouponExpirySweeper) Sweep(ctx context.Context) (int, error) {
+	ctx, span := tracing.StartSpan(ctx, "Sweeper.CouponExpiry.Sweep")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	total := 0
+	for {
+		expired, err := s.expireBatch(ctx)
+		if err != nil {
+			span.RecordError(err)
+			return total, err
+		}
+
+		total += expired
+		if expired < s.batchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		metrics.CouponExpiredTotal.Add(float64(total))
+		log.Info("expired coupons swept", zap.Int("expired_count", total))
+	}
+	return total, nil
+}
+
+// expireBatch expires one batch of available and one of lapsed reserved coupons, and records an
+// EXPIRED event per coupon in the same statement. The event keeps the order of a lapsed reservation,
+// which the update clears. Once the statement committed, a coupon.expired event is published per coupon.
+func (s *CouponExpirySweeper) expireBatch(ctx context.Context) (int, error) {
+	log := logging.GetLoggerFromContext(ctx)
+
+	rows, err := s.pg.Pool.Query(ctx, `
+		WITH available AS (
+			SELECT id, status, order_id
+			FROM coupons
+			WHERE status = 'AVAILABLE' AND expires_at <= NOW()
+			ORDER BY expires_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		), lapsed AS (
+			SELECT id, status, order_id
+			FROM coupons
+			WHERE status = 'RESERVED' AND reserved_until <= NOW() AND expires_at <= NOW()
+			ORDER BY reserved_until
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		), expired AS (
+			SELECT id, status, order_id FROM available
+			UNION ALL
+			SELECT id, status, order_id FROM lapsed
+		), written AS (
+			UPDATE coupons c
+			SET
+				status = 'EXPIRED',
+				order_id = NULL,
+				order_amount = NULL,
+				discount_amount = NULL,
+				reserved_until = NULL,
+				version = c.version + 1,
+				updated_at = NOW()
+			FROM expired
+			WHERE c.id = expired.id
+			RETURNING c.id, c.code, c.status, c.user_id, c.coupon_policy_id, c.expires_at, expired.status AS previous_status, expired.order_id
+		), event AS (
+			INSERT INTO coupon_events (
+				coupon_id,
+				type,
+				previous_status,
+				status,
+				actor,
+				order_id,
+				trace_id
+			)
+			SELECT id, 'EXPIRED', previous_status, status, $2::TEXT, order_id, NULLIF($3::TEXT, '')
+			FROM written
+		)
+		SELECT id, code, user_id, coupon_policy_id, expires_at
+		FROM written
+	`, s.batchSize, coupon.ActorExpirySweeper, tracing.TraceID(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var events []domainevent.Event
+	for rows.Next() {
+		var data domainevent.CouponExpired
+		if err := rows.Scan(&data.CouponID, &data.CouponCode, &data.UserID, &data.PolicyID, &data.ExpiresAt); err != nil {
+			return 0, err
+		}
+
+		event, err := domainevent.New(domainevent.TypeCouponExpired, data.CouponID, tracing.TraceID(ctx), data)
+		if err != nil {
+			return 0, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// Best effort, the coupons stay expired and their history records it if the events are lost
+	if err := s.events.Publish(ctx, events...); err != nil {
+		log.Error("failed to publish coupon expired events", zap.Int("expired_count", len(events)), zap.Error(err))
+	}
+
+	return len(events), nil
+}
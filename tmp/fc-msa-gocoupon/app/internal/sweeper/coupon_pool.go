@@ -0,0 +1,139 @@
+package sweeper
+
+import (
+	"context"
+	"time"
+
+	"example.com/coupon-service/internal/config"
+	"example.com/coupon-service/internal/couponpool"
+	"example.com/coupon-service/internal/instrument/logging"
+	"example.com/coupon-service/internal/instrument/tracing"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// CouponPoolReclaimer deletes the leftover UNASSIGNED coupons of POOL policies that ended or
+// were retired, together with their Redis list. The list goes first so no issuer pops a code
+// whose row is about to be deleted.
+type CouponPoolReclaimer struct {
+	pg        *config.Postgres
+	rdb       *config.Redis
+	interval  time.Duration
+	batchSize int
+}
+
+func NewCouponPoolReclaimer(cfg *config.Config, pg *config.Postgres, rdb *config.Redis) *CouponPoolReclaimer {
+	interval := cfg.Sweeper.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	batchSize := cfg.Sweeper.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	return &CouponPoolReclaimer{
+		pg:        pg,
+		rdb:       rdb,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Start reclaims every interval until ctx is canceled.
+func (r *CouponPoolReclaimer) Start(ctx context.Context) error {
+	log := logging.GetLogger()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("coupon pool reclaimer stopped")
+			return nil
+		case <-ticker.C:
+			if _, err := r.Reclaim(ctx); err != nil && ctx.Err() == nil {
+				log.Error("failed to reclaim coupon pools", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Reclaim empties the pools of ended policies and returns how many coupons were deleted.
+// Policies are picked by the same predicate as the delete, so leftover rows that have events
+// and can never be deleted do not make the same policies come back on every run.
+func (r *CouponPoolReclaimer) Reclaim(ctx context.Context) (int, error) {
+	ctx, span := tracing.StartSpan(ctx, "Sweeper.CouponPool.Reclaim")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	rows, err := r.pg.Pool.Query(ctx, `
+		SELECT p.id, p.code
+		FROM coupon_policies p
+		WHERE p.issuance_mode = 'POOL'
+			AND (p.end_time <= NOW() OR p.status = 'RETIRED')
+			AND EXISTS (
+				SELECT 1
+				FROM coupons c
+				WHERE c.coupon_policy_id = p.id AND c.status = 'UNASSIGNED'
+					AND NOT EXISTS (SELECT 1 FROM coupon_events e WHERE e.coupon_id = c.id)
+			)
+	`)
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+
+	type endedPolicy struct {
+		ID   string
+		Code string
+	}
+	policies, err := pgx.CollectRows(rows, pgx.RowToStructByPos[endedPolicy])
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+
+	total := 0
+	for _, p := range policies {
+		// Drop Redis Pool
+		if err := r.rdb.Client.Del(ctx, couponpool.CouponPolicyPoolKeyPrefix+p.Code).Err(); err != nil {
+			span.RecordError(err)
+			return total, err
+		}
+
+		// Delete Leftover Coupons, an UNASSIGNED coupon was never issued so it has no history,
+		// coupons with events are skipped rather than failing the batch on the RESTRICT key
+		for {
+			tag, err := r.pg.Pool.Exec(ctx, `
+				DELETE FROM coupons
+				WHERE id IN (
+					SELECT c.id
+					FROM coupons c
+					WHERE c.coupon_policy_id = $1 AND c.status = 'UNASSIGNED'
+						AND NOT EXISTS (SELECT 1 FROM coupon_events e WHERE e.coupon_id = c.id)
+					LIMIT $2
+					FOR UPDATE SKIP LOCKED
+				)
+			`, p.ID, r.batchSize)
+			if err != nil {
+				span.RecordError(err)
+				return total, err
+			}
+
+			total += int(tag.RowsAffected())
+			if int(tag.RowsAffected()) < r.batchSize {
+				break
+			}
+		}
+
+		log.Info("coupon pool reclaimed", zap.String("policy_code", p.Code))
+	}
+
+	if total > 0 {
+		log.Info("leftover pool coupons reclaimed", zap.Int("reclaimed_count", total))
+	}
+	return total, nil
+}
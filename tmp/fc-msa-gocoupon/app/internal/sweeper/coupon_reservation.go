@@ -0,0 +1,132 @@
+package sweeper
+
+import (
+	"context"
+	"time"
+
+	"example.com/coupon-service/internal/config"
+	"example.com/coupon-service/internal/coupon"
+	"example.com/coupon-service/internal/instrument/logging"
+	"example.com/coupon-service/internal/instrument/metrics"
+	"example.com/coupon-service/internal/instrument/tracing"
+	"go.uber.org/zap"
+)
+
+// CouponReservationSweeper periodically returns RESERVED coupons past their reserved_until to
+// AVAILABLE, so a checkout that never confirms or releases does not hold the coupon forever.
+// Coupons that have expired as well are left to CouponExpirySweeper, which moves them to EXPIRED.
+// Batches are claimed with FOR UPDATE SKIP LOCKED like the expiry sweeper.
+type CouponReservationSweeper struct {
+	pg        *config.Postgres
+	interval  time.Duration
+	batchSize int
+}
+
+func NewCouponReservationSweeper(cfg *config.Config, pg *config.Postgres) *CouponReservationSweeper {
+	interval := cfg.Sweeper.ReservationInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	batchSize := cfg.Sweeper.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	return &CouponReservationSweeper{
+		pg:        pg,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Start runs a sweep every interval until ctx is canceled.
+func (s *CouponReservationSweeper) Start(ctx context.Context) error {
+	log := logging.GetLogger()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("coupon reservation sweeper stopped")
+			return nil
+		case <-ticker.C:
+			if _, err := s.Sweep(ctx); err != nil && ctx.Err() == nil {
+				log.Error("failed to sweep coupon reservations", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Sweep releases reservations batch by batch until a batch comes back short, and returns the total released.
+func (s *CouponReservationSweeper) Sweep(ctx context.Context) (int, error) {
+	ctx, span := tracing.StartSpan(ctx, "Sweeper.CouponReservation.Sweep")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	total := 0
+	for {
+		released, err := s.releaseBatch(ctx)
+		if err != nil {
+			span.RecordError(err)
+			return total, err
+		}
+
+		total += released
+		if released < s.batchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		metrics.CouponReservationReleasedTotal.Add(float64(total))
+		log.Info("abandoned coupon reservations released", zap.Int("released_count", total))
+	}
+	return total, nil
+}
+
+// releaseBatch releases one batch and records a RELEASED event per coupon in the same statement.
+// The event keeps the order of the reservation, which the update clears.
+func (s *CouponReservationSweeper) releaseBatch(ctx context.Context) (int, error) {
+	tag, err := s.pg.Pool.Exec(ctx, `
+		WITH abandoned AS (
+			SELECT id, order_id
+			FROM coupons
+			WHERE status = 'RESERVED' AND reserved_until <= NOW() AND expires_at > NOW()
+			ORDER BY reserved_until
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		), written AS (
+			UPDATE coupons c
+			SET
+				status = 'AVAILABLE',
+				order_id = NULL,
+				order_amount = NULL,
+				discount_amount = NULL,
+				reserved_until = NULL,
+				version = c.version + 1,
+				updated_at = NOW()
+			FROM abandoned
+			WHERE c.id = abandoned.id
+			RETURNING c.id, c.status, abandoned.order_id
+		)
+		INSERT INTO coupon_events (
+			coupon_id,
+			type,
+			previous_status,
+			status,
+			actor,
+			order_id,
+			trace_id
+		)
+		SELECT id, 'RELEASED', 'RESERVED', status, $2::TEXT, order_id, NULLIF($3::TEXT, '')
+		FROM written
+	`, s.batchSize, coupon.ActorReservationSweeper, tracing.TraceID(ctx))
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
@@ -0,0 +1,102 @@
+package sweeper
+
+import (
+	"context"
+	"time"
+
+	"example.com/coupon-service/internal/config"
+	"example.com/coupon-service/internal/instrument/logging"
+	"example.com/coupon-service/internal/instrument/tracing"
+	"go.uber.org/zap"
+)
+
+// IdempotencyKeySweeper periodically deletes idempotency_keys rows past their expires_at.
+// Get already ignores them, so this only keeps the table from growing forever.
+type IdempotencyKeySweeper struct {
+	pg        *config.Postgres
+	interval  time.Duration
+	batchSize int
+}
+
+func NewIdempotencyKeySweeper(cfg *config.Config, pg *config.Postgres) *IdempotencyKeySweeper {
+	interval := cfg.Idempotency.PurgeInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	batchSize := cfg.Sweeper.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	return &IdempotencyKeySweeper{
+		pg:        pg,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Start runs a sweep every interval until ctx is canceled.
+func (s *IdempotencyKeySweeper) Start(ctx context.Context) error {
+	log := logging.GetLogger()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("idempotency key sweeper stopped")
+			return nil
+		case <-ticker.C:
+			if _, err := s.Sweep(ctx); err != nil && ctx.Err() == nil {
+				log.Error("failed to sweep idempotency keys", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Sweep deletes expired keys batch by batch until a batch comes back short, and returns the total deleted.
+func (s *IdempotencyKeySweeper) Sweep(ctx context.Context) (int, error) {
+	ctx, span := tracing.StartSpan(ctx, "Sweeper.IdempotencyKey.Sweep")
+	defer span.End()
+
+	log := logging.GetLoggerFromContext(ctx)
+
+	total := 0
+	for {
+		deleted, err := s.deleteBatch(ctx)
+		if err != nil {
+			span.RecordError(err)
+			return total, err
+		}
+
+		total += deleted
+		if deleted < s.batchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Info("expired idempotency keys deleted", zap.Int("deleted_count", total))
+	}
+	return total, nil
+}
+
+// deleteBatch deletes one batch of expired keys, using the expires_at index to find them.
+func (s *IdempotencyKeySweeper) deleteBatch(ctx context.Context) (int, error) {
+	tag, err := s.pg.Pool.Exec(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE key IN (
+			SELECT key
+			FROM idempotency_keys
+			WHERE expires_at < NOW()
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+	`, s.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
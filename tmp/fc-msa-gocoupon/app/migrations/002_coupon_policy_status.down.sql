@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_coupon_policies_status;
+
+ALTER TABLE coupon_policies DROP COLUMN IF EXISTS status;
+
+DROP TYPE IF EXISTS coupon_policy_status;
@@ -0,0 +1,23 @@
+-- ==========================================
+-- Types
+-- ==========================================
+
+-- CouponPolicyStatus enum
+CREATE TYPE coupon_policy_status AS ENUM (
+    'ACTIVE',
+    'PAUSED',
+    'RETIRED'
+);
+
+-- ==========================================
+-- Tables
+-- ==========================================
+
+ALTER TABLE coupon_policies
+    ADD COLUMN status coupon_policy_status NOT NULL DEFAULT 'ACTIVE';
+
+-- ==========================================
+-- Indexes
+-- ==========================================
+
+CREATE INDEX idx_coupon_policies_status ON coupon_policies (status);
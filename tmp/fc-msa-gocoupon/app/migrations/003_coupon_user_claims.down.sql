@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS coupon_user_claims;
+
+ALTER TABLE coupon_policies DROP COLUMN IF EXISTS max_per_user;
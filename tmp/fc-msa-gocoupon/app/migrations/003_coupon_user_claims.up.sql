@@ -0,0 +1,27 @@
+-- ==========================================
+-- Tables
+-- ==========================================
+
+ALTER TABLE coupon_policies
+    ADD COLUMN max_per_user INT NOT NULL DEFAULT 1 CHECK (max_per_user > 0);
+
+-- CouponUserClaim table, one row per (policy, user).
+-- The CHECK constraint rejects any claim beyond the policy's max_per_user,
+-- and the primary key serializes concurrent claims of the same user.
+CREATE TABLE coupon_user_claims (
+    coupon_policy_id TEXT NOT NULL REFERENCES coupon_policies(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    claimed INT NOT NULL,
+    max_per_user INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (coupon_policy_id, user_id),
+    CONSTRAINT chk_coupon_user_claims_limit CHECK (claimed > 0 AND claimed <= max_per_user)
+);
+
+-- Backfill claims from coupons issued before the limit existed
+INSERT INTO coupon_user_claims (coupon_policy_id, user_id, claimed, max_per_user)
+SELECT c.coupon_policy_id, c.user_id, COUNT(*), GREATEST(COUNT(*), p.max_per_user)
+FROM coupons c
+JOIN coupon_policies p ON p.id = c.coupon_policy_id
+GROUP BY c.coupon_policy_id, c.user_id, p.max_per_user;
@@ -0,0 +1,20 @@
+-- ==========================================
+-- Tables
+-- ==========================================
+
+-- IdempotencyKey table, durable copy of the first response stored per Idempotency-Key
+CREATE TABLE idempotency_keys (
+    key TEXT PRIMARY KEY,
+    request_hash TEXT NOT NULL,
+    status_code INT NOT NULL,
+    content_type TEXT NOT NULL,
+    response_body BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- ==========================================
+-- Indexes
+-- ==========================================
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
@@ -0,0 +1,3 @@
+ALTER TABLE coupons
+    DROP COLUMN IF EXISTS discount_amount,
+    DROP COLUMN IF EXISTS order_amount;
@@ -0,0 +1,7 @@
+-- ==========================================
+-- Tables
+-- ==========================================
+
+ALTER TABLE coupons
+    ADD COLUMN order_amount INT CHECK (order_amount >= 0),
+    ADD COLUMN discount_amount INT CHECK (discount_amount >= 0);
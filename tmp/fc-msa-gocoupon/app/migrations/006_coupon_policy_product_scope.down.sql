@@ -0,0 +1,5 @@
+ALTER TABLE coupon_policies
+    DROP COLUMN IF EXISTS exclude_categories,
+    DROP COLUMN IF EXISTS include_categories,
+    DROP COLUMN IF EXISTS exclude_product_ids,
+    DROP COLUMN IF EXISTS include_product_ids;
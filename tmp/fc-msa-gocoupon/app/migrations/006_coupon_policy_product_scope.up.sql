@@ -0,0 +1,10 @@
+-- ==========================================
+-- Tables
+-- ==========================================
+
+-- Empty include lists mean every product / category is eligible unless excluded
+ALTER TABLE coupon_policies
+    ADD COLUMN include_product_ids TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN exclude_product_ids TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN include_categories TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN exclude_categories TEXT[] NOT NULL DEFAULT '{}';
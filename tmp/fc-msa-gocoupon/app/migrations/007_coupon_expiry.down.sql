@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_coupons_available_expires_at;
+
+ALTER TABLE coupons
+    DROP COLUMN IF EXISTS expires_at;
+
+ALTER TABLE coupon_policies
+    DROP COLUMN IF EXISTS valid_days;
@@ -0,0 +1,25 @@
+-- ==========================================
+-- Tables
+-- ==========================================
+
+-- NULL valid_days keeps coupons valid until the policy end_time
+ALTER TABLE coupon_policies
+    ADD COLUMN valid_days INT CHECK (valid_days > 0);
+
+ALTER TABLE coupons
+    ADD COLUMN expires_at TIMESTAMPTZ;
+
+UPDATE coupons c
+SET expires_at = p.end_time
+FROM coupon_policies p
+WHERE c.coupon_policy_id = p.id;
+
+ALTER TABLE coupons
+    ALTER COLUMN expires_at SET NOT NULL;
+
+-- ==========================================
+-- Indexes
+-- ==========================================
+
+-- Supports the expiry sweeper, which only scans AVAILABLE coupons
+CREATE INDEX idx_coupons_available_expires_at ON coupons (expires_at) WHERE status = 'AVAILABLE';
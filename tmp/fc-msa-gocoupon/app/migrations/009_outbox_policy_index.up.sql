@@ -0,0 +1,6 @@
+-- ==========================================
+-- Indexes
+-- ==========================================
+
+-- Lets the quota reconciler count issue requests of a policy still waiting in the outbox or in Kafka
+CREATE INDEX idx_outbox_coupon_issue_policy_id ON outbox ((payload->>'policy_id')) WHERE topic = 'coupon-issue-requests';
@@ -0,0 +1,11 @@
+-- Postgres cannot drop an enum value, so UNASSIGNED stays in coupon_status
+-- Unassigned pool coupons were never issued and have no coupon_events, which 016 down has dropped by now
+DELETE FROM coupons WHERE user_id IS NULL;
+
+ALTER TABLE coupons
+    ALTER COLUMN user_id SET NOT NULL;
+
+ALTER TABLE coupon_policies
+    DROP COLUMN IF EXISTS issuance_mode;
+
+DROP TYPE IF EXISTS coupon_policy_issuance_mode;
@@ -0,0 +1,24 @@
+-- ==========================================
+-- Types
+-- ==========================================
+
+-- Pre-generated pool coupons wait as UNASSIGNED until the issuer hands them to a user.
+-- The new value cannot be referenced in this migration, which runs in one transaction.
+ALTER TYPE coupon_status ADD VALUE IF NOT EXISTS 'UNASSIGNED';
+
+-- CouponPolicyIssuanceMode enum
+CREATE TYPE coupon_policy_issuance_mode AS ENUM (
+    'ON_DEMAND',
+    'POOL'
+);
+
+-- ==========================================
+-- Tables
+-- ==========================================
+
+ALTER TABLE coupon_policies
+    ADD COLUMN issuance_mode coupon_policy_issuance_mode NOT NULL DEFAULT 'ON_DEMAND';
+
+-- Pool coupons have no user until they are assigned
+ALTER TABLE coupons
+    ALTER COLUMN user_id DROP NOT NULL;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_coupons_unassigned_coupon_policy_id;
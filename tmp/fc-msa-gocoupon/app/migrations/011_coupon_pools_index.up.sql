@@ -0,0 +1,7 @@
+-- ==========================================
+-- Indexes
+-- ==========================================
+
+-- Separate from 010 because a new enum value cannot be used in the transaction that adds it.
+-- Supports loading and reclaiming pool coupons without scanning assigned ones.
+CREATE INDEX idx_coupons_unassigned_coupon_policy_id ON coupons (coupon_policy_id, id) WHERE status = 'UNASSIGNED';
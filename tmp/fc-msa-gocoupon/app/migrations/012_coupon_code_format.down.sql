@@ -0,0 +1,3 @@
+ALTER TABLE coupon_policies
+    DROP COLUMN IF EXISTS code_length,
+    DROP COLUMN IF EXISTS code_prefix;
@@ -0,0 +1,9 @@
+-- ==========================================
+-- Tables
+-- ==========================================
+
+-- Codes are PREFIX-BODYC, BODY being code_length characters and C a check character.
+-- Existing policies keep issuing with an empty prefix, existing UUID codes stay valid.
+ALTER TABLE coupon_policies
+    ADD COLUMN code_prefix VARCHAR(16) NOT NULL DEFAULT '',
+    ADD COLUMN code_length INT NOT NULL DEFAULT 12 CHECK (code_length BETWEEN 6 AND 24);
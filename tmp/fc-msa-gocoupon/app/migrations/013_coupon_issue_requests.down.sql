@@ -0,0 +1,4 @@
+-- Postgres cannot drop an enum value, so PENDING stays in coupon_status
+DROP TABLE IF EXISTS coupon_issue_requests;
+
+DROP TYPE IF EXISTS coupon_issue_request_status;
@@ -0,0 +1,38 @@
+-- ==========================================
+-- Types
+-- ==========================================
+
+-- The v4 issuer returns PENDING coupons, so the status exists in the enum as well.
+-- The new value cannot be referenced in this migration, which runs in one transaction.
+ALTER TYPE coupon_status ADD VALUE IF NOT EXISTS 'PENDING';
+
+-- CouponIssueRequestStatus enum
+CREATE TYPE coupon_issue_request_status AS ENUM (
+    'PENDING',
+    'AVAILABLE',
+    'FAILED'
+);
+
+-- ==========================================
+-- Tables
+-- ==========================================
+
+-- Asynchronous issue requests, keyed by the coupon ID returned to the user.
+-- Written PENDING with the outbox message, settled by the consumer.
+CREATE TABLE coupon_issue_requests (
+    id TEXT PRIMARY KEY,
+    coupon_policy_id TEXT NOT NULL REFERENCES coupon_policies(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    coupon_code VARCHAR(50) NOT NULL,
+    status coupon_issue_request_status NOT NULL DEFAULT 'PENDING',
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- ==========================================
+-- Indexes
+-- ==========================================
+
+CREATE INDEX idx_coupon_issue_requests_user_id ON coupon_issue_requests (user_id);
+CREATE INDEX idx_coupon_issue_requests_pending ON coupon_issue_requests (created_at) WHERE status = 'PENDING';
@@ -0,0 +1,2 @@
+ALTER TABLE coupon_policies
+    DROP COLUMN IF EXISTS waiting_room;
@@ -0,0 +1,7 @@
+-- ==========================================
+-- Tables
+-- ==========================================
+
+-- Flash-sale policies only accept issue requests from users the waiting room admitted
+ALTER TABLE coupon_policies
+    ADD COLUMN waiting_room BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_coupons_coupon_policy_id_status_created_at;
+DROP INDEX IF EXISTS idx_coupons_coupon_policy_id_created_at;
+DROP INDEX IF EXISTS idx_coupons_user_id_created_at;
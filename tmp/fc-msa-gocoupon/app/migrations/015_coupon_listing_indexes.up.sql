@@ -0,0 +1,10 @@
+-- ==========================================
+-- Indexes
+-- ==========================================
+
+-- Keyset pagination of "my coupons" and of the admin listing per policy, both ordered by (created_at, id) DESC.
+-- A user holds few coupons, so the status filter of "my coupons" is applied on top of the user index,
+-- while a policy can hold millions and gets its own index per status.
+CREATE INDEX idx_coupons_user_id_created_at ON coupons (user_id, created_at DESC, id DESC);
+CREATE INDEX idx_coupons_coupon_policy_id_created_at ON coupons (coupon_policy_id, created_at DESC, id DESC);
+CREATE INDEX idx_coupons_coupon_policy_id_status_created_at ON coupons (coupon_policy_id, status, created_at DESC, id DESC);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS coupon_events;
+
+DROP TYPE IF EXISTS coupon_event_type;
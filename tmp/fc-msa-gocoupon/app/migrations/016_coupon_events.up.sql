@@ -0,0 +1,36 @@
+-- ==========================================
+-- Types
+-- ==========================================
+
+-- CouponEventType enum
+CREATE TYPE coupon_event_type AS ENUM (
+    'ISSUED',
+    'USED',
+    'CANCELED',
+    'EXPIRED',
+    'REVOKED'
+);
+
+-- ==========================================
+-- Tables
+-- ==========================================
+
+-- Append-only history of coupon status changes, written in the transaction of each change.
+-- Rows are never updated, order_id keeps the order a canceled coupon was used for.
+CREATE TABLE coupon_events (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    coupon_id TEXT NOT NULL REFERENCES coupons(id) ON DELETE CASCADE,
+    type coupon_event_type NOT NULL,
+    previous_status coupon_status,
+    status coupon_status NOT NULL,
+    actor TEXT NOT NULL,
+    order_id TEXT,
+    trace_id TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- ==========================================
+-- Indexes
+-- ==========================================
+
+CREATE INDEX idx_coupon_events_coupon_id ON coupon_events (coupon_id, id);
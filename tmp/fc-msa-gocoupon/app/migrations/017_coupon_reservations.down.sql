@@ -0,0 +1,13 @@
+-- Postgres cannot drop an enum value, so RESERVED stays in coupon_status and RESERVED, RELEASED in coupon_event_type
+UPDATE coupons
+SET
+    status = 'AVAILABLE',
+    order_id = NULL,
+    order_amount = NULL,
+    discount_amount = NULL
+WHERE status = 'RESERVED';
+
+DROP INDEX IF EXISTS idx_coupons_reserved_until;
+
+ALTER TABLE coupons
+    DROP COLUMN IF EXISTS reserved_until;
@@ -0,0 +1,25 @@
+-- ==========================================
+-- Types
+-- ==========================================
+
+-- A coupon is held as RESERVED for an order during checkout, until the order confirms or releases it.
+-- The new values cannot be referenced in this migration, which runs in one transaction.
+ALTER TYPE coupon_status ADD VALUE IF NOT EXISTS 'RESERVED';
+
+ALTER TYPE coupon_event_type ADD VALUE IF NOT EXISTS 'RESERVED';
+ALTER TYPE coupon_event_type ADD VALUE IF NOT EXISTS 'RELEASED';
+
+-- ==========================================
+-- Tables
+-- ==========================================
+
+-- Set only while RESERVED, the reservation sweeper returns the coupon to AVAILABLE once it passes
+ALTER TABLE coupons
+    ADD COLUMN reserved_until TIMESTAMPTZ;
+
+-- ==========================================
+-- Indexes
+-- ==========================================
+
+-- Supports the reservation sweeper, reserved_until is NULL for every other status
+CREATE INDEX idx_coupons_reserved_until ON coupons (reserved_until) WHERE reserved_until IS NOT NULL;
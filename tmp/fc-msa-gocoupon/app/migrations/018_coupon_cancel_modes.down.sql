@@ -0,0 +1,16 @@
+-- Postgres cannot drop an enum value, so REVOKED stays in coupon_status.
+-- Revoked coupons become CANCELED, which the previous version does not let anyone use.
+UPDATE coupons
+SET status = 'CANCELED'
+WHERE status = 'REVOKED';
+
+ALTER TABLE coupon_events
+    DROP COLUMN IF EXISTS reason;
+
+ALTER TABLE coupons
+    DROP COLUMN IF EXISTS quota_released;
+
+ALTER TABLE coupon_policies
+    DROP COLUMN IF EXISTS cancel_mode;
+
+DROP TYPE IF EXISTS coupon_policy_cancel_mode;
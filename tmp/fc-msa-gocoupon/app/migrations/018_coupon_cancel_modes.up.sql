@@ -0,0 +1,30 @@
+-- ==========================================
+-- Types
+-- ==========================================
+
+-- An admin revokes an unused coupon for fraud, REVOKED is terminal.
+-- The new value cannot be referenced in this migration, which runs in one transaction.
+ALTER TYPE coupon_status ADD VALUE IF NOT EXISTS 'REVOKED';
+
+-- CouponPolicyCancelMode enum, what canceling a used coupon of the policy does
+CREATE TYPE coupon_policy_cancel_mode AS ENUM (
+    'VOID',
+    'RESTORE',
+    'RELEASE'
+);
+
+-- ==========================================
+-- Tables
+-- ==========================================
+
+-- VOID keeps today's terminal CANCELED, existing policies keep it
+ALTER TABLE coupon_policies
+    ADD COLUMN cancel_mode coupon_policy_cancel_mode NOT NULL DEFAULT 'VOID';
+
+-- Set when a RELEASE cancel gave the coupon's unit back, issued counts skip such coupons
+ALTER TABLE coupons
+    ADD COLUMN quota_released BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Why an admin revoked the coupon, NULL for every other event
+ALTER TABLE coupon_events
+    ADD COLUMN reason TEXT;
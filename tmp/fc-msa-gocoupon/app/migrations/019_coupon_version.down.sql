@@ -0,0 +1,2 @@
+ALTER TABLE coupons
+    DROP COLUMN IF EXISTS version;
@@ -0,0 +1,8 @@
+-- ==========================================
+-- Tables
+-- ==========================================
+
+-- Bumped by every write of the coupon. Use, cancel and the other status changes only write the
+-- version they read, so of two concurrent changes of the same coupon only one succeeds.
+ALTER TABLE coupons
+    ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+ALTER TABLE coupon_events
+    DROP CONSTRAINT coupon_events_coupon_id_fkey,
+    ADD CONSTRAINT coupon_events_coupon_id_fkey
+        FOREIGN KEY (coupon_id) REFERENCES coupons(id) ON DELETE CASCADE;
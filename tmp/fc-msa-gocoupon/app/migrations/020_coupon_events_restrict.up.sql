@@ -0,0 +1,10 @@
+-- ==========================================
+-- Constraints
+-- ==========================================
+
+-- coupon_events is append-only, so deleting a coupon must not silently take its history with it.
+-- A coupon with history can only be deleted once its events are deleted explicitly.
+ALTER TABLE coupon_events
+    DROP CONSTRAINT coupon_events_coupon_id_fkey,
+    ADD CONSTRAINT coupon_events_coupon_id_fkey
+        FOREIGN KEY (coupon_id) REFERENCES coupons(id) ON DELETE RESTRICT;
@@ -17,7 +17,12 @@ export function setup() {
 export default function (data) {
     const url = `http://localhost:8080/check-quantity/${policyCode}`;
 
-    const res = http.get(url);
+    // The dummy endpoints need an admin token, see app/tmp/http_auth.md
+    const params = {
+        headers: { Authorization: `Bearer ${__ENV.ADMIN_TOKEN}` },
+    };
+
+    const res = http.get(url, params);
 
     check(res, {
         "status 200": (r) => r.status === 200,
@@ -0,0 +1,36 @@
+import http from 'k6/http';
+import { check } from 'k6';
+
+export const options = {
+    vus: 1,
+    iterations: 1,
+};
+
+export function setup() {
+    console.log("=== SETUP: Pre-test GET clean dummy redis db ===");
+    const startTime = new Date().toISOString();
+    return { startTime };
+}
+
+export default function (data) {
+    const url = "http://localhost:8080/clean-dummy-redis-db";
+
+    // The dummy endpoints need an admin token, see app/tmp/http_auth.md
+    const params = {
+        headers: { Authorization: `Bearer ${__ENV.ADMIN_TOKEN}` },
+    };
+
+    const res = http.get(url, params);
+
+    check(res, {
+        "status 200": (r) => r.status === 200,
+    });
+
+    console.log("Response:", res.body);
+}
+
+export function teardown(data) {
+  console.log("=== TEARDOWN: Post-test Get clean dummy redis db ===");
+  console.log("StartAt:", data.startTime);
+  console.log("EndAt:", new Date().toISOString());
+}
\ No newline at end of file